@@ -0,0 +1,181 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+	server "github.com/universonic/panther/pkg"
+	archive "github.com/universonic/panther/pkg/storage/archive"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// ExportCmd represents the command which exports all data from storage into an archive.
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all data from storage into an archive",
+	Long: `Export all hosts, scans and operations from the configured storage into an archive,
+which could be imported into another storage by "panther import". The archive is written
+to stdout unless an output file was specified.
+
+Passwords of hosts are exported as they are sealed, thus the keyring file has to be copied
+along with the archive.`,
+	PreRunE: RootCmd.PreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := archiveFormat(exportFormat, exportOutput)
+		if err != nil {
+			return err
+		}
+		cfg, err := server.ParseConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		s, err := cfg.OpenStorage()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		var kinds []string
+		if exportKinds != "" {
+			kinds = strings.Split(exportKinds, ",")
+		}
+		a, err := archive.Export(context.Background(), s, kinds...)
+		if err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if exportOutput != "" {
+			fi, err := os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer fi.Close()
+			w = fi
+		}
+		if err = archive.Encode(w, a, format); err != nil {
+			return err
+		}
+		for _, section := range a.Sections {
+			fmt.Fprintf(os.Stderr, "Exported %d %s(s)\n", len(section.Objects), section.Kind)
+		}
+		return nil
+	},
+}
+
+// ImportCmd represents the command which imports data from an archive into storage.
+var ImportCmd = &cobra.Command{
+	Use:   "import ARCHIVE",
+	Short: "Import data from an archive into storage",
+	Long: `Import all objects from an archive created by "panther export" into the configured
+storage. Objects keep their GUIDs and timestamps. Existing objects are kept by default, which
+could be changed by --on-conflict:
+
+  skip:      keep existing objects;
+  overwrite: replace existing objects by those in archive;
+  abort:     import nothing if any object already exists.
+
+It is recommended to stop the daemon during import, or the imported hosts would be scanned
+right away.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: RootCmd.PreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := archiveFormat(importFormat, args[0])
+		if err != nil {
+			return err
+		}
+		strategy, err := archive.ParseStrategy(importOnConflict)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+		a, err := archive.Decode(fi, format)
+		if err != nil {
+			return err
+		}
+		cfg, err := server.ParseConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		s, err := cfg.OpenStorage()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		if !importDryRun {
+			// Refuse to write into a storage that has been written by a newer binary.
+			if err = genericStorage.CheckSchema(context.Background(), s); err != nil {
+				return err
+			}
+		}
+		results, err := archive.Import(context.Background(), s, a, archive.ImportOptions{
+			DryRun:     importDryRun,
+			OnConflict: strategy,
+		})
+		if importDryRun {
+			fmt.Println("Dry run, nothing has been written.")
+		}
+		for _, r := range results {
+			fmt.Printf("%s: %d created, %d overwritten, %d skipped\n", r.Kind, r.Created, r.Overwritten, r.Skipped)
+		}
+		return err
+	},
+}
+
+// archiveFormat returns the format of archive, which is determined by the extension of file
+// if it was not specified.
+func archiveFormat(format, file string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+	switch ext := filepath.Ext(file); ext {
+	case ".json", "":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	default:
+		return "", fmt.Errorf("Not supported extension: %s", ext)
+	}
+}
+
+var (
+	exportOutput     string
+	exportFormat     string
+	exportKinds      string
+	importFormat     string
+	importDryRun     bool
+	importOnConflict string
+)
+
+func init() {
+	ExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "The archive file to write. Default: stdout")
+	ExportCmd.Flags().StringVarP(&exportFormat, "format", "f", "", `The format of archive: json or yaml.
+Default: determined by the extension of output file, or json.`)
+	ExportCmd.Flags().StringVar(&exportKinds, "kinds", "", "Comma-separated kinds of objects to export. Default: all")
+	ImportCmd.Flags().StringVarP(&importFormat, "format", "f", "", `The format of archive: json or yaml.
+Default: determined by the extension of archive file.`)
+	ImportCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Report what would be imported without writing anything")
+	ImportCmd.Flags().StringVar(&importOnConflict, "on-conflict", string(archive.Skip), "What to do with existing objects: skip, overwrite or abort")
+	RootCmd.AddCommand(ExportCmd, ImportCmd)
+}
@@ -0,0 +1,69 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	cobra "github.com/spf13/cobra"
+	server "github.com/universonic/panther/pkg"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// MigrateCmd represents the command which upgrades all stored objects to the current schema.
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade stored data to the current schema",
+	Long: `Rewrite all stored objects whose schema has changed, so that they are stored in the
+current API versions. Objects are upgraded whenever they are read anyway, thus this is only
+an optimization after upgrading Panther. Once migrated, older versions of Panther refuse to
+run against the storage.
+
+It is recommended to stop the daemon during migration.`,
+	PreRunE: RootCmd.PreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := server.ParseConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		s, err := cfg.OpenStorage()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		ctx := context.Background()
+		if !migrateDryRun {
+			if err = genericStorage.CheckSchema(ctx, s); err != nil {
+				return err
+			}
+		}
+		results, err := genericStorage.Migrate(ctx, s, migrateDryRun)
+		if migrateDryRun {
+			fmt.Println("Dry run, nothing has been written.")
+		}
+		for _, r := range results {
+			fmt.Printf("%s (%s): %d rewritten, %d skipped\n", r.Kind, r.APIVersion, r.Rewritten, r.Skipped)
+		}
+		return err
+	},
+}
+
+var migrateDryRun bool
+
+func init() {
+	MigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Report what would be migrated without writing anything")
+	RootCmd.AddCommand(MigrateCmd)
+}
@@ -16,6 +16,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,8 +25,10 @@ import (
 
 	toml "github.com/pelletier/go-toml"
 	executor "github.com/universonic/panther/pkg/executor"
-	etcd "github.com/universonic/panther/pkg/storage/etcd"
+	storage "github.com/universonic/panther/pkg/storage"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
 	fsutil "github.com/universonic/panther/pkg/utils/filesystem"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 	logging "github.com/universonic/panther/pkg/utils/logging"
 	web "github.com/universonic/panther/pkg/web"
 	zapcore "go.uber.org/zap/zapcore"
@@ -34,16 +37,18 @@ import (
 
 // Config is the carrier to be used for parsing config file into it.
 type Config struct {
-	Web      *web.Config      `json:"web,omitempty" yaml:"web,omitempty" toml:"web,omitempty"`
-	Executor *executor.Config `json:"executor,omitempty" yaml:"executor,omitempty" toml:"executor,omitempty"`
-	Database *etcd.Config     `json:"database,omitempty" yaml:"database,omitempty" toml:"database,omitempty"`
-	Log      *LogConfig       `json:"log,omitempty" yaml:"log,omitempty" toml:"log,omitempty"`
+	Web      *web.Config              `json:"web,omitempty" yaml:"web,omitempty" toml:"web,omitempty"`
+	Executor *executor.Config         `json:"executor,omitempty" yaml:"executor,omitempty" toml:"executor,omitempty"`
+	Database *storage.QualifiedConfig `json:"database,omitempty" yaml:"database,omitempty" toml:"database,omitempty"`
+	Keyring  *keyring.Config          `json:"keyring,omitempty" yaml:"keyring,omitempty" toml:"keyring,omitempty"`
+	Log      *LogConfig               `json:"log,omitempty" yaml:"log,omitempty" toml:"log,omitempty"`
 }
 
 // Complete fulfilled empty fields with default values.
 func (in *Config) Complete() {
 	in.Web.Complete()
 	in.Executor.Complete()
+	in.Keyring.Complete()
 	in.Log.Complete()
 }
 
@@ -82,6 +87,16 @@ func (in *Config) Apply() (svr *Server, err error) {
 	if err != nil {
 		return nil, err
 	}
+	// Refuse to run against a storage that has been written by a newer binary.
+	if err = genericStorage.CheckSchema(context.Background(), storage); err != nil {
+		storage.Close()
+		return nil, err
+	}
+	kr, err := in.Keyring.Apply()
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
 	webServerLoggerFact, err := logging.NewFactoryConfig(
 		[]string{filepath.Join(dir, "web.log")},
 		[]string{filepath.Join(dir, "web-error.log")},
@@ -94,7 +109,7 @@ func (in *Config) Apply() (svr *Server, err error) {
 	if err != nil {
 		return nil, err
 	}
-	webServer.Prepare(storage, webServerLogger)
+	webServer.Prepare(storage, kr, webServerLogger)
 	executorLoggerFact, err := logging.NewFactoryConfig(
 		[]string{filepath.Join(dir, "executor.log")},
 		[]string{filepath.Join(dir, "executor-error.log")},
@@ -107,7 +122,7 @@ func (in *Config) Apply() (svr *Server, err error) {
 	if err != nil {
 		return nil, err
 	}
-	executorServer.Prepare(storage, executorLogger)
+	executorServer.Prepare(storage, kr, executorLogger)
 	dAtA, _ := json.MarshalIndent(in, "", "  ")
 	serverLogger.Debugf("Configuration => %s", dAtA)
 	return &Server{
@@ -147,8 +162,35 @@ func (in *LogConfig) Apply() (string, zapcore.Level) {
 	return in.Output, logging.INFO
 }
 
+// OpenStorage opens the configured storage without spawning a server, which is used by
+// maintenance commands. Storage logs are written into the log directory only.
+func (in *Config) OpenStorage() (genericStorage.Storage, error) {
+	dir, lvl := in.Log.Apply()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	storageLoggerFact, err := logging.NewFactoryConfig(
+		[]string{filepath.Join(dir, "storage.log")},
+		[]string{filepath.Join(dir, "storage-error.log")},
+	).Apply(lvl, false)
+	if err != nil {
+		return nil, err
+	}
+	return in.Database.Open(storageLoggerFact.New().Sugar().Named("STORAGE"))
+}
+
 // ParseFromFile parses config from given file and try to spawn a new server, returns any encountered error.
 func ParseFromFile(f string) (*Server, error) {
+	cfg, err := ParseConfigFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Apply()
+}
+
+// ParseConfigFile parses config from given file, and returns the completed config and any
+// encountered error.
+func ParseConfigFile(f string) (*Config, error) {
 	fi, err := os.Open(f)
 	if err != nil {
 		return nil, err
@@ -161,35 +203,38 @@ func ParseFromFile(f string) (*Server, error) {
 	}
 	dAtA := buf.Bytes()
 
-	cfg := new(Config)
+	var unmarshal func([]byte, interface{}) error
 	switch ext := filepath.Ext(fi.Name()); ext {
 	case ".toml":
-		if err = toml.Unmarshal(dAtA, cfg); err != nil {
-			return nil, err
-		}
+		unmarshal = toml.Unmarshal
 	case ".yaml", ".yml":
-		if err = yaml.Unmarshal(dAtA, cfg); err != nil {
-			return nil, err
-		}
+		unmarshal = yaml.Unmarshal
 	case ".json":
-		if err = json.Unmarshal(dAtA, cfg); err != nil {
-			return nil, err
-		}
+		unmarshal = json.Unmarshal
 	default:
 		return nil, fmt.Errorf("Not supported extension: %s", ext)
 	}
+	cfg := new(Config)
+	if err = unmarshal(dAtA, cfg); err != nil {
+		return nil, err
+	}
+	// The layout of database section depends on the selected storage adapter.
+	cfg.Database, err = storage.ParseQualifiedConfig("database", dAtA, unmarshal)
+	if err != nil {
+		return nil, err
+	}
 	if cfg.Web == nil {
 		cfg.Web = new(web.Config)
 	}
 	if cfg.Executor == nil {
 		cfg.Executor = new(executor.Config)
 	}
-	if cfg.Database == nil {
-		cfg.Database = new(etcd.Config)
+	if cfg.Keyring == nil {
+		cfg.Keyring = new(keyring.Config)
 	}
 	if cfg.Log == nil {
 		cfg.Log = new(LogConfig)
 	}
 	cfg.Complete()
-	return cfg.Apply()
+	return cfg, nil
 }
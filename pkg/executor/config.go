@@ -16,8 +16,10 @@ package executor
 
 // Config is the configuration of executor
 type Config struct {
-	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty" toml:"schedule,omitempty"`
-	Workers  int    `json:"workers,omitempty" yaml:"workers,omitempty" toml:"workers,omitempty"`
+	Schedule  string           `json:"schedule,omitempty" yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+	Workers   int              `json:"workers,omitempty" yaml:"workers,omitempty" toml:"workers,omitempty"`
+	Retention *RetentionConfig `json:"retention,omitempty" yaml:"retention,omitempty" toml:"retention,omitempty"`
+	Feeds     *FeedConfig      `json:"feeds,omitempty" yaml:"feeds,omitempty" toml:"feeds,omitempty"`
 }
 
 // Complete fulfills the empty fields of Config
@@ -28,9 +30,25 @@ func (in *Config) Complete() {
 	if in.Workers <= 2 {
 		in.Workers = 8
 	}
+	if in.Retention == nil {
+		in.Retention = new(RetentionConfig)
+	}
+	in.Retention.Complete()
+	if in.Feeds == nil {
+		in.Feeds = new(FeedConfig)
+	}
+	in.Feeds.Complete()
 }
 
 // Apply spawns a new API server with configuration, and returns any encountered error.
 func (in *Config) Apply() (*Server, error) {
-	return NewServer(in.Schedule, in.Workers)
+	retention, err := in.Retention.Apply()
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := in.Feeds.Apply()
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(in.Schedule, in.Workers, retention, feeds)
 }
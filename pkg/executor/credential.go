@@ -0,0 +1,72 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// SealCredentials seals those passwords of hosts which are stored in plain text, and seals
+// the data keys of passwords with the primary key of keyring if it has been rotated. Only
+// the data keys are sealed again, thus passwords themselves are never revealed here.
+func (in *Handler) SealCredentials() {
+	defer in.logger.Sync()
+	if in.keyring == nil {
+		return
+	}
+	var sealed int
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, genericStorage.RESOURCE_HOST, genericStorage.DefaultPageSize)
+	for it.Next() {
+		host := it.Object().(*genericStorage.Host)
+		changed, err := in.sealCredential(&host.SSHCredential)
+		if err == nil {
+			var opChanged bool
+			opChanged, err = in.sealCredential(&host.OpCredential)
+			changed = changed || opChanged
+		}
+		if err != nil {
+			in.logger.Errorf("Could not seal credentials of host '%s' due to: %v", host.GetName(), err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		err = in.storage.UpdateContext(in.ctx, host)
+		if err != nil {
+			// The host might have been updated by API meanwhile, which sealed it already.
+			in.logger.Warnf("Could not store sealed credentials of host '%s' due to: %v", host.GetName(), err)
+			continue
+		}
+		sealed++
+	}
+	if err := it.Err(); err != nil {
+		in.logger.Errorf("Could not seal credentials of hosts due to: %v", err)
+	}
+	if sealed > 0 {
+		in.logger.Infof("Sealed credentials of %d host(s) with key '%s'.", sealed, in.keyring.Primary())
+	}
+}
+
+// sealCredential seals the credential with the primary key, and returns true if it has
+// been changed.
+func (in *Handler) sealCredential(cred *genericStorage.LoginCredential) (bool, error) {
+	if len(cred.Password) != 0 {
+		return true, cred.Seal(in.keyring)
+	}
+	if cred.Sealed == nil {
+		return false, nil
+	}
+	return in.keyring.Rewrap(cred.Sealed)
+}
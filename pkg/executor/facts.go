@@ -0,0 +1,115 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Sections of the output of systemFactsCommand.
+const (
+	sectionKernel       = "@@kernel"
+	sectionArch         = "@@arch"
+	sectionUptime       = "@@uptime"
+	sectionCPUs         = "@@cpus"
+	sectionMemory       = "@@memory"
+	sectionSubscription = "@@subscription"
+)
+
+// systemFactsCommand gathers the facts known by system, which are the same on every Linux
+// distribution. It is followed by the command of FactsGatherer, if any, see scanParts. The
+// subscription status is only available on hosts registered to Red Hat.
+var systemFactsCommand = strings.Join([]string{
+	"echo " + sectionKernel, "uname -r",
+	"echo " + sectionArch, "uname -m",
+	"echo " + sectionUptime, "cat /proc/uptime",
+	"echo " + sectionCPUs, "(nproc 2>/dev/null || grep -c ^processor /proc/cpuinfo)",
+	"echo " + sectionMemory, "grep MemTotal /proc/meminfo",
+	"echo " + sectionSubscription, "(subscription-manager status 2>/dev/null | grep 'Overall Status' || true)",
+}, " ; ")
+
+// parseSystemFacts parses the output of systemFactsCommand into facts. Those could not be
+// parsed are left untouched.
+func parseSystemFacts(dAtA []byte, facts *genericStorage.HostFacts) {
+	sections := splitSections(dAtA)
+	value := func(section string) string {
+		return strings.TrimSpace(string(sections[section]))
+	}
+	facts.Kernel = value(sectionKernel)
+	facts.Arch = value(sectionArch)
+	// /proc/uptime reports seconds since boot and the idle time, e.g. `350735.47 234388.90`.
+	if fields := strings.Fields(value(sectionUptime)); len(fields) > 0 {
+		if f, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			facts.Uptime = int64(f)
+		}
+	}
+	if n, err := strconv.Atoi(value(sectionCPUs)); err == nil {
+		facts.CPUs = n
+	}
+	// MemTotal is reported in KiB, e.g. `MemTotal:       16314452 kB`.
+	if fields := strings.Fields(value(sectionMemory)); len(fields) > 1 {
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			facts.Memory = n << 10
+		}
+	}
+	// The status is reported as `Overall Status: Current`.
+	if kv := strings.SplitN(value(sectionSubscription), ":", 2); len(kv) == 2 {
+		facts.Subscription = strings.TrimSpace(kv[1])
+	}
+}
+
+// gatherFacts parses the facts of host from the output of scan and saves them, which replace
+// those gathered before. Scans do not fail on errors, which are only logged.
+func (in *Handler) gatherFacts(host *genericStorage.Host, release *OSRelease, scanner Scanner, output scanOutput) {
+	dAtA, err := output.part(partFacts)
+	if err != nil {
+		in.logger.Warnf("Could not gather facts of host '%s' due to: %v", host.GetName(), err)
+		return
+	}
+	facts := genericStorage.NewHostFacts()
+	facts.SetName(host.GetName())
+	err = in.storage.GetContext(in.ctx, facts)
+	exists := err == nil
+	if err != nil && !genericStorage.IsNotFound(err) {
+		in.logger.Warnf("Could not gather facts of host '%s' due to: %v", host.GetName(), err)
+		return
+	}
+	gathered := genericStorage.NewHostFacts()
+	gathered.ObjectMeta = facts.ObjectMeta
+	// Facts carry the same labels as their hosts, so that they could be selected in the
+	// same way.
+	gathered.SetLabels(host.GetLabels())
+	gathered.OS = release.ID
+	gathered.OSName = release.PrettyName
+	gathered.OSVersion = release.VersionID
+	parseSystemFacts(dAtA, gathered)
+	if gatherer, ok := scanner.(FactsGatherer); ok {
+		gatherer.ParseFacts(dAtA, gathered)
+	}
+	gathered.CollectedAt.Time = time.Now()
+
+	if exists {
+		err = in.storage.UpdateContext(in.ctx, gathered)
+	} else {
+		err = in.storage.CreateContext(in.ctx, gathered)
+	}
+	if err != nil {
+		in.logger.Errorf("Could not save facts of host '%s' due to: %v", host.GetName(), err)
+	}
+}
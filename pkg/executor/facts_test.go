@@ -0,0 +1,153 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"reflect"
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+const systemFactsOutput = `@@kernel
+3.10.0-1160.el7.x86_64
+@@arch
+x86_64
+@@uptime
+350735.47 234388.90
+@@cpus
+4
+@@memory
+MemTotal:       16314452 kB
+@@subscription
+Overall Status: Current
+`
+
+func TestParseSystemFacts(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		expect genericStorage.HostFacts
+	}{
+		{
+			name:   "all",
+			output: systemFactsOutput,
+			expect: genericStorage.HostFacts{
+				Kernel:       "3.10.0-1160.el7.x86_64",
+				Arch:         "x86_64",
+				Uptime:       350735,
+				CPUs:         4,
+				Memory:       16314452 << 10,
+				Subscription: "Current",
+			},
+		},
+		{
+			// Hosts which are not registered to Red Hat report nothing of subscription.
+			name:   "unregistered",
+			output: "@@kernel\n5.4.0-42-generic\n@@arch\naarch64\n@@cpus\n2\n@@subscription\n",
+			expect: genericStorage.HostFacts{Kernel: "5.4.0-42-generic", Arch: "aarch64", CPUs: 2},
+		},
+		{
+			name:   "garbled",
+			output: "@@uptime\nunknown\n@@cpus\nmany\n@@memory\nMemTotal: lots\n@@subscription\nnot registered\n",
+		},
+		{name: "empty"},
+	}
+	for _, c := range cases {
+		got := genericStorage.HostFacts{OS: "rhel"}
+		c.expect.OS = "rhel"
+		parseSystemFacts([]byte(c.output), &got)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestParseFacts(t *testing.T) {
+	cases := []struct {
+		name     string
+		gatherer FactsGatherer
+		output   string
+		packages int
+		repos    []string
+	}{
+		{
+			name:     "yum",
+			gatherer: yumScanner{},
+			output: `@@packages
+412
+@@repos
+repo id                    repo name                                status
+base/7/x86_64              CentOS-7 - Base                          10,072
+!epel/x86_64               Extra Packages for Enterprise Linux 7    13,217
+*updates/7/x86_64          CentOS-7 - Updates                        3,414
+repolist: 26,703
+`,
+			packages: 412,
+			repos:    []string{"base", "epel", "updates"},
+		},
+		{
+			name:     "dnf",
+			gatherer: dnfScanner{},
+			output: `@@packages
+530
+@@repos
+repo id                           repo name
+appstream                         Rocky Linux 8 - AppStream
+baseos                            Rocky Linux 8 - BaseOS
+`,
+			packages: 530,
+			repos:    []string{"appstream", "baseos"},
+		},
+		{
+			name:     "apt",
+			gatherer: aptScanner{},
+			output: `@@packages
+623
+@@repos
+Package files:
+ 100 /var/lib/dpkg/status
+     release a=now
+ 500 http://archive.ubuntu.com/ubuntu focal-updates/main amd64 Packages
+     release v=20.04,o=Ubuntu,a=focal-updates,n=focal,l=Ubuntu,c=main,b=amd64
+ 500 http://archive.ubuntu.com/ubuntu focal-updates/main i386 Packages
+ 500 http://security.ubuntu.com/ubuntu focal-security/main amd64 Packages
+Pinned packages:
+`,
+			packages: 623,
+			repos: []string{
+				"http://archive.ubuntu.com/ubuntu focal-updates/main",
+				"http://security.ubuntu.com/ubuntu focal-security/main",
+			},
+		},
+		{
+			// Nothing is parsed if the commands are unavailable.
+			name:     "unavailable",
+			gatherer: yumScanner{},
+			output:   "@@packages\n@@repos\n",
+		},
+	}
+	for _, c := range cases {
+		// Facts are parsed from the whole output, which starts with the system facts.
+		var got genericStorage.HostFacts
+		c.gatherer.ParseFacts([]byte(systemFactsOutput+c.output), &got)
+		if got.Packages != c.packages || !reflect.DeepEqual(got.Repos, c.repos) {
+			t.Errorf("%s: expected %d packages and repos %v, got %d and %v", c.name, c.packages, c.repos, got.Packages, got.Repos)
+		}
+		if got.Kernel != "" {
+			t.Errorf("%s: expected system facts to be left untouched, got kernel %s", c.name, got.Kernel)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	feed "github.com/universonic/panther/pkg/feed"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// FeedConfig is the configuration of feeds, i.e. OVAL definitions or CSAF/VEX documents put
+// in a local directory, which are correlated with installed packages of hosts. Feeds are
+// disabled if Directory is empty.
+type FeedConfig struct {
+	Directory string `json:"directory,omitempty" yaml:"directory,omitempty" toml:"directory,omitempty"`
+	// Interval is the interval of checking feeds for changes and correlating them with all
+	// hosts, e.g. "1h".
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty" toml:"interval,omitempty"`
+}
+
+// Complete fulfills the empty fields of FeedConfig
+func (in *FeedConfig) Complete() {
+	if in.Interval == "" {
+		in.Interval = "1h"
+	}
+}
+
+// Apply validates the configuration and returns the feeds to be correlated, which is nil if
+// feeds are disabled.
+func (in *FeedConfig) Apply() (*Feeds, error) {
+	if in.Directory == "" {
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(in.Interval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("Invalid feed interval: %s", in.Interval)
+	}
+	return &Feeds{Directory: in.Directory, Interval: interval}, nil
+}
+
+// Feeds is the feeds correlated by executor.
+type Feeds struct {
+	Directory string
+	Interval  time.Duration
+}
+
+// CorrelateFeeds reloads feeds if they have changed, and correlates them with the installed
+// packages of all hosts.
+func (in *Handler) CorrelateFeeds() {
+	defer in.logger.Sync()
+	if in.feeds == nil {
+		return
+	}
+	// Skip if the previous correlation has not finished yet.
+	if !atomic.CompareAndSwapInt32(&in.correlating, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&in.correlating, 0)
+
+	db, err := in.loadFeeds()
+	if err != nil {
+		in.logger.Errorf("Could not load feeds from %s due to: %v", in.feeds.Directory, err)
+		return
+	}
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, genericStorage.RESOURCE_PACKAGE_INVENTORY, genericStorage.DefaultPageSize)
+	for it.Next() {
+		inventory := it.Object().(*genericStorage.PackageInventory)
+		if err = in.saveReport(inventory, db); err != nil {
+			in.logger.Errorf("Could not correlate feeds with host '%s' due to: %v", inventory.GetName(), err)
+		}
+	}
+	if err = it.Err(); err != nil {
+		in.logger.Errorf("Could not correlate feeds with hosts due to: %v", err)
+	}
+}
+
+// loadFeeds returns the feeds loaded before, or reloads them if any of them has changed.
+func (in *Handler) loadFeeds() (*feed.Database, error) {
+	signature, err := feed.Signature(in.feeds.Directory)
+	if err != nil {
+		return nil, err
+	}
+	in.lock.RLock()
+	db := in.feedDB
+	in.lock.RUnlock()
+	if db != nil && db.Signature == signature {
+		return db, nil
+	}
+	db, err = feed.Load(in.feeds.Directory)
+	if err != nil {
+		return nil, err
+	}
+	in.logger.Infof("Loaded %d advisories from %d feeds", len(db.Advisories), len(db.Sources))
+	in.lock.Lock()
+	in.feedDB = db
+	in.lock.Unlock()
+	return db, nil
+}
+
+// correlateInventory correlates the feeds loaded before with an inventory which has just been
+// collected. It does nothing if feeds have not been loaded yet, as all inventories will be
+// correlated once they have been loaded.
+func (in *Handler) correlateInventory(inventory *genericStorage.PackageInventory) {
+	in.lock.RLock()
+	db := in.feedDB
+	in.lock.RUnlock()
+	if db == nil {
+		return
+	}
+	if err := in.saveReport(inventory, db); err != nil {
+		in.logger.Errorf("Could not correlate feeds with host '%s' due to: %v", inventory.GetName(), err)
+	}
+}
+
+// saveReport correlates feeds with an inventory, and saves the report of its host.
+func (in *Handler) saveReport(inventory *genericStorage.PackageInventory, db *feed.Database) error {
+	report := genericStorage.NewVulnerabilityReport()
+	report.SetName(inventory.GetName())
+	err := in.storage.GetContext(in.ctx, report)
+	exists := err == nil
+	if err != nil && !genericStorage.IsNotFound(err) {
+		return err
+	}
+	report.SetLabels(inventory.GetLabels())
+	report.Security = db.Correlate(inventory)
+	report.Feeds = db.Sources
+	report.CorrelatedAt.Time = time.Now()
+	if exists {
+		return in.storage.UpdateContext(in.ctx, report)
+	}
+	return in.storage.CreateContext(in.ctx, report)
+}
@@ -15,35 +15,53 @@
 package executor
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
+	feed "github.com/universonic/panther/pkg/feed"
 	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 	sshutil "github.com/universonic/panther/pkg/utils/ssh"
 	zap "go.uber.org/zap"
 )
 
 // Handler is indeed an external executer caller.
 type Handler struct {
-	lock    sync.RWMutex
-	total   int
-	busy    int
-	storage genericStorage.Storage
-	logger  *zap.SugaredLogger
-	wg      sync.WaitGroup
-	queue   chan workload
-	clzChan chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	lock        sync.RWMutex
+	total       int
+	busy        int
+	sweeping    int32
+	correlating int32
+	feedDB      *feed.Database
+	storage     genericStorage.Storage
+	keyring     *keyring.Keyring
+	retention   *Retention
+	feeds       *Feeds
+	rollouts    map[string]int
+	updateSlots chan struct{}
+	logger      *zap.SugaredLogger
+	wg          sync.WaitGroup
+	queue       chan workload
+	clzChan     chan struct{}
 }
 
 func (in *Handler) worker() {
 	in.lock.Lock()
 	in.total++
 	in.lock.Unlock()
-	for job := range in.queue {
+LOOP:
+	for {
+		var job workload
+		select {
+		case job = <-in.queue:
+		case <-in.clzChan:
+			break LOOP
+		}
 		in.lock.Lock()
 		in.busy++
 		in.lock.Unlock()
@@ -73,10 +91,14 @@ func (in *Handler) worker() {
 }
 
 func (in *Handler) sendJob(obj genericStorage.Object, gc bool) {
-	defer recover() // prevent panic while trying to send on a closed handler
-	in.queue <- workload{
+	// Jobs are dropped once the handler has been closed, and they will be picked up by
+	// resync on next start.
+	select {
+	case in.queue <- workload{
 		gc:  gc,
 		val: obj,
+	}:
+	case <-in.clzChan:
 	}
 }
 
@@ -102,18 +124,94 @@ func (in *Handler) State() (busy, total int) {
 	return in.busy, in.total
 }
 
-// ScanAllHost scans on all existing host.
+// ScanAllHost scans on all existing host by the global schedule. Hosts which have their own
+// schedules are scanned by ScanScheduledHosts instead, and those in blackouts are skipped.
 func (in *Handler) ScanAllHost() {
+	in.scanHosts(func(host *genericStorage.Host, schedules []genericStorage.Schedule) bool {
+		if scanScheduleOf(schedules) != nil {
+			return false
+		}
+		if reason := blockedReason(host, schedules, time.Now(), false); reason != "" {
+			in.logger.Infof("Skip scheduled scan as %s", reason)
+			return false
+		}
+		return true
+	})
+}
+
+// ResyncHosts reconciles hosts with their system scan results, so that those hosts which
+// were created or deleted while events had been lost could be handled. It returns the
+// version of host list.
+func (in *Handler) ResyncHosts() (string, error) {
 	defer in.logger.Sync()
-	list := genericStorage.NewHostList()
-	err := in.storage.List(list)
+	// Scans must be listed before hosts, or those scans of newly created hosts would be
+	// considered as orphans.
+	scans := genericStorage.NewSystemScanList()
+	err := in.storage.ListContext(in.ctx, scans)
 	if err != nil {
-		in.logger.Errorf("Could not retrieve host list from storage due to: %v", err)
-		return
+		return "", err
+	}
+	hosts := genericStorage.NewHostList()
+	err = in.storage.ListContext(in.ctx, hosts)
+	if err != nil {
+		return "", err
+	}
+	scanned := make(map[string]bool)
+	for i := range scans.Members {
+		scanned[scans.Members[i].GetName()] = true
+	}
+	existing := make(map[string]bool)
+	for i := range hosts.Members {
+		existing[hosts.Members[i].GetName()] = true
+		if !scanned[hosts.Members[i].GetName()] {
+			in.sendJob(&hosts.Members[i], false)
+		}
+	}
+	for name := range scanned {
+		if !existing[name] {
+			host := genericStorage.NewHost()
+			host.SetName(name)
+			in.sendJob(host, true)
+		}
+	}
+	return hosts.GetResourceVersion(), nil
+}
+
+// ResyncScans handles all system scans that are waiting to be performed. It returns the
+// version of system scan list.
+func (in *Handler) ResyncScans() (string, error) {
+	defer in.logger.Sync()
+	list := genericStorage.NewSystemScanList()
+	err := in.storage.ListContext(in.ctx, list)
+	if err != nil {
+		return "", err
 	}
 	for i := range list.Members {
-		in.sendJob(&list.Members[i], false)
+		if list.Members[i].State == genericStorage.StartedState {
+			in.sendJob(&list.Members[i], false)
+		}
 	}
+	return list.GetResourceVersion(), nil
+}
+
+// ResyncOps handles all host operations that are waiting to be performed. It returns the
+// version of host operation list.
+func (in *Handler) ResyncOps() (string, error) {
+	defer in.logger.Sync()
+	// Operations pile up over time, thus they are streamed page by page.
+	started := &genericStorage.Selector{
+		Fields: []genericStorage.Requirement{
+			{Key: "state", Operator: genericStorage.Equals, Values: []string{genericStorage.StartedState.String()}},
+		},
+	}
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, genericStorage.RESOURCE_HOST_OPERATION, genericStorage.DefaultPageSize, genericStorage.WithSelector(started))
+	for it.Next() {
+		in.sendJob(it.Object(), false)
+	}
+	if err := it.Err(); err != nil {
+		return "", err
+	}
+	return it.ResourceVersion(), nil
 }
 
 // HandleHostEvent handles host event.
@@ -170,14 +268,17 @@ func (in *Handler) handleHost(host *genericStorage.Host) {
 
 	scan := genericStorage.NewSystemScan()
 	scan.SetName(host.GetName())
-	err := in.storage.Get(scan)
+	err := in.storage.GetContext(in.ctx, scan)
 	if err != nil {
 		if genericStorage.IsInternalError(err) {
 			in.logger.Errorf("Unexpected storage error while trying to scan host '%s': %v", host.GetName(), err)
 			return
 		}
+		// Scanning results carry the same labels as their hosts, so that they could be
+		// selected in the same way.
+		scan.SetLabels(host.GetLabels())
 		scan.State = genericStorage.StartedState
-		err = in.storage.Create(scan)
+		err = in.storage.CreateContext(in.ctx, scan)
 		if err != nil {
 			in.logger.Errorf("Could not initiate host scan result: %v", err)
 			return
@@ -185,8 +286,9 @@ func (in *Handler) handleHost(host *genericStorage.Host) {
 	} else {
 		switch scan.State {
 		case genericStorage.SuccessState, genericStorage.FailureState:
+			scan.SetLabels(host.GetLabels())
 			scan.State = genericStorage.StartedState
-			err = in.storage.Update(scan)
+			err = in.storage.UpdateContext(in.ctx, scan)
 			if err != nil {
 				in.logger.Errorf("Abort to scan host '%s' since we could not initiate a scan result due to: %v", host.GetName(), err)
 				return
@@ -203,49 +305,164 @@ func (in *Handler) handleScan(scan *genericStorage.SystemScan) {
 	}
 	scan.State = genericStorage.InProgressState
 	scan.Security = scan.Security[:0]
-	err := in.storage.Update(scan)
+	scan.RebootRequired = false
+	scan.Services = nil
+	err := in.storage.UpdateContext(in.ctx, scan)
 	if err != nil {
 		in.logger.Errorf("Abort to scan host '%s' due to: %v", scan.GetName(), err)
 		return
 	}
+	startedAt := time.Now()
 
 	var (
-		lines    [][]byte
-		observer genericStorage.Watcher
-		upstream <-chan genericStorage.WatchEvent
-		done     chan error
+		release *OSRelease
+		scanner Scanner
+		output  scanOutput
+		dAtA    []byte
+		updates []genericStorage.SecurityUpdate
 	)
 	op := genericStorage.NewHostOperation()
 
 	host := genericStorage.NewHost()
 	host.SetName(scan.GetName())
-	err = in.storage.Get(host)
+	err = in.storage.GetContext(in.ctx, host)
 	if err != nil {
 		in.logger.Errorf("Abort to scan host '%s' due to: %v", scan.GetName(), err)
 		scan.State = genericStorage.FailureState
 		goto FINALIZE
 	}
+	scan.SetLabels(host.GetLabels())
+
+	// All commands of a scan are performed by a single operation. The scanner is selected by
+	// the operating system of host, which is detected on every scan as it might have been
+	// upgraded since. The scanner of last scan is assumed, and the commands are performed
+	// again only if another scanner is selected, e.g. on the first scan of host.
+	scanner = LookupScanner(scan.Scanner)
+	for attempt := 0; ; attempt++ {
+		op, err = in.runOp(host, scanCommand(scanParts(scanner)))
+		if err != nil {
+			in.logger.Errorf("Failed to scan on host '%s' due to: %v", host.GetName(), err)
+			scan.State = genericStorage.FailureState
+			goto FINALIZE
+		}
+		output = splitParts(op.Data)
+		dAtA, err = output.part(partDetect)
+		if err != nil {
+			in.logger.Errorf("Failed to detect operating system of host '%s' due to: %v", host.GetName(), err)
+			scan.State = genericStorage.FailureState
+			goto FINALIZE
+		}
+		release = ParseOSRelease(dAtA)
+		selected := SelectScanner(release)
+		if attempt > 0 || scanner != nil && scanner.Name() == selected.Name() {
+			break
+		}
+		scanner = selected
+	}
+	scan.Scanner = scanner.Name()
+	// Facts and installed packages are saved even if the scan fails.
+	in.gatherFacts(host, release, scanner, output)
+	in.collectInventory(host, scanner, output)
+	dAtA, err = output.part(partScan)
+	if err != nil {
+		in.logger.Errorf("Failed to scan on host '%s' due to: %v", host.GetName(), err)
+		scan.State = genericStorage.FailureState
+		goto FINALIZE
+	}
+	updates, err = scanner.Parse(dAtA)
+	if err != nil {
+		in.logger.Errorf("Could not parse scan result of host '%s' due to: %v", host.GetName(), err)
+		scan.State = genericStorage.FailureState
+		goto FINALIZE
+	}
+	scan.Security = append(scan.Security, updates...)
+	scan.State = genericStorage.SuccessState
+	in.checkRestart(host, scan, scanner, output)
+
+FINALIZE:
+	// Every finished scan is kept as a record, and the scan refers to the latest one.
+	if record, e := in.recordScan(scan, op, startedAt, err); e != nil {
+		in.logger.Errorf("Could not record scan result for host '%s' due to: %v", scan.GetName(), e)
+	} else {
+		scan.Latest = record.GetName()
+	}
+	err = in.storage.UpdateContext(in.ctx, scan)
+	if err != nil {
+		in.logger.Errorf("Could not save scan result for host '%s' due to: %v", host.GetName(), err)
+	}
+}
+
+// checkRestart detects whether host has to be rebooted or its services have to be restarted
+// from the output of scan. Scans do not fail on errors, which are only logged, as the tools
+// might not be installed.
+func (in *Handler) checkRestart(host *genericStorage.Host, scan *genericStorage.SystemScan, scanner Scanner, output scanOutput) {
+	checker, ok := scanner.(RestartChecker)
+	if !ok {
+		return
+	}
+	dAtA, err := output.part(partRestart)
+	if err == nil {
+		scan.RebootRequired, scan.Services, err = checker.ParseRestart(dAtA)
+	}
+	if err != nil {
+		in.logger.Warnf("Could not detect whether host '%s' has to be restarted due to: %v", host.GetName(), err)
+	}
+}
+
+const (
+	// internalOpTimeout is the time (in seconds) for the commands of internal operations to
+	// finish.
+	internalOpTimeout = 3600
+	// awaitOpGrace is the time for internal operations to be picked up by workers, which is
+	// waited beyond the timeout of them.
+	awaitOpGrace = 10 * time.Minute
+)
+
+// runOp performs a command on host by an internal operation, and waits until it has been
+// finished by another worker. The operation is always returned, which carries the output of
+// command if it succeeded.
+func (in *Handler) runOp(host *genericStorage.Host, command string) (*genericStorage.HostOperation, error) {
+	return in.awaitOp(newInternalOp(host, command, genericStorage.OutputMethod))
+}
+
+// newInternalOp returns an internal operation to be performed on host.
+func newInternalOp(host *genericStorage.Host, command string, method genericStorage.OperationMethod) *genericStorage.HostOperation {
+	op := genericStorage.NewHostOperation()
 	op.SetGUID(uuid.NewV4().String())
 	op.SetName(op.GetGUID())
 	op.SetNamespace(host.GetName())
 	op.Type = genericStorage.InternalOperation
-	op.Command = "yum updateinfo list cve"
-	op.Method = genericStorage.OutputMethod
+	op.Command = command
+	op.Method = method
+	op.Timeout = internalOpTimeout
 	op.State = genericStorage.StartedState
+	return op
+}
 
-	observer, err = in.storage.Watch(op, genericStorage.WatchOnName)
+// awaitOp creates an operation, and waits until it has been finished by another worker. It
+// gives up once the timeout of operation and awaitOpGrace have passed, and the operation is
+// aborted if it has not been picked up by then.
+func (in *Handler) awaitOp(op *genericStorage.HostOperation) (*genericStorage.HostOperation, error) {
+	timeout := time.Duration(op.Timeout)*time.Second + awaitOpGrace
+	ctx, cancel := context.WithTimeout(in.ctx, timeout)
+	defer cancel()
+	observer, err := in.storage.WatchContext(ctx, op, genericStorage.WatchOnName)
 	if err != nil {
-		in.logger.Errorf("Abort to scan host '%s' since we could not initiate observer due to: %v", host.GetName(), err)
-		scan.State = genericStorage.FailureState
-		goto FINALIZE
+		return op, fmt.Errorf("Could not initiate observer due to: %v", err)
 	}
 	defer observer.Close()
-	upstream = observer.Output()
-	done = make(chan error, 1)
+	upstream := observer.Output()
+	done := make(chan error, 1)
+	var finished *genericStorage.HostOperation
 
 	go func() {
 		for {
-			event := <-upstream
+			event, ok := <-upstream
+			if !ok {
+				done <- fmt.Errorf("Observer exited before we can proceed")
+				return
+			}
+			cv := genericStorage.NewHostOperation()
 			switch event.Type {
 			case genericStorage.CREATE:
 				continue
@@ -255,16 +472,28 @@ func (in *Handler) handleScan(scan *genericStorage.SystemScan) {
 			case genericStorage.ERROR:
 				done <- fmt.Errorf("%s", event.Value)
 				return
-			}
-			cv := genericStorage.NewHostOperation()
-			err := event.Unmarshal(cv)
-			if err != nil {
-				done <- err
-				return
+			case genericStorage.RESYNC:
+				// Events might have been lost, thus the latest state has to be retrieved.
+				cv.SetNamespace(op.GetNamespace())
+				cv.SetName(op.GetName())
+				err := in.storage.GetContext(ctx, cv)
+				if err != nil {
+					if genericStorage.IsNotFound(err) {
+						continue
+					}
+					done <- err
+					return
+				}
+			default:
+				err := event.Unmarshal(cv)
+				if err != nil {
+					done <- err
+					return
+				}
 			}
 			switch cv.State {
 			case genericStorage.SuccessState:
-				op = cv
+				finished = cv
 				done <- nil
 				return
 			case genericStorage.FailureState:
@@ -274,51 +503,67 @@ func (in *Handler) handleScan(scan *genericStorage.SystemScan) {
 		}
 	}()
 
-	err = in.storage.Create(op)
+	err = in.createOp(op)
 	if err != nil {
-		in.logger.Errorf("Could not initiate operation for host '%s' due to: %v", host.GetName(), err)
-		scan.State = genericStorage.FailureState
-		goto FINALIZE
+		return op, fmt.Errorf("Could not initiate operation due to: %v", err)
 	}
-	err = <-done
-	close(done)
-	if err != nil {
-		in.logger.Errorf("Failed to scan on host '%s' due to: %v", host.GetName(), err)
-		scan.State = genericStorage.FailureState
-		goto FINALIZE
-	}
-	lines = bytes.Split(op.Data, []byte("\n"))
-	for _, each := range lines {
-		line := bytes.TrimSpace(each)
-		if !bytes.HasPrefix(line, []byte("CVE-")) {
-			continue
-		}
-		parsed := bytes.Fields(line)
-		if len(parsed) == 3 {
-			entity := genericStorage.SecurityUpdate{
-				CVEID:   string(parsed[0]),
-				Package: string(parsed[2]),
-			}
-			switch string(parsed[1]) {
-			case "Critical/Sec.":
-				entity.Severity = genericStorage.CriticalSec
-			case "Important/Sec.":
-				entity.Severity = genericStorage.ImportantSec
-			case "Moderate/Sec.":
-				entity.Severity = genericStorage.ModerateSec
-			}
-			scan.Security = append(scan.Security, entity)
+	select {
+	case err = <-done:
+		if err == nil {
+			op = finished
 		}
+		return op, err
+	case <-ctx.Done():
 	}
-	scan.State = genericStorage.SuccessState
+	if in.ctx.Err() == nil {
+		in.abortOp(op)
+	}
+	return op, fmt.Errorf("Operation did not finish in %s", timeout)
+}
 
-FINALIZE:
-	err = in.storage.Update(scan)
+// abortOp aborts an internal operation which has been given up, unless it has been picked up
+// by a worker already.
+func (in *Handler) abortOp(op *genericStorage.HostOperation) {
+	cv := genericStorage.NewHostOperation()
+	cv.SetNamespace(op.GetNamespace())
+	cv.SetName(op.GetName())
+	err := in.storage.GetContext(in.ctx, cv)
+	if err == nil && cv.State == genericStorage.StartedState {
+		cv.State = genericStorage.AbortState
+		// The update fails with a conflict if the operation has been picked up since.
+		err = in.storage.UpdateContext(in.ctx, cv)
+	}
 	if err != nil {
-		in.logger.Errorf("Could not save scan result for host '%s' due to: %v", host.GetName(), err)
+		in.logger.Warnf("Could not abort operation '%s' on host '%s' due to: %v", op.GetName(), op.GetNamespace(), err)
 	}
 }
 
+// recordScan creates an immutable record of a finished scan. The op is the operation which
+// performed the scan, and cause is the reason of failure if the scan has failed.
+func (in *Handler) recordScan(scan *genericStorage.SystemScan, op *genericStorage.HostOperation, startedAt time.Time, cause error) (*genericStorage.ScanRecord, error) {
+	finishedAt := time.Now()
+	record := genericStorage.NewScanRecord()
+	record.SetNamespace(scan.GetName())
+	record.SetName(startedAt.UTC().Format(genericStorage.ScanRecordNameFormat))
+	record.SetLabels(scan.GetLabels())
+	record.State = scan.State
+	record.Security = scan.Security
+	record.Scanner = scan.Scanner
+	record.RebootRequired = scan.RebootRequired
+	record.Services = scan.Services
+	record.StartedAt.Time = startedAt
+	record.FinishedAt.Time = finishedAt
+	record.Duration = int64(finishedAt.Sub(startedAt) / time.Millisecond)
+	record.Operation = op.GetName()
+	if scan.State == genericStorage.FailureState && cause != nil {
+		record.Reason = cause.Error()
+	}
+	if err := in.createRecord(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
 func (in *Handler) handleOp(op *genericStorage.HostOperation) {
 	defer in.logger.Sync()
 	// Ignore those ops that is being handled by other workers.
@@ -326,10 +571,11 @@ func (in *Handler) handleOp(op *genericStorage.HostOperation) {
 		return
 	}
 	var (
-		host *genericStorage.Host
-		err  error
-		conn *sshutil.Conn
-		dAtA []byte
+		host   *genericStorage.Host
+		err    error
+		conn   *sshutil.Conn
+		dAtA   []byte
+		reason string
 	)
 	done := make(chan struct{}, 1)
 	defer close(done)
@@ -351,37 +597,28 @@ func (in *Handler) handleOp(op *genericStorage.HostOperation) {
 
 	host = genericStorage.NewHost()
 	host.SetName(op.GetNamespace())
-	err = in.storage.Get(host)
+	err = in.storage.GetContext(in.ctx, host)
 	if err != nil {
 		in.logger.Errorf("Could not perform command `%s` on host '%s' due to a storage error: %v", op.Command, op.GetNamespace(), err)
 		op.State = genericStorage.AbortState
 		goto FINALIZE
 	}
 	op.State = genericStorage.InProgressState
-	err = in.storage.Update(op)
+	err = in.storage.UpdateContext(in.ctx, op)
 	if err != nil {
 		in.logger.Errorf("Could not refresh operation state for host '%s' due to a storage error: %v", op.GetNamespace(), err)
 		op.State = genericStorage.FailureState
 		op.Data = []byte(err.Error())
 		goto FINALIZE
 	}
-	conn, err = sshutil.NewConn(host.SSHAddress, host.SSHPort, host.SSHCredential.User, string(host.SSHCredential.Password))
+	conn, reason, err = in.connect(host)
 	if err != nil {
 		in.logger.Errorf("Failed to connect to host '%s' due to: %v", host.GetName(), err)
 		op.State = genericStorage.FailureState
-		op.Data = []byte(err.Error())
+		op.Data = []byte(reason)
 		goto FINALIZE
 	}
 	defer conn.Close()
-	if host.OpCredential.User != "" {
-		err = conn.Su(host.OpCredential.User, string(host.OpCredential.Password))
-		if err != nil {
-			in.logger.Errorf("Unexpected privilege error on host %s: %v", host.GetName(), err)
-			op.State = genericStorage.FailureState
-			op.Data = []byte(err.Error())
-			goto FINALIZE
-		}
-	}
 
 	switch op.Method {
 	case genericStorage.RunMethod:
@@ -390,6 +627,8 @@ func (in *Handler) handleOp(op *genericStorage.HostOperation) {
 		dAtA, err = conn.Output(op.Command, op.Timeout)
 	case genericStorage.CombinedOutputMethod:
 		dAtA, err = conn.CombinedOutput(op.Command, op.Timeout)
+	case genericStorage.RebootMethod:
+		dAtA, err = in.reboot(host, conn, op.Command, op.Timeout)
 	}
 	if err != nil {
 		in.logger.Errorf("Failed to perform command `%s` on host '%s' due to: %v", op.Command, host.GetName(), err)
@@ -401,18 +640,45 @@ func (in *Handler) handleOp(op *genericStorage.HostOperation) {
 	op.State = genericStorage.SuccessState
 
 FINALIZE:
-	err = in.storage.Update(op)
+	err = in.storage.UpdateContext(in.ctx, op)
 	if err != nil {
 		in.logger.Errorf("Could not store execution result to database due to: %v", err)
 	}
 }
 
+// connect dials host, and switches to the privileged user of host if there is one. The reason
+// of failure is returned as well, which could be exposed as the data of operations.
+func (in *Handler) connect(host *genericStorage.Host) (*sshutil.Conn, string, error) {
+	// Passwords are only revealed right before dialing.
+	sshPass, err := host.SSHCredential.Reveal(in.keyring)
+	if err != nil {
+		return nil, "Could not open SSH credential", fmt.Errorf("Could not open SSH credential: %v", err)
+	}
+	conn, err := sshutil.NewConn(host.SSHAddress, host.SSHPort, host.SSHCredential.User, string(sshPass))
+	if err != nil {
+		return nil, err.Error(), err
+	}
+	if host.OpCredential.User != "" {
+		opPass, err := host.OpCredential.Reveal(in.keyring)
+		if err != nil {
+			conn.Close()
+			return nil, "Could not open privilege credential", fmt.Errorf("Could not open privilege credential: %v", err)
+		}
+		err = conn.Su(host.OpCredential.User, string(opPass))
+		if err != nil {
+			conn.Close()
+			return nil, err.Error(), fmt.Errorf("Unexpected privilege error: %v", err)
+		}
+	}
+	return conn, "", nil
+}
+
 func (in *Handler) gcHost(host *genericStorage.Host) {
 	defer in.logger.Sync()
 
 	scan := genericStorage.NewSystemScan()
 	scan.SetName(host.GetName())
-	err := in.storage.Delete(scan)
+	err := in.storage.DeleteContext(in.ctx, scan)
 	if err != nil {
 		if genericStorage.IsInternalError(err) {
 			in.logger.Errorf("Could cleanup system scanning result that is related to host '%s' due to an internal error: %v", host.GetName(), err)
@@ -420,12 +686,36 @@ func (in *Handler) gcHost(host *genericStorage.Host) {
 			in.logger.Warnf("System scanning result that is related to host '%s' seems has been removed from the storage: %v", host.GetName(), err)
 		}
 	}
+	facts := genericStorage.NewHostFacts()
+	facts.SetName(host.GetName())
+	err = in.storage.DeleteContext(in.ctx, facts)
+	if err != nil && !genericStorage.IsNotFound(err) {
+		in.logger.Errorf("Could not cleanup facts that are related to host '%s' due to: %v", host.GetName(), err)
+	}
+	inventory := genericStorage.NewPackageInventory()
+	inventory.SetName(host.GetName())
+	err = in.storage.DeleteContext(in.ctx, inventory)
+	if err != nil && !genericStorage.IsNotFound(err) {
+		in.logger.Errorf("Could not cleanup installed packages that are related to host '%s' due to: %v", host.GetName(), err)
+	}
+	report := genericStorage.NewVulnerabilityReport()
+	report.SetName(host.GetName())
+	err = in.storage.DeleteContext(in.ctx, report)
+	if err != nil && !genericStorage.IsNotFound(err) {
+		in.logger.Errorf("Could not cleanup vulnerability report that is related to host '%s' due to: %v", host.GetName(), err)
+	}
+	in.gcNamespace(genericStorage.RESOURCE_HOST_OPERATION, host.GetName())
+	in.gcNamespace(genericStorage.RESOURCE_SCAN_RECORD, host.GetName())
 }
 
-// Close aims to shutdown handler gracefully if possible.
+// Close aims to shutdown handler gracefully if possible. Storage requests of those jobs
+// which could not finish in time are cancelled.
 func (in *Handler) Close() error {
-	close(in.queue)
+	defer in.cancel()
+	// Rollouts are started under the lock, so that none of them would be missed by Wait.
+	in.lock.Lock()
 	close(in.clzChan)
+	in.lock.Unlock()
 
 	clz := make(chan struct{}, 1)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -445,11 +735,22 @@ func (in *Handler) Close() error {
 }
 
 // NewHandler return a new Handler instance.
-func NewHandler(storage genericStorage.Storage, logger *zap.SugaredLogger, workers int) *Handler {
+func NewHandler(storage genericStorage.Storage, kr *keyring.Keyring, logger *zap.SugaredLogger, workers int, retention *Retention, feeds *Feeds) *Handler {
+	ctx, cancel := context.WithCancel(context.Background())
 	h := &Handler{
-		storage: storage,
-		logger:  logger,
-		queue:   make(chan workload, 100),
+		ctx:       ctx,
+		cancel:    cancel,
+		storage:   storage,
+		keyring:   kr,
+		retention: retention,
+		feeds:     feeds,
+		rollouts:  make(map[string]int),
+		// Hosts are updated by at most half of workers at a time, so that the operations they
+		// wait for could be performed by the others, and so could scans.
+		updateSlots: make(chan struct{}, (workers+1)/2),
+		logger:      logger,
+		queue:       make(chan workload, 100),
+		clzChan:     make(chan struct{}),
 	}
 	h.wg.Add(workers)
 	for w := 0; w < workers; w++ {
@@ -0,0 +1,51 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+func TestAbortOp(t *testing.T) {
+	h, storage := newTestHandler(t)
+	defer h.Close()
+	host := genericStorage.NewHost()
+	host.SetName("web-1")
+	cases := []struct {
+		state  genericStorage.State
+		expect genericStorage.State
+	}{
+		{genericStorage.StartedState, genericStorage.AbortState},
+		// Operations picked up by workers are left to finish.
+		{genericStorage.InProgressState, genericStorage.InProgressState},
+		{genericStorage.SuccessState, genericStorage.SuccessState},
+	}
+	for _, c := range cases {
+		op := newInternalOp(host, "true", genericStorage.OutputMethod)
+		op.State = c.state
+		if err := storage.Create(op); err != nil {
+			t.Fatal(err)
+		}
+		h.abortOp(op)
+		if err := storage.Get(op); err != nil {
+			t.Fatal(err)
+		}
+		if op.State != c.expect {
+			t.Errorf("%s: expected %s, got %s", c.state, c.expect, op.State)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// collectInventory parses installed packages on host from the output of scan and saves them,
+// which replace those collected before. Scans do not fail on errors, which are only logged.
+func (in *Handler) collectInventory(host *genericStorage.Host, scanner Scanner, output scanOutput) {
+	collector, ok := scanner.(InventoryCollector)
+	if !ok {
+		return
+	}
+	err := in.saveInventory(host, collector, output)
+	if err != nil {
+		in.logger.Warnf("Could not collect installed packages of host '%s' due to: %v", host.GetName(), err)
+	}
+}
+
+func (in *Handler) saveInventory(host *genericStorage.Host, collector InventoryCollector, output scanOutput) error {
+	dAtA, err := output.part(partInventory)
+	if err != nil {
+		return err
+	}
+	inventory := genericStorage.NewPackageInventory()
+	inventory.SetName(host.GetName())
+	err = in.storage.GetContext(in.ctx, inventory)
+	exists := err == nil
+	if err != nil && !genericStorage.IsNotFound(err) {
+		return err
+	}
+	packages, err := collector.ParseInventory(dAtA)
+	if err != nil {
+		return fmt.Errorf("Could not parse installed packages: %v", err)
+	}
+	// Inventories carry the same labels as their hosts, so that they could be selected in the
+	// same way.
+	inventory.SetLabels(host.GetLabels())
+	inventory.Manager = collector.Manager()
+	inventory.Packages = packages
+	inventory.CollectedAt.Time = time.Now()
+	if exists {
+		err = in.storage.UpdateContext(in.ctx, inventory)
+	} else {
+		err = in.storage.CreateContext(in.ctx, inventory)
+	}
+	if err != nil {
+		return err
+	}
+	in.correlateInventory(inventory)
+	return nil
+}
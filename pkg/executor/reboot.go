@@ -0,0 +1,102 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	sshutil "github.com/universonic/panther/pkg/utils/ssh"
+)
+
+const (
+	// DefaultRebootCommand is the command to reboot hosts if none is given.
+	DefaultRebootCommand = "shutdown -r now"
+	// DefaultRebootTimeout is the time (in seconds) to wait for hosts to come back if no
+	// timeout is given.
+	DefaultRebootTimeout = 600
+
+	// bootIDCommand prints the random ID generated by kernel on each boot, which tells whether
+	// host has been rebooted since.
+	bootIDCommand = "cat /proc/sys/kernel/random/boot_id"
+	// commandTimeout is the time (in seconds) of the commands issued during reboot.
+	commandTimeout = 30
+	// rebootPollInterval is the interval of trying to reconnect to host.
+	rebootPollInterval = 10 * time.Second
+)
+
+// reboot reboots host by command through conn, and waits until host comes back with a new
+// boot ID. The command is detached and delayed, so that it returns before the connection is
+// dropped.
+func (in *Handler) reboot(host *genericStorage.Host, conn *sshutil.Conn, command string, timeout uint) ([]byte, error) {
+	startedAt := time.Now()
+	before, err := conn.Output(bootIDCommand, commandTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read boot ID due to: %v", err)
+	}
+	if command == "" {
+		command = DefaultRebootCommand
+	}
+	err = conn.Run("nohup sh -c "+shellQuote("sleep 2; "+command)+" >/dev/null 2>&1 &", commandTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not reboot due to: %v", err)
+	}
+	in.logger.Infof("Host '%s' is rebooting", host.GetName())
+	if timeout == 0 {
+		timeout = DefaultRebootTimeout
+	}
+	deadline := startedAt.Add(time.Duration(timeout) * time.Second)
+
+	ticker := time.NewTicker(rebootPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-in.ctx.Done():
+			return nil, in.ctx.Err()
+		}
+		after, err := in.bootID(host)
+		if err == nil && !bytes.Equal(after, before) {
+			took := time.Since(startedAt) / time.Second * time.Second
+			in.logger.Infof("Host '%s' came back after %s", host.GetName(), took)
+			return []byte(fmt.Sprintf("Host came back after %s", took)), nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("it has not been rebooted yet")
+			}
+			return nil, fmt.Errorf("Host did not come back in %ds, the last attempt failed as %v", timeout, err)
+		}
+	}
+}
+
+// bootID reads the boot ID of host through a new connection.
+func (in *Handler) bootID(host *genericStorage.Host) ([]byte, error) {
+	conn, _, err := in.connect(host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Output(bootIDCommand, commandTimeout)
+}
+
+// rebootHost reboots host by an internal operation, and waits until host has come back.
+func (in *Handler) rebootHost(host *genericStorage.Host) (*genericStorage.HostOperation, error) {
+	op := newInternalOp(host, "", genericStorage.RebootMethod)
+	op.Timeout = DefaultRebootTimeout
+	return in.awaitOp(op)
+}
@@ -0,0 +1,321 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// RetentionPolicy limits the finished operations to be kept on each host. Empty MaxAge
+// and zero MaxCount mean no limit.
+type RetentionPolicy struct {
+	// MaxAge is the duration to keep an operation since it was created, e.g. "720h".
+	MaxAge string `json:"max_age,omitempty" yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	// MaxCount is the number of the latest operations to keep on each host.
+	MaxCount int `json:"max_count,omitempty" yaml:"max_count,omitempty" toml:"max_count,omitempty"`
+}
+
+// RetentionConfig is the configuration of operation retention. Internal operations are
+// issued by executor itself, e.g. by scans, while user operations are issued through API.
+// Scan records are limited on each host as well, and internal operations referenced by
+// the kept records are never deleted by max count.
+type RetentionConfig struct {
+	// Interval is the interval of enforcing retention policies, e.g. "1h".
+	Interval string           `json:"interval,omitempty" yaml:"interval,omitempty" toml:"interval,omitempty"`
+	Internal *RetentionPolicy `json:"internal,omitempty" yaml:"internal,omitempty" toml:"internal,omitempty"`
+	User     *RetentionPolicy `json:"user,omitempty" yaml:"user,omitempty" toml:"user,omitempty"`
+	Records  *RetentionPolicy `json:"records,omitempty" yaml:"records,omitempty" toml:"records,omitempty"`
+}
+
+// Complete fulfills the empty fields of RetentionConfig
+func (in *RetentionConfig) Complete() {
+	if in.Interval == "" {
+		in.Interval = "1h"
+	}
+	if in.Internal == nil {
+		in.Internal = &RetentionPolicy{MaxAge: "720h", MaxCount: 30}
+	}
+	if in.User == nil {
+		in.User = &RetentionPolicy{MaxAge: "2160h", MaxCount: 100}
+	}
+	if in.Records == nil {
+		in.Records = &RetentionPolicy{MaxAge: "720h", MaxCount: 30}
+	}
+}
+
+// Apply validates the configuration and returns the retention to be enforced.
+func (in *RetentionConfig) Apply() (*Retention, error) {
+	interval, err := time.ParseDuration(in.Interval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("Invalid retention interval: %s", in.Interval)
+	}
+	internal, err := in.Internal.parse()
+	if err != nil {
+		return nil, err
+	}
+	user, err := in.User.parse()
+	if err != nil {
+		return nil, err
+	}
+	records, err := in.Records.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Retention{
+		Interval: interval,
+		Internal: internal,
+		User:     user,
+		Records:  records,
+	}, nil
+}
+
+func (in *RetentionPolicy) parse() (policy Policy, err error) {
+	if in.MaxAge != "" {
+		if policy.MaxAge, err = time.ParseDuration(in.MaxAge); err != nil || policy.MaxAge < 0 {
+			return policy, fmt.Errorf("Invalid max age of retention policy: %s", in.MaxAge)
+		}
+	}
+	if in.MaxCount < 0 {
+		return policy, fmt.Errorf("Invalid max count of retention policy: %d", in.MaxCount)
+	}
+	policy.MaxCount = in.MaxCount
+	return policy, nil
+}
+
+// Policy is a parsed RetentionPolicy. Zero values mean no limit.
+type Policy struct {
+	MaxAge   time.Duration
+	MaxCount int
+}
+
+// Retention is the retention of operations and scan records enforced by executor.
+type Retention struct {
+	Interval time.Duration
+	Internal Policy
+	User     Policy
+	Records  Policy
+}
+
+// policyOf returns the policy that is applied to operations of given type.
+func (in *Retention) policyOf(t genericStorage.OperationType) Policy {
+	if in == nil {
+		return Policy{}
+	}
+	if t == genericStorage.InternalOperation {
+		return in.Internal
+	}
+	return in.User
+}
+
+// createOp creates an operation. Operations expire by storage if it is able to, so that
+// they are removed in time even if the executor is not running.
+func (in *Handler) createOp(op *genericStorage.HostOperation) error {
+	if expirer, ok := in.storage.(genericStorage.Expirer); ok {
+		if ttl := in.retention.policyOf(op.Type).MaxAge; ttl > 0 {
+			return expirer.CreateWithTTL(in.ctx, op, ttl)
+		}
+	}
+	return in.storage.CreateContext(in.ctx, op)
+}
+
+// createRecord creates a scan record, which expires by storage like operations do.
+func (in *Handler) createRecord(record *genericStorage.ScanRecord) error {
+	if expirer, ok := in.storage.(genericStorage.Expirer); ok && in.retention != nil {
+		if ttl := in.retention.Records.MaxAge; ttl > 0 {
+			return expirer.CreateWithTTL(in.ctx, record, ttl)
+		}
+	}
+	return in.storage.CreateContext(in.ctx, record)
+}
+
+// retained is the brief of an operation which is considered by retention.
+type retained struct {
+	namespace string
+	name      string
+	createdAt time.Time
+}
+
+// retentionGroup is a group of operations which are limited by the same max count.
+type retentionGroup struct {
+	namespace string
+	t         genericStorage.OperationType
+}
+
+// EnforceRetention deletes those scan records and finished operations that exceed the
+// retention policies. Operations in progress are never deleted, and neither are the
+// operations referenced by the kept records deleted by max count.
+func (in *Handler) EnforceRetention() {
+	defer in.logger.Sync()
+	if in.retention == nil {
+		return
+	}
+	// Skip if the previous sweep has not finished yet.
+	if !atomic.CompareAndSwapInt32(&in.sweeping, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&in.sweeping, 0)
+	now := time.Now()
+	expired, referenced, err := in.expiredRecords(now)
+	if err != nil {
+		in.logger.Errorf("Could not enforce retention of scan records due to: %v", err)
+		return
+	}
+	if deleted := in.deleteRetained(genericStorage.RESOURCE_SCAN_RECORD, expired); deleted > 0 {
+		in.logger.Infof("Deleted %d scan record(s) according to retention policies.", deleted)
+	}
+	expired = nil
+	// Operations are grouped by their hosts and types, and those within max age are
+	// further limited by max count.
+	groups := make(map[retentionGroup][]retained)
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, genericStorage.RESOURCE_HOST_OPERATION, genericStorage.DefaultPageSize)
+	for it.Next() {
+		op := it.Object().(*genericStorage.HostOperation)
+		switch op.State {
+		case genericStorage.StartedState, genericStorage.InProgressState:
+			continue
+		}
+		r := retained{
+			namespace: op.GetNamespace(),
+			name:      op.GetName(),
+			createdAt: op.GetCreationTimestamp(),
+		}
+		policy := in.retention.policyOf(op.Type)
+		if policy.MaxAge > 0 && now.Sub(r.createdAt) > policy.MaxAge {
+			expired = append(expired, r)
+			continue
+		}
+		if policy.MaxCount > 0 {
+			// Operations referenced by scan records are kept as long as the records.
+			if referenced[r.namespace+"/"+r.name] {
+				continue
+			}
+			group := retentionGroup{namespace: op.GetNamespace(), t: op.Type}
+			groups[group] = append(groups[group], r)
+		}
+	}
+	if err := it.Err(); err != nil {
+		in.logger.Errorf("Could not enforce retention of operations due to: %v", err)
+		return
+	}
+	for group, list := range groups {
+		max := in.retention.policyOf(group.t).MaxCount
+		if len(list) <= max {
+			continue
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].createdAt.After(list[j].createdAt)
+		})
+		expired = append(expired, list[max:]...)
+	}
+	if deleted := in.deleteRetained(genericStorage.RESOURCE_HOST_OPERATION, expired); deleted > 0 {
+		in.logger.Infof("Deleted %d operation(s) according to retention policies.", deleted)
+	}
+}
+
+// expiredRecords returns those scan records that exceed the retention policy, along with
+// the operations referenced by the others, which are keyed by "<host>/<name>".
+func (in *Handler) expiredRecords(now time.Time) ([]retained, map[string]bool, error) {
+	policy := in.retention.Records
+	var expired []retained
+	kept := make(map[string][]retained)
+	ops := make(map[retained]string)
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, genericStorage.RESOURCE_SCAN_RECORD, genericStorage.DefaultPageSize)
+	for it.Next() {
+		record := it.Object().(*genericStorage.ScanRecord)
+		r := retained{
+			namespace: record.GetNamespace(),
+			name:      record.GetName(),
+			createdAt: record.GetCreationTimestamp(),
+		}
+		if policy.MaxAge > 0 && now.Sub(r.createdAt) > policy.MaxAge {
+			expired = append(expired, r)
+			continue
+		}
+		kept[r.namespace] = append(kept[r.namespace], r)
+		if record.Operation != "" {
+			ops[r] = record.Operation
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, list := range kept {
+		if policy.MaxCount > 0 && len(list) > policy.MaxCount {
+			sort.Slice(list, func(i, j int) bool {
+				return list[i].createdAt.After(list[j].createdAt)
+			})
+			expired = append(expired, list[policy.MaxCount:]...)
+			list = list[:policy.MaxCount]
+		}
+		for _, r := range list {
+			if op, ok := ops[r]; ok {
+				referenced[r.namespace+"/"+op] = true
+			}
+		}
+	}
+	return expired, referenced, nil
+}
+
+// deleteRetained deletes given objects of kind, and returns the number of deleted ones.
+func (in *Handler) deleteRetained(kind string, list []retained) int {
+	deleted := 0
+	for _, r := range list {
+		if in.deleteObject(kind, r.namespace, r.name) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// gcNamespace deletes all objects of given kind on the host.
+func (in *Handler) gcNamespace(kind, host string) {
+	var names []string
+	it := genericStorage.NewIteratorContext(in.ctx, in.storage, kind, genericStorage.DefaultPageSize, genericStorage.InNamespace(host))
+	for it.Next() {
+		names = append(names, it.Object().GetName())
+	}
+	if err := it.Err(); err != nil {
+		in.logger.Errorf("Could not cleanup %s that is related to host '%s' due to: %v", kind, host, err)
+		return
+	}
+	for _, name := range names {
+		in.deleteObject(kind, host, name)
+	}
+}
+
+// deleteObject deletes an object of given kind, and returns true if it has been deleted.
+func (in *Handler) deleteObject(kind, namespace, name string) bool {
+	obj, err := genericStorage.NewObjectOf(kind)
+	if err != nil {
+		return false
+	}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	err = in.storage.DeleteContext(in.ctx, obj)
+	if err != nil {
+		// It might have been deleted by others, or expired by storage.
+		if genericStorage.IsInternalError(err) {
+			in.logger.Errorf("Could not delete %s '%s' on host '%s' due to: %v", kind, name, namespace, err)
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+func TestEnforceRetention(t *testing.T) {
+	h, storage := newTestHandler(t)
+	defer h.Close()
+	h.retention = &Retention{
+		Internal: Policy{MaxAge: 24 * time.Hour, MaxCount: 2},
+		User:     Policy{MaxCount: 1},
+		Records:  Policy{MaxCount: 1},
+	}
+	restorer := storage.(genericStorage.Restorer)
+	now := time.Now()
+	ops := []struct {
+		host  string
+		name  string
+		t     genericStorage.OperationType
+		state genericStorage.State
+		age   time.Duration
+	}{
+		// Internal operations of web-1 exceed both max age and max count.
+		{"web-1", "expired", genericStorage.InternalOperation, genericStorage.SuccessState, 48 * time.Hour},
+		{"web-1", "started", genericStorage.InternalOperation, genericStorage.StartedState, 48 * time.Hour},
+		{"web-1", "in-progress", genericStorage.InternalOperation, genericStorage.InProgressState, 48 * time.Hour},
+		{"web-1", "dropped-record", genericStorage.InternalOperation, genericStorage.SuccessState, 5 * time.Hour},
+		{"web-1", "kept-record", genericStorage.InternalOperation, genericStorage.SuccessState, 4 * time.Hour},
+		{"web-1", "oldest", genericStorage.InternalOperation, genericStorage.FailureState, 3 * time.Hour},
+		{"web-1", "older", genericStorage.InternalOperation, genericStorage.SuccessState, 2 * time.Hour},
+		{"web-1", "latest", genericStorage.InternalOperation, genericStorage.AbortState, time.Hour},
+		// User operations have no max age.
+		{"web-1", "user-older", genericStorage.UserOperation, genericStorage.SuccessState, 200 * time.Hour},
+		{"web-1", "user-latest", genericStorage.UserOperation, genericStorage.SuccessState, 100 * time.Hour},
+		// Operations of web-2 are counted on their own.
+		{"web-2", "other-older", genericStorage.InternalOperation, genericStorage.SuccessState, 2 * time.Hour},
+		{"web-2", "other-latest", genericStorage.InternalOperation, genericStorage.SuccessState, time.Hour},
+		{"web-2", "other-user", genericStorage.UserOperation, genericStorage.SuccessState, 300 * time.Hour},
+	}
+	for _, each := range ops {
+		op := genericStorage.NewHostOperation()
+		op.SetNamespace(each.host)
+		op.SetName(each.name)
+		op.Type = each.t
+		op.State = each.state
+		op.SetCreationTimestamp(now.Add(-each.age))
+		if err := restorer.Restore(context.Background(), op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the latest record is kept, and so is the operation referenced by it.
+	records := []struct {
+		name string
+		op   string
+		age  time.Duration
+	}{
+		{"record-older", "dropped-record", 5 * time.Hour},
+		{"record-latest", "kept-record", 4 * time.Hour},
+	}
+	for _, each := range records {
+		record := genericStorage.NewScanRecord()
+		record.SetNamespace("web-1")
+		record.SetName(each.name)
+		record.Operation = each.op
+		record.SetCreationTimestamp(now.Add(-each.age))
+		if err := restorer.Restore(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h.EnforceRetention()
+
+	names := func(kind string) []string {
+		var list []string
+		it := genericStorage.NewIterator(storage, kind, genericStorage.DefaultPageSize)
+		for it.Next() {
+			list = append(list, it.Object().GetNamespace()+"/"+it.Object().GetName())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(list)
+		return list
+	}
+	want := []string{
+		"web-1/in-progress",
+		"web-1/kept-record",
+		"web-1/latest",
+		"web-1/older",
+		"web-1/started",
+		"web-1/user-latest",
+		"web-2/other-latest",
+		"web-2/other-older",
+		"web-2/other-user",
+	}
+	if got := names(genericStorage.RESOURCE_HOST_OPERATION); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected operations %v to be kept, got %v", want, got)
+	}
+	want = []string{"web-1/record-latest"}
+	if got := names(genericStorage.RESOURCE_SCAN_RECORD); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected records %v to be kept, got %v", want, got)
+	}
+}
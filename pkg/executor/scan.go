@@ -0,0 +1,128 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Parts of the command of a scan, see scanCommand.
+const (
+	partDetect    = "detect"
+	partFacts     = "facts"
+	partInventory = "inventory"
+	partScan      = "scan"
+	partRestart   = "restart"
+
+	// Each part of output starts with the marker of part, and it ends with the marker of its
+	// result. They differ from the markers of sections, which are kept in the output of parts.
+	partMarker    = "%%part:"
+	partSucceeded = "%%succeeded:"
+	partFailed    = "%%failed:"
+)
+
+// scanPart is a command to be performed by a scan.
+type scanPart struct {
+	name    string
+	command string
+}
+
+// scanParts returns the parts of command to be performed by a scan. The operating system is
+// always detected, and the others are only performed if scanner is known.
+func scanParts(scanner Scanner) []scanPart {
+	parts := []scanPart{{partDetect, DetectCommand}}
+	if scanner == nil {
+		return parts
+	}
+	facts := systemFactsCommand
+	if gatherer, ok := scanner.(FactsGatherer); ok {
+		facts += " ; " + gatherer.FactsCommand()
+	}
+	parts = append(parts, scanPart{partFacts, facts})
+	if collector, ok := scanner.(InventoryCollector); ok {
+		parts = append(parts, scanPart{partInventory, collector.InventoryCommand()})
+	}
+	parts = append(parts, scanPart{partScan, scanner.Command()})
+	if checker, ok := scanner.(RestartChecker); ok {
+		parts = append(parts, scanPart{partRestart, checker.RestartCommand()})
+	}
+	return parts
+}
+
+// scanCommand joins the commands of parts, so that a scan is performed by a single operation.
+// Each of them is run in a subshell, and the joined command succeeds even if some of them
+// failed, whose results are told by markers.
+func scanCommand(parts []scanPart) string {
+	var commands []string
+	for _, each := range parts {
+		commands = append(commands,
+			"echo "+partMarker+each.name,
+			"("+each.command+") && echo "+partSucceeded+each.name+" || echo "+partFailed+each.name,
+		)
+	}
+	return strings.Join(commands, " ; ")
+}
+
+// partOutput is the output of a part of scanCommand.
+type partOutput struct {
+	dAtA     []byte
+	finished bool
+	failed   bool
+}
+
+// scanOutput is the output of scanCommand split by parts.
+type scanOutput map[string]*partOutput
+
+// splitParts splits the output of scanCommand by the markers of parts.
+func splitParts(dAtA []byte) scanOutput {
+	out := make(scanOutput)
+	var current *partOutput
+	for _, line := range bytes.SplitAfter(dAtA, []byte("\n")) {
+		marker := string(bytes.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(marker, partMarker):
+			current = new(partOutput)
+			out[strings.TrimPrefix(marker, partMarker)] = current
+			continue
+		case strings.HasPrefix(marker, partSucceeded), strings.HasPrefix(marker, partFailed):
+			if current != nil {
+				current.finished = true
+				current.failed = strings.HasPrefix(marker, partFailed)
+			}
+			current = nil
+			continue
+		}
+		if current != nil {
+			current.dAtA = append(current.dAtA, line...)
+		}
+	}
+	return out
+}
+
+// part returns the output of part, or an error if the part failed or was not performed.
+func (in scanOutput) part(name string) ([]byte, error) {
+	out, ok := in[name]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("Command of %s was not performed", name)
+	case !out.finished:
+		return nil, fmt.Errorf("Command of %s did not finish", name)
+	case out.failed:
+		return nil, fmt.Errorf("Command of %s failed", name)
+	}
+	return out.dAtA, nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanParts(t *testing.T) {
+	cases := []struct {
+		scanner Scanner
+		expect  []string
+	}{
+		{nil, []string{partDetect}},
+		{yumScanner{}, []string{partDetect, partFacts, partInventory, partScan, partRestart}},
+		{aptScanner{}, []string{partDetect, partFacts, partInventory, partScan, partRestart}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, each := range scanParts(c.scanner) {
+			got = append(got, each.name)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%v: expected parts %v, got %v", c.scanner, c.expect, got)
+		}
+	}
+	command := scanCommand(scanParts(yumScanner{}))
+	for _, each := range []string{yumScanner{}.Command(), yumScanner{}.FactsCommand(), yumScanner{}.RestartCommand(), rpmInventoryCommand} {
+		if !strings.Contains(command, each) {
+			t.Errorf("Expected %q in command %q", each, command)
+		}
+	}
+}
+
+func TestSplitParts(t *testing.T) {
+	output := splitParts([]byte(`%%part:detect
+ID="centos"
+%%succeeded:detect
+%%part:facts
+@@kernel
+3.10.0-957.el7.x86_64
+%%succeeded:facts
+%%part:scan
+@@advisories
+%%failed:scan
+%%part:restart
+@@reboot
+`))
+	cases := []struct {
+		part   string
+		expect string
+		err    string
+	}{
+		{partDetect, "ID=\"centos\"\n", ""},
+		// Sections of parts are kept.
+		{partFacts, "@@kernel\n3.10.0-957.el7.x86_64\n", ""},
+		{partScan, "", "Command of scan failed"},
+		{partRestart, "", "Command of restart did not finish"},
+		{partInventory, "", "Command of inventory was not performed"},
+	}
+	for _, c := range cases {
+		got, err := output.part(c.part)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error %q, got %v", c.part, c.err, err)
+			}
+			continue
+		}
+		if err != nil || string(got) != c.expect {
+			t.Errorf("%s: expected %q, got %q (%v)", c.part, c.expect, got, err)
+		}
+	}
+}
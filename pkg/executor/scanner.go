@@ -0,0 +1,210 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+const (
+	// DetectCommand is the command which prints the os-release file of host. Nothing is
+	// printed on hosts without it (e.g. CentOS 6), which are scanned by DefaultScanner.
+	DetectCommand = "cat /etc/os-release 2>/dev/null || true"
+	// DefaultScanner is the name of scanner to be used if no scanner matches the operating
+	// system of host.
+	DefaultScanner = "yum"
+)
+
+// OSRelease is the identification of the operating system of host. See os-release(5).
+type OSRelease struct {
+	ID        string
+	IDLike    []string
+	VersionID string
+	// PrettyName is the name of operating system for presentation, e.g. "CentOS Linux 7 (Core)".
+	PrettyName string
+}
+
+// ParseOSRelease parses the content of os-release file. Unknown keys and malformed lines are
+// ignored, thus an empty OSRelease is returned if nothing could be recognized.
+func ParseOSRelease(dAtA []byte) *OSRelease {
+	out := new(OSRelease)
+	scanner := bufio.NewScanner(bytes.NewReader(dAtA))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(kv[1], `"'`)
+		switch kv[0] {
+		case "ID":
+			out.ID = strings.ToLower(value)
+		case "ID_LIKE":
+			out.IDLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			out.VersionID = value
+		case "PRETTY_NAME":
+			out.PrettyName = value
+		}
+	}
+	return out
+}
+
+// Is returns true if the operating system is, or is derived from, any of the given IDs.
+func (in *OSRelease) Is(ids ...string) bool {
+	for _, id := range ids {
+		if in.ID == id {
+			return true
+		}
+		for _, like := range in.IDLike {
+			if like == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MajorVersion returns the major version of the operating system, or 0 if it is unknown.
+func (in *OSRelease) MajorVersion() int {
+	n, err := strconv.Atoi(strings.SplitN(in.VersionID, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Scanner lists the security updates available on hosts of certain operating systems by
+// their package managers.
+type Scanner interface {
+	// Name returns the unique name of scanner.
+	Name() string
+	// Match returns true if the scanner is able to scan hosts of the operating system.
+	Match(os *OSRelease) bool
+	// Command returns the command to be performed on host, whose output is parsed by Parse.
+	Command() string
+	// Parse parses the output of command into security updates.
+	Parse(dAtA []byte) ([]genericStorage.SecurityUpdate, error)
+}
+
+// Updater is implemented by the scanners which are able to install the updates they found.
+type Updater interface {
+	// UpdateCommand returns the command to be performed on host, which installs the packages
+	// of updates and lists the installed versions of them afterwards. The command succeeds
+	// even if the installation failed, so that the installed versions are always reported.
+	UpdateCommand(updates []genericStorage.SecurityUpdate) string
+	// ParseUpdate parses the output of command into the result of each package, and returns
+	// the reason of failure if the installation failed.
+	ParseUpdate(dAtA []byte, updates []genericStorage.SecurityUpdate) ([]genericStorage.PackageResult, error)
+}
+
+// RestartChecker is implemented by the scanners which are able to detect whether hosts have
+// to be rebooted, or their services have to be restarted, for installed updates to take effect.
+type RestartChecker interface {
+	// RestartCommand returns the command to be performed on host, whose output is parsed by
+	// ParseRestart.
+	RestartCommand() string
+	// ParseRestart parses the output of command. An error is returned if it could not be
+	// detected, e.g. the tool is not installed on host.
+	ParseRestart(dAtA []byte) (reboot bool, services []string, err error)
+}
+
+// FactsGatherer is implemented by the scanners which are able to gather the facts known by
+// package managers, i.e. the number of installed packages and the enabled repositories.
+type FactsGatherer interface {
+	// FactsCommand returns the command to be performed on host, whose output is parsed by
+	// ParseFacts.
+	FactsCommand() string
+	// ParseFacts parses the output of command into facts. Those could not be parsed are left
+	// untouched.
+	ParseFacts(dAtA []byte, facts *genericStorage.HostFacts)
+}
+
+// InventoryCollector is implemented by the scanners which are able to list installed packages.
+type InventoryCollector interface {
+	// Manager returns the package manager by whose scheme versions of packages are compared.
+	Manager() string
+	// InventoryCommand returns the command to be performed on host, whose output is parsed by
+	// ParseInventory.
+	InventoryCommand() string
+	// ParseInventory parses the output of command into installed packages.
+	ParseInventory(dAtA []byte) ([]genericStorage.InstalledPackage, error)
+}
+
+var (
+	scannersLock sync.RWMutex
+	scanners     []Scanner
+)
+
+// RegisterScanner makes a scanner available for selection. Scanners are matched in the order
+// of registration, thus the more specific ones have to be registered first. If RegisterScanner
+// is called twice with the same name or if scanner is nil, it panics.
+func RegisterScanner(s Scanner) {
+	scannersLock.Lock()
+	defer scannersLock.Unlock()
+	if s == nil {
+		panic("executor: RegisterScanner scanner is nil")
+	}
+	for _, each := range scanners {
+		if each.Name() == s.Name() {
+			panic("executor: RegisterScanner called twice for scanner " + s.Name())
+		}
+	}
+	scanners = append(scanners, s)
+}
+
+// SelectScanner returns the first registered scanner which matches the operating system, or
+// DefaultScanner if none matches.
+func SelectScanner(os *OSRelease) Scanner {
+	scannersLock.RLock()
+	defer scannersLock.RUnlock()
+	var fallback Scanner
+	for _, each := range scanners {
+		if each.Match(os) {
+			return each
+		}
+		if each.Name() == DefaultScanner {
+			fallback = each
+		}
+	}
+	return fallback
+}
+
+// LookupScanner returns the registered scanner of given name, or nil if it does not exist.
+func LookupScanner(name string) Scanner {
+	scannersLock.RLock()
+	defer scannersLock.RUnlock()
+	for _, each := range scanners {
+		if each.Name() == name {
+			return each
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterScanner(dnfScanner{})
+	RegisterScanner(yumScanner{})
+	RegisterScanner(aptScanner{})
+}
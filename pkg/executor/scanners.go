@@ -0,0 +1,872 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// parseSeverity converts the severity of an advisory, e.g. "Important/Sec." of yum or
+// "Important" of dnf5.
+func parseSeverity(s string) genericStorage.SecuritySeverity {
+	switch strings.TrimSuffix(s, "/Sec.") {
+	case "Critical":
+		return genericStorage.CriticalSec
+	case "Important":
+		return genericStorage.ImportantSec
+	case "Moderate":
+		return genericStorage.ModerateSec
+	case "Low":
+		return genericStorage.LowSec
+	}
+	return genericStorage.UnknownSec
+}
+
+// Sections of the output of rpm based scanners, each of which starts with its marker line.
+const (
+	sectionAdvisories = "@@advisories"
+	sectionCVEs       = "@@cves"
+	sectionIssued     = "@@issued"
+	sectionInstalled  = "@@installed"
+	// Sections of the output of update commands.
+	sectionUpdate    = "@@update"
+	sectionSucceeded = "@@succeeded"
+	sectionFailed    = "@@failed"
+	// Sections of the output of restart commands.
+	sectionReboot   = "@@reboot"
+	sectionServices = "@@services"
+	// Sections of the output of facts commands.
+	sectionPackages = "@@packages"
+	sectionRepos    = "@@repos"
+)
+
+// queryInstalled lists installed packages in the form of `<NAME>.<ARCH> <NEVRA>`.
+const queryInstalled = `rpm -qa --qf '%{NAME}.%{ARCH} %{NAME}-%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}.%{ARCH}\n'`
+
+// rpmCommand joins the commands of an rpm based scanner, whose outputs are separated by the
+// markers of sections. Only the lines of IDs and dates are kept from advisory details, which
+// are lengthy otherwise.
+func rpmCommand(list, listCVE, info string) string {
+	return strings.Join([]string{
+		"echo " + sectionAdvisories, list,
+		"echo " + sectionCVEs, listCVE,
+		"echo " + sectionIssued, "(" + info + " | grep -E '^ *(Update ID|Issued|Updated) *:' || true)",
+		"echo " + sectionInstalled, queryInstalled,
+	}, " && ")
+}
+
+// updateCommand joins the command which installs packages and the one which queries them
+// afterwards. The output of installation is kept in sections, and it is followed by a marker
+// of its result.
+func updateCommand(install, query string) string {
+	return strings.Join([]string{
+		"echo " + sectionUpdate,
+		"(" + install + " 2>&1 && echo " + sectionSucceeded + " || echo " + sectionFailed + ")",
+		"echo " + sectionInstalled,
+		"(" + query + " 2>/dev/null || true)",
+	}, " ; ")
+}
+
+// updateError returns the reason of failure if the installation failed, which is the last
+// line of its output.
+func updateError(sections map[string][]byte) error {
+	if _, ok := sections[sectionFailed]; !ok {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(sections[sectionUpdate])), "\n")
+	if reason := strings.TrimSpace(lines[len(lines)-1]); reason != "" {
+		return fmt.Errorf("Installation failed: %s", reason)
+	}
+	return fmt.Errorf("Installation failed")
+}
+
+// shellQuote quotes an argument of shell command, as packages are reported by hosts.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// validPackage returns true if the package reported by host consists of the characters
+// allowed in names and versions of rpm and dpkg only. Commands might be wrapped into double
+// quotes by `su`, where quoting is not enough for characters like `$` or `"`.
+func validPackage(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._+-:~^", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// packageResult compares the installed package after the update with the expected one. The
+// update is also considered succeeded if the package was upgraded to another version, e.g.
+// a newer one published meanwhile.
+func packageResult(update genericStorage.SecurityUpdate, expected, installed string) genericStorage.PackageResult {
+	out := genericStorage.PackageResult{
+		Package:   update.Package,
+		Previous:  update.Installed,
+		Installed: installed,
+		State:     genericStorage.FailureState,
+	}
+	for _, each := range strings.Split(installed, ", ") {
+		if each == expected {
+			out.State = genericStorage.SuccessState
+			return out
+		}
+	}
+	if installed != "" && installed != update.Installed {
+		out.State = genericStorage.SuccessState
+	}
+	return out
+}
+
+// restartCommand joins the command which prints "yes" or "no" whether a reboot is required
+// (or "unknown" if it could not tell), and the one which lists services to be restarted.
+func restartCommand(reboot, services string) string {
+	return strings.Join([]string{
+		"echo " + sectionReboot, reboot,
+		"echo " + sectionServices, "(" + services + " 2>/dev/null || true)",
+	}, " ; ")
+}
+
+// parseRestart parses the output of restartCommand. Only those lines of services starting with
+// prefix are considered, whose prefix is trimmed.
+func parseRestart(dAtA []byte, prefix string) (bool, []string, error) {
+	sections := splitSections(dAtA)
+	var reboot bool
+	switch strings.TrimSpace(string(sections[sectionReboot])) {
+	case "yes":
+		reboot = true
+	case "no":
+	default:
+		return false, nil, fmt.Errorf("Could not detect whether reboot is required")
+	}
+	var services []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(sections[sectionServices]), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		services = append(services, line)
+	}
+	sort.Strings(services)
+	return reboot, services, nil
+}
+
+// factsCommand joins the command which prints the number of installed packages, and the one
+// which lists enabled repositories. Neither of them fails the whole command.
+func factsCommand(count, repos string) string {
+	return strings.Join([]string{
+		"echo " + sectionPackages, "(" + count + " 2>/dev/null || true)",
+		"echo " + sectionRepos, "(" + repos + " 2>/dev/null || true)",
+	}, " ; ")
+}
+
+// parseFacts parses the output of factsCommand into facts, where repositories are parsed from
+// each line by parseRepo, which returns an empty string for those lines to be skipped.
+func parseFacts(dAtA []byte, facts *genericStorage.HostFacts, parseRepo func(line string) string) {
+	sections := splitSections(dAtA)
+	if n, err := strconv.Atoi(strings.TrimSpace(string(sections[sectionPackages]))); err == nil {
+		facts.Packages = n
+	}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(sections[sectionRepos]), "\n") {
+		repo := parseRepo(line)
+		if repo == "" || seen[repo] {
+			continue
+		}
+		seen[repo] = true
+		facts.Repos = append(facts.Repos, repo)
+	}
+	sort.Strings(facts.Repos)
+}
+
+// parseRPMRepo parses a line of `repolist`, e.g.:
+//   base/7/x86_64       CentOS-7 - Base       10,072
+// The header, the summary and the flags of repositories (e.g. `!` for expired metadata) are
+// ignored, and so is the release suffix of yum.
+func parseRPMRepo(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] == "repo" || fields[0] == "repolist:" {
+		return ""
+	}
+	return strings.SplitN(strings.TrimLeft(fields[0], "!*"), "/", 2)[0]
+}
+
+// rpmInventoryCommand lists installed packages in the form of `<NAME> <EVR> <ARCH>`.
+const rpmInventoryCommand = `rpm -qa --qf '%{NAME} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE} %{ARCH}\n'`
+
+// parseRPMInventory parses the output of rpmInventoryCommand. Packages without architecture
+// (e.g. gpg-pubkey) are reported with an empty one.
+func parseRPMInventory(dAtA []byte) ([]genericStorage.InstalledPackage, error) {
+	var out []genericStorage.InstalledPackage
+	scanner := bufio.NewScanner(bytes.NewReader(dAtA))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[2] == "(none)" {
+			fields[2] = ""
+		}
+		out = append(out, genericStorage.InstalledPackage{Name: fields[0], Version: fields[1], Arch: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("No installed package was listed")
+	}
+	return out, nil
+}
+
+// splitSections splits the output of rpmCommand by the markers of sections.
+func splitSections(dAtA []byte) map[string][]byte {
+	out := make(map[string][]byte)
+	var (
+		current string
+		buf     bytes.Buffer
+	)
+	for _, line := range bytes.SplitAfter(dAtA, []byte("\n")) {
+		if marker := string(bytes.TrimSpace(line)); strings.HasPrefix(marker, "@@") {
+			if current != "" {
+				out[current] = append([]byte(nil), buf.Bytes()...)
+			}
+			current = marker
+			buf.Reset()
+			continue
+		}
+		buf.Write(line)
+	}
+	if current != "" {
+		out[current] = buf.Bytes()
+	}
+	return out
+}
+
+// advisory is an advisory applicable to a package.
+type advisory struct {
+	id       string
+	t        genericStorage.AdvisoryType
+	severity genericStorage.SecuritySeverity
+	nevra    string
+	issued   string
+}
+
+// dnfAdvisory is an entry of the JSON output of dnf5. While CVEs are listed, the CVE is either
+// the name of entry or one of its references.
+type dnfAdvisory struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Severity   string `json:"severity"`
+	NEVRA      string `json:"nevra"`
+	BuildTime  string `json:"buildtime"`
+	References []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"references"`
+}
+
+func isJSON(dAtA []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(dAtA), []byte("["))
+}
+
+// parseAdvisories parses the output of `updateinfo list`, where each line is in the form of
+// `<ID> <SEVERITY>/Sec.|<TYPE> <NEVRA>`, or the JSON output of dnf5. Security advisories
+// without severity are listed with the type `security`.
+func parseAdvisories(dAtA []byte) ([]advisory, error) {
+	var out []advisory
+	if isJSON(dAtA) {
+		var entries []dnfAdvisory
+		if err := json.Unmarshal(bytes.TrimSpace(dAtA), &entries); err != nil {
+			return nil, fmt.Errorf("Invalid advisories: %v", err)
+		}
+		for _, each := range entries {
+			out = append(out, advisory{
+				id:       each.Name,
+				t:        genericStorage.AdvisoryType(strings.ToLower(each.Type)),
+				severity: parseSeverity(each.Severity),
+				nevra:    each.NEVRA,
+				issued:   parseDate(each.BuildTime),
+			})
+		}
+		return out, nil
+	}
+	for _, each := range bytes.Split(dAtA, []byte("\n")) {
+		parsed := strings.Fields(string(each))
+		if len(parsed) != 3 || strings.HasPrefix(parsed[0], "CVE-") {
+			continue
+		}
+		a := advisory{id: parsed[0], nevra: parsed[2]}
+		switch t := genericStorage.AdvisoryType(strings.ToLower(parsed[1])); {
+		case strings.HasSuffix(parsed[1], "Sec."):
+			a.t, a.severity = genericStorage.SecurityAdvisory, parseSeverity(parsed[1])
+		case t == genericStorage.SecurityAdvisory:
+			// Advisories without severity are listed by their bare type.
+			a.t, a.severity = t, genericStorage.UnknownSec
+		case t == genericStorage.BugfixAdvisory, t == genericStorage.EnhancementAdvisory, t == genericStorage.NewPackageAdvisory:
+			a.t = t
+		default:
+			// Not an advisory, e.g. messages of plugins.
+			continue
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// cve is a CVE fixed by a package.
+type cve struct {
+	id       string
+	severity genericStorage.SecuritySeverity
+}
+
+// parseCVEs parses the output of `updateinfo list cve`, where each line is in the form of
+// `<CVE> <SEVERITY>/Sec. <NEVRA>`, or the JSON output of dnf5. CVEs are indexed by NEVRA.
+func parseCVEs(dAtA []byte) (map[string][]cve, error) {
+	out := make(map[string][]cve)
+	if isJSON(dAtA) {
+		var entries []dnfAdvisory
+		if err := json.Unmarshal(bytes.TrimSpace(dAtA), &entries); err != nil {
+			return nil, fmt.Errorf("Invalid CVEs: %v", err)
+		}
+		for _, each := range entries {
+			severity := parseSeverity(each.Severity)
+			if strings.HasPrefix(each.Name, "CVE-") {
+				out[each.NEVRA] = append(out[each.NEVRA], cve{each.Name, severity})
+			}
+			for _, ref := range each.References {
+				if strings.EqualFold(ref.Type, "cve") {
+					out[each.NEVRA] = append(out[each.NEVRA], cve{ref.ID, severity})
+				}
+			}
+		}
+		return out, nil
+	}
+	for _, each := range bytes.Split(dAtA, []byte("\n")) {
+		parsed := strings.Fields(string(each))
+		if len(parsed) != 3 || !strings.HasPrefix(parsed[0], "CVE-") {
+			continue
+		}
+		out[parsed[2]] = append(out[parsed[2]], cve{parsed[0], parseSeverity(parsed[1])})
+	}
+	return out, nil
+}
+
+// parseIssued parses the IDs and dates of advisory details, and returns the dates by IDs. The
+// date of issue is preferred, while dnf only shows the date of last update.
+func parseIssued(dAtA []byte) map[string]string {
+	out := make(map[string]string)
+	var id string
+	for _, each := range bytes.Split(dAtA, []byte("\n")) {
+		kv := strings.SplitN(string(each), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "Update ID":
+			id = value
+		case "Issued":
+			out[id] = parseDate(value)
+		case "Updated":
+			if _, ok := out[id]; !ok {
+				out[id] = parseDate(value)
+			}
+		}
+	}
+	return out
+}
+
+// parseDate returns the date part of a timestamp, e.g. "2018-01-03 00:00:00".
+func parseDate(s string) string {
+	if len(s) < 10 {
+		return ""
+	}
+	if _, err := time.Parse("2006-01-02", s[:10]); err != nil {
+		return ""
+	}
+	return s[:10]
+}
+
+// parseInstalled parses the output of queryInstalled, and returns the NEVRAs of installed
+// packages by `<NAME>.<ARCH>`. Packages with multiple versions installed (e.g. kernel) have
+// all of them listed.
+func parseInstalled(dAtA []byte) map[string]string {
+	all := make(map[string][]string)
+	for _, each := range bytes.Split(dAtA, []byte("\n")) {
+		parsed := strings.Fields(string(each))
+		if len(parsed) != 2 {
+			continue
+		}
+		all[parsed[0]] = append(all[parsed[0]], parsed[1])
+	}
+	out := make(map[string]string, len(all))
+	for key, list := range all {
+		sort.Strings(list)
+		out[key] = strings.Join(list, ", ")
+	}
+	return out
+}
+
+// nameArch returns `<NAME>.<ARCH>` of a NEVRA, where the epoch is either prefixed to it by yum
+// (1:openssl-1.0.2k-8.el7.x86_64) or placed before the version by dnf (openssl-1:1.0.2k...).
+func nameArch(nevra string) string {
+	if i := strings.Index(nevra, ":"); i >= 0 && !strings.Contains(nevra[:i], "-") {
+		nevra = nevra[i+1:]
+	}
+	dot := strings.LastIndex(nevra, ".")
+	if dot < 0 {
+		return ""
+	}
+	rest := nevra[:dot]
+	for i := 0; i < 2; i++ {
+		dash := strings.LastIndex(rest, "-")
+		if dash < 0 {
+			return ""
+		}
+		rest = rest[:dash]
+	}
+	return rest + nevra[dot:]
+}
+
+// normalizeNEVRA places the epoch prefixed by yum before the version as rpm does, e.g.
+// 1:openssl-1.0.2k-8.el7.x86_64 becomes openssl-1:1.0.2k-8.el7.x86_64.
+func normalizeNEVRA(nevra string) string {
+	i := strings.Index(nevra, ":")
+	if i < 0 || strings.Contains(nevra[:i], "-") {
+		return nevra
+	}
+	epoch, rest := nevra[:i], nevra[i+1:]
+	dash := strings.LastIndex(rest, "-")
+	if dash < 0 {
+		return nevra
+	}
+	dash = strings.LastIndex(rest[:dash], "-")
+	if dash < 0 {
+		return nevra
+	}
+	return rest[:dash+1] + epoch + ":" + rest[dash+1:]
+}
+
+// rpmUpdateCommand returns the update command of an rpm based updater, where install is the
+// command which installs the given packages. Invalid packages are never installed, thus they
+// are considered failed.
+func rpmUpdateCommand(install string, updates []genericStorage.SecurityUpdate) string {
+	var packages, names []string
+	for _, each := range updates {
+		if !validPackage(each.Package) {
+			continue
+		}
+		packages = append(packages, shellQuote(each.Package))
+		names = append(names, shellQuote(nameArch(each.Package)))
+	}
+	query := strings.Replace(queryInstalled, "rpm -qa", "rpm -q", 1) + " " + strings.Join(names, " ")
+	return updateCommand(install+" "+strings.Join(packages, " "), query)
+}
+
+// parseRPMUpdate parses the output of rpmUpdateCommand.
+func parseRPMUpdate(dAtA []byte, updates []genericStorage.SecurityUpdate) ([]genericStorage.PackageResult, error) {
+	sections := splitSections(dAtA)
+	installed := parseInstalled(sections[sectionInstalled])
+	var out []genericStorage.PackageResult
+	for _, each := range updates {
+		out = append(out, packageResult(each, normalizeNEVRA(each.Package), installed[nameArch(each.Package)]))
+	}
+	return out, updateError(sections)
+}
+
+// parseRPMScan parses the output of rpmCommand. Every advisory is recorded once for each CVE
+// it fixes, while those fix no CVE are recorded once.
+func parseRPMScan(dAtA []byte) ([]genericStorage.SecurityUpdate, error) {
+	sections := splitSections(dAtA)
+	advisories, err := parseAdvisories(sections[sectionAdvisories])
+	if err != nil {
+		return nil, err
+	}
+	cves, err := parseCVEs(sections[sectionCVEs])
+	if err != nil {
+		return nil, err
+	}
+	issued := parseIssued(sections[sectionIssued])
+	installed := parseInstalled(sections[sectionInstalled])
+
+	var out []genericStorage.SecurityUpdate
+	covered := make(map[string]bool)
+	for _, each := range advisories {
+		update := genericStorage.SecurityUpdate{
+			Severity:  each.severity,
+			Package:   each.nevra,
+			Advisory:  each.id,
+			Type:      each.t,
+			Installed: installed[nameArch(each.nevra)],
+			Issued:    each.issued,
+		}
+		if update.Issued == "" {
+			update.Issued = issued[each.id]
+		}
+		if each.t != genericStorage.SecurityAdvisory || len(cves[each.nevra]) == 0 {
+			out = append(out, update)
+			continue
+		}
+		covered[each.nevra] = true
+		for _, c := range cves[each.nevra] {
+			update.CVEID = c.id
+			out = append(out, update)
+		}
+	}
+	// CVEs are still recorded even if their advisories are unknown.
+	var uncovered []string
+	for nevra := range cves {
+		if !covered[nevra] {
+			uncovered = append(uncovered, nevra)
+		}
+	}
+	sort.Strings(uncovered)
+	for _, nevra := range uncovered {
+		for _, c := range cves[nevra] {
+			out = append(out, genericStorage.SecurityUpdate{
+				CVEID:     c.id,
+				Severity:  c.severity,
+				Package:   nevra,
+				Type:      genericStorage.SecurityAdvisory,
+				Installed: installed[nameArch(nevra)],
+			})
+		}
+	}
+	return out, nil
+}
+
+// yumScanner scans RHEL/CentOS 7 and older, and the other yum based systems.
+type yumScanner struct{}
+
+func (yumScanner) Name() string { return "yum" }
+
+func (yumScanner) Match(os *OSRelease) bool {
+	return os.Is("rhel", "centos", "fedora")
+}
+
+func (yumScanner) Command() string {
+	return rpmCommand("yum -q updateinfo list", "yum -q updateinfo list cve", "yum -q updateinfo info")
+}
+
+func (yumScanner) Parse(dAtA []byte) ([]genericStorage.SecurityUpdate, error) {
+	return parseRPMScan(dAtA)
+}
+
+// UpdateCommand installs the exact versions of packages, thus nothing newer is installed.
+func (yumScanner) UpdateCommand(updates []genericStorage.SecurityUpdate) string {
+	return rpmUpdateCommand("yum -y -q update-to", updates)
+}
+
+// RestartCommand checks by needs-restarting of yum-utils, whose -r exits with 1 if a reboot
+// is required.
+func (yumScanner) RestartCommand() string {
+	return restartCommand(
+		"if command -v needs-restarting >/dev/null 2>&1; then (needs-restarting -r >/dev/null 2>&1 && echo no || echo yes); else echo unknown; fi",
+		"needs-restarting -s",
+	)
+}
+
+func (yumScanner) ParseRestart(dAtA []byte) (bool, []string, error) {
+	return parseRestart(dAtA, "")
+}
+
+// FactsCommand counts installed packages by rpm, and lists enabled repositories by yum.
+func (yumScanner) FactsCommand() string {
+	return factsCommand("rpm -qa | wc -l", "yum -q repolist enabled")
+}
+
+func (yumScanner) ParseFacts(dAtA []byte, facts *genericStorage.HostFacts) {
+	parseFacts(dAtA, facts, parseRPMRepo)
+}
+
+func (yumScanner) Manager() string { return genericStorage.RPMManager }
+
+func (yumScanner) InventoryCommand() string { return rpmInventoryCommand }
+
+func (yumScanner) ParseInventory(dAtA []byte) ([]genericStorage.InstalledPackage, error) {
+	return parseRPMInventory(dAtA)
+}
+
+func (yumScanner) ParseUpdate(dAtA []byte, updates []genericStorage.SecurityUpdate) ([]genericStorage.PackageResult, error) {
+	return parseRPMUpdate(dAtA, updates)
+}
+
+// dnfScanner scans RHEL 8 and newer, Fedora and the other dnf based systems. The JSON output
+// of dnf5 is preferred, and the text output of dnf4 is used if it is not supported.
+type dnfScanner struct{}
+
+func (dnfScanner) Name() string { return "dnf" }
+
+func (dnfScanner) Match(os *OSRelease) bool {
+	// CentOS 7 is also like fedora, thus versions have to be checked. Amazon Linux 2 is
+	// identified as version 2, while its successors are versioned by year.
+	return os.ID == "fedora" || (os.Is("rhel", "centos", "fedora") && os.MajorVersion() >= 8)
+}
+
+func (dnfScanner) Command() string {
+	return rpmCommand(
+		"(dnf -q updateinfo list --json 2>/dev/null || dnf -q updateinfo list)",
+		"(dnf -q updateinfo list --with-cve --json 2>/dev/null || dnf -q updateinfo list --with-cve)",
+		"dnf -q updateinfo info 2>/dev/null",
+	)
+}
+
+func (dnfScanner) Parse(dAtA []byte) ([]genericStorage.SecurityUpdate, error) {
+	return parseRPMScan(dAtA)
+}
+
+// UpdateCommand installs the exact versions of packages, as dnf upgrades packages to the
+// versions given by their NEVRAs.
+func (dnfScanner) UpdateCommand(updates []genericStorage.SecurityUpdate) string {
+	return rpmUpdateCommand("dnf -y -q upgrade", updates)
+}
+
+// RestartCommand checks by the needs-restarting plugin of dnf.
+func (dnfScanner) RestartCommand() string {
+	return restartCommand(
+		"if dnf -q needs-restarting --help >/dev/null 2>&1; then (dnf -q needs-restarting -r >/dev/null 2>&1 && echo no || echo yes); else echo unknown; fi",
+		"dnf -q needs-restarting -s",
+	)
+}
+
+func (dnfScanner) ParseRestart(dAtA []byte) (bool, []string, error) {
+	return parseRestart(dAtA, "")
+}
+
+// FactsCommand counts installed packages by rpm, and lists enabled repositories by dnf.
+func (dnfScanner) FactsCommand() string {
+	return factsCommand("rpm -qa | wc -l", "dnf -q repolist --enabled")
+}
+
+func (dnfScanner) ParseFacts(dAtA []byte, facts *genericStorage.HostFacts) {
+	parseFacts(dAtA, facts, parseRPMRepo)
+}
+
+func (dnfScanner) Manager() string { return genericStorage.RPMManager }
+
+func (dnfScanner) InventoryCommand() string { return rpmInventoryCommand }
+
+func (dnfScanner) ParseInventory(dAtA []byte) ([]genericStorage.InstalledPackage, error) {
+	return parseRPMInventory(dAtA)
+}
+
+func (dnfScanner) ParseUpdate(dAtA []byte, updates []genericStorage.SecurityUpdate) ([]genericStorage.PackageResult, error) {
+	return parseRPMUpdate(dAtA, updates)
+}
+
+// aptScanner scans Debian, Ubuntu and their derivatives. Like unattended-upgrades, upgrades
+// from security origins (e.g. `focal-security` or `Debian-Security`) are considered as
+// security updates. APT knows neither CVEs nor severities, thus only packages are reported.
+// Package lists are as fresh as the last `apt-get update` on host, which is run daily by the
+// apt timers on most systems.
+type aptScanner struct{}
+
+func (aptScanner) Name() string { return "apt" }
+
+func (aptScanner) Match(os *OSRelease) bool {
+	return os.Is("debian")
+}
+
+func (aptScanner) Command() string {
+	return "LANG=C apt-get -s -o Debug::NoLocking=1 dist-upgrade"
+}
+
+// Parse parses the simulated upgrade, where each package to be upgraded is listed as:
+//   Inst <NAME> [<CURRENT VERSION>] (<VERSION> <ORIGIN>[, <ORIGIN>...] [<ARCH>])
+// Both the available and the installed packages are reported in the form of
+// `<NAME>_<VERSION>_<ARCH>`.
+func (aptScanner) Parse(dAtA []byte) ([]genericStorage.SecurityUpdate, error) {
+	var out []genericStorage.SecurityUpdate
+	scanner := bufio.NewScanner(bytes.NewReader(dAtA))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		start := strings.Index(line, "(")
+		end := strings.Index(line, ")")
+		if start < 0 || end < start {
+			continue
+		}
+		fields := strings.Fields(line[:start])
+		candidate := strings.Fields(line[start+1 : end])
+		if len(fields) < 2 || len(candidate) < 2 || !strings.Contains(strings.ToLower(line[start+1:end]), "security") {
+			continue
+		}
+		var arch string
+		if last := candidate[len(candidate)-1]; strings.HasPrefix(last, "[") {
+			arch = "_" + strings.Trim(last, "[]")
+		}
+		update := genericStorage.SecurityUpdate{
+			Package: fields[1] + "_" + candidate[0] + arch,
+			Type:    genericStorage.SecurityAdvisory,
+		}
+		if len(fields) > 2 {
+			update.Installed = fields[1] + "_" + strings.Trim(fields[2], "[]") + arch
+		}
+		out = append(out, update)
+	}
+	return out, scanner.Err()
+}
+
+// splitDebian splits a package of `<NAME>_<VERSION>[_<ARCH>]` reported by Parse.
+func splitDebian(pkg string) (name, version, arch string) {
+	parsed := strings.SplitN(pkg, "_", 3)
+	name = parsed[0]
+	if len(parsed) > 1 {
+		version = parsed[1]
+	}
+	if len(parsed) > 2 {
+		arch = parsed[2]
+	}
+	return
+}
+
+// UpdateCommand installs the exact versions of packages without installing any new package.
+// Existing configuration files are kept as there is nobody to answer prompts.
+func (aptScanner) UpdateCommand(updates []genericStorage.SecurityUpdate) string {
+	var packages, names []string
+	for _, each := range updates {
+		if !validPackage(each.Package) {
+			continue
+		}
+		name, version, arch := splitDebian(each.Package)
+		if arch != "" {
+			name += ":" + arch
+		}
+		packages = append(packages, shellQuote(name+"="+version))
+		names = append(names, shellQuote(name))
+	}
+	return updateCommand(
+		"DEBIAN_FRONTEND=noninteractive apt-get -y -q -o Dpkg::Options::=--force-confold install --only-upgrade "+strings.Join(packages, " "),
+		"dpkg-query -W "+strings.Join(names, " "),
+	)
+}
+
+// ParseUpdate parses the output of UpdateCommand, where each package is listed by dpkg-query
+// as `<NAME>[:<ARCH>]\t<VERSION>`.
+func (aptScanner) ParseUpdate(dAtA []byte, updates []genericStorage.SecurityUpdate) ([]genericStorage.PackageResult, error) {
+	sections := splitSections(dAtA)
+	versions := make(map[string]string)
+	for _, line := range strings.Split(string(sections[sectionInstalled]), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		versions[strings.SplitN(fields[0], ":", 2)[0]] = fields[1]
+	}
+	var out []genericStorage.PackageResult
+	for _, each := range updates {
+		name, _, arch := splitDebian(each.Package)
+		var installed string
+		if version, ok := versions[name]; ok {
+			installed = name + "_" + version
+			if arch != "" {
+				installed += "_" + arch
+			}
+		}
+		out = append(out, packageResult(each, each.Package, installed))
+	}
+	return out, updateError(sections)
+}
+
+// RestartCommand checks the flag file created by packages which require a reboot, and lists
+// services by needrestart in batch mode if it is installed.
+func (aptScanner) RestartCommand() string {
+	return restartCommand(
+		"(test -f /var/run/reboot-required && echo yes || echo no)",
+		"needrestart -b -r l",
+	)
+}
+
+// ParseRestart parses the output of RestartCommand, where services are listed by needrestart
+// as `NEEDRESTART-SVC: <SERVICE>`.
+func (aptScanner) ParseRestart(dAtA []byte) (bool, []string, error) {
+	return parseRestart(dAtA, "NEEDRESTART-SVC:")
+}
+
+// FactsCommand counts installed packages by dpkg, and lists package sources by apt-cache.
+func (aptScanner) FactsCommand() string {
+	return factsCommand("dpkg -l | grep -c '^ii'", "LANG=C apt-cache policy")
+}
+
+// ParseFacts parses the output of FactsCommand, where each source is listed by apt-cache as:
+//   500 http://archive.ubuntu.com/ubuntu focal-updates/main amd64 Packages
+// Sources are reported in the form of `<URI> <SUITE>/<COMPONENT>`.
+func (aptScanner) ParseFacts(dAtA []byte, facts *genericStorage.HostFacts) {
+	parseFacts(dAtA, facts, func(line string) string {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.Contains(fields[1], "://") {
+			return ""
+		}
+		return fields[1] + " " + fields[2]
+	})
+}
+
+func (aptScanner) Manager() string { return genericStorage.DpkgManager }
+
+// InventoryCommand lists packages by dpkg, which is wide enough not to truncate any column.
+func (aptScanner) InventoryCommand() string {
+	return "COLUMNS=512 dpkg -l"
+}
+
+// ParseInventory parses the output of InventoryCommand, where each package is listed as:
+//   ii  openssl:amd64  1.1.1f-1ubuntu2.16  amd64  Secure Sockets Layer toolkit
+// Only those installed (including those on hold) are reported, and the architecture qualifier
+// of names is trimmed.
+func (aptScanner) ParseInventory(dAtA []byte) ([]genericStorage.InstalledPackage, error) {
+	var out []genericStorage.InstalledPackage
+	scanner := bufio.NewScanner(bytes.NewReader(dAtA))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || (fields[0] != "ii" && fields[0] != "hi") {
+			continue
+		}
+		out = append(out, genericStorage.InstalledPackage{
+			Name:    strings.SplitN(fields[1], ":", 2)[0],
+			Version: fields[2],
+			Arch:    fields[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("No installed package was listed")
+	}
+	return out, nil
+}
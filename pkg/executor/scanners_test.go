@@ -0,0 +1,435 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"reflect"
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+const (
+	centOS7Release = `NAME="CentOS Linux"
+VERSION="7 (Core)"
+ID="centos"
+ID_LIKE="rhel fedora"
+VERSION_ID="7"
+PRETTY_NAME="CentOS Linux 7 (Core)"
+`
+	rocky9Release = `NAME="Rocky Linux"
+VERSION="9.2 (Blue Onyx)"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.2"
+PRETTY_NAME="Rocky Linux 9.2 (Blue Onyx)"
+`
+	ubuntuRelease = `NAME="Ubuntu"
+VERSION="20.04.6 LTS (Focal Fossa)"
+ID=ubuntu
+ID_LIKE=debian
+PRETTY_NAME="Ubuntu 20.04.6 LTS"
+VERSION_ID="20.04"
+`
+)
+
+func TestParseOSRelease(t *testing.T) {
+	cases := []struct {
+		name   string
+		dAtA   string
+		expect OSRelease
+		major  int
+	}{
+		{"Empty", "", OSRelease{}, 0},
+		{"CentOS7", centOS7Release, OSRelease{ID: "centos", IDLike: []string{"rhel", "fedora"}, VersionID: "7", PrettyName: "CentOS Linux 7 (Core)"}, 7},
+		{"Rocky9", rocky9Release, OSRelease{ID: "rocky", IDLike: []string{"rhel", "centos", "fedora"}, VersionID: "9.2", PrettyName: "Rocky Linux 9.2 (Blue Onyx)"}, 9},
+		{"Ubuntu", ubuntuRelease, OSRelease{ID: "ubuntu", IDLike: []string{"debian"}, VersionID: "20.04", PrettyName: "Ubuntu 20.04.6 LTS"}, 20},
+		{"Malformed", "# comment\nID\nID=\"RHEL\"\nVERSION_ID=rolling\n", OSRelease{ID: "rhel", VersionID: "rolling"}, 0},
+	}
+	for _, c := range cases {
+		got := ParseOSRelease([]byte(c.dAtA))
+		if !reflect.DeepEqual(*got, c.expect) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.expect, *got)
+		}
+		if major := got.MajorVersion(); major != c.major {
+			t.Errorf("%s: expected major version %d, got %d", c.name, c.major, major)
+		}
+	}
+}
+
+func TestSelectScanner(t *testing.T) {
+	cases := []struct {
+		dAtA   string
+		expect string
+	}{
+		{"", "yum"},
+		{centOS7Release, "yum"},
+		{"ID=\"rhel\"\nVERSION_ID=\"7.9\"", "yum"},
+		{"ID=\"amzn\"\nID_LIKE=\"centos rhel fedora\"\nVERSION_ID=\"2\"", "yum"},
+		{"ID=\"rhel\"\nID_LIKE=\"fedora\"\nVERSION_ID=\"8.6\"", "dnf"},
+		{rocky9Release, "dnf"},
+		{"ID=fedora\nVERSION_ID=39", "dnf"},
+		{ubuntuRelease, "apt"},
+		{"ID=debian\nVERSION_ID=\"12\"", "apt"},
+		{"ID=alpine\nVERSION_ID=3.18.4", DefaultScanner},
+	}
+	for _, c := range cases {
+		if got := SelectScanner(ParseOSRelease([]byte(c.dAtA))).Name(); got != c.expect {
+			t.Errorf("%q: expected scanner %s, got %s", c.dAtA, c.expect, got)
+		}
+	}
+}
+
+func TestNameArch(t *testing.T) {
+	cases := map[string]string{
+		"kernel-3.10.0-693.11.6.el7.x86_64":  "kernel.x86_64",
+		"1:openssl-1.0.2k-9.el7.x86_64":      "openssl.x86_64",
+		"openssl-1:1.0.2k-9.el7.x86_64":      "openssl.x86_64",
+		"python3-libs-3.6.8-51.el8_8.2.i686": "python3-libs.i686",
+		"tzdata-2023c-1.el9.noarch":          "tzdata.noarch",
+		"kernel":                             "",
+		"kernel-3.10.0.x86_64":               "",
+	}
+	for nevra, expect := range cases {
+		if got := nameArch(nevra); got != expect {
+			t.Errorf("%s: expected %q, got %q", nevra, expect, got)
+		}
+	}
+}
+
+func TestNormalizeNEVRA(t *testing.T) {
+	cases := map[string]string{
+		"1:openssl-1.0.2k-9.el7.x86_64":       "openssl-1:1.0.2k-9.el7.x86_64",
+		"openssl-1:1.0.2k-9.el7.x86_64":       "openssl-1:1.0.2k-9.el7.x86_64",
+		"kernel-3.10.0-693.11.6.el7.x86_64":   "kernel-3.10.0-693.11.6.el7.x86_64",
+		"2:vim-common-8.0.1763-19.el8.x86_64": "vim-common-2:8.0.1763-19.el8.x86_64",
+		"1:malformed":                         "1:malformed",
+	}
+	for nevra, expect := range cases {
+		if got := normalizeNEVRA(nevra); got != expect {
+			t.Errorf("%s: expected %q, got %q", nevra, expect, got)
+		}
+	}
+}
+
+// yumScanOutput is the output of yumScanner.Command on CentOS 7.
+const yumScanOutput = `@@advisories
+Loaded plugins: fastestmirror, product-id
+RHSA-2018:0007 Important/Sec. kernel-3.10.0-693.11.6.el7.x86_64
+RHBA-2018:0010 bugfix         1:openssl-1.0.2k-9.el7.x86_64
+RHEA-2018:0020 enhancement    tzdata-2018c-1.el7.noarch
+RHSA-2018:0100 Low/Sec.       bash-4.2.46-30.el7.x86_64
+updateinfo list done
+@@cves
+CVE-2017-5715 Important/Sec. kernel-3.10.0-693.11.6.el7.x86_64
+CVE-2017-5753 Important/Sec. kernel-3.10.0-693.11.6.el7.x86_64
+CVE-2017-9999 Moderate/Sec.  glibc-2.17-196.el7_4.2.x86_64
+@@issued
+  Update ID : RHSA-2018:0007
+    Release : 0
+     Issued : 2018-01-03 00:00:00
+    Updated : 2018-01-05 00:00:00
+  Update ID : RHBA-2018:0010
+    Updated : 2018-01-09 00:00:00
+@@installed
+kernel.x86_64 kernel-3.10.0-693.el7.x86_64
+kernel.x86_64 kernel-3.10.0-514.el7.x86_64
+openssl.x86_64 openssl-1:1.0.2k-8.el7.x86_64
+bash.x86_64 bash-4.2.46-29.el7.x86_64
+glibc.x86_64 glibc-2.17-196.el7.x86_64
+`
+
+// dnf4ScanOutput is the output of dnfScanner.Command on RHEL 8, where dnf4 does not support
+// the JSON output.
+const dnf4ScanOutput = `@@advisories
+RHSA-2023:1405 Important/Sec. openssl-1:1.1.1k-9.el8_7.x86_64
+RHSA-2023:1405 Important/Sec. openssl-libs-1:1.1.1k-9.el8_7.x86_64
+RHBA-2023:1500 bugfix         systemd-239-68.el8_7.4.x86_64
+@@cves
+CVE-2023-0286 Important/Sec. openssl-1:1.1.1k-9.el8_7.x86_64
+CVE-2023-0286 Important/Sec. openssl-libs-1:1.1.1k-9.el8_7.x86_64
+@@issued
+  Update ID: RHSA-2023:1405
+       Type: security
+    Updated: 2023-03-22 10:09:46
+  Update ID: RHBA-2023:1500
+    Updated: 2023-03-28 08:15:02
+@@installed
+openssl.x86_64 openssl-1:1.1.1k-7.el8_6.x86_64
+openssl-libs.x86_64 openssl-libs-1:1.1.1k-7.el8_6.x86_64
+systemd.x86_64 systemd-239-68.el8_7.2.x86_64
+`
+
+// dnf5ScanOutput is the output of dnfScanner.Command on Fedora 40, where dnf5 lists advisories
+// and CVEs in JSON.
+const dnf5ScanOutput = `@@advisories
+[{"name":"FEDORA-2024-1a2b3c","type":"security","severity":"Critical","nevra":"openssl-1:3.2.1-2.fc40.x86_64","buildtime":"2024-03-01 10:00:00"},{"name":"FEDORA-2024-4d5e6f","type":"bugfix","severity":"None","nevra":"vim-minimal-2:9.1.113-1.fc40.x86_64","buildtime":"2024-03-02 08:00:00"}]
+@@cves
+[{"name":"CVE-2024-0727","type":"security","severity":"Critical","nevra":"openssl-1:3.2.1-2.fc40.x86_64"},{"name":"FEDORA-2024-1a2b3c","type":"security","severity":"Critical","nevra":"openssl-1:3.2.1-2.fc40.x86_64","references":[{"id":"CVE-2024-2511","type":"cve"},{"id":"2265871","type":"bugzilla"}]}]
+@@issued
+@@installed
+openssl.x86_64 openssl-1:3.2.0-1.fc40.x86_64
+vim-minimal.x86_64 vim-minimal-2:9.1.095-1.fc40.x86_64
+`
+
+func TestParseRPMScan(t *testing.T) {
+	cases := []struct {
+		name   string
+		dAtA   string
+		expect []genericStorage.SecurityUpdate
+	}{
+		{"yum", yumScanOutput, []genericStorage.SecurityUpdate{
+			{CVEID: "CVE-2017-5715", Severity: genericStorage.ImportantSec, Package: "kernel-3.10.0-693.11.6.el7.x86_64", Advisory: "RHSA-2018:0007", Type: genericStorage.SecurityAdvisory, Installed: "kernel-3.10.0-514.el7.x86_64, kernel-3.10.0-693.el7.x86_64", Issued: "2018-01-03"},
+			{CVEID: "CVE-2017-5753", Severity: genericStorage.ImportantSec, Package: "kernel-3.10.0-693.11.6.el7.x86_64", Advisory: "RHSA-2018:0007", Type: genericStorage.SecurityAdvisory, Installed: "kernel-3.10.0-514.el7.x86_64, kernel-3.10.0-693.el7.x86_64", Issued: "2018-01-03"},
+			{Package: "1:openssl-1.0.2k-9.el7.x86_64", Advisory: "RHBA-2018:0010", Type: genericStorage.BugfixAdvisory, Installed: "openssl-1:1.0.2k-8.el7.x86_64", Issued: "2018-01-09"},
+			{Package: "tzdata-2018c-1.el7.noarch", Advisory: "RHEA-2018:0020", Type: genericStorage.EnhancementAdvisory},
+			{Severity: genericStorage.LowSec, Package: "bash-4.2.46-30.el7.x86_64", Advisory: "RHSA-2018:0100", Type: genericStorage.SecurityAdvisory, Installed: "bash-4.2.46-29.el7.x86_64"},
+			{CVEID: "CVE-2017-9999", Severity: genericStorage.ModerateSec, Package: "glibc-2.17-196.el7_4.2.x86_64", Type: genericStorage.SecurityAdvisory, Installed: "glibc-2.17-196.el7.x86_64"},
+		}},
+		{"dnf4", dnf4ScanOutput, []genericStorage.SecurityUpdate{
+			{CVEID: "CVE-2023-0286", Severity: genericStorage.ImportantSec, Package: "openssl-1:1.1.1k-9.el8_7.x86_64", Advisory: "RHSA-2023:1405", Type: genericStorage.SecurityAdvisory, Installed: "openssl-1:1.1.1k-7.el8_6.x86_64", Issued: "2023-03-22"},
+			{CVEID: "CVE-2023-0286", Severity: genericStorage.ImportantSec, Package: "openssl-libs-1:1.1.1k-9.el8_7.x86_64", Advisory: "RHSA-2023:1405", Type: genericStorage.SecurityAdvisory, Installed: "openssl-libs-1:1.1.1k-7.el8_6.x86_64", Issued: "2023-03-22"},
+			{Package: "systemd-239-68.el8_7.4.x86_64", Advisory: "RHBA-2023:1500", Type: genericStorage.BugfixAdvisory, Installed: "systemd-239-68.el8_7.2.x86_64", Issued: "2023-03-28"},
+		}},
+		{"dnf5", dnf5ScanOutput, []genericStorage.SecurityUpdate{
+			{CVEID: "CVE-2024-0727", Severity: genericStorage.CriticalSec, Package: "openssl-1:3.2.1-2.fc40.x86_64", Advisory: "FEDORA-2024-1a2b3c", Type: genericStorage.SecurityAdvisory, Installed: "openssl-1:3.2.0-1.fc40.x86_64", Issued: "2024-03-01"},
+			{CVEID: "CVE-2024-2511", Severity: genericStorage.CriticalSec, Package: "openssl-1:3.2.1-2.fc40.x86_64", Advisory: "FEDORA-2024-1a2b3c", Type: genericStorage.SecurityAdvisory, Installed: "openssl-1:3.2.0-1.fc40.x86_64", Issued: "2024-03-01"},
+			{Package: "vim-minimal-2:9.1.113-1.fc40.x86_64", Advisory: "FEDORA-2024-4d5e6f", Type: genericStorage.BugfixAdvisory, Installed: "vim-minimal-2:9.1.095-1.fc40.x86_64", Issued: "2024-03-02"},
+		}},
+	}
+	for _, c := range cases {
+		got, err := parseRPMScan([]byte(c.dAtA))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", c.name, c.expect, got)
+		}
+	}
+	// Security advisories without severity are listed by yum with the bare type.
+	got, err := parseRPMScan([]byte(`@@advisories
+RHSA-2019:0001 security bind-9.9.4-73.el7_6.x86_64
+FEDORA-EPEL-2019-1 security nginx-1.12.2-3.el7.x86_64
+@@cves
+CVE-2018-5743 security bind-9.9.4-73.el7_6.x86_64
+@@issued
+@@installed
+`))
+	expect := []genericStorage.SecurityUpdate{
+		{CVEID: "CVE-2018-5743", Package: "bind-9.9.4-73.el7_6.x86_64", Advisory: "RHSA-2019:0001", Type: genericStorage.SecurityAdvisory},
+		{Package: "nginx-1.12.2-3.el7.x86_64", Advisory: "FEDORA-EPEL-2019-1", Type: genericStorage.SecurityAdvisory},
+	}
+	if err != nil || !reflect.DeepEqual(got, expect) {
+		t.Errorf("Without severity: expected\n%+v\ngot\n%+v (%v)", expect, got, err)
+	}
+	if _, err := parseRPMScan([]byte("@@advisories\n[{\"name\": 1}]\n")); err == nil {
+		t.Error("Expected an error on malformed JSON output")
+	}
+}
+
+// aptScanOutput is the output of aptScanner.Command on Ubuntu 20.04.
+const aptScanOutput = `NOTE: This is only a simulation!
+      apt-get needs root privileges for real execution.
+Reading package lists...
+Building dependency tree...
+Calculating upgrade...
+The following packages will be upgraded:
+  libssl1.1 tzdata vim
+3 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.
+Inst libssl1.1 [1.1.1f-1ubuntu2.19] (1.1.1f-1ubuntu2.20 Ubuntu:20.04/focal-updates, Ubuntu:20.04/focal-security [amd64])
+Inst vim [2:8.1.2269-1ubuntu5.20] (2:8.1.2269-1ubuntu5.21 Ubuntu:20.04/focal-updates [amd64])
+Inst tzdata (2024a-0ubuntu0.20.04 Ubuntu:20.04/focal-security [all])
+Conf libssl1.1 (1.1.1f-1ubuntu2.20 Ubuntu:20.04/focal-updates, Ubuntu:20.04/focal-security [amd64])
+Conf vim (2:8.1.2269-1ubuntu5.21 Ubuntu:20.04/focal-updates [amd64])
+Conf tzdata (2024a-0ubuntu0.20.04 Ubuntu:20.04/focal-security [all])
+`
+
+func TestAptScannerParse(t *testing.T) {
+	got, err := aptScanner{}.Parse([]byte(aptScanOutput))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := []genericStorage.SecurityUpdate{
+		{Package: "libssl1.1_1.1.1f-1ubuntu2.20_amd64", Type: genericStorage.SecurityAdvisory, Installed: "libssl1.1_1.1.1f-1ubuntu2.19_amd64"},
+		{Package: "tzdata_2024a-0ubuntu0.20.04_all", Type: genericStorage.SecurityAdvisory},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected\n%+v\ngot\n%+v", expect, got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":                                  "''",
+		"kernel-3.10.0-693.11.6.el7.x86_64": "'kernel-3.10.0-693.11.6.el7.x86_64'",
+		"it's":                              `'it'\''s'`,
+		"a; rm -rf /":                       "'a; rm -rf /'",
+		"''":                                `''\'''\'''`,
+	}
+	for s, expect := range cases {
+		if got := shellQuote(s); got != expect {
+			t.Errorf("%q: expected %s, got %s", s, expect, got)
+		}
+	}
+}
+
+func TestValidPackage(t *testing.T) {
+	cases := map[string]bool{
+		"":                                    false,
+		"1:openssl-1.0.2k-9.el7.x86_64":       true,
+		"libstdc++-8.5.0-18.el8.x86_64":       true,
+		"libssl1.1_1.1.1f-1ubuntu2.20_amd64":  true,
+		"vim_2:8.1.2269-1ubuntu5~20.04_amd64": true,
+		"rust-1.75.0^20231228-1.fc40.x86_64":  true,
+		"kernel-3.10.0 'x'":                   false,
+		"a$(reboot)":                          false,
+		"a`reboot`":                           false,
+		`a";reboot;"`:                         false,
+		"a\nreboot":                           false,
+	}
+	for s, expect := range cases {
+		if got := validPackage(s); got != expect {
+			t.Errorf("%q: expected %v, got %v", s, expect, got)
+		}
+	}
+}
+
+var rpmUpdates = []genericStorage.SecurityUpdate{
+	{CVEID: "CVE-2017-5715", Package: "kernel-3.10.0-693.11.6.el7.x86_64", Type: genericStorage.SecurityAdvisory, Installed: "kernel-3.10.0-693.el7.x86_64"},
+	{Package: "1:openssl-1.0.2k-9.el7.x86_64", Type: genericStorage.BugfixAdvisory, Installed: "openssl-1:1.0.2k-8.el7.x86_64"},
+	{CVEID: "CVE-2014-6271", Package: "bash-4.2.46-30.el7.x86_64", Type: genericStorage.SecurityAdvisory, Installed: "bash-4.2.46-29.el7.x86_64"},
+}
+
+func TestRPMUpdateCommand(t *testing.T) {
+	query := `(rpm -q --qf '%{NAME}.%{ARCH} %{NAME}-%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}.%{ARCH}\n' 'kernel.x86_64' 'openssl.x86_64' 2>/dev/null || true)`
+	cases := []struct {
+		updater Updater
+		expect  string
+	}{
+		{yumScanner{}, "echo @@update ; (yum -y -q update-to 'kernel-3.10.0-693.11.6.el7.x86_64' '1:openssl-1.0.2k-9.el7.x86_64' 2>&1 && echo @@succeeded || echo @@failed) ; echo @@installed ; " + query},
+		{dnfScanner{}, "echo @@update ; (dnf -y -q upgrade 'kernel-3.10.0-693.11.6.el7.x86_64' '1:openssl-1.0.2k-9.el7.x86_64' 2>&1 && echo @@succeeded || echo @@failed) ; echo @@installed ; " + query},
+	}
+	updates := append(rpmUpdates[:2:2], genericStorage.SecurityUpdate{Package: "evil-1.0-1.x86_64$(reboot)"})
+	for _, c := range cases {
+		if got := c.updater.UpdateCommand(updates); got != c.expect {
+			t.Errorf("%T: expected\n%s\ngot\n%s", c.updater, c.expect, got)
+		}
+	}
+}
+
+func TestParseRPMUpdate(t *testing.T) {
+	cases := []struct {
+		name   string
+		dAtA   string
+		expect []genericStorage.State
+		err    string
+	}{
+		{
+			name: "Succeeded",
+			dAtA: `@@update
+@@succeeded
+@@installed
+kernel.x86_64 kernel-3.10.0-693.11.6.el7.x86_64
+kernel.x86_64 kernel-3.10.0-693.el7.x86_64
+openssl.x86_64 openssl-1:1.0.2k-9.el7.x86_64
+bash.x86_64 bash-4.2.46-31.el7.x86_64
+`,
+			// Bash was upgraded to a newer version published meanwhile.
+			expect: []genericStorage.State{genericStorage.SuccessState, genericStorage.SuccessState, genericStorage.SuccessState},
+		},
+		{
+			name: "Failed",
+			dAtA: `@@update
+Error: Package: bash-4.2.46-30.el7.x86_64 (updates)
+Error: Nothing to do
+@@failed
+@@installed
+kernel.x86_64 kernel-3.10.0-693.el7.x86_64
+openssl.x86_64 openssl-1:1.0.2k-9.el7.x86_64
+bash.x86_64 bash-4.2.46-29.el7.x86_64
+`,
+			expect: []genericStorage.State{genericStorage.FailureState, genericStorage.SuccessState, genericStorage.FailureState},
+			err:    "Installation failed: Error: Nothing to do",
+		},
+		{
+			name:   "NothingInstalled",
+			dAtA:   "@@update\n@@failed\n@@installed\n",
+			expect: []genericStorage.State{genericStorage.FailureState, genericStorage.FailureState, genericStorage.FailureState},
+			err:    "Installation failed",
+		},
+	}
+	for _, c := range cases {
+		got, err := parseRPMUpdate([]byte(c.dAtA), rpmUpdates)
+		if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+		if len(got) != len(c.expect) {
+			t.Errorf("%s: expected %d results, got %+v", c.name, len(c.expect), got)
+			continue
+		}
+		for i, each := range got {
+			if each.State != c.expect[i] || each.Package != rpmUpdates[i].Package || each.Previous != rpmUpdates[i].Installed {
+				t.Errorf("%s: unexpected result of %s: %+v", c.name, rpmUpdates[i].Package, each)
+			}
+		}
+	}
+}
+
+func TestPackageResult(t *testing.T) {
+	update := genericStorage.SecurityUpdate{Package: "1:openssl-1.0.2k-9.el7.x86_64", Installed: "openssl-1:1.0.2k-8.el7.x86_64"}
+	expected := "openssl-1:1.0.2k-9.el7.x86_64"
+	cases := map[string]genericStorage.State{
+		"openssl-1:1.0.2k-9.el7.x86_64":                                genericStorage.SuccessState,
+		"openssl-1:1.0.2k-8.el7.x86_64, openssl-1:1.0.2k-9.el7.x86_64": genericStorage.SuccessState,
+		"openssl-1:1.0.2k-10.el7.x86_64":                               genericStorage.SuccessState,
+		"openssl-1:1.0.2k-8.el7.x86_64":                                genericStorage.FailureState,
+		"":                                                             genericStorage.FailureState,
+	}
+	for installed, expect := range cases {
+		got := packageResult(update, expected, installed)
+		if got.State != expect || got.Installed != installed || got.Previous != update.Installed || got.Package != update.Package {
+			t.Errorf("%q: expected %s, got %+v", installed, expect, got)
+		}
+	}
+}
+
+func TestAptUpdate(t *testing.T) {
+	updates := []genericStorage.SecurityUpdate{
+		{Package: "libssl1.1_1.1.1f-1ubuntu2.20_amd64", Type: genericStorage.SecurityAdvisory, Installed: "libssl1.1_1.1.1f-1ubuntu2.19_amd64"},
+		{Package: "tzdata_2024a-0ubuntu0.20.04_all", Type: genericStorage.SecurityAdvisory, Installed: "tzdata_2023c-0ubuntu0.20.04.2_all"},
+		{Package: "libc6_2.31-0ubuntu9.14_amd64", Type: genericStorage.SecurityAdvisory, Installed: "libc6_2.31-0ubuntu9.12_amd64"},
+	}
+	expect := "echo @@update ; (DEBIAN_FRONTEND=noninteractive apt-get -y -q -o Dpkg::Options::=--force-confold install --only-upgrade " +
+		"'libssl1.1:amd64=1.1.1f-1ubuntu2.20' 'tzdata:all=2024a-0ubuntu0.20.04' 'libc6:amd64=2.31-0ubuntu9.14' 2>&1 && echo @@succeeded || echo @@failed) ; " +
+		"echo @@installed ; (dpkg-query -W 'libssl1.1:amd64' 'tzdata:all' 'libc6:amd64' 2>/dev/null || true)"
+	if got := (aptScanner{}).UpdateCommand(updates); got != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, got)
+	}
+	got, err := aptScanner{}.ParseUpdate([]byte("@@update\nSetting up libssl1.1:amd64 (1.1.1f-1ubuntu2.20) ...\n@@succeeded\n@@installed\nlibssl1.1:amd64\t1.1.1f-1ubuntu2.20\ntzdata\t2024a-0ubuntu0.20.04\nlibc6:amd64\t2.31-0ubuntu9.12\n"), updates)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	states := []genericStorage.State{genericStorage.SuccessState, genericStorage.SuccessState, genericStorage.FailureState}
+	installed := []string{"libssl1.1_1.1.1f-1ubuntu2.20_amd64", "tzdata_2024a-0ubuntu0.20.04_all", "libc6_2.31-0ubuntu9.12_amd64"}
+	if len(got) != len(states) {
+		t.Fatalf("Expected %d results, got %+v", len(states), got)
+	}
+	for i, each := range got {
+		if each.State != states[i] || each.Installed != installed[i] || each.Previous != updates[i].Installed {
+			t.Errorf("Unexpected result of %s: %+v", updates[i].Package, each)
+		}
+	}
+}
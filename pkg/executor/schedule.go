@@ -0,0 +1,198 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// schedulePollInterval is the interval of checking the schedules of hosts, and the update
+// jobs waiting for maintenance windows.
+const schedulePollInterval = time.Minute
+
+// listSchedules returns all schedules.
+func (in *Handler) listSchedules() (*genericStorage.ScheduleList, error) {
+	list := genericStorage.NewScheduleList()
+	err := in.storage.ListContext(in.ctx, list)
+	return list, err
+}
+
+// scanScheduleOf returns the first schedule which defines when to scan, or nil if hosts are
+// scanned by the global schedule.
+func scanScheduleOf(schedules []genericStorage.Schedule) *genericStorage.Schedule {
+	for i := range schedules {
+		if schedules[i].Scan != "" {
+			return &schedules[i]
+		}
+	}
+	return nil
+}
+
+// blockedReason returns why host could not be touched at t, or an empty string if it could.
+// The maintenance windows of the first schedule which defines them apply, while blackouts of
+// all schedules apply. Hosts could be scanned outside maintenance windows if update is false.
+func blockedReason(host *genericStorage.Host, schedules []genericStorage.Schedule, t time.Time, update bool) string {
+	for _, each := range schedules {
+		if blackout := each.BlackoutAt(t); blackout != nil {
+			reason := fmt.Sprintf("host '%s' is in blackout of schedule '%s' until %s", host.GetName(), each.GetName(), blackout.End.Format(time.RFC3339))
+			if blackout.Reason != "" {
+				reason += " (" + blackout.Reason + ")"
+			}
+			return reason
+		}
+	}
+	if !update {
+		return ""
+	}
+	for _, each := range schedules {
+		if len(each.Windows) == 0 {
+			continue
+		}
+		if !each.InWindow(t) {
+			return fmt.Sprintf("host '%s' is out of maintenance windows of schedule '%s'", host.GetName(), each.GetName())
+		}
+		break
+	}
+	return ""
+}
+
+// scanHosts scans those hosts selected by fn, which is given the schedules of each host.
+func (in *Handler) scanHosts(fn func(host *genericStorage.Host, schedules []genericStorage.Schedule) bool) {
+	defer in.logger.Sync()
+	schedules, err := in.listSchedules()
+	if err != nil {
+		in.logger.Errorf("Could not retrieve schedule list from storage due to: %v", err)
+		return
+	}
+	list := genericStorage.NewHostList()
+	err = in.storage.ListContext(in.ctx, list)
+	if err != nil {
+		in.logger.Errorf("Could not retrieve host list from storage due to: %v", err)
+		return
+	}
+	for i := range list.Members {
+		if fn(&list.Members[i], schedules.Of(&list.Members[i])) {
+			in.sendJob(&list.Members[i], false)
+		}
+	}
+}
+
+// ScanScheduledHosts scans those hosts whose own schedules have been due since last, unless
+// they are in blackouts.
+func (in *Handler) ScanScheduledHosts(last, now time.Time) {
+	in.scanHosts(func(host *genericStorage.Host, schedules []genericStorage.Schedule) bool {
+		schedule := scanScheduleOf(schedules)
+		if schedule == nil || !schedule.ScanDue(last, now) {
+			return false
+		}
+		if reason := blockedReason(host, schedules, now, false); reason != "" {
+			in.logger.Infof("Skip scheduled scan as %s", reason)
+			return false
+		}
+		return true
+	})
+}
+
+// pendingBatch returns the hosts of update job to be updated by the next batch.
+func pendingBatch(job *genericStorage.UpdateJob) ([]string, error) {
+	handled := make(map[string]bool)
+	for _, each := range job.Results {
+		handled[each.Host] = true
+	}
+	var pending []string
+	for _, each := range job.Hosts {
+		if !handled[each] {
+			pending = append(pending, each)
+		}
+	}
+	size, err := job.Rollout.BatchSizeOf(len(job.Hosts))
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > size {
+		pending = pending[:size]
+	}
+	return pending, nil
+}
+
+// batchBlockedReason returns why hosts of a batch could not be updated now, or an empty
+// string if all of them could. Hosts which do not exist are not blocked, as they are
+// reported as failed by the update.
+func (in *Handler) batchBlockedReason(batch []string) (string, error) {
+	schedules, err := in.listSchedules()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	for _, name := range batch {
+		host := genericStorage.NewHost()
+		host.SetName(name)
+		err = in.storage.GetContext(in.ctx, host)
+		if genericStorage.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if reason := blockedReason(host, schedules.Of(host), now, true); reason != "" {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+// ResumeWaitingJobs resumes those update jobs waiting for maintenance windows, whose hosts of
+// the next batch could be updated now. Jobs left in progress without being rolled out, e.g. as
+// their progress could not be saved, are paused as well.
+func (in *Handler) ResumeWaitingJobs() {
+	defer in.logger.Sync()
+	list := genericStorage.NewUpdateJobList()
+	err := in.storage.ListContext(in.ctx, list)
+	if err != nil {
+		in.logger.Errorf("Could not retrieve update job list from storage due to: %v", err)
+		return
+	}
+	for i := range list.Members {
+		job := &list.Members[i]
+		if job.State == genericStorage.InProgressState && !in.rollingOut(job.GetName()) {
+			in.pauseInterruptedJob(job, "interrupted")
+			continue
+		}
+		if job.State != genericStorage.WaitingState {
+			continue
+		}
+		batch, err := pendingBatch(job)
+		if err != nil {
+			continue
+		}
+		reason, err := in.batchBlockedReason(batch)
+		if err != nil {
+			in.logger.Errorf("Could not check schedules of update job '%s' due to: %v", job.GetName(), err)
+			continue
+		}
+		if reason != "" {
+			continue
+		}
+		// The job is performed once it has been updated, unless it has been aborted since.
+		job.State = genericStorage.StartedState
+		job.Reason = ""
+		if err = in.storage.UpdateContext(in.ctx, job); err != nil {
+			in.logger.Errorf("Could not resume update job '%s' due to: %v", job.GetName(), err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// saturday is 2018-06-02 00:00:00 UTC, which is a Saturday.
+var saturday = time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC)
+
+func newTestSchedule(name string, windows []genericStorage.MaintenanceWindow, blackouts ...genericStorage.Blackout) genericStorage.Schedule {
+	schedule := genericStorage.NewSchedule()
+	schedule.SetName(name)
+	schedule.Hosts = []string{"web-1"}
+	schedule.Windows = windows
+	schedule.Blackouts = blackouts
+	return *schedule
+}
+
+func newTestBlackout(start, end time.Time, reason string) genericStorage.Blackout {
+	var blackout genericStorage.Blackout
+	blackout.Start.Time, blackout.End.Time = start, end
+	blackout.Reason = reason
+	return blackout
+}
+
+func TestBlockedReason(t *testing.T) {
+	host := genericStorage.NewHost()
+	host.SetName("web-1")
+	nightly := []genericStorage.MaintenanceWindow{{Start: "0 0 2 * * *", Duration: "2h"}}
+	weekly := []genericStorage.MaintenanceWindow{{Start: "0 0 10 * * SAT", Duration: "2h"}}
+	// The schedules overlap, as all of them apply to the host.
+	schedules := []genericStorage.Schedule{
+		newTestSchedule("a-scan", nil),
+		newTestSchedule("b-nightly", nightly, newTestBlackout(saturday.Add(3*time.Hour), saturday.Add(4*time.Hour), "")),
+		newTestSchedule("c-weekly", weekly, newTestBlackout(saturday.Add(11*time.Hour), saturday.Add(12*time.Hour), "freeze")),
+	}
+	cases := []struct {
+		name   string
+		t      time.Time
+		update bool
+		expect string
+	}{
+		{"WindowStart", saturday.Add(2 * time.Hour), true, ""},
+		{"BeforeWindow", saturday.Add(2*time.Hour - time.Second), true, "out of maintenance windows of schedule 'b-nightly'"},
+		{"WindowEnd", saturday.Add(4 * time.Hour), true, "out of maintenance windows of schedule 'b-nightly'"},
+		{"BlackoutStart", saturday.Add(3 * time.Hour), true, "in blackout of schedule 'b-nightly' until 2018-06-02T04:00:00Z"},
+		// Only the windows of the first schedule defining them apply.
+		{"LaterWindow", saturday.Add(10 * time.Hour), true, "out of maintenance windows of schedule 'b-nightly'"},
+		// Blackouts of all schedules apply.
+		{"LaterBlackout", saturday.Add(11 * time.Hour), false, "in blackout of schedule 'c-weekly' until 2018-06-02T12:00:00Z (freeze)"},
+		{"BlackoutEnd", saturday.Add(12 * time.Hour), false, ""},
+		// Hosts could be scanned outside maintenance windows.
+		{"Scan", saturday.Add(2*time.Hour - time.Second), false, ""},
+	}
+	for _, c := range cases {
+		got := blockedReason(host, schedules, c.t, c.update)
+		if c.expect == "" && got != "" || !strings.HasSuffix(got, c.expect) {
+			t.Errorf("%s: expected reason ending with %q, got %q", c.name, c.expect, got)
+		}
+	}
+	if got := blockedReason(host, nil, saturday, true); got != "" {
+		t.Errorf("Expected hosts without schedules never to be blocked, got %q", got)
+	}
+}
+
+func TestPendingBatch(t *testing.T) {
+	hosts := []string{"web-1", "web-2", "web-3", "web-4", "web-5"}
+	handled := func(names ...string) (results []genericStorage.HostUpdateResult) {
+		for _, each := range names {
+			results = append(results, genericStorage.HostUpdateResult{Host: each})
+		}
+		return results
+	}
+	cases := []struct {
+		name    string
+		size    string
+		results []genericStorage.HostUpdateResult
+		expect  []string
+	}{
+		{"Default", "", nil, []string{"web-1"}},
+		{"All", "100%", nil, hosts},
+		{"First", "2", nil, []string{"web-1", "web-2"}},
+		{"Next", "2", handled("web-1", "web-2"), []string{"web-3", "web-4"}},
+		{"Last", "40%", handled("web-1", "web-2", "web-3", "web-4"), []string{"web-5"}},
+		{"Unordered", "2", handled("web-2", "web-4"), []string{"web-1", "web-3"}},
+		{"Done", "2", handled(hosts...), nil},
+	}
+	for _, c := range cases {
+		job := genericStorage.NewUpdateJob()
+		job.Hosts = hosts
+		job.Rollout.BatchSize = c.size
+		job.Results = c.results
+		got, err := pendingBatch(job)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expect, got)
+		}
+	}
+	job := genericStorage.NewUpdateJob()
+	job.Hosts = hosts
+	job.Rollout.BatchSize = "-1"
+	if _, err := pendingBatch(job); err == nil {
+		t.Error("Expected an error on invalid batch size")
+	}
+}
@@ -15,10 +15,12 @@
 package executor
 
 import (
+	"context"
 	"time"
 
 	cron "github.com/robfig/cron"
 	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 	zap "go.uber.org/zap"
 )
 
@@ -31,17 +33,22 @@ type Server struct {
 	clzSubCh     []chan struct{}
 	sche         cron.Schedule
 	workers      int
-	hostObserver genericStorage.Watcher
-	scanObserver genericStorage.Watcher
-	opObserver   genericStorage.Watcher
+	retention    *Retention
+	feeds        *Feeds
+	hostObserver *subscription
+	scanObserver *subscription
+	opObserver   *subscription
+	jobObserver  *subscription
 	storage      genericStorage.Storage
+	logger       *zap.SugaredLogger
 	Handler      *Handler
 }
 
 // Prepare initialize inner storage and logger for server
-func (in *Server) Prepare(storage genericStorage.Storage, logger *zap.SugaredLogger) {
+func (in *Server) Prepare(storage genericStorage.Storage, kr *keyring.Keyring, logger *zap.SugaredLogger) {
 	in.storage = storage
-	in.Handler = NewHandler(storage, logger, in.workers)
+	in.logger = logger
+	in.Handler = NewHandler(storage, kr, logger, in.workers, in.retention, in.feeds)
 }
 
 // Subscribe attach an external channel to be used for callback function when server exited.
@@ -59,21 +66,33 @@ func (in *Server) Serve() (err error) {
 		}
 		in.clzSubCh = in.clzSubCh[:0]
 	}()
-	in.hostObserver, err = in.storage.Watch(genericStorage.NewHost(), genericStorage.WatchOnKind)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Credentials are sealed before hosts are watched, so that the updates would not be
+	// handled as changes of hosts.
+	in.Handler.SealCredentials()
+	// Objects are listed and handled before watching, so that those changes which were
+	// made while we were not running would not be missed.
+	in.hostObserver, err = newSubscription(ctx, in.storage, genericStorage.NewHost(), in.Handler.ResyncHosts, in.logger)
 	if err != nil {
 		return
 	}
-	in.scanObserver, err = in.storage.Watch(genericStorage.NewSystemScan(), genericStorage.WatchOnKind)
+	defer in.hostObserver.Close()
+	in.scanObserver, err = newSubscription(ctx, in.storage, genericStorage.NewSystemScan(), in.Handler.ResyncScans, in.logger)
 	if err != nil {
 		return
 	}
-	in.opObserver, err = in.storage.Watch(genericStorage.NewHostOperation(), genericStorage.WatchOnKind)
+	defer in.scanObserver.Close()
+	in.opObserver, err = newSubscription(ctx, in.storage, genericStorage.NewHostOperation(), in.Handler.ResyncOps, in.logger)
 	if err != nil {
 		return
 	}
-	hostEventChan := in.hostObserver.Output()
-	scanEventChan := in.scanObserver.Output()
-	opEventChan := in.opObserver.Output()
+	defer in.opObserver.Close()
+	in.jobObserver, err = newSubscription(ctx, in.storage, genericStorage.NewUpdateJob(), in.Handler.ResyncUpdateJobs, in.logger)
+	if err != nil {
+		return
+	}
+	defer in.jobObserver.Close()
 	var (
 		revalidate bool
 		timer      *time.Timer
@@ -84,31 +103,63 @@ func (in *Server) Serve() (err error) {
 	} else {
 		timer = time.NewTimer(sche.Sub(time.Now()))
 	}
+	// Operations are swept periodically according to retention policies.
+	var sweep <-chan time.Time
+	if in.retention != nil {
+		ticker := time.NewTicker(in.retention.Interval)
+		defer ticker.Stop()
+		sweep = ticker.C
+		go in.Handler.EnforceRetention()
+	}
+	// Feeds are reloaded if they have changed, and are correlated with all hosts periodically.
+	var correlate <-chan time.Time
+	if in.feeds != nil {
+		ticker := time.NewTicker(in.feeds.Interval)
+		defer ticker.Stop()
+		correlate = ticker.C
+		go in.Handler.CorrelateFeeds()
+	}
+	// Schedules of hosts are checked periodically, and so are the update jobs waiting for
+	// maintenance windows.
+	poll := time.NewTicker(schedulePollInterval)
+	defer poll.Stop()
+	lastPoll := time.Now()
 LOOP:
 	for {
 		select {
-		case event := <-hostEventChan:
+		case event, ok := <-in.hostObserver.Output():
+			if !in.hostObserver.Accept(event, ok, in.closeCh) {
+				continue
+			}
 			switch event.Type {
 			case genericStorage.CREATE, genericStorage.UPDATE:
 				go in.Handler.HandleHostEvent(event)
 			case genericStorage.DELETE:
 				go in.Handler.HandleHostCleanupEvent(event)
-			case genericStorage.ERROR:
-				break LOOP
 			}
-		case event := <-scanEventChan:
+		case event, ok := <-in.scanObserver.Output():
+			if !in.scanObserver.Accept(event, ok, in.closeCh) {
+				continue
+			}
 			switch event.Type {
 			case genericStorage.CREATE, genericStorage.UPDATE:
 				go in.Handler.HandleScanEvent(event)
-			case genericStorage.ERROR:
-				break LOOP
 			}
-		case event := <-opEventChan:
+		case event, ok := <-in.opObserver.Output():
+			if !in.opObserver.Accept(event, ok, in.closeCh) {
+				continue
+			}
 			switch event.Type {
 			case genericStorage.CREATE:
 				go in.Handler.HandleOpEvent(event)
-			case genericStorage.ERROR:
-				break LOOP
+			}
+		case event, ok := <-in.jobObserver.Output():
+			if !in.jobObserver.Accept(event, ok, in.closeCh) {
+				continue
+			}
+			switch event.Type {
+			case genericStorage.CREATE, genericStorage.UPDATE:
+				go in.Handler.HandleUpdateJobEvent(event)
 			}
 		case <-timer.C:
 			if sche := in.sche.Next(time.Now()); sche.IsZero() {
@@ -121,14 +172,24 @@ LOOP:
 			if !revalidate {
 				go in.Handler.ScanAllHost()
 			}
+		case <-sweep:
+			go in.Handler.EnforceRetention()
+		case <-correlate:
+			go in.Handler.CorrelateFeeds()
+		case now := <-poll.C:
+			go in.Handler.ScanScheduledHosts(lastPoll, now)
+			go in.Handler.ResumeWaitingJobs()
+			lastPoll = now
 		case <-in.closeCh:
 			break LOOP
 		}
 	}
 
 	timer.Stop()
-	in.hostObserver.Close()
-	in.opObserver.Close()
+	// Jobs in progress are given a chance to finish, and the rest of them are cancelled.
+	if err := in.Handler.Close(); err != nil {
+		in.logger.Warnf("Jobs in progress were cancelled during shutdown: %v", err)
+	}
 	return nil
 }
 
@@ -138,14 +199,16 @@ func (in *Server) Stop() {
 }
 
 // NewServer returns an empty scheduler server
-func NewServer(exp string, workers int) (*Server, error) {
+func NewServer(exp string, workers int, retention *Retention, feeds *Feeds) (*Server, error) {
 	sche, err := cron.Parse(exp)
 	if err != nil {
 		return nil, err
 	}
 	return &Server{
-		closeCh: make(chan struct{}, 1),
-		sche:    sche,
-		workers: workers,
+		closeCh:   make(chan struct{}, 1),
+		sche:      sche,
+		workers:   workers,
+		retention: retention,
+		feeds:     feeds,
 	}, nil
 }
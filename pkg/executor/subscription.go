@@ -0,0 +1,141 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+const (
+	// DefaultRetryInterval is the initial interval to wait before renewing a broken watcher.
+	DefaultRetryInterval = 500 * time.Millisecond
+	// MaxRetryInterval is the maximum interval to wait before renewing a broken watcher.
+	MaxRetryInterval = 30 * time.Second
+)
+
+// subscription keeps watching on a kind of object with the list-then-watch pattern.
+// It tracks the latest revision that it has seen, so that a broken watcher could be
+// renewed from there, and objects will be listed again through resync whenever events
+// have been lost.
+type subscription struct {
+	ctx     context.Context
+	cv      genericStorage.Object
+	resync  func() (string, error)
+	storage genericStorage.Storage
+	watcher genericStorage.Watcher
+	logger  *zap.SugaredLogger
+}
+
+// Output returns the event channel of the current watcher. Note that it changes once
+// the watcher has been renewed.
+func (in *subscription) Output() <-chan genericStorage.WatchEvent {
+	return in.watcher.Output()
+}
+
+// Accept inspects an event received from Output, and returns true if it should be
+// handled by caller. Broken watchers are renewed, and lost events are recovered by
+// resync, both of which will be taken care of here.
+func (in *subscription) Accept(event genericStorage.WatchEvent, ok bool, stop <-chan struct{}) bool {
+	defer in.logger.Sync()
+	switch {
+	case !ok:
+		in.logger.Warnf("Watcher on %s was closed unexpectedly.", in.cv.GetKind())
+		in.renew(stop)
+		return false
+	case event.Type == genericStorage.ERROR:
+		in.logger.Warnf("Watcher on %s was broken due to: %s", in.cv.GetKind(), event.Value)
+		in.renew(stop)
+		return false
+	case event.Type == genericStorage.RESYNC:
+		in.logger.Warnf("Events on %s might have been lost, resync is required: %s", in.cv.GetKind(), event.Value)
+		if _, err := in.resync(); err != nil {
+			in.logger.Errorf("Could not resync %s due to: %v", in.cv.GetKind(), err)
+		}
+		return false
+	}
+	in.track(event)
+	return true
+}
+
+// Close stops the current watcher.
+func (in *subscription) Close() error {
+	return in.watcher.Close()
+}
+
+// track records the resource version carried by event.
+func (in *subscription) track(event genericStorage.WatchEvent) {
+	meta := new(struct {
+		genericStorage.ObjectMeta `json:"metadata,omitempty"`
+	})
+	if err := json.Unmarshal(event.Value, meta); err != nil {
+		return
+	}
+	if version := meta.GetResourceVersion(); version != "" {
+		in.cv.SetResourceVersion(version)
+	}
+}
+
+// renew closes the broken watcher and re-establishes it from the latest revision that
+// has been seen. It keeps retrying until succeeded or stop is closed.
+func (in *subscription) renew(stop <-chan struct{}) {
+	in.watcher.Close()
+	interval := DefaultRetryInterval
+	for {
+		w, err := in.storage.WatchContext(in.ctx, in.cv, genericStorage.WatchOnKind)
+		if err == nil {
+			in.watcher = w
+			in.logger.Infof("Watcher on %s has been renewed from version %s.", in.cv.GetKind(), in.cv.GetResourceVersion())
+			return
+		}
+		in.logger.Errorf("Could not renew watcher on %s, retry in %v due to: %v", in.cv.GetKind(), interval, err)
+		in.logger.Sync()
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+		if interval *= 2; interval > MaxRetryInterval {
+			interval = MaxRetryInterval
+		}
+	}
+}
+
+// newSubscription resyncs objects of the same kind as cv first, and then starts watching
+// on them right after the version of resync, so that no event will be missed. Watchers
+// are stopped once the context is done.
+func newSubscription(ctx context.Context, storage genericStorage.Storage, cv genericStorage.Object, resync func() (string, error), logger *zap.SugaredLogger) (*subscription, error) {
+	version, err := resync()
+	if err != nil {
+		return nil, err
+	}
+	cv.SetResourceVersion(version)
+	w, err := storage.WatchContext(ctx, cv, genericStorage.WatchOnKind)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription{
+		ctx:     ctx,
+		cv:      cv,
+		resync:  resync,
+		storage: storage,
+		watcher: w,
+		logger:  logger,
+	}, nil
+}
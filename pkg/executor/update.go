@@ -0,0 +1,388 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// ResyncUpdateJobs handles all update jobs that are waiting to be performed. Jobs left in
+// progress without being rolled out by this handler were interrupted, e.g. by a restart, and
+// they are paused so that they could be resumed or aborted. It returns the version of update
+// job list.
+func (in *Handler) ResyncUpdateJobs() (string, error) {
+	defer in.logger.Sync()
+	list := genericStorage.NewUpdateJobList()
+	err := in.storage.ListContext(in.ctx, list)
+	if err != nil {
+		return "", err
+	}
+	for i := range list.Members {
+		switch job := &list.Members[i]; job.State {
+		case genericStorage.StartedState:
+			in.startRollout(job)
+		case genericStorage.InProgressState:
+			if !in.rollingOut(job.GetName()) {
+				in.pauseInterruptedJob(job, "interrupted by restart")
+			}
+		}
+	}
+	return list.GetResourceVersion(), nil
+}
+
+// rollingOut returns true if the update job is being rolled out by this handler.
+func (in *Handler) rollingOut(name string) bool {
+	in.lock.RLock()
+	defer in.lock.RUnlock()
+	return in.rollouts[name] > 0
+}
+
+// pauseInterruptedJob pauses an update job whose rollout was interrupted. Those hosts which
+// have been handled are skipped once it has been resumed.
+func (in *Handler) pauseInterruptedJob(job *genericStorage.UpdateJob, reason string) {
+	in.logger.Warnf("Update job '%s' is paused as its rollout was %s", job.GetName(), reason)
+	job.State = genericStorage.PausedState
+	job.Reason = reason
+	job.Stop = ""
+	// The update fails with a conflict if the job has been picked up since.
+	if err := in.storage.UpdateContext(in.ctx, job); err != nil {
+		in.logger.Errorf("Could not pause update job '%s' due to: %v", job.GetName(), err)
+	}
+}
+
+// saveJobAttempts is the number of attempts to save the progress of an update job.
+const saveJobAttempts = 5
+
+// saveJob saves the progress of an update job being rolled out. Users might have requested to
+// stop the job meanwhile, which is the only change made by others while it is in progress, and
+// the request is taken from the stored job on conflicts. Failed saves are retried, so that the
+// job would not be left in progress.
+func (in *Handler) saveJob(job *genericStorage.UpdateJob) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = in.storage.UpdateContext(in.ctx, job)
+		if err == nil || attempt == saveJobAttempts {
+			return err
+		}
+		if genericStorage.IsVersionConflict(err) {
+			stored := genericStorage.NewUpdateJob()
+			stored.SetName(job.GetName())
+			if err = in.storage.GetContext(in.ctx, stored); err == nil {
+				if stored.State != genericStorage.InProgressState {
+					return genericStorage.ErrResourceVersionConflict
+				}
+				job.SetResourceVersion(stored.GetResourceVersion())
+				if job.State == genericStorage.InProgressState || job.State == genericStorage.WaitingState {
+					job.Stop = stored.Stop
+				}
+				continue
+			}
+		}
+		in.logger.Warnf("Could not save update job '%s' in attempt %d due to: %v", job.GetName(), attempt, err)
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-in.ctx.Done():
+			return in.ctx.Err()
+		}
+	}
+}
+
+// stopJob takes the action requested by users on an update job in progress.
+func stopJob(job *genericStorage.UpdateJob) {
+	switch job.Stop {
+	case genericStorage.AbortRollout:
+		job.State = genericStorage.AbortState
+		job.Reason = "Aborted by user"
+		job.FinishedAt.Time = time.Now()
+	default:
+		job.State = genericStorage.PausedState
+		job.Reason = "Paused by user"
+	}
+	job.Stop = ""
+}
+
+// HandleUpdateJobEvent handles update job event.
+func (in *Handler) HandleUpdateJobEvent(event genericStorage.WatchEvent) {
+	defer in.logger.Sync()
+	job := genericStorage.NewUpdateJob()
+	err := event.Unmarshal(job)
+	if err != nil {
+		in.logger.Errorf("Received update job event seems to be invalid: %v", err)
+		return
+	}
+	in.startRollout(job)
+}
+
+// startRollout rolls out an update job in its own goroutine rather than by a worker, as it
+// waits for the operations performed by workers. Jobs are dropped once the handler has been
+// closed, and they will be picked up by resync on next start.
+func (in *Handler) startRollout(job *genericStorage.UpdateJob) {
+	if job.State != genericStorage.StartedState {
+		return
+	}
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	select {
+	case <-in.clzChan:
+		return
+	default:
+	}
+	in.wg.Add(1)
+	go func() {
+		defer in.wg.Done()
+		in.handleUpdateJob(job)
+	}()
+}
+
+// handleUpdateJob rolls out updates to hosts batch by batch. The job is saved once each batch
+// has been finished, so that the progress could be followed. It is paused or aborted if too
+// many hosts of a batch failed, and it waits if hosts of a batch are out of their maintenance
+// windows or in blackouts, and it is stopped between batches if users have requested so.
+// Those hosts which have been handled are skipped once it has been resumed.
+func (in *Handler) handleUpdateJob(job *genericStorage.UpdateJob) {
+	defer in.logger.Sync()
+
+	if job.State != genericStorage.StartedState {
+		return
+	}
+	handled := make(map[string]bool)
+	for _, each := range job.Results {
+		handled[each.Host] = true
+	}
+	var pending []string
+	for _, each := range job.Hosts {
+		if !handled[each] {
+			pending = append(pending, each)
+		}
+	}
+	size, err := job.Rollout.BatchSizeOf(len(job.Hosts))
+	if err != nil {
+		in.logger.Errorf("Abort to perform update job '%s' due to: %v", job.GetName(), err)
+		job.State = genericStorage.AbortState
+		job.Reason = err.Error()
+		job.FinishedAt.Time = time.Now()
+		if err = in.storage.UpdateContext(in.ctx, job); err != nil {
+			in.logger.Errorf("Could not save result of update job '%s' due to: %v", job.GetName(), err)
+		}
+		return
+	}
+	// The rollout is registered before the job is saved in progress, so that it is never
+	// considered interrupted by resync.
+	in.lock.Lock()
+	in.rollouts[job.GetName()]++
+	in.lock.Unlock()
+	defer func() {
+		in.lock.Lock()
+		if in.rollouts[job.GetName()]--; in.rollouts[job.GetName()] <= 0 {
+			delete(in.rollouts, job.GetName())
+		}
+		in.lock.Unlock()
+	}()
+	job.State = genericStorage.InProgressState
+	job.Reason = ""
+	job.Stop = ""
+	job.Batches = job.Batch + (len(pending)+size-1)/size
+	if job.StartedAt.IsZero() {
+		job.StartedAt.Time = time.Now()
+	}
+	// The job is left untouched on conflicts, as it has been changed by others since.
+	err = in.storage.UpdateContext(in.ctx, job)
+	if err != nil {
+		in.logger.Errorf("Abort to perform update job '%s' due to: %v", job.GetName(), err)
+		return
+	}
+
+	for len(pending) > 0 {
+		if job.Stop != "" {
+			in.logger.Infof("Update job '%s' is stopped by user before batch %d", job.GetName(), job.Batch+1)
+			stopJob(job)
+			break
+		}
+		batch := pending
+		if len(batch) > size {
+			batch = batch[:size]
+		}
+		// The job waits until all hosts of the batch could be touched, and it is resumed by
+		// ResumeWaitingJobs.
+		var reason string
+		reason, err = in.batchBlockedReason(batch)
+		if err != nil {
+			reason = fmt.Sprintf("schedules could not be checked due to: %v", err)
+		}
+		if reason != "" {
+			in.logger.Infof("Update job '%s' is waiting as %s", job.GetName(), reason)
+			job.State = genericStorage.WaitingState
+			job.Reason = reason
+			break
+		}
+		pending = pending[len(batch):]
+		job.Batch++
+
+		results := make([]genericStorage.HostUpdateResult, len(batch))
+		var wg sync.WaitGroup
+		wg.Add(len(batch))
+		for i := range batch {
+			go func(i int) {
+				defer wg.Done()
+				// Hosts of a batch are updated as long as there are free slots.
+				select {
+				case in.updateSlots <- struct{}{}:
+				case <-in.ctx.Done():
+					results[i] = genericStorage.HostUpdateResult{Host: batch[i], State: genericStorage.FailureState, Reason: in.ctx.Err().Error()}
+					return
+				}
+				defer func() { <-in.updateSlots }()
+				results[i] = in.updateHost(job, batch[i])
+			}(i)
+		}
+		wg.Wait()
+		var failed int
+		for i := range results {
+			results[i].Batch = job.Batch
+			if results[i].State != genericStorage.SuccessState {
+				failed++
+			}
+		}
+		job.Results = append(job.Results, results...)
+
+		// The policy has been validated on creation.
+		max, _ := job.Rollout.MaxFailuresOf(len(batch))
+		if failed > max && len(pending) > 0 {
+			job.Reason = fmt.Sprintf("%d of %d hosts failed in batch %d, which exceeds %d", failed, len(batch), job.Batch, max)
+			in.logger.Warnf("Update job '%s' is stopped as %s", job.GetName(), job.Reason)
+			switch job.Rollout.Action() {
+			case genericStorage.AbortRollout:
+				job.State = genericStorage.AbortState
+				job.FinishedAt.Time = time.Now()
+			default:
+				job.State = genericStorage.PausedState
+			}
+			break
+		}
+		// Jobs left in progress by failed saves are paused by ResumeWaitingJobs.
+		err = in.saveJob(job)
+		if err != nil {
+			in.logger.Errorf("Abort to perform update job '%s' due to: %v", job.GetName(), err)
+			return
+		}
+	}
+	if job.State == genericStorage.InProgressState {
+		job.State = genericStorage.SuccessState
+		for _, each := range job.Results {
+			if each.State != genericStorage.SuccessState {
+				job.State = genericStorage.FailureState
+				break
+			}
+		}
+		job.FinishedAt.Time = time.Now()
+	}
+	err = in.saveJob(job)
+	// Users might have requested to stop the job while it was turning to wait.
+	if err == nil && job.Stop != "" {
+		stopJob(job)
+		err = in.saveJob(job)
+	}
+	if err != nil {
+		in.logger.Errorf("Could not save result of update job '%s' due to: %v", job.GetName(), err)
+	}
+}
+
+// updateHost applies the updates selected from the latest scan of host, and then rescans the
+// host so that the applied updates disappear from its scan.
+func (in *Handler) updateHost(job *genericStorage.UpdateJob, name string) (result genericStorage.HostUpdateResult) {
+	result.Host = name
+	result.State = genericStorage.FailureState
+	fail := func(err error) genericStorage.HostUpdateResult {
+		in.logger.Errorf("Update job '%s' failed on host '%s' due to: %v", job.GetName(), name, err)
+		result.Reason = err.Error()
+		return result
+	}
+
+	host := genericStorage.NewHost()
+	host.SetName(name)
+	err := in.storage.GetContext(in.ctx, host)
+	if err != nil {
+		return fail(err)
+	}
+	scan := genericStorage.NewSystemScan()
+	scan.SetName(name)
+	err = in.storage.GetContext(in.ctx, scan)
+	if err != nil {
+		return fail(err)
+	}
+	if scan.State != genericStorage.SuccessState {
+		return fail(fmt.Errorf("No successful scan is available, the scan is %s", scan.State))
+	}
+	updater, ok := LookupScanner(scan.Scanner).(Updater)
+	if !ok {
+		return fail(fmt.Errorf("Updates could not be applied by scanner '%s'", scan.Scanner))
+	}
+	updates := job.Selector.Select(scan.Security)
+	if len(updates) == 0 {
+		// Nothing has to be updated, and neither the host has to be rescanned.
+		result.State = genericStorage.SuccessState
+		return result
+	}
+
+	op, err := in.runOp(host, updater.UpdateCommand(updates))
+	result.Operation = op.GetName()
+	// The host is rescanned even if the update failed, as some of packages might have been
+	// installed. The scan is skipped if it is in progress, which is rescanned on schedule.
+	defer in.handleHost(host)
+	if err != nil {
+		return fail(err)
+	}
+	result.Packages, err = updater.ParseUpdate(op.Data, updates)
+	if err != nil {
+		return fail(err)
+	}
+	for _, each := range result.Packages {
+		if each.State != genericStorage.SuccessState {
+			return fail(fmt.Errorf("Package %s could not be installed", each.Package))
+		}
+	}
+	// The host is rebooted and its health is checked only if it has been updated
+	// successfully, as the failure has been reported already otherwise.
+	if checker, ok := updater.(RestartChecker); ok && job.Rollout.Reboot {
+		op, err = in.runOp(host, checker.RestartCommand())
+		if err != nil {
+			return fail(fmt.Errorf("Could not detect whether reboot is required: %v", err))
+		}
+		var required bool
+		required, _, err = checker.ParseRestart(op.Data)
+		if err != nil {
+			return fail(err)
+		}
+		if required {
+			op, err = in.rebootHost(host)
+			result.Reboot = op.GetName()
+			if err != nil {
+				return fail(fmt.Errorf("Reboot failed: %v", err))
+			}
+		}
+	}
+	if job.Rollout.HealthCheck != "" {
+		op, err = in.runOp(host, job.Rollout.HealthCheck)
+		result.HealthCheck = op.GetName()
+		if err != nil {
+			return fail(fmt.Errorf("Health check failed: %v", err))
+		}
+	}
+	result.State = genericStorage.SuccessState
+	return result
+}
@@ -0,0 +1,127 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	zap "go.uber.org/zap"
+)
+
+// newTestHandler returns a handler on a memory storage, which has to be closed by caller.
+func newTestHandler(t *testing.T) (*Handler, genericStorage.Storage) {
+	storage, err := memory.New().Open(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(storage, nil, zap.NewNop().Sugar(), 4, nil, nil), storage
+}
+
+func TestSaveJobTakesStop(t *testing.T) {
+	h, storage := newTestHandler(t)
+	defer h.Close()
+	job := genericStorage.NewUpdateJob()
+	job.SetName("job")
+	job.Hosts = []string{"web-1", "web-2"}
+	job.State = genericStorage.InProgressState
+	if err := storage.Create(job); err != nil {
+		t.Fatal(err)
+	}
+	// The job is stopped by user while it is being rolled out.
+	stored := genericStorage.NewUpdateJob()
+	stored.SetName("job")
+	if err := storage.Get(stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.Stop = genericStorage.AbortRollout
+	if err := storage.Update(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	job.Batch = 1
+	if err := h.saveJob(job); err != nil {
+		t.Fatalf("Expected the progress to be saved on conflict, got %v", err)
+	}
+	if job.Stop != genericStorage.AbortRollout {
+		t.Errorf("Expected the stop request to be taken, got %q", job.Stop)
+	}
+	if err := storage.Get(stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Batch != 1 || stored.Stop != genericStorage.AbortRollout {
+		t.Errorf("Expected the progress to be saved with the stop request, got %+v", stored)
+	}
+
+	// Jobs changed by others in other ways are left untouched.
+	stored.State = genericStorage.PausedState
+	if err := storage.Update(stored); err != nil {
+		t.Fatal(err)
+	}
+	job.Batch = 2
+	if err := h.saveJob(job); !genericStorage.IsVersionConflict(err) {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+}
+
+func TestStopJob(t *testing.T) {
+	cases := []struct {
+		stop     genericStorage.RolloutAction
+		state    genericStorage.State
+		finished bool
+	}{
+		{genericStorage.PauseRollout, genericStorage.PausedState, false},
+		{genericStorage.AbortRollout, genericStorage.AbortState, true},
+	}
+	for _, c := range cases {
+		job := genericStorage.NewUpdateJob()
+		job.State = genericStorage.InProgressState
+		job.Stop = c.stop
+		stopJob(job)
+		if job.State != c.state || job.Stop != "" || job.Reason == "" || job.FinishedAt.IsZero() == c.finished {
+			t.Errorf("%s: unexpected job %+v", c.stop, job)
+		}
+	}
+}
+
+func TestResumeWaitingJobsPausesInterrupted(t *testing.T) {
+	h, storage := newTestHandler(t)
+	defer h.Close()
+	job := genericStorage.NewUpdateJob()
+	job.SetName("job")
+	job.Hosts = []string{"web-1"}
+	job.State = genericStorage.InProgressState
+	if err := storage.Create(job); err != nil {
+		t.Fatal(err)
+	}
+	// Jobs being rolled out are left untouched.
+	h.rollouts["job"] = 1
+	h.ResumeWaitingJobs()
+	if err := storage.Get(job); err != nil {
+		t.Fatal(err)
+	}
+	if job.State != genericStorage.InProgressState {
+		t.Fatalf("Expected the job being rolled out to be in progress, got %s", job.State)
+	}
+	delete(h.rollouts, "job")
+	h.ResumeWaitingJobs()
+	if err := storage.Get(job); err != nil {
+		t.Fatal(err)
+	}
+	if job.State != genericStorage.PausedState || job.Reason == "" {
+		t.Errorf("Expected the interrupted job to be paused, got %s (%s)", job.State, job.Reason)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// csafDocument is a CSAF advisory (or VEX document) published by Red Hat.
+type csafDocument struct {
+	Document struct {
+		Tracking struct {
+			ID                 string `json:"id"`
+			InitialReleaseDate string `json:"initial_release_date"`
+		} `json:"tracking"`
+		AggregateSeverity struct {
+			Text string `json:"text"`
+		} `json:"aggregate_severity"`
+	} `json:"document"`
+	ProductTree struct {
+		Branches      []csafBranch `json:"branches"`
+		Relationships []struct {
+			FullProductName  csafProduct `json:"full_product_name"`
+			ProductReference string      `json:"product_reference"`
+		} `json:"relationships"`
+	} `json:"product_tree"`
+	Vulnerabilities []struct {
+		CVE           string `json:"cve"`
+		ReleaseDate   string `json:"release_date"`
+		ProductStatus struct {
+			Fixed []string `json:"fixed"`
+		} `json:"product_status"`
+		Threats []struct {
+			Category string `json:"category"`
+			Details  string `json:"details"`
+		} `json:"threats"`
+	} `json:"vulnerabilities"`
+}
+
+type csafBranch struct {
+	Branches []csafBranch `json:"branches"`
+	Product  *csafProduct `json:"product"`
+}
+
+type csafProduct struct {
+	ProductID string `json:"product_id"`
+	Helper    struct {
+		PURL string `json:"purl"`
+	} `json:"product_identification_helper"`
+}
+
+// parseCSAF parses a CSAF advisory or VEX document. Products of fixed status are resolved to
+// packages by their package URLs, e.g.:
+//   pkg:rpm/redhat/openssl@1.0.2k-16.el7_6.1?arch=x86_64&epoch=1
+// Source packages are ignored, and so are the products which are affected but not fixed yet.
+func parseCSAF(r io.Reader, source string) ([]Advisory, error) {
+	var doc csafDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	purls := make(map[string]string)
+	var walk func(branches []csafBranch)
+	walk = func(branches []csafBranch) {
+		for _, each := range branches {
+			if each.Product != nil && each.Product.Helper.PURL != "" {
+				purls[each.Product.ProductID] = each.Product.Helper.PURL
+			}
+			walk(each.Branches)
+		}
+	}
+	walk(doc.ProductTree.Branches)
+	// Products of platforms refer to the packages by relationships.
+	for _, each := range doc.ProductTree.Relationships {
+		if purl, ok := purls[each.ProductReference]; ok {
+			purls[each.FullProductName.ProductID] = purl
+		}
+	}
+
+	var out []Advisory
+	for _, vuln := range doc.Vulnerabilities {
+		advisory := Advisory{
+			ID:       doc.Document.Tracking.ID,
+			CVEs:     appendUnique(nil, vuln.CVE),
+			Severity: parseSeverity(doc.Document.AggregateSeverity.Text),
+			Issued:   date(doc.Document.Tracking.InitialReleaseDate),
+			Source:   source,
+		}
+		for _, each := range vuln.Threats {
+			if each.Category == "impact" {
+				advisory.Severity = parseSeverity(each.Details)
+			}
+		}
+		if advisory.Issued == "" {
+			advisory.Issued = date(vuln.ReleaseDate)
+		}
+		seen := make(map[string]bool)
+		for _, product := range vuln.ProductStatus.Fixed {
+			purl := purls[product]
+			if purl == "" || seen[purl] {
+				continue
+			}
+			seen[purl] = true
+			if fix, ok := parsePURL(purl); ok {
+				advisory.Fixes = append(advisory.Fixes, fix)
+			}
+		}
+		if len(advisory.Fixes) > 0 {
+			out = append(out, advisory)
+		}
+	}
+	return out, nil
+}
+
+// date returns the date of an RFC 3339 timestamp.
+func date(timestamp string) string {
+	if len(timestamp) < len("2006-01-02") {
+		return ""
+	}
+	return timestamp[:len("2006-01-02")]
+}
+
+// parsePURL parses the package URL of an rpm into a fix.
+func parsePURL(purl string) (fix Fix, ok bool) {
+	if !strings.HasPrefix(purl, "pkg:rpm/") {
+		return fix, false
+	}
+	u, err := url.Parse(purl)
+	if err != nil {
+		return fix, false
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Path
+	}
+	at := strings.LastIndex(path, "@")
+	if at < 0 {
+		return fix, false
+	}
+	fix.Name = path[strings.LastIndex(path[:at], "/")+1 : at]
+	fix.Version = path[at+1:]
+	query := u.Query()
+	if epoch := query.Get("epoch"); epoch != "" {
+		fix.Version = epoch + ":" + fix.Version
+	}
+	switch arch := query.Get("arch"); arch {
+	case "src":
+		return fix, false
+	case "":
+	default:
+		fix.Arch = regexp.MustCompile("^" + regexp.QuoteMeta(arch) + "$")
+	}
+	return fix, fix.Name != "" && fix.Version != ""
+}
@@ -0,0 +1,240 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feed reads the security data published by vendors, i.e. OVAL definitions and
+// CSAF/VEX documents of Red Hat, and correlates them with the packages installed on hosts.
+// Unlike scans, it does not depend on the repositories configured on hosts, thus the hosts
+// whose metadata is stale (e.g. air-gapped hosts) are still correlated with the latest data.
+package feed
+
+import (
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Advisory is a fix of vulnerabilities published by feeds.
+type Advisory struct {
+	// ID is the ID of advisory, e.g. RHSA-2018:0007, or the ID of document if unknown.
+	ID       string
+	CVEs     []string
+	Severity genericStorage.SecuritySeverity
+	// Issued is the date (in the form of 2006-01-02) when the advisory was issued, if known.
+	Issued string
+	Fixes  []Fix
+	// Source is the name of file which the advisory was read from.
+	Source string
+}
+
+// Fix is a package fixed by an advisory, whose older versions are vulnerable.
+type Fix struct {
+	Name string
+	// Version is `[EPOCH:]VERSION-RELEASE` of the fixed package.
+	Version string
+	// Arch matches the architectures the fix applies to, or any architecture if it is nil.
+	Arch *regexp.Regexp
+}
+
+// distPattern extracts the major version of RHEL from releases, e.g. `7` of `16.el7_6.1`.
+var distPattern = regexp.MustCompile(`\.el(\d+)`)
+
+// Affects returns true if the installed package is vulnerable to the fix. Fixes built for a
+// major version of RHEL (by `.elN` of their releases) only apply to the packages built for
+// the same version, as feeds of all versions might be read together.
+func (in Fix) Affects(pkg genericStorage.InstalledPackage) bool {
+	if pkg.Name != in.Name {
+		return false
+	}
+	if in.Arch != nil && !in.Arch.MatchString(pkg.Arch) {
+		return false
+	}
+	if dist := distPattern.FindStringSubmatch(in.Version); dist != nil {
+		installed := distPattern.FindStringSubmatch(pkg.Version)
+		if installed == nil || installed[1] != dist[1] {
+			return false
+		}
+	}
+	return genericStorage.CompareVersions(genericStorage.RPMManager, pkg.Version, in.Version) < 0
+}
+
+// Database is the advisories read from a directory of feeds.
+type Database struct {
+	// Sources are the names of files which have been read.
+	Sources    []string
+	Advisories []Advisory
+	// Signature identifies the files which have been read, see Signature.
+	Signature string
+}
+
+// Correlate returns the security updates of which the installed packages of inventory are
+// vulnerable to. Like scans, an advisory which fixes multiple CVEs is reported once for each
+// of them. Only inventories of rpm are correlated, as the feeds are published by Red Hat.
+func (in *Database) Correlate(inventory *genericStorage.PackageInventory) []genericStorage.SecurityUpdate {
+	if in == nil || inventory.Manager != genericStorage.RPMManager {
+		return nil
+	}
+	installed := make(map[string][]genericStorage.InstalledPackage)
+	for _, each := range inventory.Packages {
+		installed[each.Name] = append(installed[each.Name], each)
+	}
+	var out []genericStorage.SecurityUpdate
+	seen := make(map[genericStorage.SecurityUpdate]bool)
+	for _, advisory := range in.Advisories {
+		for _, fix := range advisory.Fixes {
+			for _, pkg := range installed[fix.Name] {
+				if !fix.Affects(pkg) {
+					continue
+				}
+				update := genericStorage.SecurityUpdate{
+					Severity:  advisory.Severity,
+					Package:   nevra(fix.Name, fix.Version, pkg.Arch),
+					Advisory:  advisory.ID,
+					Type:      genericStorage.SecurityAdvisory,
+					Installed: nevra(pkg.Name, pkg.Version, pkg.Arch),
+					Issued:    advisory.Issued,
+				}
+				cves := advisory.CVEs
+				if len(cves) == 0 {
+					cves = []string{""}
+				}
+				for _, cve := range cves {
+					update.CVEID = cve
+					if !seen[update] {
+						seen[update] = true
+						out = append(out, update)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// nevra formats a package in the form of `<NAME>-[<EPOCH>:]<VERSION>-<RELEASE>.<ARCH>`, which
+// is the same as scans.
+func nevra(name, version, arch string) string {
+	if strings.HasPrefix(version, "0:") {
+		version = version[2:]
+	}
+	if arch == "" {
+		return name + "-" + version
+	}
+	return name + "-" + version + "." + arch
+}
+
+// parsers parse feeds by the suffixes of their names, and those compressed by bzip2 are
+// parsed by the suffixes before `.bz2`.
+var parsers = map[string]func(r io.Reader, source string) ([]Advisory, error){
+	".xml":  parseOVAL,
+	".json": parseCSAF,
+}
+
+// parserOf returns the parser of file, and whether it is compressed by bzip2.
+func parserOf(name string) (func(r io.Reader, source string) ([]Advisory, error), bool) {
+	compressed := strings.HasSuffix(name, ".bz2")
+	parser := parsers[filepath.Ext(strings.TrimSuffix(name, ".bz2"))]
+	return parser, compressed
+}
+
+// Signature returns a string which identifies the feeds in directory by their names, sizes
+// and modification times, so that feeds are reloaded only if it changes.
+func Signature(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, each := range files {
+		if parser, _ := parserOf(each.Name()); parser == nil || each.IsDir() {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", each.Name(), each.Size(), each.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// Load reads all feeds in directory, i.e. OVAL definitions (*.xml) and CSAF/VEX documents
+// (*.json), either of which could be compressed by bzip2 (*.bz2). Other files are ignored.
+func Load(dir string) (*Database, error) {
+	signature, err := Signature(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := &Database{Signature: signature}
+	for _, each := range files {
+		parser, compressed := parserOf(each.Name())
+		if parser == nil || each.IsDir() {
+			continue
+		}
+		advisories, err := loadFile(filepath.Join(dir, each.Name()), parser, compressed)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read feed %s: %v", each.Name(), err)
+		}
+		db.Sources = append(db.Sources, each.Name())
+		db.Advisories = append(db.Advisories, advisories...)
+	}
+	sort.Strings(db.Sources)
+	return db, nil
+}
+
+func loadFile(path string, parser func(r io.Reader, source string) ([]Advisory, error), compressed bool) ([]Advisory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compressed {
+		r = bzip2.NewReader(f)
+	}
+	return parser(r, filepath.Base(path))
+}
+
+// parseSeverity converts the severity of Red Hat, e.g. "Important" or "important".
+func parseSeverity(s string) genericStorage.SecuritySeverity {
+	sev, err := genericStorage.ParseSecuritySeverity(s)
+	if err != nil {
+		return genericStorage.UnknownSec
+	}
+	return sev
+}
+
+// appendUnique appends those of items which are not in list yet.
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		var found bool
+		for _, each := range list {
+			if each == item {
+				found = true
+				break
+			}
+		}
+		if !found && item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,192 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// describe formats an advisory for comparison, as the architectures of fixes are patterns.
+func describe(advisories []Advisory) []string {
+	var out []string
+	for _, each := range advisories {
+		s := fmt.Sprintf("%s %v %s %s %s:", each.ID, each.CVEs, each.Severity, each.Issued, each.Source)
+		for _, fix := range each.Fixes {
+			s += fmt.Sprintf(" %s-%s(%v)", fix.Name, fix.Version, fix.Arch)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParseOVAL(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "com.redhat.rhsa-RHEL7.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	advisories, err := parseOVAL(f, "rhel-7.xml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := []string{
+		"RHSA-2019:0049 [CVE-2018-16864 CVE-2018-16865] Important 2019-01-14 rhel-7.xml:" +
+			" systemd-0:219-62.el7_6.2(^(?:aarch64|ppc64|ppc64le|s390x|x86_64)$)" +
+			" systemd-libs-0:219-62.el7_6.2(^(?:aarch64|ppc64|ppc64le|s390x|x86_64)$)",
+		"RHSA-2018:3032 [CVE-2018-10372] Low 2018-10-30 rhel-7.xml: binutils-0:2.27-34.base.el7(^(?:x86_64)$)",
+	}
+	if got := describe(advisories); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected\n%v\ngot\n%v", expect, got)
+	}
+}
+
+func TestParseCSAF(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "rhsa-2019_0109.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	advisories, err := parseCSAF(f, "rhsa.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fixes := " openssl-1:1.0.2k-16.el7_6.1(^x86_64$) openssl-libs-1:1.0.2k-16.el7_6.1(^x86_64$)"
+	// CVE-2019-1559 is affected but not fixed yet.
+	expect := []string{
+		"RHSA-2019:0109 [CVE-2018-0734] Low 2019-01-16 rhsa.json:" + fixes,
+		"RHSA-2019:0109 [CVE-2018-5407] Moderate 2019-01-16 rhsa.json:" + fixes,
+	}
+	if got := describe(advisories); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected\n%v\ngot\n%v", expect, got)
+	}
+}
+
+func TestParsePURL(t *testing.T) {
+	cases := []struct {
+		purl    string
+		version string
+		arch    string
+		ok      bool
+	}{
+		{"pkg:rpm/redhat/openssl@1.0.2k-16.el7_6.1?arch=x86_64&epoch=1", "1:1.0.2k-16.el7_6.1", "^x86_64$", true},
+		{"pkg:rpm/redhat/kernel-rt@3.10.0-957.rt56.910.el7?arch=noarch", "3.10.0-957.rt56.910.el7", "^noarch$", true},
+		{"pkg:rpm/redhat/tzdata@2019a-1.el7", "2019a-1.el7", "<nil>", true},
+		{"pkg:rpm/redhat/openssl@1.0.2k-16.el7_6.1?arch=src&epoch=1", "", "", false},
+		{"pkg:deb/debian/openssl@1.1.1n-0+deb11u4?arch=amd64", "", "", false},
+		{"pkg:rpm/redhat/openssl", "", "", false},
+		{"pkg:rpm/redhat/openssl@", "", "", false},
+	}
+	for _, c := range cases {
+		fix, ok := parsePURL(c.purl)
+		if ok != c.ok {
+			t.Errorf("%s: expected ok %v, got %v", c.purl, c.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if fix.Version != c.version || fmt.Sprint(fix.Arch) != c.arch {
+			t.Errorf("%s: expected %s (%s), got %s (%v)", c.purl, c.version, c.arch, fix.Version, fix.Arch)
+		}
+	}
+}
+
+func TestFixAffects(t *testing.T) {
+	fix := Fix{Name: "openssl", Version: "1:1.0.2k-16.el7_6.1", Arch: regexp.MustCompile("^x86_64$")}
+	cases := []struct {
+		pkg    genericStorage.InstalledPackage
+		expect bool
+	}{
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-12.el7", Arch: "x86_64"}, true},
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-16.el7_6.1", Arch: "x86_64"}, false},
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-19.el7", Arch: "x86_64"}, false},
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-12.el7", Arch: "i686"}, false},
+		{genericStorage.InstalledPackage{Name: "openssl-libs", Version: "1:1.0.2k-12.el7", Arch: "x86_64"}, false},
+		// Fixes of RHEL 7 never apply to RHEL 8, nor to packages of unknown distributions.
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-12.el8", Arch: "x86_64"}, false},
+		{genericStorage.InstalledPackage{Name: "openssl", Version: "1:1.0.2k-12", Arch: "x86_64"}, false},
+	}
+	for _, c := range cases {
+		if got := fix.Affects(c.pkg); got != c.expect {
+			t.Errorf("%+v: expected %v, got %v", c.pkg, c.expect, got)
+		}
+	}
+	// Fixes without distribution nor architecture apply to any of them.
+	fix = Fix{Name: "tzdata", Version: "2019a-1"}
+	if !fix.Affects(genericStorage.InstalledPackage{Name: "tzdata", Version: "2018e-3.el7", Arch: "noarch"}) {
+		t.Error("Expected tzdata to be affected")
+	}
+}
+
+func TestLoadAndCorrelate(t *testing.T) {
+	db, err := Load("testdata")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expect := []string{"com.redhat.rhsa-RHEL7.xml", "rhsa-2019_0109.json"}; !reflect.DeepEqual(db.Sources, expect) {
+		t.Errorf("Expected sources %v, got %v", expect, db.Sources)
+	}
+	if len(db.Advisories) != 4 {
+		t.Errorf("Expected 4 advisories, got %d", len(db.Advisories))
+	}
+	signature, err := Signature("testdata")
+	if err != nil || signature != db.Signature {
+		t.Errorf("Expected signature %s, got %s (%v)", db.Signature, signature, err)
+	}
+
+	inventory := genericStorage.NewPackageInventory()
+	inventory.Manager = genericStorage.RPMManager
+	inventory.Packages = []genericStorage.InstalledPackage{
+		{Name: "systemd", Version: "219-57.el7", Arch: "x86_64"},
+		{Name: "systemd-libs", Version: "219-57.el7", Arch: "i686"},
+		{Name: "binutils", Version: "2.27-34.base.el7", Arch: "x86_64"},
+		{Name: "openssl", Version: "1:1.0.2k-12.el7", Arch: "x86_64"},
+		{Name: "openssl-libs", Version: "1:1.0.2k-16.el7_6.1", Arch: "x86_64"},
+		{Name: "gpg-pubkey", Version: "fd431d51-4ae0493b"},
+	}
+	expect := []genericStorage.SecurityUpdate{
+		{CVEID: "CVE-2018-16864", Severity: genericStorage.ImportantSec, Package: "systemd-219-62.el7_6.2.x86_64", Advisory: "RHSA-2019:0049", Type: genericStorage.SecurityAdvisory, Installed: "systemd-219-57.el7.x86_64", Issued: "2019-01-14"},
+		{CVEID: "CVE-2018-16865", Severity: genericStorage.ImportantSec, Package: "systemd-219-62.el7_6.2.x86_64", Advisory: "RHSA-2019:0049", Type: genericStorage.SecurityAdvisory, Installed: "systemd-219-57.el7.x86_64", Issued: "2019-01-14"},
+		{CVEID: "CVE-2018-0734", Severity: genericStorage.LowSec, Package: "openssl-1:1.0.2k-16.el7_6.1.x86_64", Advisory: "RHSA-2019:0109", Type: genericStorage.SecurityAdvisory, Installed: "openssl-1:1.0.2k-12.el7.x86_64", Issued: "2019-01-16"},
+		{CVEID: "CVE-2018-5407", Severity: genericStorage.ModerateSec, Package: "openssl-1:1.0.2k-16.el7_6.1.x86_64", Advisory: "RHSA-2019:0109", Type: genericStorage.SecurityAdvisory, Installed: "openssl-1:1.0.2k-12.el7.x86_64", Issued: "2019-01-16"},
+	}
+	if got := db.Correlate(inventory); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected\n%+v\ngot\n%+v", expect, got)
+	}
+	inventory.Manager = genericStorage.DpkgManager
+	if got := db.Correlate(inventory); got != nil {
+		t.Errorf("Expected inventories of dpkg not to be correlated, got %+v", got)
+	}
+}
+
+func TestLoadCompressed(t *testing.T) {
+	db, err := Load(filepath.Join("testdata", "bzip2"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(db.Sources) != 1 || len(db.Advisories) != 2 || db.Advisories[0].Source != "rhsa-2019_0109.json.bz2" {
+		t.Errorf("Unexpected feeds: %v", describe(db.Advisories))
+	}
+	if _, err = Load(filepath.Join("testdata", "missing")); err == nil {
+		t.Error("Expected an error on missing directory")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ovalDocument is the OVAL definitions published by Red Hat. Elements are matched by their
+// local names, thus the namespaces of them do not matter.
+type ovalDocument struct {
+	Definitions []ovalDefinition `xml:"definitions>definition"`
+	Tests       []ovalTest       `xml:"tests>rpminfo_test"`
+	Objects     []ovalObject     `xml:"objects>rpminfo_object"`
+	States      []ovalState      `xml:"states>rpminfo_state"`
+}
+
+type ovalDefinition struct {
+	ID         string          `xml:"id,attr"`
+	Class      string          `xml:"class,attr"`
+	References []ovalReference `xml:"metadata>reference"`
+	Severity   string          `xml:"metadata>advisory>severity"`
+	Issued     struct {
+		Date string `xml:"date,attr"`
+	} `xml:"metadata>advisory>issued"`
+	CVEs     []string     `xml:"metadata>advisory>cve"`
+	Criteria ovalCriteria `xml:"criteria"`
+}
+
+type ovalReference struct {
+	Source string `xml:"source,attr"`
+	RefID  string `xml:"ref_id,attr"`
+}
+
+type ovalCriteria struct {
+	Criteria  []ovalCriteria  `xml:"criteria"`
+	Criterion []ovalCriterion `xml:"criterion"`
+}
+
+type ovalCriterion struct {
+	TestRef string `xml:"test_ref,attr"`
+	Negate  bool   `xml:"negate,attr"`
+}
+
+type ovalTest struct {
+	ID     string `xml:"id,attr"`
+	Object struct {
+		Ref string `xml:"object_ref,attr"`
+	} `xml:"object"`
+	State struct {
+		Ref string `xml:"state_ref,attr"`
+	} `xml:"state"`
+}
+
+type ovalObject struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+type ovalState struct {
+	ID   string     `xml:"id,attr"`
+	EVR  *ovalValue `xml:"evr"`
+	Arch *ovalValue `xml:"arch"`
+}
+
+type ovalValue struct {
+	Operation string `xml:"operation,attr"`
+	Value     string `xml:",chardata"`
+}
+
+// parseOVAL parses OVAL definitions of patches, e.g. com.redhat.rhsa-RHEL7.xml. The criteria
+// of definitions are not evaluated, instead, the packages are collected from those tests
+// which require them to be earlier than fixed versions, e.g.:
+//   <criterion comment="openssl is earlier than 1:1.0.2k-16.el7_6.1" test_ref="..."/>
+// The other tests, e.g. whether RHEL is installed or packages are signed by Red Hat, are
+// ignored.
+func parseOVAL(r io.Reader, source string) ([]Advisory, error) {
+	var doc ovalDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	tests := make(map[string]ovalTest)
+	for _, each := range doc.Tests {
+		tests[each.ID] = each
+	}
+	objects := make(map[string]string)
+	for _, each := range doc.Objects {
+		objects[each.ID] = strings.TrimSpace(each.Name)
+	}
+	states := make(map[string]ovalState)
+	for _, each := range doc.States {
+		states[each.ID] = each
+	}
+	fixOf := func(criterion ovalCriterion) (fix Fix, ok bool) {
+		test, found := tests[criterion.TestRef]
+		if !found || criterion.Negate {
+			return fix, false
+		}
+		state, found := states[test.State.Ref]
+		if !found || state.EVR == nil || state.EVR.Operation != "less than" {
+			return fix, false
+		}
+		fix.Name = objects[test.Object.Ref]
+		fix.Version = strings.TrimSpace(state.EVR.Value)
+		if state.Arch != nil {
+			pattern := strings.TrimSpace(state.Arch.Value)
+			if state.Arch.Operation != "pattern match" {
+				pattern = regexp.QuoteMeta(pattern)
+			}
+			arch, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return fix, false
+			}
+			fix.Arch = arch
+		}
+		return fix, fix.Name != "" && fix.Version != ""
+	}
+
+	var out []Advisory
+	for _, def := range doc.Definitions {
+		if def.Class != "patch" {
+			continue
+		}
+		advisory := Advisory{
+			ID:       def.ID,
+			Severity: parseSeverity(strings.TrimSpace(def.Severity)),
+			Issued:   def.Issued.Date,
+			Source:   source,
+		}
+		for _, each := range def.References {
+			if each.Source == "CVE" {
+				advisory.CVEs = appendUnique(advisory.CVEs, each.RefID)
+			} else if advisory.ID == def.ID {
+				advisory.ID = each.RefID
+			}
+		}
+		for _, each := range def.CVEs {
+			advisory.CVEs = appendUnique(advisory.CVEs, strings.TrimSpace(each))
+		}
+		walkCriteria(def.Criteria, func(criterion ovalCriterion) {
+			if fix, ok := fixOf(criterion); ok {
+				advisory.Fixes = append(advisory.Fixes, fix)
+			}
+		})
+		if len(advisory.Fixes) > 0 {
+			out = append(out, advisory)
+		}
+	}
+	return out, nil
+}
+
+// walkCriteria calls fn on every criterion of criteria, including those nested.
+func walkCriteria(criteria ovalCriteria, fn func(ovalCriterion)) {
+	for _, each := range criteria.Criterion {
+		fn(each)
+	}
+	for _, each := range criteria.Criteria {
+		walkCriteria(each, fn)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Version is the version of archive layout written by Export.
+const Version = 1
+
+// Archive is a snapshot of objects in storage, which is independent of storage adapters.
+type Archive struct {
+	Version   int       `json:"version" yaml:"version"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	Sections  []Section `json:"sections" yaml:"sections"`
+}
+
+// Section holds all objects of a kind.
+type Section struct {
+	Kind string `json:"kind" yaml:"kind"`
+	// Objects are kept in their generic form, so that an archive could be encoded in any
+	// supported format.
+	Objects []map[string]interface{} `json:"objects" yaml:"objects"`
+}
+
+// Export reads all objects of given kinds from storage into an archive. All registered
+// kinds are exported if none was given.
+func Export(ctx context.Context, s generic.Storage, kinds ...string) (*Archive, error) {
+	if len(kinds) == 0 {
+		kinds = generic.Kinds()
+	}
+	out := &Archive{Version: Version, CreatedAt: time.Now().UTC()}
+	for _, kind := range kinds {
+		section := Section{Kind: kind, Objects: []map[string]interface{}{}}
+		it := generic.NewIteratorContext(ctx, s, kind, generic.DefaultPageSize)
+		for it.Next() {
+			obj := it.Object()
+			// Versions are assigned by storage, and are meaningless in other storages.
+			obj.SetResourceVersion("")
+			m, err := toMap(obj)
+			if err != nil {
+				return nil, err
+			}
+			section.Objects = append(section.Objects, m)
+		}
+		if err := it.Err(); err != nil {
+			return nil, fmt.Errorf("Could not export %s due to: %v", kind, err)
+		}
+		out.Sections = append(out.Sections, section)
+	}
+	return out, nil
+}
+
+// Encode writes the archive in given format, which is either "json" or "yaml".
+func Encode(w io.Writer, a *Archive, format string) error {
+	var (
+		dAtA []byte
+		err  error
+	)
+	switch format {
+	case "json":
+		dAtA, err = json.MarshalIndent(a, "", "  ")
+	case "yaml", "yml":
+		dAtA, err = yaml.Marshal(a)
+	default:
+		return fmt.Errorf("Not supported format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dAtA)
+	return err
+}
+
+// Decode reads an archive in given format, which is either "json" or "yaml".
+func Decode(r io.Reader, format string) (*Archive, error) {
+	dAtA, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	a := new(Archive)
+	switch format {
+	case "json":
+		// Numbers are kept as they are, as float64 could not hold all values of int64.
+		dec := json.NewDecoder(bytes.NewReader(dAtA))
+		dec.UseNumber()
+		err = dec.Decode(a)
+	case "yaml", "yml":
+		// YAML decodes nested maps with keys of any type, which are not accepted by JSON.
+		raw := new(struct {
+			Version   int       `yaml:"version"`
+			CreatedAt time.Time `yaml:"created_at"`
+			Sections  []struct {
+				Kind    string        `yaml:"kind"`
+				Objects []interface{} `yaml:"objects"`
+			} `yaml:"sections"`
+		})
+		if err = yaml.Unmarshal(dAtA, raw); err != nil {
+			break
+		}
+		a.Version, a.CreatedAt = raw.Version, raw.CreatedAt
+		for _, each := range raw.Sections {
+			section := Section{Kind: each.Kind}
+			for _, obj := range each.Objects {
+				m, ok := normalize(obj).(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("Invalid object of %s in archive", each.Kind)
+				}
+				section.Objects = append(section.Objects, m)
+			}
+			a.Sections = append(a.Sections, section)
+		}
+	default:
+		return nil, fmt.Errorf("Not supported format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.Version != Version {
+		return nil, fmt.Errorf("Not supported archive version: %d", a.Version)
+	}
+	return a, nil
+}
+
+// Strategy decides what to do if an object in archive already exists in storage.
+type Strategy string
+
+const (
+	// Skip keeps the existing object.
+	Skip Strategy = "skip"
+	// Overwrite replaces the existing object by the one in archive.
+	Overwrite Strategy = "overwrite"
+	// Abort imports nothing if any object already exists.
+	Abort Strategy = "abort"
+)
+
+// ParseStrategy returns the Strategy of given name.
+func ParseStrategy(s string) (Strategy, error) {
+	switch t := Strategy(s); t {
+	case Skip, Overwrite, Abort:
+		return t, nil
+	}
+	return "", fmt.Errorf("Unknown conflict strategy: %s", s)
+}
+
+// ImportOptions are the options of Import.
+type ImportOptions struct {
+	// DryRun reports what would be done without writing anything into storage.
+	DryRun bool
+	// OnConflict is the strategy for those objects which already exist. Default: Skip.
+	OnConflict Strategy
+}
+
+// Result is the number of objects of a kind which have been handled by Import.
+type Result struct {
+	Kind        string `json:"kind" yaml:"kind"`
+	Created     int    `json:"created" yaml:"created"`
+	Overwritten int    `json:"overwritten" yaml:"overwritten"`
+	Skipped     int    `json:"skipped" yaml:"skipped"`
+}
+
+// Import writes all objects in archive into storage. Objects keep their GUIDs and timestamps
+// if the storage implements generic.Restorer. All objects are decoded and checked against
+// storage before the first write, so that storage would not be left half-restored by an
+// invalid object or a conflict on Abort. It returns the results of all kinds that have been
+// handled, even if an error occurred while writing.
+func Import(ctx context.Context, s generic.Storage, a *Archive, opts ImportOptions) ([]Result, error) {
+	if opts.OnConflict == "" {
+		opts.OnConflict = Skip
+	}
+	plans := make([][]importPlan, len(a.Sections))
+	for i, section := range a.Sections {
+		for _, m := range section.Objects {
+			obj, err := fromMap(section.Kind, m)
+			if err != nil {
+				return nil, err
+			}
+			existing, err := generic.NewObjectOf(section.Kind)
+			if err != nil {
+				return nil, err
+			}
+			existing.SetNamespace(obj.GetNamespace())
+			existing.SetName(obj.GetName())
+			err = s.GetContext(ctx, existing)
+			switch {
+			case err == nil:
+				if opts.OnConflict == Abort {
+					return nil, fmt.Errorf("%s '%s' already exists", section.Kind, nameOf(obj))
+				}
+			case generic.IsNotFound(err):
+				existing = nil
+			default:
+				return nil, err
+			}
+			plans[i] = append(plans[i], importPlan{obj: obj, existing: existing})
+		}
+	}
+
+	var results []Result
+	for i, section := range a.Sections {
+		result := Result{Kind: section.Kind}
+		for _, each := range plans[i] {
+			switch {
+			case each.existing == nil:
+				if !opts.DryRun {
+					if err := restore(ctx, s, each.obj); err != nil {
+						return append(results, result), fmt.Errorf("Could not import %s '%s' due to: %v", section.Kind, nameOf(each.obj), err)
+					}
+				}
+				result.Created++
+			case opts.OnConflict == Skip:
+				result.Skipped++
+			default:
+				if !opts.DryRun {
+					if err := overwrite(ctx, s, each.obj, each.existing); err != nil {
+						return append(results, result), fmt.Errorf("Could not overwrite %s '%s' due to: %v", section.Kind, nameOf(each.obj), err)
+					}
+				}
+				result.Overwritten++
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importPlan is an object in archive to be imported, and the existing one in storage if any.
+type importPlan struct {
+	obj      generic.Object
+	existing generic.Object
+}
+
+func restore(ctx context.Context, s generic.Storage, obj generic.Object) error {
+	if restorer, ok := s.(generic.Restorer); ok {
+		return restorer.Restore(ctx, obj)
+	}
+	return s.CreateContext(ctx, obj)
+}
+
+// overwrite replaces the existing object. Immutable objects are deleted and created again,
+// while the others are updated in place, so that no deletion would be observed by watchers.
+func overwrite(ctx context.Context, s generic.Storage, obj, existing generic.Object) error {
+	if generic.IsImmutable(obj) {
+		if err := s.DeleteContext(ctx, existing); err != nil {
+			return err
+		}
+		return restore(ctx, s, obj)
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return s.UpdateContext(ctx, obj)
+}
+
+func nameOf(obj generic.Object) string {
+	if obj.HasNamespace() {
+		return obj.GetNamespace() + "/" + obj.GetName()
+	}
+	return obj.GetName()
+}
+
+func toMap(obj generic.Object) (map[string]interface{}, error) {
+	dAtA, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as they are, as float64 could not hold all values of int64.
+	dec := json.NewDecoder(bytes.NewReader(dAtA))
+	dec.UseNumber()
+	m := make(map[string]interface{})
+	if err = dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func fromMap(kind string, m map[string]interface{}) (generic.Object, error) {
+	obj, err := generic.NewObjectOf(kind)
+	if err != nil {
+		return nil, err
+	}
+	dAtA, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	// Archives might have been exported by older binaries.
+	if dAtA, err = generic.UpgradeRaw(dAtA); err != nil {
+		return nil, fmt.Errorf("Invalid object of %s in archive: %v", kind, err)
+	}
+	if err = json.Unmarshal(dAtA, obj); err != nil {
+		return nil, fmt.Errorf("Invalid object of %s in archive: %v", kind, err)
+	}
+	if obj.GetKind() != kind {
+		return nil, fmt.Errorf("Object of %s found in section of %s", obj.GetKind(), kind)
+	}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("Object of %s without name found in archive", kind)
+	}
+	obj.SetResourceVersion("")
+	return obj, nil
+}
+
+// normalize converts maps decoded from YAML into those could be encoded by JSON.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			m[fmt.Sprintf("%v", key)] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = normalize(t[i])
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	archive "github.com/universonic/panther/pkg/storage/archive"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	zap "go.uber.org/zap"
+)
+
+func openMemory(t *testing.T) generic.Storage {
+	s, err := memory.New().Open(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newHost(name string) *generic.Host {
+	host := generic.NewHost()
+	host.SetName(name)
+	host.SSHAddress = name + ".example.com"
+	return host
+}
+
+func TestRoundTripKeepsNumbers(t *testing.T) {
+	src := openMemory(t)
+	defer src.Close()
+	facts := generic.NewHostFacts()
+	facts.SetName("web-1")
+	// The value could not be held by float64.
+	facts.Memory = 1<<62 + 1
+	if err := src.Create(facts); err != nil {
+		t.Fatal(err)
+	}
+	a, err := archive.Export(context.Background(), src, facts.GetKind())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"json", "yaml"} {
+		var buf bytes.Buffer
+		if err = archive.Encode(&buf, a, format); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := archive.Decode(&buf, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		dst := openMemory(t)
+		if _, err = archive.Import(context.Background(), dst, decoded, archive.ImportOptions{}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got := generic.NewHostFacts()
+		got.SetName("web-1")
+		if err = dst.Get(got); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got.Memory != facts.Memory {
+			t.Errorf("%s: expected %d, got %d", format, facts.Memory, got.Memory)
+		}
+		dst.Close()
+	}
+}
+
+func TestImportOnConflict(t *testing.T) {
+	src := openMemory(t)
+	defer src.Close()
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		if err := src.Create(newHost(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := archive.Export(context.Background(), src, generic.RESOURCE_HOST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		strategy archive.Strategy
+		dryRun   bool
+		result   archive.Result
+		failed   bool
+		hosts    int
+		address  string
+	}{
+		{archive.Skip, false, archive.Result{Kind: generic.RESOURCE_HOST, Created: 2, Skipped: 1}, false, 3, "old"},
+		{archive.Overwrite, false, archive.Result{Kind: generic.RESOURCE_HOST, Created: 2, Overwritten: 1}, false, 3, "web-2.example.com"},
+		{archive.Overwrite, true, archive.Result{Kind: generic.RESOURCE_HOST, Created: 2, Overwritten: 1}, false, 1, "old"},
+		// Nothing is imported, even those objects before the existing one.
+		{archive.Abort, false, archive.Result{}, true, 1, "old"},
+	}
+	for _, c := range cases {
+		dst := openMemory(t)
+		existing := newHost("web-2")
+		existing.SSHAddress = "old"
+		if err = dst.Create(existing); err != nil {
+			t.Fatal(err)
+		}
+		results, err := archive.Import(context.Background(), dst, a, archive.ImportOptions{DryRun: c.dryRun, OnConflict: c.strategy})
+		if (err != nil) != c.failed {
+			t.Errorf("%s: unexpected error: %v", c.strategy, err)
+		}
+		if !c.failed && (len(results) != 1 || results[0] != c.result) {
+			t.Errorf("%s: expected %+v, got %+v", c.strategy, c.result, results)
+		}
+		list := generic.NewHostList()
+		if err = dst.List(list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Members) != c.hosts {
+			t.Errorf("%s: expected %d hosts, got %d", c.strategy, c.hosts, len(list.Members))
+		}
+		if err = dst.Get(existing); err != nil {
+			t.Fatal(err)
+		}
+		if existing.SSHAddress != c.address {
+			t.Errorf("%s: expected address %q, got %q", c.strategy, c.address, existing.SSHAddress)
+		}
+		dst.Close()
+	}
+}
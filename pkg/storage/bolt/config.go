@@ -0,0 +1,86 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	bbolt "github.com/coreos/bbolt"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	observer "github.com/universonic/panther/pkg/storage/internal/observer"
+	zap "go.uber.org/zap"
+)
+
+const (
+	// DefaultPath is the default location of the database file.
+	DefaultPath = "/var/lib/panther/panther.db"
+	// DefaultOpenTimeout indicates the default time duration (in seconds) to wait for the
+	// file lock of database, which might be held by another running daemon.
+	DefaultOpenTimeout = 3
+)
+
+// Config indicates the embedded storage configuration. The embedded storage persists
+// all objects into a single local database file, which is suitable for single-node
+// deployments where a standalone etcd cluster is too heavy.
+type Config struct {
+	Path    string `json:"path,omitempty" yaml:"path,omitempty" toml:"path,omitempty"`
+	Timeout int    `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+// Open is used for opening (or creating if absent) the database file.
+func (in *Config) Open(logger *zap.SugaredLogger) (generic.Storage, error) {
+	if in.Path == "" {
+		in.Path = DefaultPath
+	}
+	if in.Timeout <= 0 {
+		in.Timeout = DefaultOpenTimeout
+	}
+	if err := os.MkdirAll(filepath.Dir(in.Path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(in.Path, 0600, &bbolt.Options{
+		Timeout: time.Duration(in.Timeout) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rev int64
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{objectBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		rev = currentRevision(tx)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	c := &conn{
+		db:     db,
+		hub:    observer.NewHub(rev, logger.Named("OBSERVER")),
+		logger: logger,
+	}
+	return c, nil
+}
+
+// New returns an empty configuration carrier.
+func New() *Config {
+	return new(Config)
+}
@@ -0,0 +1,494 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bbolt "github.com/coreos/bbolt"
+	uuid "github.com/satori/go.uuid"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	observer "github.com/universonic/panther/pkg/storage/internal/observer"
+	zap "go.uber.org/zap"
+)
+
+var (
+	// objectBucket stores all objects with keys of `/<kind>/[<namespace>/]<name>`.
+	objectBucket = []byte("objects")
+	// metaBucket stores the bookkeeping data of the storage itself.
+	metaBucket = []byte("meta")
+	// revisionKey holds the latest revision of the storage in metaBucket.
+	revisionKey = []byte("revision")
+)
+
+// headerSize is the size of revisions header that is prepended to each stored value.
+const headerSize = 16
+
+// record is a stored value along with its revisions, which follows the same semantics
+// as etcd does, so that an object could be compared by its modification revision.
+type record struct {
+	createRevision int64
+	modRevision    int64
+	value          []byte
+}
+
+func (in *record) marshal() []byte {
+	b := make([]byte, headerSize+len(in.value))
+	binary.BigEndian.PutUint64(b[0:8], uint64(in.createRevision))
+	binary.BigEndian.PutUint64(b[8:16], uint64(in.modRevision))
+	copy(b[headerSize:], in.value)
+	return b
+}
+
+func unmarshalRecord(b []byte) (*record, error) {
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("Corrupted record with %d byte(s)", len(b))
+	}
+	r := &record{
+		createRevision: int64(binary.BigEndian.Uint64(b[0:8])),
+		modRevision:    int64(binary.BigEndian.Uint64(b[8:16])),
+	}
+	// Values returned by bolt are only valid during the transaction.
+	r.value = append([]byte(nil), b[headerSize:]...)
+	return r, nil
+}
+
+type conn struct {
+	lock   sync.Mutex // serializes writers so that events are emitted in order
+	db     *bbolt.DB
+	hub    *observer.Hub
+	logger *zap.SugaredLogger
+}
+
+func (in *conn) Close() error {
+	in.hub.Close()
+	return in.db.Close()
+}
+
+func (in *conn) Create(obj generic.Object) error {
+	return in.create(obj, false)
+}
+
+// Restore creates an object, keeping its GUID and timestamps.
+func (in *conn) Restore(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.create(obj, true)
+}
+
+func (in *conn) create(obj generic.Object, restore bool) error {
+	if _, err := uuid.FromString(obj.GetGUID()); err != nil {
+		obj.SetGUID(uuid.NewV4().String())
+	}
+	if !restore || obj.GetCreationTimestamp().IsZero() {
+		obj.SetCreationTimestamp(time.Now())
+	}
+	if obj.GetName() == "" {
+		obj.SetName(obj.GetGUID())
+	}
+	// Versions are assigned by storage, and are never persisted along with objects.
+	obj.SetResourceVersion("")
+	obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
+	rev, err := in.txnCreate(in.keyOf(obj), obj)
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(generic.FormatResourceVersion(rev))
+	return nil
+}
+
+func (in *conn) Get(cv generic.Object) error {
+	return in.getKey(in.keyOf(cv), cv)
+}
+
+func (in *conn) Watch(cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	return in.hub.Watch(context.Background(), cv, opt, sel...)
+}
+
+func (in *conn) List(cv generic.ObjectList, opts ...generic.ListOption) (err error) {
+	defer in.logger.Sync()
+	o := generic.NewListOptions(opts...)
+	var kp []byte
+	if cv.HasNamespace() && o.Namespace != "" {
+		kp = []byte(filepath.Join("/", cv.GetKind(), o.Namespace) + "/")
+	} else {
+		kp = []byte(filepath.Join("/", cv.GetKind()) + "/")
+	}
+	// Bolt keeps no history of values, thus following pages of a paginated list are
+	// retrieved from the latest values, starting at the key where the previous page stopped.
+	var rev int64
+	start := kp
+	if o.Continue != "" {
+		var s string
+		if rev, s, err = generic.DecodeContinue(o.Continue, string(kp)); err != nil {
+			return
+		}
+		start = []byte(s)
+	}
+	length := 0
+	err = in.db.View(func(tx *bbolt.Tx) error {
+		if rev == 0 {
+			rev = currentRevision(tx)
+		}
+		c := tx.Bucket(objectBucket).Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, kp); k, v = c.Next() {
+			if o.Limit > 0 && int64(length) == o.Limit {
+				cv.SetContinue(generic.EncodeContinue(rev, string(k)))
+				return nil
+			}
+			r, err := unmarshalRecord(v)
+			if err != nil {
+				return err
+			}
+			raw, err := generic.UpgradeRaw(r.value)
+			if err != nil {
+				return err
+			}
+			matched, err := o.Selector.MatchesRaw(cv.GetKind(), raw)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				continue
+			}
+			raw, err = generic.SetRawResourceVersion(raw, r.modRevision)
+			if err != nil {
+				return err
+			}
+			if err = cv.AppendRaw(raw); err != nil {
+				return err
+			}
+			length++
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(rev))
+	in.logger.Debugf("Listed %d object(s) in kind %s", length, cv.GetKind())
+	return nil
+}
+
+func (in *conn) Update(obj generic.Object) error {
+	if generic.IsImmutable(obj) {
+		return generic.ErrImmutable
+	}
+	version := obj.GetResourceVersion()
+	expected, err := generic.ParseResourceVersion(version)
+	if err != nil {
+		return generic.ErrResourceVersionConflict
+	}
+	rev, err := in.txnUpdate(in.keyOf(obj), expected, func(currentValue []byte) ([]byte, error) {
+		old := new(struct {
+			generic.ObjectMeta `json:"metadata,omitempty"`
+		})
+		if len(currentValue) != 0 {
+			err := json.Unmarshal(currentValue, old)
+			if err != nil {
+				return nil, err
+			}
+			// Permanently preserve an object's history metadata.
+			obj.SetGUID(old.GetGUID())
+			obj.SetKind(old.GetKind())
+			obj.SetNamespace(old.GetNamespace())
+			obj.SetName(old.GetName())
+		}
+		now := time.Now()
+		// If it is not present, then we consider it as a newly created object.
+		if old.GetCreationTimestamp().IsZero() {
+			obj.SetCreationTimestamp(now)
+		} else {
+			obj.SetCreationTimestamp(old.GetCreationTimestamp())
+		}
+		obj.SetUpdatingTimestamp(now)
+		obj.SetResourceVersion("")
+		obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
+		return json.Marshal(obj)
+	})
+	if err != nil {
+		obj.SetResourceVersion(version)
+		return err
+	}
+	obj.SetResourceVersion(generic.FormatResourceVersion(rev))
+	return nil
+}
+
+func (in *conn) Delete(obj generic.Object) error {
+	return in.deleteKey(in.keyOf(obj))
+}
+
+// Bolt transactions could not be interrupted once they have begun, thus contexts are only
+// checked before requests are served.
+
+func (in *conn) CreateContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Create(obj)
+}
+
+func (in *conn) GetContext(ctx context.Context, cv generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Get(cv)
+}
+
+func (in *conn) WatchContext(ctx context.Context, cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return in.hub.Watch(ctx, cv, opt, sel...)
+}
+
+func (in *conn) ListContext(ctx context.Context, cv generic.ObjectList, opts ...generic.ListOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.List(cv, opts...)
+}
+
+func (in *conn) UpdateContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Update(obj)
+}
+
+func (in *conn) DeleteContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Delete(obj)
+}
+
+func (in *conn) keyOf(obj generic.Object) string {
+	if obj.HasNamespace() {
+		return filepath.Join("/", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	return filepath.Join("/", obj.GetKind(), obj.GetName())
+}
+
+// currentRevision returns the revision of storage within given transaction.
+func currentRevision(tx *bbolt.Tx) int64 {
+	if v := tx.Bucket(metaBucket).Get(revisionKey); len(v) == 8 {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+// nextRevision increases and returns the revision of storage within given transaction.
+func (in *conn) nextRevision(tx *bbolt.Tx) (int64, error) {
+	rev := currentRevision(tx) + 1
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(rev))
+	return rev, tx.Bucket(metaBucket).Put(revisionKey, v)
+}
+
+func (in *conn) txnCreate(key string, value interface{}) (rev int64, err error) {
+	defer in.logger.Sync()
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during creating data entity '%s' due to: %v", key, err)
+		}
+	}()
+	var b []byte
+	b, err = json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	err = in.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(objectBucket)
+		if bucket.Get([]byte(key)) != nil {
+			return generic.ErrResourceAlreadyExists
+		}
+		var err error
+		rev, err = in.nextRevision(tx)
+		if err != nil {
+			return err
+		}
+		r := &record{createRevision: rev, modRevision: rev, value: b}
+		return bucket.Put([]byte(key), r.marshal())
+	})
+	if err != nil {
+		return 0, err
+	}
+	in.hub.Notify(generic.CREATE, key, b, nil, rev)
+	in.logger.Debugf("Created key '%s'", key)
+	return rev, nil
+}
+
+func (in *conn) getKey(key string, cv generic.Object) (err error) {
+	defer in.logger.Sync()
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during getting data entity '%s' due to: %v", key, err)
+		}
+	}()
+	var r *record
+	err = in.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(objectBucket).Get([]byte(key))
+		if v == nil {
+			return generic.ErrResourceNotFound
+		}
+		var err error
+		r, err = unmarshalRecord(v)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	in.logger.Debugf("Retrieved key '%s'", key)
+	var value []byte
+	if value, err = generic.UpgradeRaw(r.value); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(value, cv); err != nil {
+		return err
+	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(r.modRevision))
+	return nil
+}
+
+// txnUpdate updates the value of key with update function. If expected is not zero, the
+// update will only be applied when the current modification revision of key matches it.
+// The revision of the update will be returned on success.
+func (in *conn) txnUpdate(key string, expected int64, update func(current []byte) ([]byte, error)) (rev int64, err error) {
+	var currentValue, updatedValue []byte
+	defer in.logger.Sync()
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during updating data entity '%s' due to: %v", key, err)
+		}
+	}()
+	var modRev int64
+	err = in.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(objectBucket).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		r, err := unmarshalRecord(v)
+		if err != nil {
+			return err
+		}
+		currentValue = r.value
+		modRev = r.modRevision
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if expected != 0 {
+		if modRev == 0 {
+			return 0, generic.ErrResourceNotFound
+		}
+		if modRev != expected {
+			return 0, generic.ErrResourceVersionConflict
+		}
+	}
+
+	updatedValue, err = update(currentValue)
+	if err != nil {
+		return 0, err
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	var created bool
+	err = in.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(objectBucket)
+		r := new(record)
+		if v := bucket.Get([]byte(key)); v != nil {
+			var err error
+			r, err = unmarshalRecord(v)
+			if err != nil {
+				return err
+			}
+		}
+		if r.modRevision != modRev {
+			return generic.ErrResourceVersionConflict
+		}
+		var err error
+		rev, err = in.nextRevision(tx)
+		if err != nil {
+			return err
+		}
+		if r.createRevision == 0 {
+			r.createRevision = rev
+			created = true
+		}
+		r.modRevision = rev
+		r.value = updatedValue
+		return bucket.Put([]byte(key), r.marshal())
+	})
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		in.hub.Notify(generic.CREATE, key, updatedValue, nil, rev)
+	} else {
+		in.hub.Notify(generic.UPDATE, key, updatedValue, currentValue, rev)
+	}
+	in.logger.Debugf("Updated key '%s'", key)
+	return rev, nil
+}
+
+func (in *conn) deleteKey(key string) (err error) {
+	defer in.logger.Sync()
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during deleting data entity '%s' due to: %v", key, err)
+		}
+	}()
+	var (
+		prev *record
+		rev  int64
+	)
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	err = in.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(objectBucket)
+		v := bucket.Get([]byte(key))
+		if v == nil {
+			return generic.ErrResourceNotFound
+		}
+		var err error
+		prev, err = unmarshalRecord(v)
+		if err != nil {
+			return err
+		}
+		if rev, err = in.nextRevision(tx); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return err
+	}
+	in.hub.Notify(generic.DELETE, key, prev.value, nil, rev)
+	in.logger.Debugf("Deleted key '%s'", key)
+	return nil
+}
@@ -46,6 +46,8 @@ type Config struct {
 	User       string      `json:"user,omitempty" yaml:"user,omitempty" toml:"user,omitempty"`
 	Password   string      `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty"`
 	SSLOptions *SSLOptions `json:"ssl,omitempty" yaml:"ssl,omitempty" toml:"ssl,omitempty"`
+	// RequestTimeout is the timeout duration (in seconds) of a single etcd request.
+	RequestTimeout int `json:"request_timeout,omitempty" yaml:"request_timeout,omitempty" toml:"request_timeout,omitempty"`
 }
 
 // Open is used for initiating a new connection with etcd cluster.
@@ -101,10 +103,15 @@ func (in *Config) Open(logger *zap.SugaredLogger) (generic.Storage, error) {
 	}
 	prefix := filepath.Join(in.Namespace...)
 	db.KV = namespace.NewKV(db.KV, prefix)
+	timeout := DefaultRequestTimeout
+	if in.RequestTimeout > 0 {
+		timeout = time.Duration(in.RequestTimeout) * time.Second
+	}
 	c := &conn{
-		prefix: prefix,
-		db:     db,
-		logger: logger,
+		prefix:  prefix,
+		timeout: timeout,
+		db:      db,
+		logger:  logger,
 	}
 	return c, nil
 }
@@ -23,20 +23,22 @@ import (
 	"time"
 
 	clientv3 "github.com/coreos/etcd/clientv3"
+	rpctypes "github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	uuid "github.com/satori/go.uuid"
 	generic "github.com/universonic/panther/pkg/storage/generic"
 	zap "go.uber.org/zap"
 )
 
 const (
-	// DefaultRequestTimeout indicates the timeout duration of all etcd request.
+	// DefaultRequestTimeout indicates the default timeout duration of all etcd request.
 	DefaultRequestTimeout = 3 * time.Second
 )
 
 type conn struct {
-	prefix string // This is a workaround as Client.Watch() does not wrap keys into KV
-	db     *clientv3.Client
-	logger *zap.SugaredLogger
+	prefix  string // This is a workaround as Client.Watch() does not wrap keys into KV
+	timeout time.Duration
+	db      *clientv3.Client
+	logger  *zap.SugaredLogger
 }
 
 func (in *conn) Close() error {
@@ -44,43 +46,101 @@ func (in *conn) Close() error {
 }
 
 func (in *conn) Create(obj generic.Object) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	return in.CreateContext(context.Background(), obj)
+}
+
+func (in *conn) CreateContext(ctx context.Context, obj generic.Object) error {
+	return in.create(ctx, obj, false)
+}
+
+// Restore creates an object, keeping its GUID and timestamps.
+func (in *conn) Restore(ctx context.Context, obj generic.Object) error {
+	return in.create(ctx, obj, true)
+}
+
+// CreateWithTTL creates an object which is attached to a new lease of ttl, thus it will be
+// deleted by etcd once the lease has expired.
+func (in *conn) CreateWithTTL(ctx context.Context, obj generic.Object, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
+	defer cancel()
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := in.db.Grant(ctx, seconds)
+	if err != nil {
+		return err
+	}
+	if err = in.create(ctx, obj, false, clientv3.WithLease(lease.ID)); err != nil {
+		// The lease would expire by itself anyway, thus it is fine if revoking failed.
+		in.db.Revoke(ctx, lease.ID)
+		return err
+	}
+	return nil
+}
+
+// create creates an object. Its GUID and timestamps are kept if restore is true.
+func (in *conn) create(ctx context.Context, obj generic.Object, restore bool, opts ...clientv3.OpOption) error {
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
 	defer cancel()
 	if _, err := uuid.FromString(obj.GetGUID()); err != nil {
 		obj.SetGUID(uuid.NewV4().String())
 	}
-	obj.SetCreationTimestamp(time.Now())
+	if !restore || obj.GetCreationTimestamp().IsZero() {
+		obj.SetCreationTimestamp(time.Now())
+	}
 	if obj.GetName() == "" {
 		obj.SetName(obj.GetGUID())
 	}
-	return in.txnCreate(ctx, in.keyOf(obj), obj)
+	// Versions are assigned by storage, and are never persisted along with objects.
+	obj.SetResourceVersion("")
+	obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
+	rev, err := in.txnCreate(ctx, in.keyOf(obj), obj, opts...)
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(generic.FormatResourceVersion(rev))
+	return nil
+}
+
+func (in *conn) Get(cv generic.Object) error {
+	return in.GetContext(context.Background(), cv)
 }
 
-func (in *conn) Get(cv generic.Object) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+func (in *conn) GetContext(ctx context.Context, cv generic.Object) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
 	defer cancel()
 	return in.getKey(ctx, in.keyOf(cv), cv)
 }
 
-func (in *conn) Watch(cv generic.Object, opt generic.WatchOption) (w generic.Watcher, err error) {
+func (in *conn) Watch(cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	return in.WatchContext(context.Background(), cv, opt, sel...)
+}
+
+func (in *conn) WatchContext(ctx context.Context, cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (w generic.Watcher, err error) {
 	var kp string
+	selector := generic.MergeSelectors(sel...)
+	rev, err := generic.ParseResourceVersion(cv.GetResourceVersion())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid resource version %q to watch from", cv.GetResourceVersion())
+	}
 	switch opt {
 	case generic.WatchOnKind:
 		kp = strings.TrimSuffix(in.prefix+filepath.Join("/", cv.GetKind()), "/") + "/"
-		return newWatcherFrom(clientv3.NewWatcher(in.db), kp, in.logger.Named("OBSERVER").With(
+		return newWatcherFrom(ctx, clientv3.NewWatcher(in.db), in.prefix, kp, rev, in.timeout, selector, in.logger.Named("OBSERVER").With(
 			"prefix", true,
 			"key", kp,
-		), clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithProgressNotify()), nil
+		), clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithProgressNotify())
 	case generic.WatchOnNamespace:
 		var ns string
 		if cv.HasNamespace() {
 			ns = cv.GetNamespace()
 		}
 		kp = strings.TrimSuffix(in.prefix+filepath.Join("/", cv.GetKind(), ns), "/") + "/"
-		return newWatcherFrom(clientv3.NewWatcher(in.db), kp, in.logger.Named("OBSERVER").With(
+		return newWatcherFrom(ctx, clientv3.NewWatcher(in.db), in.prefix, kp, rev, in.timeout, selector, in.logger.Named("OBSERVER").With(
 			"prefix", true,
 			"key", kp,
-		), clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithProgressNotify()), nil
+		), clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithProgressNotify())
 	case generic.WatchOnName:
 		var ns string
 		if cv.HasNamespace() {
@@ -92,42 +152,122 @@ func (in *conn) Watch(cv generic.Object, opt generic.WatchOption) (w generic.Wat
 			return nil, fmt.Errorf("Name must be specified while watching on a specific target")
 		}
 		kp = in.prefix + filepath.Join("/", cv.GetKind(), ns, cv.GetName())
-		return newWatcherFrom(clientv3.NewWatcher(in.db), kp, in.logger.Named("OBSERVER").With(
+		return newWatcherFrom(ctx, clientv3.NewWatcher(in.db), in.prefix, kp, rev, in.timeout, selector, in.logger.Named("OBSERVER").With(
 			"prefix", false,
 			"key", kp,
-		), clientv3.WithPrevKV(), clientv3.WithProgressNotify()), nil
+		), clientv3.WithPrevKV(), clientv3.WithProgressNotify())
 	}
 	return nil, fmt.Errorf("Invalid watch option")
 }
 
-func (in *conn) List(cv generic.ObjectList, ns ...string) (err error) {
+func (in *conn) List(cv generic.ObjectList, opts ...generic.ListOption) error {
+	return in.ListContext(context.Background(), cv, opts...)
+}
+
+func (in *conn) ListContext(ctx context.Context, cv generic.ObjectList, opts ...generic.ListOption) (err error) {
 	defer in.logger.Sync()
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
-	defer cancel()
-	var res *clientv3.GetResponse
-	if cv.HasNamespace() && len(ns) != 0 {
-		res, err = in.db.Get(ctx, filepath.Join("/", cv.GetKind(), ns[0])+"/", clientv3.WithPrefix())
+	o := generic.NewListOptions(opts...)
+	var prefix string
+	if cv.HasNamespace() && o.Namespace != "" {
+		prefix = filepath.Join("/", cv.GetKind(), o.Namespace) + "/"
 	} else {
-		res, err = in.db.Get(ctx, filepath.Join("/", cv.GetKind())+"/", clientv3.WithPrefix())
+		prefix = filepath.Join("/", cv.GetKind()) + "/"
 	}
-	if err != nil {
-		return
+	// A paginated list is retrieved at the revision of its first page, so that all pages
+	// together make up a consistent snapshot.
+	var rev int64
+	key := prefix
+	if o.Continue != "" {
+		if rev, key, err = generic.DecodeContinue(o.Continue, prefix); err != nil {
+			return
+		}
 	}
 	length := 0
-	for _, v := range res.Kvs {
-		if err = cv.AppendRaw(v.Value); err != nil {
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+	for {
+		options := []clientv3.OpOption{clientv3.WithRange(rangeEnd)}
+		if rev > 0 {
+			options = append(options, clientv3.WithRev(rev))
+		}
+		if o.Limit > 0 {
+			options = append(options, clientv3.WithLimit(o.Limit))
+		}
+		var res *clientv3.GetResponse
+		res, err = in.rangeKeys(ctx, key, options...)
+		if err == rpctypes.ErrCompacted {
+			return generic.ErrResourceExpired
+		}
+		if err != nil {
 			return
 		}
-		length++
+		if rev == 0 {
+			rev = res.Header.Revision
+		}
+		for _, v := range res.Kvs {
+			if o.Limit > 0 && int64(length) == o.Limit {
+				// The page is full while there are still more keys left.
+				cv.SetContinue(generic.EncodeContinue(rev, string(v.Key)))
+				break
+			}
+			var raw []byte
+			if raw, err = generic.UpgradeRaw(v.Value); err != nil {
+				return
+			}
+			// Etcd has no idea about the content of values, thus they are filtered here.
+			var matched bool
+			matched, err = o.Selector.MatchesRaw(cv.GetKind(), raw)
+			if err != nil {
+				return
+			}
+			if !matched {
+				continue
+			}
+			raw, err = generic.SetRawResourceVersion(raw, v.ModRevision)
+			if err != nil {
+				return
+			}
+			if err = cv.AppendRaw(raw); err != nil {
+				return
+			}
+			length++
+		}
+		if cv.GetContinue() != "" || !res.More || len(res.Kvs) == 0 {
+			break
+		}
+		key = string(res.Kvs[len(res.Kvs)-1].Key) + "\x00"
+		if o.Limit > 0 && int64(length) == o.Limit {
+			cv.SetContinue(generic.EncodeContinue(rev, key))
+			break
+		}
 	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(rev))
 	in.logger.Debugf("Listed %d object(s) in kind %s", length, cv.GetKind())
 	return nil
 }
 
+// rangeKeys retrieves a batch of keys from given key, each batch has its own timeout.
+func (in *conn) rangeKeys(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
+	defer cancel()
+	return in.db.Get(ctx, key, opts...)
+}
+
 func (in *conn) Update(obj generic.Object) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	return in.UpdateContext(context.Background(), obj)
+}
+
+func (in *conn) UpdateContext(ctx context.Context, obj generic.Object) error {
+	if generic.IsImmutable(obj) {
+		return generic.ErrImmutable
+	}
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
 	defer cancel()
-	return in.txnUpdate(ctx, in.keyOf(obj), func(currentValue []byte) ([]byte, error) {
+	version := obj.GetResourceVersion()
+	expected, err := generic.ParseResourceVersion(version)
+	if err != nil {
+		return generic.ErrResourceVersionConflict
+	}
+	rev, err := in.txnUpdate(ctx, in.keyOf(obj), expected, func(currentValue []byte) ([]byte, error) {
 		old := new(struct {
 			generic.ObjectMeta `json:"metadata,omitempty"`
 		})
@@ -150,12 +290,24 @@ func (in *conn) Update(obj generic.Object) error {
 			obj.SetCreationTimestamp(old.GetCreationTimestamp())
 		}
 		obj.SetUpdatingTimestamp(now)
+		obj.SetResourceVersion("")
+		obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
 		return json.Marshal(obj)
 	})
+	if err != nil {
+		obj.SetResourceVersion(version)
+		return err
+	}
+	obj.SetResourceVersion(generic.FormatResourceVersion(rev))
+	return nil
 }
 
 func (in *conn) Delete(obj generic.Object) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	return in.DeleteContext(context.Background(), obj)
+}
+
+func (in *conn) DeleteContext(ctx context.Context, obj generic.Object) error {
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
 	defer cancel()
 	return in.deleteKey(ctx, in.keyOf(obj))
 }
@@ -167,7 +319,7 @@ func (in *conn) keyOf(obj generic.Object) string {
 	return filepath.Join("/", obj.GetKind(), obj.GetName())
 }
 
-func (in *conn) txnCreate(ctx context.Context, key string, value interface{}) (err error) {
+func (in *conn) txnCreate(ctx context.Context, key string, value interface{}, opts ...clientv3.OpOption) (rev int64, err error) {
 	defer in.logger.Sync()
 	defer func() {
 		if err != nil {
@@ -177,25 +329,25 @@ func (in *conn) txnCreate(ctx context.Context, key string, value interface{}) (e
 	var b []byte
 	b, err = json.Marshal(value)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	txn := in.db.Txn(ctx)
 	var res *clientv3.TxnResponse
 	res, err = txn.
 		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
-		Then(clientv3.OpPut(key, string(b))).
+		Then(clientv3.OpPut(key, string(b), opts...)).
 		Commit()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if !res.Succeeded {
-		return generic.ErrResourceAlreadyExists
+		return 0, generic.ErrResourceAlreadyExists
 	}
-	in.logger.Debugf("Created key '%s': %s", key, b)
-	return nil
+	in.logger.Debugf("Created key '%s'", key)
+	return res.Header.Revision, nil
 }
 
-func (in *conn) getKey(ctx context.Context, key string, value interface{}) (err error) {
+func (in *conn) getKey(ctx context.Context, key string, cv generic.Object) (err error) {
 	defer in.logger.Sync()
 	defer func() {
 		if err != nil {
@@ -210,11 +362,22 @@ func (in *conn) getKey(ctx context.Context, key string, value interface{}) (err
 	if r.Count == 0 {
 		return generic.ErrResourceNotFound
 	}
-	in.logger.Debugf("Retrieved key '%s': %s", key, r.Kvs[0].Value)
-	return json.Unmarshal(r.Kvs[0].Value, value)
+	in.logger.Debugf("Retrieved key '%s'", key)
+	var value []byte
+	if value, err = generic.UpgradeRaw(r.Kvs[0].Value); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(value, cv); err != nil {
+		return err
+	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(r.Kvs[0].ModRevision))
+	return nil
 }
 
-func (in *conn) txnUpdate(ctx context.Context, key string, update func(current []byte) ([]byte, error)) (err error) {
+// txnUpdate updates the value of key with update function. If expected is not zero, the
+// update will only be applied when the current modification revision of key matches it.
+// The revision of the update will be returned on success.
+func (in *conn) txnUpdate(ctx context.Context, key string, expected int64, update func(current []byte) ([]byte, error)) (rev int64, err error) {
 	var currentValue, updatedValue []byte
 	defer in.logger.Sync()
 	defer func() {
@@ -225,33 +388,46 @@ func (in *conn) txnUpdate(ctx context.Context, key string, update func(current [
 	var getResp *clientv3.GetResponse
 	getResp, err = in.db.Get(ctx, key)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	var modRev int64
 	if len(getResp.Kvs) > 0 {
 		currentValue = getResp.Kvs[0].Value
 		modRev = getResp.Kvs[0].ModRevision
 	}
+	if expected != 0 {
+		if modRev == 0 {
+			return 0, generic.ErrResourceNotFound
+		}
+		if modRev != expected {
+			return 0, generic.ErrResourceVersionConflict
+		}
+	}
 
 	updatedValue, err = update(currentValue)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
+	// An existing key keeps its lease, or it would never expire once it has been updated.
+	var opts []clientv3.OpOption
+	if modRev != 0 {
+		opts = append(opts, clientv3.WithIgnoreLease())
+	}
 	txn := in.db.Txn(ctx)
 	var updateResp *clientv3.TxnResponse
 	updateResp, err = txn.
 		If(clientv3.Compare(clientv3.ModRevision(key), "=", modRev)).
-		Then(clientv3.OpPut(key, string(updatedValue))).
+		Then(clientv3.OpPut(key, string(updatedValue), opts...)).
 		Commit()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if !updateResp.Succeeded {
-		return fmt.Errorf("Could not update key=%q due to: Concurrent conflicting update occurred", key)
+		return 0, generic.ErrResourceVersionConflict
 	}
-	in.logger.Debugf("Updated key '%s': %s => %s", key, currentValue, updatedValue)
-	return nil
+	in.logger.Debugf("Updated key '%s'", key)
+	return updateResp.Header.Revision, nil
 }
 
 func (in *conn) deleteKey(ctx context.Context, key string) (err error) {
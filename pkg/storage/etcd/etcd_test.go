@@ -0,0 +1,31 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_test
+
+import (
+	"testing"
+
+	etcdtest "github.com/universonic/panther/pkg/storage/etcd/etcdtest"
+	storagetest "github.com/universonic/panther/pkg/storage/generic/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	server, err := etcdtest.NewEmbedded()
+	if err != nil {
+		t.Fatalf("Could not start embedded etcd server: %v", err)
+	}
+	defer server.Close()
+	storagetest.Run(t, server.Open)
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etcdtest provides an embedded single-member etcd server, so that the etcd
+// storage adapter could be tested without a live etcd cluster.
+package etcdtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	embed "github.com/coreos/etcd/embed"
+	etcd "github.com/universonic/panther/pkg/storage/etcd"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+// DefaultStartTimeout is the time duration to wait for the embedded server to be ready.
+const DefaultStartTimeout = 30 * time.Second
+
+// Embedded is a running embedded etcd server.
+type Embedded struct {
+	dir      string
+	endpoint string
+	server   *embed.Etcd
+}
+
+// Endpoint returns the client endpoint of the embedded server.
+func (in *Embedded) Endpoint() string {
+	return in.endpoint
+}
+
+// Open opens a new storage connection to the embedded server. Each connection is
+// isolated into its own key namespace, so that test cases never see each other.
+func (in *Embedded) Open(t *testing.T) generic.Storage {
+	cfg := etcd.New()
+	cfg.Endpoints = []string{in.endpoint}
+	cfg.Namespace = []string{"/com.redhat", "panther-test", fmt.Sprintf("%d", time.Now().UnixNano())}
+	s, err := cfg.Open(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("Could not connect to embedded etcd server: %v", err)
+	}
+	return s
+}
+
+// Close stops the embedded server and removes its data directory.
+func (in *Embedded) Close() error {
+	in.server.Close()
+	return os.RemoveAll(in.dir)
+}
+
+// NewEmbedded starts a new embedded etcd server which listens on random local ports,
+// and stores its data into a temporary directory.
+func NewEmbedded() (*Embedded, error) {
+	dir, err := ioutil.TempDir("", "panther-etcd")
+	if err != nil {
+		return nil, err
+	}
+	clientURL, err := randomLocalURL()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	peerURL, err := randomLocalURL()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	select {
+	case <-server.Server.ReadyNotify():
+	case err = <-server.Err():
+		server.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	case <-time.After(DefaultStartTimeout):
+		server.Server.Stop()
+		server.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("Embedded etcd server took too long to start")
+	}
+	return &Embedded{
+		dir:      dir,
+		endpoint: clientURL.Host,
+		server:   server,
+	}, nil
+}
+
+// randomLocalURL returns a local URL with a port that is currently available.
+func randomLocalURL() (*url.URL, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	return url.Parse("http://" + l.Addr().String())
+}
@@ -16,25 +16,46 @@ package etcd
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	clientv3 "github.com/coreos/etcd/clientv3"
 	generic "github.com/universonic/panther/pkg/storage/generic"
 	zap "go.uber.org/zap"
 )
 
+const (
+	// DefaultRetryInterval is the initial interval to wait before re-establishing a broken watcher.
+	DefaultRetryInterval = 100 * time.Millisecond
+	// MaxRetryInterval is the maximum interval to wait before re-establishing a broken watcher.
+	MaxRetryInterval = 10 * time.Second
+)
+
 // watcher is a low-level structure that wraps etcd watcher inside. Note that
 // you should prevent using the global watcher of the etcd client. And if so,
 // then you should never call Close unless the program is exiting.
+//
+// It tracks the latest revision that it has delivered, so that it could be
+// re-established from there without losing any event once the underlying
+// stream is broken, e.g. by network failures or a leader election.
 type watcher struct {
-	key     string
-	opts    []clientv3.OpOption
-	watcher clientv3.Watcher
-	outChan chan generic.WatchEvent
-	logger  *zap.SugaredLogger
+	prefix   string
+	key      string
+	revision int64
+	timeout  time.Duration
+	selector *generic.Selector
+	opts     []clientv3.OpOption
+	watcher  clientv3.Watcher
+	ctx      context.Context
+	cancel   context.CancelFunc
+	outChan  chan generic.WatchEvent
+	logger   *zap.SugaredLogger
 }
 
 func (in *watcher) Close() error {
+	in.cancel()
 	return in.watcher.Close()
 }
 
@@ -42,69 +63,259 @@ func (in *watcher) Output() <-chan generic.WatchEvent {
 	return in.outChan
 }
 
-func (in *watcher) watch() {
-	defer in.logger.Sync()
-	in.logger.Debug("Watcher started.")
-	in.logger.Sync()
+// kindOf returns the kind of object by its full key, which is laid out as
+// `<prefix>/<kind>/[<namespace>/]<name>`.
+func (in *watcher) kindOf(key string) string {
+	return strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(key, in.prefix), "/"), "/", 2)[0]
+}
+
+// versioned attaches the revision of event to its value as ResourceVersion.
+func (in *watcher) versioned(value []byte, revision int64) []byte {
+	v, err := generic.SetRawResourceVersion(value, revision)
+	if err != nil {
+		in.logger.Warnf("Could not attach resource version to event value: %v", err)
+		return value
+	}
+	return v
+}
+
+// upgradeEvent upgrades the values of an event to the current API version.
+func upgradeEvent(value, prev []byte) (_, _ []byte, err error) {
+	if value != nil {
+		if value, err = generic.UpgradeRaw(value); err != nil {
+			return nil, nil, err
+		}
+	}
+	if prev != nil {
+		if prev, err = generic.UpgradeRaw(prev); err != nil {
+			return nil, nil, err
+		}
+	}
+	return value, prev, nil
+}
+
+// send delivers an event to output, and returns false if the watcher has been closed.
+func (in *watcher) send(ev generic.WatchEvent) bool {
+	select {
+	case in.outChan <- ev:
+		in.logger.Debugw("Sent event =>", "type", ev.Type, "kind", ev.Kind, "key", ev.Key)
+		in.logger.Sync()
+		return true
+	case <-in.ctx.Done():
+		return false
+	}
+}
 
-	ch := in.watcher.Watch(context.Background(), in.key, in.opts...)
+// establish opens a new stream right after the latest delivered revision, and waits
+// until it has been established on server side, or we may miss those events that
+// occurred right after this call. The stream should be released with the returned
+// cancel function.
+func (in *watcher) establish() (clientv3.WatchChan, context.CancelFunc, error) {
+	opts := append([]clientv3.OpOption{clientv3.WithCreatedNotify()}, in.opts...)
+	if in.revision > 0 {
+		opts = append(opts, clientv3.WithRev(in.revision+1))
+	}
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(in.ctx))
+	ch := in.watcher.Watch(ctx, in.key, opts...)
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			cancel()
+			if err := in.ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("Watch stream was closed before being established")
+		}
+		if resp.CompactRevision != 0 {
+			cancel()
+			return in.compacted(resp.CompactRevision)
+		}
+		if err := resp.Err(); err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		if in.revision == 0 {
+			in.revision = resp.Header.Revision
+		}
+	case <-time.After(in.timeout):
+		in.logger.Warn("Watcher has not been established in time, events might be missed.")
+	case <-in.ctx.Done():
+		cancel()
+		return nil, nil, in.ctx.Err()
+	}
+	return ch, cancel, nil
+}
+
+// compacted reports a RESYNC event, and re-establishes the watcher from the oldest
+// revision that is still available.
+func (in *watcher) compacted(revision int64) (clientv3.WatchChan, context.CancelFunc, error) {
+	in.logger.Warnf("Revision %d has been compacted, resync from revision %d is required.", in.revision+1, revision)
+	if !in.send(generic.WatchEvent{
+		Type:  generic.RESYNC,
+		Value: []byte(fmt.Sprintf("Required revision %d has been compacted", in.revision+1)),
+	}) {
+		return nil, nil, in.ctx.Err()
+	}
+	in.revision = revision - 1
+	return in.establish()
+}
+
+// forward delivers all events of a stream. It returns when the stream has been broken,
+// or the watcher has been closed.
+func (in *watcher) forward(ch clientv3.WatchChan) error {
 	for resp := range ch {
+		if resp.CompactRevision != 0 {
+			return errCompacted{resp.CompactRevision}
+		}
 		if err := resp.Err(); err != nil {
-			in.outChan <- generic.WatchEvent{
-				Type:  generic.ERROR,
-				Value: []byte(err.Error()),
-			}
-			in.logger.Error(err)
-			return
+			return err
 		}
 		if resp.IsProgressNotify() {
+			// Nothing interested has changed till the revision in header.
+			if resp.Header.Revision > in.revision {
+				in.revision = resp.Header.Revision
+			}
+			continue
+		}
+		if resp.Created {
+			// The stream was not established in time, see establish.
+			if in.revision == 0 {
+				in.revision = resp.Header.Revision
+			}
 			continue
 		}
 		for _, event := range resp.Events {
-			var ev generic.WatchEvent
+			var (
+				t           generic.WatchEventType
+				value, prev []byte
+			)
 			switch event.Type {
 			case clientv3.EventTypePut:
-				var t generic.WatchEventType
 				if event.Kv.CreateRevision == event.Kv.ModRevision {
 					t = generic.CREATE
 				} else {
 					t = generic.UPDATE
 				}
-				k := string(event.Kv.Key)
-				ev = generic.WatchEvent{
-					Type:  t,
-					Kind:  filepath.Base(filepath.Dir(k)),
-					Key:   filepath.Base(k),
-					Value: event.Kv.Value,
+				value = event.Kv.Value
+				if event.PrevKv != nil {
+					prev = event.PrevKv.Value
 				}
 			case clientv3.EventTypeDelete:
-				k := string(event.Kv.Key)
-				ev = generic.WatchEvent{
-					Type:  generic.DELETE,
-					Kind:  filepath.Base(filepath.Dir(k)),
-					Key:   filepath.Base(k),
-					Value: event.PrevKv.Value,
+				t = generic.DELETE
+				if event.PrevKv != nil {
+					value = event.PrevKv.Value
 				}
 			default:
 				continue
 			}
+			k := string(event.Kv.Key)
+			kind := in.kindOf(k)
+			value, prev, err := upgradeEvent(value, prev)
+			if err != nil {
+				in.logger.Errorf("Dropped event on key '%s' due to: %v", k, err)
+				in.revision = event.Kv.ModRevision
+				continue
+			}
+			t, ok, err := in.selector.SelectEvent(t, kind, value, prev)
+			if err != nil {
+				in.logger.Warnf("Could not apply selector on key '%s' due to: %v", k, err)
+			}
+			if ok {
+				ev := generic.WatchEvent{
+					Type:  t,
+					Kind:  kind,
+					Key:   filepath.Base(k),
+					Value: in.versioned(value, event.Kv.ModRevision),
+				}
+				if !in.send(ev) {
+					return in.ctx.Err()
+				}
+			}
+			in.revision = event.Kv.ModRevision
+		}
+	}
+	if err := in.ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("Watch stream was closed unexpectedly")
+}
 
-			in.outChan <- ev
-			in.logger.Debugw("Sent event =>", "event", ev)
+// errCompacted indicates that the stream was cancelled since the revision it required
+// has been compacted.
+type errCompacted struct {
+	revision int64
+}
+
+func (in errCompacted) Error() string {
+	return fmt.Sprintf("Required revision has been compacted, the oldest available revision is %d", in.revision)
+}
+
+func (in *watcher) watch(ch clientv3.WatchChan, cancel context.CancelFunc) {
+	defer in.logger.Sync()
+	defer close(in.outChan)
+	// The watcher might be stopped by its parent context rather than Close.
+	defer in.watcher.Close()
+	in.logger.Debug("Watcher started.")
+	in.logger.Sync()
+
+	interval := DefaultRetryInterval
+	for {
+		err := in.forward(ch)
+		cancel()
+		if in.ctx.Err() != nil {
+			break
+		}
+		if e, ok := err.(errCompacted); ok {
+			ch, cancel, err = in.compacted(e.revision)
+		} else {
+			in.logger.Warnf("Watcher was broken at revision %d due to: %v", in.revision, err)
+			ch, cancel, err = in.establish()
+		}
+		// Keep retrying until it has been re-established, or the watcher is closed.
+		for err != nil {
+			if in.ctx.Err() != nil {
+				break
+			}
+			in.logger.Errorf("Could not re-establish watcher, retry in %v due to: %v", interval, err)
 			in.logger.Sync()
+			select {
+			case <-time.After(interval):
+			case <-in.ctx.Done():
+			}
+			if interval *= 2; interval > MaxRetryInterval {
+				interval = MaxRetryInterval
+			}
+			ch, cancel, err = in.establish()
 		}
+		if err != nil {
+			break
+		}
+		interval = DefaultRetryInterval
+		in.logger.Infof("Watcher has been re-established from revision %d.", in.revision+1)
 	}
 	in.logger.Debug("Watcher exited.")
 }
 
-func newWatcherFrom(w clientv3.Watcher, key string, logger *zap.SugaredLogger, opts ...clientv3.OpOption) generic.Watcher {
+func newWatcherFrom(parent context.Context, w clientv3.Watcher, prefix, key string, revision int64, timeout time.Duration, selector *generic.Selector, logger *zap.SugaredLogger, opts ...clientv3.OpOption) (generic.Watcher, error) {
+	ctx, cancel := context.WithCancel(parent)
 	t := &watcher{
-		key:     key,
-		opts:    opts,
-		watcher: w,
-		outChan: make(chan generic.WatchEvent, generic.DefaultWatchChanSize),
-		logger:  logger,
+		prefix:   prefix,
+		key:      key,
+		revision: revision,
+		timeout:  timeout,
+		selector: selector,
+		opts:     opts,
+		watcher:  w,
+		ctx:      ctx,
+		cancel:   cancel,
+		outChan:  make(chan generic.WatchEvent, generic.DefaultWatchChanSize),
+		logger:   logger,
+	}
+	ch, release, err := t.establish()
+	if err != nil {
+		t.Close()
+		return nil, err
 	}
-	go t.watch()
-	return t
+	go t.watch(ch, release)
+	return t, nil
 }
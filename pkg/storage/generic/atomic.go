@@ -30,6 +30,17 @@ type ObjectMeta struct {
 	CreatedAt Time `json:"created_at,omitempty" protobuf:"bytes,5,req,name=created_at"`
 	// UpdatedAt indicates the updating timestamp
 	UpdatedAt *Time `json:"updated_at,omitempty" protobuf:"bytes,6,opt,name=updated_at"`
+	// ResourceVersion is an opaque value that represents the internal version of the object,
+	// which is assigned by storage on every write. If it is present during an update, the
+	// update will be rejected with ErrResourceVersionConflict unless it matches the current
+	// version of the stored object. It is never persisted along with the object itself.
+	ResourceVersion string `json:"resource_version,omitempty" protobuf:"bytes,7,opt,name=resource_version"`
+	// Labels are key/value pairs that are used for organizing and selecting objects, such
+	// as their environment or role.
+	Labels map[string]string `json:"labels,omitempty" protobuf:"bytes,8,rep,name=labels"`
+	// APIVersion is the version of schema in which the object was written, which is assigned
+	// by storage on every write. Objects without it are in InitialAPIVersion.
+	APIVersion string `json:"api_version,omitempty" protobuf:"bytes,9,opt,name=api_version"`
 }
 
 // SetGUID set the GUID for an object
@@ -95,6 +106,36 @@ func (in *ObjectMeta) GetUpdatingTimestamp() *time.Time {
 	return &in.UpdatedAt.Time
 }
 
+// SetResourceVersion set the ResourceVersion for an object
+func (in *ObjectMeta) SetResourceVersion(version string) {
+	in.ResourceVersion = version
+}
+
+// GetResourceVersion returns the ResourceVersion of an object
+func (in *ObjectMeta) GetResourceVersion() string {
+	return in.ResourceVersion
+}
+
+// SetLabels set the Labels for an object
+func (in *ObjectMeta) SetLabels(labels map[string]string) {
+	in.Labels = labels
+}
+
+// GetLabels returns the Labels of an object
+func (in *ObjectMeta) GetLabels() map[string]string {
+	return in.Labels
+}
+
+// SetAPIVersion set the APIVersion for an object
+func (in *ObjectMeta) SetAPIVersion(version string) {
+	in.APIVersion = version
+}
+
+// GetAPIVersion returns the APIVersion of an object
+func (in *ObjectMeta) GetAPIVersion() string {
+	return in.APIVersion
+}
+
 // HasNamespace returns true if object is namespace-sensitive. This could be overriden
 // within specific object.
 func (in *ObjectMeta) HasNamespace() bool { return false }
@@ -105,6 +146,12 @@ type ObjectListMeta struct {
 	Kind string `json:"kind,omitempty"`
 	// Isolated represents it is a list of object with namespace
 	Isolated bool `json:"isolated,omitempty"`
+	// ResourceVersion represents the revision of storage at which the list was retrieved.
+	// It could be used to start watching right after the list.
+	ResourceVersion string `json:"resource_version,omitempty"`
+	// Continue is present if the list is a page of a paginated list, and there are more
+	// objects to retrieve with it.
+	Continue string `json:"continue,omitempty"`
 }
 
 // GetKind returns the Kind of an object list
@@ -117,6 +164,26 @@ func (in *ObjectListMeta) HasNamespace() bool {
 	return in.Isolated
 }
 
+// SetResourceVersion sets the ResourceVersion of an object list
+func (in *ObjectListMeta) SetResourceVersion(version string) {
+	in.ResourceVersion = version
+}
+
+// GetResourceVersion returns the ResourceVersion of an object list
+func (in *ObjectListMeta) GetResourceVersion() string {
+	return in.ResourceVersion
+}
+
+// SetContinue sets the Continue of an object list
+func (in *ObjectListMeta) SetContinue(token string) {
+	in.Continue = token
+}
+
+// GetContinue returns the Continue of an object list
+func (in *ObjectListMeta) GetContinue() string {
+	return in.Continue
+}
+
 // Time is a wrapper around time.Time which supports correct
 // marshaling to YAML and JSON.  Wrappers are provided for many
 // of the factory methods that the time package offers.
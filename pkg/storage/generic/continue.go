@@ -0,0 +1,186 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// DefaultPageSize is the number of objects retrieved by a single List of Iterator.
+const DefaultPageSize = 500
+
+// continueToken is the content of a continue token. It is opaque to clients.
+type continueToken struct {
+	// Revision is the revision of storage at which the first page was retrieved.
+	Revision int64 `json:"rev"`
+	// Start is the key from where the next page begins.
+	Start string `json:"start"`
+}
+
+// EncodeContinue returns a continue token which refers to a list at the revision, and
+// the next page of which begins at the key.
+func EncodeContinue(revision int64, start string) string {
+	dAtA, _ := json.Marshal(&continueToken{Revision: revision, Start: start})
+	return base64.RawURLEncoding.EncodeToString(dAtA)
+}
+
+// DecodeContinue decodes a continue token, and returns the revision of list and the key
+// from where the next page begins. The key must be within given prefix, or the token is
+// considered as invalid.
+func DecodeContinue(token, prefix string) (revision int64, start string, err error) {
+	dAtA, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, "", ErrInvalidContinue
+	}
+	t := new(continueToken)
+	if err = json.Unmarshal(dAtA, t); err != nil {
+		return 0, "", ErrInvalidContinue
+	}
+	if t.Revision < 0 || !strings.HasPrefix(t.Start, prefix) {
+		return 0, "", ErrInvalidContinue
+	}
+	return t.Revision, t.Start, nil
+}
+
+// rawList is an ObjectList that holds raw format data of any kind.
+type rawList struct {
+	ObjectListMeta
+	members [][]byte
+}
+
+func (in *rawList) AppendRaw(dAtA []byte) error {
+	in.members = append(in.members, dAtA)
+	return nil
+}
+
+// Iterator streams objects of a kind from storage page by page, so that only a single
+// page of objects is held in memory at a time. It is used like:
+//
+//   it := NewIterator(storage, RESOURCE_HOST_OPERATION, DefaultPageSize)
+//   for it.Next() {
+//       op := it.Object().(*HostOperation)
+//       ...
+//   }
+//   if err := it.Err(); err != nil {
+//       ...
+//   }
+type Iterator struct {
+	ctx      context.Context
+	storage  Storage
+	kind     string
+	isolated bool
+	pageSize int64
+	opts     []ListOption
+	page     [][]byte
+	pos      int
+	token    string
+	version  string
+	done     bool
+	obj      Object
+	err      error
+}
+
+// Next advances the iterator to the next object, and returns false if there is no more
+// object or an error occurred.
+func (in *Iterator) Next() bool {
+	if in.err != nil {
+		return false
+	}
+	for in.pos >= len(in.page) {
+		if in.done {
+			return false
+		}
+		if !in.fetch() {
+			return false
+		}
+	}
+	obj, err := NewObjectOf(in.kind)
+	if err != nil {
+		in.err = err
+		return false
+	}
+	if err = json.Unmarshal(in.page[in.pos], obj); err != nil {
+		in.err = err
+		return false
+	}
+	in.pos++
+	in.obj = obj
+	return true
+}
+
+// Object returns the current object.
+func (in *Iterator) Object() Object {
+	return in.obj
+}
+
+// ResourceVersion returns the resource version of the first page, from where a watcher
+// could be started right after the iteration. It is empty until Next has been called.
+func (in *Iterator) ResourceVersion() string {
+	return in.version
+}
+
+// Err returns the error occurred during iteration, if any.
+func (in *Iterator) Err() error {
+	return in.err
+}
+
+func (in *Iterator) fetch() bool {
+	list := &rawList{ObjectListMeta: ObjectListMeta{Kind: in.kind, Isolated: in.isolated}}
+	opts := append(append([]ListOption(nil), in.opts...), WithLimit(in.pageSize))
+	if in.token != "" {
+		opts = append(opts, WithContinue(in.token))
+	}
+	if err := in.storage.ListContext(in.ctx, list, opts...); err != nil {
+		in.err = err
+		return false
+	}
+	if in.version == "" {
+		in.version = list.GetResourceVersion()
+	}
+	in.page, in.pos = list.members, 0
+	in.token = list.GetContinue()
+	in.done = in.token == ""
+	return true
+}
+
+// NewIterator returns an Iterator over objects of given kind, which retrieves a page of
+// pageSize objects at a time. Zero pageSize means DefaultPageSize.
+func NewIterator(s Storage, kind string, pageSize int64, opts ...ListOption) *Iterator {
+	return NewIteratorContext(context.Background(), s, kind, pageSize, opts...)
+}
+
+// NewIteratorContext is like NewIterator, but all pages are retrieved with given context.
+func NewIteratorContext(ctx context.Context, s Storage, kind string, pageSize int64, opts ...ListOption) *Iterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	it := &Iterator{
+		ctx:      ctx,
+		storage:  s,
+		kind:     kind,
+		pageSize: pageSize,
+		opts:     opts,
+	}
+	obj, err := NewObjectOf(kind)
+	if err != nil {
+		it.err = err
+		return it
+	}
+	it.isolated = obj.HasNamespace()
+	return it
+}
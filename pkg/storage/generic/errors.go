@@ -14,6 +14,12 @@
 
 package generic
 
+import "errors"
+
+// ErrSchemaTooNew is the error returned if an object was stored in a newer API version than
+// this binary supports. It is an internal error, as clients could do nothing about it.
+var ErrSchemaTooNew = errors.New("Stored schema is newer than supported")
+
 type overlayError struct {
 	s string
 }
@@ -32,6 +38,21 @@ var (
 
 	// ErrResourceAlreadyExists is the error returned by storages if a resource ID has been taken during a creation.
 	ErrResourceAlreadyExists = newOverlayError("ID or name already exists")
+
+	// ErrResourceVersionConflict is the error returned by storages if an object has been modified
+	// since the version that an update was based on.
+	ErrResourceVersionConflict = newOverlayError("Object has been modified, please apply your changes to the latest version and try again")
+
+	// ErrImmutable is the error returned by storages if an update was applied on an immutable object.
+	ErrImmutable = newOverlayError("Object is immutable and could not be updated")
+
+	// ErrInvalidContinue is the error returned by storages if a continue token of List is malformed,
+	// or does not belong to the list.
+	ErrInvalidContinue = newOverlayError("Invalid continue token")
+
+	// ErrResourceExpired is the error returned by storages if the snapshot that a continue token
+	// refers to is no longer available.
+	ErrResourceExpired = newOverlayError("The continue token has expired, please list again from the beginning")
 )
 
 // IsInternalError checks if a given error is an internal error which is generally a storage error.
@@ -57,3 +78,27 @@ func IsConflict(e error) bool {
 	}
 	return false
 }
+
+// IsVersionConflict returns true if a given error is ErrResourceVersionConflict
+func IsVersionConflict(e error) bool {
+	if e == ErrResourceVersionConflict {
+		return true
+	}
+	return false
+}
+
+// IsExpired returns true if a given error is ErrResourceExpired
+func IsExpired(e error) bool {
+	if e == ErrResourceExpired {
+		return true
+	}
+	return false
+}
+
+// IsImmutableError returns true if a given error is ErrImmutable
+func IsImmutableError(e error) bool {
+	if e == ErrImmutable {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseSecuritySeverity parses a severity by its name (case-insensitive), e.g. "critical",
+// or by its value, e.g. "1".
+func ParseSecuritySeverity(s string) (SecuritySeverity, error) {
+	s = strings.TrimSpace(s)
+	for sev := CriticalSec; sev <= LowSec; sev++ {
+		if strings.EqualFold(s, sev.String()) || s == strconv.Itoa(int(sev)) {
+			return sev, nil
+		}
+	}
+	return UnknownSec, fmt.Errorf("Invalid severity: %s", s)
+}
+
+// CVEFilter selects the security updates to be reported by CVEs. Each of the criteria must
+// be satisfied if it is given, thus an empty filter selects every update which fixes a CVE.
+type CVEFilter struct {
+	CVEs       []string           `json:"cves,omitempty"`
+	Severities []SecuritySeverity `json:"severities,omitempty"`
+	// Since and Until restrict the dates (in the form of 2006-01-02, inclusive) when the
+	// advisories were issued. Updates whose dates are unknown do not satisfy them.
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
+// Matches returns true if the update fixes a CVE and satisfies all criteria of filter.
+func (in *CVEFilter) Matches(update SecurityUpdate) bool {
+	if update.CVEID == "" {
+		return false
+	}
+	if len(in.CVEs) > 0 && !containsFold(in.CVEs, update.CVEID) {
+		return false
+	}
+	if len(in.Severities) > 0 {
+		var matched bool
+		for _, each := range in.Severities {
+			if each == update.Severity {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	// Dates are compared as strings, as they are of the same layout.
+	if in.Since != "" && (update.Issued == "" || update.Issued < in.Since) {
+		return false
+	}
+	if in.Until != "" && (update.Issued == "" || update.Issued > in.Until) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, each := range list {
+		if strings.EqualFold(each, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CVEExposure is a CVE and the hosts which are exposed to it, i.e. those have pending
+// updates which fix it.
+type CVEExposure struct {
+	CVEID string `json:"cve_id"`
+	// Severity is the most severe one among the advisories which fix the CVE, and Issued is
+	// the earliest date when they were issued.
+	Severity   SecuritySeverity `json:"severity,omitempty"`
+	Issued     string           `json:"issued,omitempty"`
+	Advisories []string         `json:"advisories,omitempty"`
+	Hosts      []ExposedHost    `json:"hosts,omitempty"`
+}
+
+// ExposedHost is a host exposed to a CVE, and the packages to be updated to fix it.
+type ExposedHost struct {
+	Host     string   `json:"host"`
+	Packages []string `json:"packages,omitempty"`
+}
+
+// moreSevere returns true if a is more severe than b, where unknown severities are the least.
+func moreSevere(a, b SecuritySeverity) bool {
+	if a == UnknownSec || b == UnknownSec {
+		return b == UnknownSec && a != UnknownSec
+	}
+	return a < b
+}
+
+// IndexCVEs inverts the security updates of scans into CVEs, which are ordered by severity
+// and then by ID. Only successful scans are considered, and hosts are ordered by name.
+func IndexCVEs(scans []SystemScan, filter *CVEFilter) []CVEExposure {
+	index := make(map[string]*CVEExposure)
+	for _, scan := range scans {
+		if scan.State != SuccessState {
+			continue
+		}
+		for _, update := range scan.Security {
+			if !filter.Matches(update) {
+				continue
+			}
+			id := strings.ToUpper(update.CVEID)
+			cve, ok := index[id]
+			if !ok {
+				cve = &CVEExposure{CVEID: id, Severity: update.Severity, Issued: update.Issued}
+				index[id] = cve
+			}
+			if moreSevere(update.Severity, cve.Severity) {
+				cve.Severity = update.Severity
+			}
+			if update.Issued != "" && (cve.Issued == "" || update.Issued < cve.Issued) {
+				cve.Issued = update.Issued
+			}
+			if update.Advisory != "" && !contains(cve.Advisories, update.Advisory) {
+				cve.Advisories = append(cve.Advisories, update.Advisory)
+			}
+			if n := len(cve.Hosts); n == 0 || cve.Hosts[n-1].Host != scan.GetName() {
+				cve.Hosts = append(cve.Hosts, ExposedHost{Host: scan.GetName()})
+			}
+			host := &cve.Hosts[len(cve.Hosts)-1]
+			if update.Package != "" && !contains(host.Packages, update.Package) {
+				host.Packages = append(host.Packages, update.Package)
+			}
+		}
+	}
+	out := make([]CVEExposure, 0, len(index))
+	for _, each := range index {
+		sort.Strings(each.Advisories)
+		sort.Slice(each.Hosts, func(i, j int) bool { return each.Hosts[i].Host < each.Hosts[j].Host })
+		out = append(out, *each)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Severity != out[j].Severity {
+			return moreSevere(out[i].Severity, out[j].Severity)
+		}
+		return out[i].CVEID < out[j].CVEID
+	})
+	return out
+}
+
+// ExposureSummary counts the exposure of all hosts to CVEs.
+type ExposureSummary struct {
+	// Hosts is the number of hosts which have been scanned successfully, and ExposedHosts is
+	// the number of those exposed to at least one CVE.
+	Hosts        int                `json:"hosts"`
+	ExposedHosts int                `json:"exposed_hosts"`
+	CVEs         int                `json:"cves"`
+	Severities   []SeverityExposure `json:"severities"`
+}
+
+// SeverityExposure counts CVEs of a severity, and the hosts exposed to at least one of them.
+type SeverityExposure struct {
+	Severity SecuritySeverity `json:"severity"`
+	CVEs     int              `json:"cves"`
+	Hosts    int              `json:"hosts"`
+}
+
+// SummarizeExposure summarizes the CVEs indexed from scans by IndexCVEs. Every severity is
+// counted even if there is no CVE of it, from the most severe to unknown.
+func SummarizeExposure(scans []SystemScan, cves []CVEExposure) *ExposureSummary {
+	out := new(ExposureSummary)
+	for _, scan := range scans {
+		if scan.State == SuccessState {
+			out.Hosts++
+		}
+	}
+	out.CVEs = len(cves)
+	exposed := make(map[string]bool)
+	bySeverity := make(map[SecuritySeverity]map[string]bool)
+	counts := make(map[SecuritySeverity]int)
+	for _, cve := range cves {
+		counts[cve.Severity]++
+		if bySeverity[cve.Severity] == nil {
+			bySeverity[cve.Severity] = make(map[string]bool)
+		}
+		for _, each := range cve.Hosts {
+			exposed[each.Host] = true
+			bySeverity[cve.Severity][each.Host] = true
+		}
+	}
+	out.ExposedHosts = len(exposed)
+	for _, sev := range []SecuritySeverity{CriticalSec, ImportantSec, ModerateSec, LowSec, UnknownSec} {
+		out.Severities = append(out.Severities, SeverityExposure{
+			Severity: sev,
+			CVEs:     counts[sev],
+			Hosts:    len(bySeverity[sev]),
+		})
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSecuritySeverity(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    SecuritySeverity
+		invalid bool
+	}{
+		{in: "critical", want: CriticalSec},
+		{in: " Important ", want: ImportantSec},
+		{in: "MODERATE", want: ModerateSec},
+		{in: "4", want: LowSec},
+		{in: "0", invalid: true},
+		{in: "urgent", invalid: true},
+	}
+	for _, c := range cases {
+		got, err := ParseSecuritySeverity(c.in)
+		if c.invalid != (err != nil) || got != c.want {
+			t.Errorf("%q: expected %v (invalid %v), got %v, %v", c.in, c.want, c.invalid, got, err)
+		}
+	}
+}
+
+func TestCVEFilterMatches(t *testing.T) {
+	update := SecurityUpdate{CVEID: "CVE-2018-0001", Severity: ImportantSec, Issued: "2018-01-05"}
+	cases := []struct {
+		name   string
+		filter CVEFilter
+		update SecurityUpdate
+		want   bool
+	}{
+		{name: "empty filter", update: update, want: true},
+		{name: "no CVE", update: SecurityUpdate{Severity: ImportantSec}},
+		{name: "CVE", filter: CVEFilter{CVEs: []string{"CVE-2018-0002", "CVE-2018-0001"}}, update: update, want: true},
+		{name: "CVE case-insensitive", filter: CVEFilter{CVEs: []string{"cve-2018-0001"}}, update: update, want: true},
+		{name: "other CVE", filter: CVEFilter{CVEs: []string{"CVE-2018-0002"}}, update: update},
+		{name: "severity", filter: CVEFilter{Severities: []SecuritySeverity{CriticalSec, ImportantSec}}, update: update, want: true},
+		{name: "other severity", filter: CVEFilter{Severities: []SecuritySeverity{CriticalSec}}, update: update},
+		{name: "since inclusive", filter: CVEFilter{Since: "2018-01-05"}, update: update, want: true},
+		{name: "since later", filter: CVEFilter{Since: "2018-01-06"}, update: update},
+		{name: "until inclusive", filter: CVEFilter{Until: "2018-01-05"}, update: update, want: true},
+		{name: "until earlier", filter: CVEFilter{Until: "2018-01-04"}, update: update},
+		{name: "between", filter: CVEFilter{Since: "2018-01-01", Until: "2018-01-31"}, update: update, want: true},
+		{name: "since unknown date", filter: CVEFilter{Since: "2018-01-01"}, update: SecurityUpdate{CVEID: "CVE-2018-0001"}},
+		{name: "until unknown date", filter: CVEFilter{Until: "2018-01-31"}, update: SecurityUpdate{CVEID: "CVE-2018-0001"}},
+	}
+	for _, c := range cases {
+		if got := c.filter.Matches(c.update); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func testExposureScans() []SystemScan {
+	scan := func(name string, state State, updates ...SecurityUpdate) SystemScan {
+		out := NewSystemScan()
+		out.SetName(name)
+		out.State = state
+		out.Security = updates
+		return *out
+	}
+	return []SystemScan{
+		scan("web-2", SuccessState,
+			SecurityUpdate{CVEID: "CVE-2018-0001", Severity: CriticalSec, Package: "a", Advisory: "RHSA-2018:0001", Issued: "2018-01-05"},
+			SecurityUpdate{CVEID: "cve-2018-0001", Severity: ImportantSec, Package: "b", Advisory: "RHSA-2018:0002", Issued: "2018-01-03"},
+			SecurityUpdate{CVEID: "CVE-2018-0001", Severity: CriticalSec, Package: "a", Advisory: "RHSA-2018:0001", Issued: "2018-01-05"},
+			SecurityUpdate{CVEID: "CVE-2018-0002", Severity: ModerateSec, Package: "c", Advisory: "RHSA-2018:0003", Issued: "2018-02-01"},
+			SecurityUpdate{Package: "d", Advisory: "RHBA-2018:0001", Type: BugfixAdvisory},
+		),
+		scan("web-1", SuccessState,
+			SecurityUpdate{CVEID: "CVE-2018-0001", Package: "a", Advisory: "RHSA-2018:0001", Issued: "2018-01-05"},
+			SecurityUpdate{CVEID: "CVE-2018-0003", Package: "d", Advisory: "RHSA-2018:0004"},
+		),
+		// Failed scans are not considered.
+		scan("web-3", FailureState,
+			SecurityUpdate{CVEID: "CVE-2018-0004", Severity: CriticalSec, Package: "a", Advisory: "RHSA-2018:0005"},
+		),
+		scan("web-4", SuccessState),
+	}
+}
+
+func TestIndexCVEs(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter CVEFilter
+		want   []CVEExposure
+	}{
+		{
+			name: "all",
+			want: []CVEExposure{
+				{
+					CVEID:      "CVE-2018-0001",
+					Severity:   CriticalSec,
+					Issued:     "2018-01-03",
+					Advisories: []string{"RHSA-2018:0001", "RHSA-2018:0002"},
+					Hosts: []ExposedHost{
+						{Host: "web-1", Packages: []string{"a"}},
+						{Host: "web-2", Packages: []string{"a", "b"}},
+					},
+				},
+				{
+					CVEID:      "CVE-2018-0002",
+					Severity:   ModerateSec,
+					Issued:     "2018-02-01",
+					Advisories: []string{"RHSA-2018:0003"},
+					Hosts:      []ExposedHost{{Host: "web-2", Packages: []string{"c"}}},
+				},
+				{
+					CVEID:      "CVE-2018-0003",
+					Advisories: []string{"RHSA-2018:0004"},
+					Hosts:      []ExposedHost{{Host: "web-1", Packages: []string{"d"}}},
+				},
+			},
+		},
+		{
+			name:   "severity",
+			filter: CVEFilter{Severities: []SecuritySeverity{CriticalSec}},
+			want: []CVEExposure{
+				{
+					CVEID:      "CVE-2018-0001",
+					Severity:   CriticalSec,
+					Issued:     "2018-01-05",
+					Advisories: []string{"RHSA-2018:0001"},
+					Hosts:      []ExposedHost{{Host: "web-2", Packages: []string{"a"}}},
+				},
+			},
+		},
+		{
+			name:   "CVE and dates",
+			filter: CVEFilter{CVEs: []string{"cve-2018-0001", "cve-2018-0003"}, Since: "2018-01-04"},
+			want: []CVEExposure{
+				{
+					CVEID:      "CVE-2018-0001",
+					Severity:   CriticalSec,
+					Issued:     "2018-01-05",
+					Advisories: []string{"RHSA-2018:0001"},
+					Hosts: []ExposedHost{
+						{Host: "web-1", Packages: []string{"a"}},
+						{Host: "web-2", Packages: []string{"a"}},
+					},
+				},
+			},
+		},
+		{
+			name:   "nothing",
+			filter: CVEFilter{Until: "2017-12-31"},
+			want:   []CVEExposure{},
+		},
+	}
+	for _, c := range cases {
+		if got := IndexCVEs(testExposureScans(), &c.filter); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestSummarizeExposure(t *testing.T) {
+	scans := testExposureScans()
+	got := SummarizeExposure(scans, IndexCVEs(scans, &CVEFilter{}))
+	want := &ExposureSummary{
+		Hosts:        3,
+		ExposedHosts: 2,
+		CVEs:         3,
+		Severities: []SeverityExposure{
+			{Severity: CriticalSec, CVEs: 1, Hosts: 2},
+			{Severity: ImportantSec},
+			{Severity: ModerateSec, CVEs: 1, Hosts: 1},
+			{Severity: LowSec},
+			{Severity: UnknownSec, CVEs: 1, Hosts: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	// Every severity is counted even if nothing is exposed.
+	got = SummarizeExposure(nil, nil)
+	if got.Hosts != 0 || got.ExposedHosts != 0 || got.CVEs != 0 || len(got.Severities) != 5 {
+		t.Errorf("Expected an empty summary of all severities, got %+v", got)
+	}
+}
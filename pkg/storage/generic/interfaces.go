@@ -15,6 +15,7 @@
 package generic
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 )
@@ -39,24 +40,147 @@ type SortableObject interface {
 	GetCreationTimestamp() time.Time
 	SetUpdatingTimestamp(timestamp time.Time)
 	GetUpdatingTimestamp() *time.Time
+	SetResourceVersion(version string)
+	GetResourceVersion() string
+	SetLabels(labels map[string]string)
+	GetLabels() map[string]string
+	SetAPIVersion(version string)
+	GetAPIVersion() string
+}
+
+// Immutable is implemented by objects which could never be updated once created. Storages
+// reject updates on them with ErrImmutable, while they could still be deleted.
+type Immutable interface {
+	IsImmutable() bool
+}
+
+// IsImmutable returns true if the object could never be updated once created.
+func IsImmutable(obj Object) bool {
+	v, ok := obj.(Immutable)
+	return ok && v.IsImmutable()
 }
 
 // ObjectList indicates a generic type of object list
 type ObjectList interface {
 	GetKind() string
 	HasNamespace() bool
+	SetResourceVersion(version string)
+	GetResourceVersion() string
+	SetContinue(token string)
+	GetContinue() string
 	AppendRaw([]byte) error
 }
 
-// Storage is the interface that is used for interacting with database.
+// Storage is the interface that is used for interacting with database. Both List and
+// Watch could be narrowed down by selectors, and only those objects that satisfy all of
+// them will be returned or observed.
+//
+// Each method has a variant that accepts a context, which could be used to cancel the
+// request. The request timeout of storage still applies on top of the context, and the
+// methods without a context are equivalent to their variants with context.Background().
+// The watcher returned by WatchContext is closed once the context is done.
 type Storage interface {
 	Close() error
 	Create(obj Object) error
+	CreateContext(ctx context.Context, obj Object) error
 	Get(cv Object) error
-	Watch(cv Object, opt WatchOption) (Watcher, error)
-	List(cv ObjectList, ns ...string) error
+	GetContext(ctx context.Context, cv Object) error
+	Watch(cv Object, opt WatchOption, sel ...*Selector) (Watcher, error)
+	WatchContext(ctx context.Context, cv Object, opt WatchOption, sel ...*Selector) (Watcher, error)
+	List(cv ObjectList, opts ...ListOption) error
+	ListContext(ctx context.Context, cv ObjectList, opts ...ListOption) error
 	Update(obj Object) error
+	UpdateContext(ctx context.Context, obj Object) error
 	Delete(obj Object) error
+	DeleteContext(ctx context.Context, obj Object) error
+}
+
+// Expirer is implemented by storages which are able to expire objects by themselves, such
+// as etcd with leases. An object created by CreateWithTTL is deleted by storage once its
+// ttl has elapsed, no matter whether it has been updated since.
+type Expirer interface {
+	CreateWithTTL(ctx context.Context, obj Object, ttl time.Duration) error
+}
+
+// Restorer is implemented by storages which are able to create objects as they are. Unlike
+// Create, the GUID and the timestamps of object are kept, thus it is used for restoring
+// objects from archives. Those absent are still assigned as Create does.
+type Restorer interface {
+	Restore(ctx context.Context, obj Object) error
+}
+
+// ListOptions are the options of List.
+type ListOptions struct {
+	// Namespace restricts the result to a namespace. It is only effective on lists of
+	// namespace-sensitive objects.
+	Namespace string
+	// Selector restricts the result to those objects that satisfy it.
+	Selector *Selector
+	// Limit is the maximum number of objects to return. If there are more objects, the
+	// Continue of list will be set for retrieving the next page. Zero means no limit.
+	Limit int64
+	// Continue is the token returned by the previous page, from where to continue.
+	Continue string
+}
+
+// ListOption is a function that modifies ListOptions.
+type ListOption func(*ListOptions)
+
+// InNamespace restricts the result of List to given namespace.
+func InNamespace(ns string) ListOption {
+	return func(in *ListOptions) {
+		in.Namespace = ns
+	}
+}
+
+// WithSelector restricts the result of List to those objects that satisfy the selector.
+// If specified multiple times, all of them must be satisfied.
+func WithSelector(sel *Selector) ListOption {
+	return func(in *ListOptions) {
+		in.Selector = MergeSelectors(in.Selector, sel)
+	}
+}
+
+// WithLimit restricts the number of objects returned by List. The rest of objects could
+// be retrieved by the continue token of the returned list.
+func WithLimit(limit int64) ListOption {
+	return func(in *ListOptions) {
+		in.Limit = limit
+	}
+}
+
+// WithContinue continues a paginated List from the token returned by the previous page.
+// Other options must be the same as those of the previous page.
+func WithContinue(token string) ListOption {
+	return func(in *ListOptions) {
+		in.Continue = token
+	}
+}
+
+// NewListOptions returns ListOptions with given options applied.
+func NewListOptions(opts ...ListOption) *ListOptions {
+	o := new(ListOptions)
+	for _, fn := range opts {
+		fn(o)
+	}
+	return o
+}
+
+// MergeSelectors returns a selector that requires all given selectors, or nil if there
+// is none.
+func MergeSelectors(sel ...*Selector) *Selector {
+	var out *Selector
+	for _, s := range sel {
+		if s.Empty() {
+			continue
+		}
+		if out == nil {
+			out = s
+			continue
+		}
+		out = out.And(s)
+	}
+	return out
 }
 
 // DefaultWatchChanSize indicates the default channel size of watcher output
@@ -78,6 +202,7 @@ var WatchEventTypeName = map[uint8]string{
 	0x02: "UPDATE",
 	0x04: "DELETE",
 	0x08: "ERROR",
+	0x10: "RESYNC",
 }
 
 const (
@@ -89,9 +214,16 @@ const (
 	DELETE
 	// ERROR indicates an error watching event
 	ERROR
+	// RESYNC indicates that some events could not be delivered as the history of storage
+	// has been lost, e.g. compacted. The watcher keeps going on from the oldest available
+	// revision, but consumers should list objects again to recover their states.
+	RESYNC
 )
 
-// Watcher is a generic watcher of Storage
+// Watcher is a generic watcher of Storage. If the ResourceVersion of the object being
+// watched is specified, events right after that version will be delivered, so that a
+// watcher could be resumed from the last event it has seen, or started from the version
+// of a list without losing any event. Otherwise, it starts from the current revision.
 type Watcher interface {
 	Close() error
 	Output() <-chan WatchEvent
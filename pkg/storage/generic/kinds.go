@@ -0,0 +1,76 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	kindsLock sync.RWMutex
+	kinds     = make(map[string]func() Object)
+)
+
+// RegisterKind makes a kind of object known by its constructor, so that raw format data
+// of that kind could be decoded without knowing its type in advance. If RegisterKind is
+// called twice with the same kind or if fn is nil, it panics.
+func RegisterKind(kind string, fn func() Object) {
+	kindsLock.Lock()
+	defer kindsLock.Unlock()
+	if fn == nil {
+		panic("generic: RegisterKind constructor is nil")
+	}
+	if _, dup := kinds[kind]; dup {
+		panic("generic: RegisterKind called twice for kind " + kind)
+	}
+	kinds[kind] = fn
+}
+
+// NewObjectOf returns a new empty object of given kind, and any encountered error.
+func NewObjectOf(kind string) (Object, error) {
+	kindsLock.RLock()
+	fn, ok := kinds[kind]
+	kindsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown kind of object: %s", kind)
+	}
+	return fn(), nil
+}
+
+// Kinds returns all registered kinds in order.
+func Kinds() []string {
+	kindsLock.RLock()
+	defer kindsLock.RUnlock()
+	var list []string
+	for kind := range kinds {
+		list = append(list, kind)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func init() {
+	RegisterKind(RESOURCE_HOST, func() Object { return NewHost() })
+	RegisterKind(RESOURCE_SYSTEM_SCAN, func() Object { return NewSystemScan() })
+	RegisterKind(RESOURCE_HOST_OPERATION, func() Object { return NewHostOperation() })
+	RegisterKind(RESOURCE_SCAN_RECORD, func() Object { return NewScanRecord() })
+	RegisterKind(RESOURCE_UPDATE_JOB, func() Object { return NewUpdateJob() })
+	RegisterKind(RESOURCE_HOST_FACTS, func() Object { return NewHostFacts() })
+	RegisterKind(RESOURCE_PACKAGE_INVENTORY, func() Object { return NewPackageInventory() })
+	RegisterKind(RESOURCE_VULNERABILITY_REPORT, func() Object { return NewVulnerabilityReport() })
+	RegisterKind(RESOURCE_SCHEDULE, func() Object { return NewSchedule() })
+}
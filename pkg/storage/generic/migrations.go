@@ -0,0 +1,36 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+// migrateAdvisoryType marks the updates of scans stored in v1 as security advisories, as
+// only CVEs were recorded by then.
+func migrateAdvisoryType(obj map[string]interface{}) error {
+	updates, _ := obj["security"].([]interface{})
+	for _, each := range updates {
+		update, ok := each.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok = update["type"]; !ok {
+			update["type"] = string(SecurityAdvisory)
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterMigration(RESOURCE_SYSTEM_SCAN, "v1", migrateAdvisoryType)
+	RegisterMigration(RESOURCE_SCAN_RECORD, "v1", migrateAdvisoryType)
+}
@@ -0,0 +1,340 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Package managers whose version schemes are understood.
+const (
+	// RPMManager indicates packages versioned as `[EPOCH:]VERSION-RELEASE`, see rpmvercmp.
+	RPMManager = "rpm"
+	// DpkgManager indicates packages versioned as `[EPOCH:]UPSTREAM[-REVISION]`, see
+	// deb-version(7).
+	DpkgManager = "dpkg"
+)
+
+// CompareVersions compares two versions of packages by the scheme of given package manager,
+// and returns -1, 0 or 1 if a is older than, equal to or newer than b.
+func CompareVersions(manager, a, b string) int {
+	if manager == DpkgManager {
+		return compareDebian(a, b)
+	}
+	return compareRPM(a, b)
+}
+
+// splitEpoch splits the epoch from version, which is empty if omitted.
+func splitEpoch(version string) (epoch, rest string) {
+	if i := strings.Index(version, ":"); i >= 0 {
+		return version[:i], version[i+1:]
+	}
+	return "", version
+}
+
+// compareEpoch compares epochs numerically, where an omitted epoch is 0.
+func compareEpoch(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareRPM compares `[EPOCH:]VERSION[-RELEASE]` of rpm. Releases are compared only if both
+// versions have them, thus `1.0.2k` equals to any release of it.
+func compareRPM(a, b string) int {
+	ae, a := splitEpoch(a)
+	be, b := splitEpoch(b)
+	if c := compareEpoch(ae, be); c != 0 {
+		return c
+	}
+	av, ar := a, ""
+	if i := strings.LastIndex(a, "-"); i >= 0 {
+		av, ar = a[:i], a[i+1:]
+	}
+	bv, br := b, ""
+	if i := strings.LastIndex(b, "-"); i >= 0 {
+		bv, br = b[:i], b[i+1:]
+	}
+	if c := rpmvercmp(av, bv); c != 0 || ar == "" || br == "" {
+		return c
+	}
+	return rpmvercmp(ar, br)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// rpmvercmp compares segments of versions the same way as rpm does. Numeric segments are
+// newer than alphabetic ones, `~` sorts before anything and `^` sorts after the base version.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for {
+		for a != "" && !isDigit(a[0]) && !isAlpha(a[0]) && a[0] != '~' && a[0] != '^' {
+			a = a[1:]
+		}
+		for b != "" && !isDigit(b[0]) && !isAlpha(b[0]) && b[0] != '~' && b[0] != '^' {
+			b = b[1:]
+		}
+		// Tilde sorts before everything, even the end of version.
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		// Caret sorts after the end of version, but before anything else.
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+		numeric := isDigit(a[0])
+		sa, sb := segment(a, numeric), segment(b, numeric)
+		a, b = a[len(sa):], b[len(sb):]
+		if sb == "" {
+			// Segments of different types, where the numeric one is newer.
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if numeric {
+			c = compareEpoch(sa, sb)
+		} else {
+			c = strings.Compare(sa, sb)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	}
+	return 1
+}
+
+// segment returns the leading numeric or alphabetic segment of s.
+func segment(s string, numeric bool) string {
+	i := 0
+	for i < len(s) && ((numeric && isDigit(s[i])) || (!numeric && isAlpha(s[i]))) {
+		i++
+	}
+	return s[:i]
+}
+
+// compareDebian compares `[EPOCH:]UPSTREAM[-REVISION]` of dpkg. Like compareRPM, revisions
+// are compared only if both versions have them.
+func compareDebian(a, b string) int {
+	ae, a := splitEpoch(a)
+	be, b := splitEpoch(b)
+	if c := compareEpoch(ae, be); c != 0 {
+		return c
+	}
+	au, ar := a, ""
+	if i := strings.LastIndex(a, "-"); i >= 0 {
+		au, ar = a[:i], a[i+1:]
+	}
+	bu, br := b, ""
+	if i := strings.LastIndex(b, "-"); i >= 0 {
+		bu, br = b[:i], b[i+1:]
+	}
+	if c := verrevcmp(au, bu); c != 0 || ar == "" || br == "" {
+		return c
+	}
+	return verrevcmp(ar, br)
+}
+
+// order returns the weight of a non-digit character of Debian versions, where letters sort
+// before non-letters, and `~` sorts before anything, even the end of version.
+func order(c byte) int {
+	switch {
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	case c == 0:
+		return 0
+	}
+	return int(c) + 256
+}
+
+// verrevcmp compares parts of Debian versions the same way as dpkg does, which alternate
+// between non-digit and numeric segments.
+func verrevcmp(a, b string) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := order(at(a, i)), order(at(b, j))
+			if i < len(a) && isDigit(a[i]) {
+				ac = 0
+			}
+			if j < len(b) && isDigit(b[j]) {
+				bc = 0
+			}
+			if ac != bc {
+				if ac < bc {
+					return -1
+				}
+				return 1
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		var first int
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if first == 0 {
+				first = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if first != 0 {
+			if first < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// VersionConstraint is a requirement on versions of packages, e.g. `< 1.0.2k-16`.
+type VersionConstraint struct {
+	Operator string `json:"operator,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// Matches returns true if version satisfies the constraint by the scheme of package manager.
+func (in VersionConstraint) Matches(manager, version string) bool {
+	c := CompareVersions(manager, version, in.Version)
+	switch in.Operator {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "!=":
+		return c != 0
+	}
+	return c == 0
+}
+
+func (in VersionConstraint) String() string {
+	return in.Operator + " " + in.Version
+}
+
+// VersionRange is a set of constraints, all of which must be satisfied.
+type VersionRange []VersionConstraint
+
+// Matches returns true if version satisfies all constraints, thus an empty range matches
+// every version.
+func (in VersionRange) Matches(manager, version string) bool {
+	for _, each := range in {
+		if !each.Matches(manager, version) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseVersionRange parses a comma-separated list of constraints, each of which is a version
+// led by one of `=`, `==`, `!=`, `<`, `<=`, `>` and `>=`, e.g.:
+//
+//   >= 1.0.1, < 1.0.2k-16
+//
+// A version without operator requires exactly that version.
+func ParseVersionRange(s string) (VersionRange, error) {
+	var out VersionRange
+	if strings.TrimSpace(s) == "" {
+		return out, nil
+	}
+	for _, each := range strings.Split(s, ",") {
+		each = strings.TrimSpace(each)
+		var c VersionConstraint
+		for _, op := range []string{"<=", ">=", "!=", "==", "<", ">", "="} {
+			if strings.HasPrefix(each, op) {
+				c.Operator = op
+				each = strings.TrimSpace(strings.TrimPrefix(each, op))
+				break
+			}
+		}
+		if c.Operator == "" || c.Operator == "==" {
+			c.Operator = "="
+		}
+		if each == "" || strings.ContainsAny(each, " <>=!") {
+			return nil, fmt.Errorf("Invalid version constraint: %s", c.Operator+each)
+		}
+		c.Version = each
+		out = append(out, c)
+	}
+	return out, nil
+}
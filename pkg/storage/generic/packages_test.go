@@ -0,0 +1,182 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"testing"
+)
+
+// rpmVersions are taken from the test suite of rpmvercmp, along with releases and epochs.
+var rpmVersions = []struct {
+	a, b   string
+	expect int
+}{
+	{"1.0", "1.0", 0},
+	{"1.0", "2.0", -1},
+	{"2.0", "1.0", 1},
+	{"2.0.1", "2.0.1", 0},
+	{"2.0", "2.0.1", -1},
+	{"2.0.1a", "2.0.1a", 0},
+	{"2.0.1a", "2.0.1", 1},
+	{"5.5p1", "5.5p2", -1},
+	{"5.5p10", "5.5p1", 1},
+	{"10xyz", "10.1xyz", -1},
+	{"xyz10", "xyz10.1", -1},
+	{"xyz.4", "8", -1},
+	{"5.6p1", "6.5p1", -1},
+	{"6.0.rc1", "6.0", 1},
+	{"10b2", "10a1", 1},
+	{"1.0aa", "1.0a", 1},
+	{"10.0001", "10.1", 0},
+	{"10.0001", "10.0039", -1},
+	{"4.999.9", "5.0", -1},
+	{"20101121", "20101122", -1},
+	{"2.0", "2_0", 0},
+	{"a+", "a_", 0},
+	{"+_", "_+", 0},
+	{"1.0~rc1", "1.0~rc1", 0},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0~rc1", "1.0~rc2", -1},
+	{"1.0~rc1~git123", "1.0~rc1", -1},
+	{"1.0^", "1.0", 1},
+	{"1.0^git1", "1.0", 1},
+	{"1.0^git1", "1.0^git2", -1},
+	{"1.0^git1", "1.01", -1},
+	{"1.0^20160101^git1", "1.0^20160101", 1},
+	{"1.0~rc1^git1", "1.0~rc1", 1},
+	{"1.0^git1~pre", "1.0^git1", -1},
+	// Epochs and releases.
+	{"1:1.0", "2.0", 1},
+	{"0:1.0", "1.0", 0},
+	{"1.0.2k-15.el7", "1.0.2k-16.el7", -1},
+	{"1.0.2k-16.el7", "1.0.2k-16", 1},
+	{"1.0.2k-16.el7", "1.0.2k", 0},
+	{"1:1.0.2k-16.el7", "1:1.0.2k-16.el7_6.1", -1},
+}
+
+// debianVersions are taken from the test suite of dpkg.
+var debianVersions = []struct {
+	a, b   string
+	expect int
+}{
+	{"1.0-1", "2.0-2", -1},
+	{"2.2~rc-4", "2.2-1", -1},
+	{"2.2-1", "2.2~rc-4", 1},
+	{"1.0000-1", "1.0-1", 0},
+	{"1", "0:1", 0},
+	{"0", "0:0-0", 0},
+	{"2:2.5", "1:7.5", 1},
+	{"1:0foo", "0foo", 1},
+	{"0:0foo", "0foo", 0},
+	{"0foo", "0foo-0", 0},
+	// Unlike dpkg, revisions are compared only if both versions have them.
+	{"0foo", "0foo-1", 0},
+	{"0foo.bar", "0foobar", 1},
+	{"1.09", "1.9", 0},
+	{"1.0~", "1.0", -1},
+	{"1.0~~", "1.0~", -1},
+	{"1.0~~a", "1.0~~", 1},
+	{"1.0", "1.0+", -1},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0", "1.0+b1", -1},
+	{"1.2.10", "1.2.9", 1},
+	{"1.1.1f-1ubuntu2.16", "1.1.1f-1ubuntu2.17", -1},
+	{"2.35-0ubuntu3.4", "2.35-0ubuntu3.10", -1},
+	{"2:8.1.2269-1ubuntu5.21", "8.2.3995-1ubuntu2", 1},
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range rpmVersions {
+		if got := CompareVersions(RPMManager, c.a, c.b); got != c.expect {
+			t.Errorf("rpm: %s vs %s: expected %d, got %d", c.a, c.b, c.expect, got)
+		}
+		if got := CompareVersions(RPMManager, c.b, c.a); got != -c.expect {
+			t.Errorf("rpm: %s vs %s: expected %d, got %d", c.b, c.a, -c.expect, got)
+		}
+	}
+	for _, c := range debianVersions {
+		if got := CompareVersions(DpkgManager, c.a, c.b); got != c.expect {
+			t.Errorf("dpkg: %s vs %s: expected %d, got %d", c.a, c.b, c.expect, got)
+		}
+		if got := CompareVersions(DpkgManager, c.b, c.a); got != -c.expect {
+			t.Errorf("dpkg: %s vs %s: expected %d, got %d", c.b, c.a, -c.expect, got)
+		}
+	}
+}
+
+func TestParseVersionRange(t *testing.T) {
+	cases := []struct {
+		s      string
+		expect string
+		err    bool
+	}{
+		{"", "", false},
+		{"1.0", "=1.0", false},
+		{"== 1.0", "=1.0", false},
+		{">= 1.0.1, < 1.0.2k-16", ">=1.0.1,<1.0.2k-16", false},
+		{"!=2:8.1", "!=2:8.1", false},
+		{"<", "", true},
+		{"< 1 2", "", true},
+		{">= 1.0,", "", true},
+		{"=> 1.0", "", true},
+	}
+	for _, c := range cases {
+		r, err := ParseVersionRange(c.s)
+		if (err != nil) != c.err {
+			t.Errorf("%q: expected error %v, got %v", c.s, c.err, err)
+			continue
+		}
+		var got string
+		for i, each := range r {
+			if i > 0 {
+				got += ","
+			}
+			got += each.Operator + each.Version
+		}
+		if got != c.expect {
+			t.Errorf("%q: expected %s, got %s", c.s, c.expect, got)
+		}
+	}
+}
+
+func TestVersionRangeMatches(t *testing.T) {
+	cases := []struct {
+		manager string
+		r       string
+		version string
+		expect  bool
+	}{
+		{RPMManager, "", "1.0-1", true},
+		{RPMManager, ">= 1.0.1, < 1.0.2k-16", "1:1.0.2k-15.el7", false},
+		{RPMManager, ">= 1.0.1, < 1.0.2k-16", "1.0.2k-15.el7", true},
+		{RPMManager, ">= 1.0.1, < 1.0.2k-16", "1.0.2k-16.el7", false},
+		{RPMManager, ">= 1.0.1, < 1.0.2k-16", "1.0.0-1", false},
+		{RPMManager, "1.0.2k", "1.0.2k-16.el7", true},
+		{RPMManager, "!= 1.0.2k-16.el7", "1.0.2k-16.el7", false},
+		{DpkgManager, "< 1.1.1f-1ubuntu2.17", "1.1.1f-1ubuntu2.16", true},
+		{DpkgManager, "> 1.0", "1.0~rc1", false},
+		{DpkgManager, "<= 1.0", "1.0", true},
+	}
+	for _, c := range cases {
+		r, err := ParseVersionRange(c.r)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.r, err)
+			continue
+		}
+		if got := r.Matches(c.manager, c.version); got != c.expect {
+			t.Errorf("%s: %s in %q: expected %v, got %v", c.manager, c.version, c.r, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// InitialAPIVersion is the API version of objects which were stored before versioning
+	// was introduced, and thus carry no version at all.
+	InitialAPIVersion = "v1"
+	// RESOURCE_SCHEMA indicates the kind of a Schema
+	RESOURCE_SCHEMA = "schema"
+	// SchemaName is the name of the only Schema in storage.
+	SchemaName = "panther"
+)
+
+// Migration upgrades an object in its generic form by a single API version, e.g. renames or
+// converts its fields. The API version in metadata is maintained by caller.
+type Migration func(obj map[string]interface{}) error
+
+var (
+	migrationsLock sync.RWMutex
+	// migrations of a kind are kept in order, the i-th of which upgrades objects from
+	// version `v<i+1>` to `v<i+2>`.
+	migrations = make(map[string][]Migration)
+)
+
+// RegisterMigration registers a migration which upgrades objects of kind from the given API
+// version to the next one, which becomes the current API version of that kind. Migrations
+// of a kind must be registered in order starting from InitialAPIVersion, or it panics.
+func RegisterMigration(kind, from string, fn Migration) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+	if fn == nil {
+		panic("generic: RegisterMigration migration is nil")
+	}
+	n, err := parseAPIVersion(from)
+	if err != nil || n != len(migrations[kind])+1 {
+		panic(fmt.Sprintf("generic: RegisterMigration called out of order for kind %s from %s", kind, from))
+	}
+	migrations[kind] = append(migrations[kind], fn)
+}
+
+// APIVersionOf returns the current API version of kind, in which objects are written.
+func APIVersionOf(kind string) string {
+	migrationsLock.RLock()
+	defer migrationsLock.RUnlock()
+	return formatAPIVersion(len(migrations[kind]) + 1)
+}
+
+// CompareAPIVersions returns -1, 0 or 1 if API version a is older than, the same as or newer
+// than b respectively. An empty version is considered as InitialAPIVersion.
+func CompareAPIVersions(a, b string) (int, error) {
+	x, err := parseAPIVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := parseAPIVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func parseAPIVersion(v string) (int, error) {
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || n < 1 || !strings.HasPrefix(v, "v") {
+		return 0, fmt.Errorf("Invalid API version: %s", v)
+	}
+	return n, nil
+}
+
+func formatAPIVersion(n int) string {
+	return "v" + strconv.Itoa(n)
+}
+
+// UpgradeRaw upgrades the raw format data of an object to the current API version of its
+// kind. Storages apply it on every value they read, so that objects written by an older
+// binary are always decoded in the current schema. The data is returned as is if it is
+// already current, or ErrSchemaTooNew is returned if it was written by a newer binary.
+func UpgradeRaw(dAtA []byte) ([]byte, error) {
+	head := new(struct {
+		Metadata struct {
+			Kind       string `json:"kind"`
+			APIVersion string `json:"api_version"`
+		} `json:"metadata"`
+	})
+	if err := json.Unmarshal(dAtA, head); err != nil {
+		return nil, err
+	}
+	stored, err := parseAPIVersion(head.Metadata.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	migrationsLock.RLock()
+	list := migrations[head.Metadata.Kind]
+	migrationsLock.RUnlock()
+	current := len(list) + 1
+	switch {
+	case stored == current:
+		return dAtA, nil
+	case stored > current:
+		return nil, ErrSchemaTooNew
+	}
+	// Numbers are kept as they are, as float64 could not hold all values of int64.
+	dec := json.NewDecoder(bytes.NewReader(dAtA))
+	dec.UseNumber()
+	obj := make(map[string]interface{})
+	if err = dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	for i := stored - 1; i < len(list); i++ {
+		if err = list[i](obj); err != nil {
+			return nil, fmt.Errorf("Could not upgrade %s from %s: %v", head.Metadata.Kind, formatAPIVersion(i+1), err)
+		}
+	}
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		meta = make(map[string]interface{})
+		obj["metadata"] = meta
+	}
+	meta["api_version"] = formatAPIVersion(current)
+	return json.Marshal(obj)
+}
+
+// Schema records the API versions of all kinds that have been written into storage. It is
+// used to prevent binaries from running against storages written by newer ones.
+type Schema struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	Versions map[string]string `json:"versions,omitempty" protobuf:"bytes,2,rep,name=versions"`
+}
+
+// NewSchema generates a new Schema instance with the only name
+func NewSchema() *Schema {
+	return &Schema{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_SCHEMA, Name: SchemaName},
+	}
+}
+
+// CheckSchema compares the schema of storage with the current API versions of all kinds. It
+// returns ErrSchemaTooNew if any kind has been written in a newer version, or records the
+// current versions otherwise, so that older binaries would refuse to run hereafter.
+func CheckSchema(ctx context.Context, s Storage) (err error) {
+	// Retry if the schema was recorded by another binary meanwhile.
+	for i := 0; i < 3; i++ {
+		if err = checkSchema(ctx, s); !IsConflict(err) && !IsVersionConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func checkSchema(ctx context.Context, s Storage) error {
+	schema := NewSchema()
+	err := s.GetContext(ctx, schema)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	changed := !exists
+	if schema.Versions == nil {
+		schema.Versions = make(map[string]string)
+	}
+	for _, kind := range Kinds() {
+		current := APIVersionOf(kind)
+		cmp, err := CompareAPIVersions(schema.Versions[kind], current)
+		if err != nil {
+			return err
+		}
+		switch {
+		case cmp > 0:
+			return fmt.Errorf("%v: %s is stored in %s, while %s is supported", ErrSchemaTooNew, kind, schema.Versions[kind], current)
+		case cmp < 0 || schema.Versions[kind] == "":
+			schema.Versions[kind] = current
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if exists {
+		return s.UpdateContext(ctx, schema)
+	}
+	return s.CreateContext(ctx, schema)
+}
+
+// MigrationResult is the number of objects of a kind which have been handled by Migrate.
+type MigrationResult struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"api_version"`
+	Rewritten  int    `json:"rewritten"`
+	// Skipped are immutable objects, which are upgraded whenever they are read.
+	Skipped int `json:"skipped"`
+}
+
+// Migrate rewrites all objects of those kinds which have migrations, so that they are stored
+// in their current API versions. Objects are upgraded on read anyway, while migrating them
+// once for all saves the cost of upgrading them again and again. Nothing is written if dryRun
+// is true.
+func Migrate(ctx context.Context, s Storage, dryRun bool) ([]MigrationResult, error) {
+	var results []MigrationResult
+	for _, kind := range Kinds() {
+		result := MigrationResult{Kind: kind, APIVersion: APIVersionOf(kind)}
+		if result.APIVersion == InitialAPIVersion {
+			// Objects of kinds without migrations are always current.
+			results = append(results, result)
+			continue
+		}
+		it := NewIteratorContext(ctx, s, kind, DefaultPageSize)
+		for it.Next() {
+			obj := it.Object()
+			if IsImmutable(obj) {
+				result.Skipped++
+				continue
+			}
+			if !dryRun {
+				if err := s.UpdateContext(ctx, obj); err != nil {
+					return append(results, result), fmt.Errorf("Could not migrate %s '%s' due to: %v", kind, obj.GetName(), err)
+				}
+			}
+			result.Rewritten++
+		}
+		if err := it.Err(); err != nil {
+			return append(results, result), err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
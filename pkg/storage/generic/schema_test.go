@@ -0,0 +1,245 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	zap "go.uber.org/zap"
+)
+
+func openMemory(t *testing.T) generic.Storage {
+	s, err := memory.New().Open(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRegisterMigration(t *testing.T) {
+	noop := func(map[string]interface{}) error { return nil }
+	cases := []struct {
+		name   string
+		from   []string
+		panics bool
+	}{
+		{name: "in order", from: []string{"v1", "v2", "v3"}},
+		{name: "initial version skipped", from: []string{"v2"}, panics: true},
+		{name: "version repeated", from: []string{"v1", "v1"}, panics: true},
+		{name: "version skipped", from: []string{"v1", "v3"}, panics: true},
+		{name: "empty version as initial", from: []string{"", "v2"}},
+		{name: "invalid version", from: []string{"1"}, panics: true},
+	}
+	for _, c := range cases {
+		kind := "test-register-" + strings.Replace(c.name, " ", "-", -1)
+		panicked := func() (panicked bool) {
+			defer func() {
+				panicked = recover() != nil
+			}()
+			for _, from := range c.from {
+				generic.RegisterMigration(kind, from, noop)
+			}
+			return false
+		}()
+		if panicked != c.panics {
+			t.Errorf("%s: expected panic %v, got %v", c.name, c.panics, panicked)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected nil migration to panic")
+			}
+		}()
+		generic.RegisterMigration("test-register-nil", "v1", nil)
+	}()
+	if got := generic.APIVersionOf("test-register-in-order"); got != "v4" {
+		t.Errorf("Expected v4 after 3 migrations, got %s", got)
+	}
+	if got := generic.APIVersionOf("test-register-none"); got != generic.InitialAPIVersion {
+		t.Errorf("Expected %s without migrations, got %s", generic.InitialAPIVersion, got)
+	}
+}
+
+func TestUpgradeRaw(t *testing.T) {
+	const kind = "test-upgrade"
+	generic.RegisterMigration(kind, "v1", func(obj map[string]interface{}) error {
+		obj["name"] = obj["old_name"]
+		delete(obj, "old_name")
+		return nil
+	})
+	generic.RegisterMigration(kind, "v2", func(obj map[string]interface{}) error {
+		obj["upgraded"] = true
+		return nil
+	})
+	cases := []struct {
+		name    string
+		raw     string
+		want    string
+		tooNew  bool
+		invalid bool
+	}{
+		{
+			name: "current",
+			raw:  `{"metadata":{"kind":"test-upgrade","api_version":"v3"},"name":"a"}`,
+			want: `{"metadata":{"kind":"test-upgrade","api_version":"v3"},"name":"a"}`,
+		},
+		{
+			name: "older",
+			raw:  `{"metadata":{"kind":"test-upgrade","api_version":"v2"},"name":"a","size":9007199254740993}`,
+			want: `{"metadata":{"api_version":"v3","kind":"test-upgrade"},"name":"a","size":9007199254740993,"upgraded":true}`,
+		},
+		{
+			name: "unversioned",
+			raw:  `{"metadata":{"kind":"test-upgrade"},"old_name":"a"}`,
+			want: `{"metadata":{"api_version":"v3","kind":"test-upgrade"},"name":"a","upgraded":true}`,
+		},
+		{
+			name:   "too new",
+			raw:    `{"metadata":{"kind":"test-upgrade","api_version":"v4"}}`,
+			tooNew: true,
+		},
+		{
+			name:    "invalid version",
+			raw:     `{"metadata":{"kind":"test-upgrade","api_version":"3"}}`,
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		got, err := generic.UpgradeRaw([]byte(c.raw))
+		switch {
+		case c.tooNew:
+			if err != generic.ErrSchemaTooNew {
+				t.Errorf("%s: expected %v, got %s, %v", c.name, generic.ErrSchemaTooNew, got, err)
+			}
+		case c.invalid:
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", c.name, got)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case string(got) != c.want:
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	s := openMemory(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	// Current versions are recorded on the first run.
+	if err := generic.CheckSchema(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	schema := generic.NewSchema()
+	if err := s.Get(schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range generic.Kinds() {
+		if schema.Versions[kind] != generic.APIVersionOf(kind) {
+			t.Errorf("Expected %s to be recorded in %s, got %s", kind, generic.APIVersionOf(kind), schema.Versions[kind])
+		}
+	}
+
+	// Older versions are raised to the current ones.
+	schema.Versions[generic.RESOURCE_SYSTEM_SCAN] = generic.InitialAPIVersion
+	if err := s.Update(schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := generic.CheckSchema(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(schema); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema.Versions[generic.RESOURCE_SYSTEM_SCAN]; got != generic.APIVersionOf(generic.RESOURCE_SYSTEM_SCAN) {
+		t.Errorf("Expected the version to be raised, got %s", got)
+	}
+
+	// Newer versions are refused and left untouched.
+	schema.Versions[generic.RESOURCE_SYSTEM_SCAN] = "v99"
+	if err := s.Update(schema); err != nil {
+		t.Fatal(err)
+	}
+	err := generic.CheckSchema(ctx, s)
+	if err == nil || !strings.Contains(err.Error(), generic.ErrSchemaTooNew.Error()) {
+		t.Errorf("Expected %v, got %v", generic.ErrSchemaTooNew, err)
+	}
+	if err := s.Get(schema); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema.Versions[generic.RESOURCE_SYSTEM_SCAN]; got != "v99" {
+		t.Errorf("Expected the newer version to be kept, got %s", got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s := openMemory(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	host := generic.NewHost()
+	host.SetName("web-1")
+	scan := generic.NewSystemScan()
+	scan.SetName("web-1")
+	record := generic.NewScanRecord()
+	record.SetNamespace("web-1")
+	record.SetName("record-1")
+	for _, obj := range []generic.Object{host, scan, record} {
+		if err := s.Create(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		results, err := generic.Migrate(ctx, s, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]generic.MigrationResult)
+		for _, each := range results {
+			got[each.Kind] = each
+		}
+		want := map[string]generic.MigrationResult{
+			generic.RESOURCE_HOST:        {Kind: generic.RESOURCE_HOST, APIVersion: generic.InitialAPIVersion},
+			generic.RESOURCE_SYSTEM_SCAN: {Kind: generic.RESOURCE_SYSTEM_SCAN, APIVersion: "v2", Rewritten: 1},
+			generic.RESOURCE_SCAN_RECORD: {Kind: generic.RESOURCE_SCAN_RECORD, APIVersion: "v2", Skipped: 1},
+		}
+		for kind, each := range want {
+			if got[kind] != each {
+				dAtA, _ := json.Marshal(got[kind])
+				t.Errorf("dry run %v: expected %+v, got %s", dryRun, each, dAtA)
+			}
+		}
+	}
+
+	// Records are never rewritten, thus they keep their creation.
+	stored := generic.NewScanRecord()
+	stored.SetNamespace("web-1")
+	stored.SetName("record-1")
+	if err := s.Get(stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.GetResourceVersion() != record.GetResourceVersion() {
+		t.Errorf("Expected the record to be untouched, got version %s from %s", stored.GetResourceVersion(), record.GetResourceVersion())
+	}
+}
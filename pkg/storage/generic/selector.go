@@ -0,0 +1,345 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operator is the relationship between a key and its values in a Requirement.
+type Operator string
+
+const (
+	// Equals requires the value of key to be equal to the only value.
+	Equals Operator = "="
+	// NotEquals requires the value of key to be different from the only value, or the key
+	// to be absent.
+	NotEquals Operator = "!="
+	// In requires the value of key to be one of the values.
+	In Operator = "in"
+	// NotIn requires the value of key to be none of the values, or the key to be absent.
+	NotIn Operator = "notin"
+	// Exists requires the key to be present.
+	Exists Operator = "exists"
+	// DoesNotExist requires the key to be absent.
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a single condition of a selector.
+type Requirement struct {
+	Key      string   `json:"key"`
+	Operator Operator `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Matches returns true if the value of key satisfies the requirement.
+func (in Requirement) Matches(value string, exists bool) bool {
+	switch in.Operator {
+	case Equals:
+		return exists && value == in.Values[0]
+	case NotEquals:
+		return !exists || value != in.Values[0]
+	case In:
+		return exists && contains(in.Values, value)
+	case NotIn:
+		return !exists || !contains(in.Values, value)
+	case Exists:
+		return exists
+	case DoesNotExist:
+		return !exists
+	}
+	return false
+}
+
+func (in Requirement) String() string {
+	switch in.Operator {
+	case Equals, NotEquals:
+		return in.Key + string(in.Operator) + in.Values[0]
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", in.Key, in.Operator, strings.Join(in.Values, ","))
+	case DoesNotExist:
+		return "!" + in.Key
+	}
+	return in.Key
+}
+
+func contains(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldSelectable is implemented by objects which expose their own fields to field
+// selectors, e.g. `state=FAILED`. Metadata fields are always available as
+// `metadata.guid`, `metadata.name` and `metadata.namespace`.
+type FieldSelectable interface {
+	SelectableFields() map[string]string
+}
+
+// FieldsOf returns all fields of an object that could be used by field selectors.
+func FieldsOf(obj Object) map[string]string {
+	fields := map[string]string{
+		"metadata.guid":      obj.GetGUID(),
+		"metadata.name":      obj.GetName(),
+		"metadata.namespace": obj.GetNamespace(),
+	}
+	if v, ok := obj.(FieldSelectable); ok {
+		for key, value := range v.SelectableFields() {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// Selector selects objects by their labels and fields. All requirements must be satisfied
+// by an object to be selected, and an empty selector selects everything.
+type Selector struct {
+	Labels []Requirement `json:"labels,omitempty"`
+	Fields []Requirement `json:"fields,omitempty"`
+}
+
+// Empty returns true if the selector has no requirement.
+func (in *Selector) Empty() bool {
+	return in == nil || (len(in.Labels) == 0 && len(in.Fields) == 0)
+}
+
+// Matches returns true if the object satisfies all requirements of selector.
+func (in *Selector) Matches(obj Object) bool {
+	if in.Empty() {
+		return true
+	}
+	labels := obj.GetLabels()
+	for _, r := range in.Labels {
+		value, exists := labels[r.Key]
+		if !r.Matches(value, exists) {
+			return false
+		}
+	}
+	if len(in.Fields) == 0 {
+		return true
+	}
+	fields := FieldsOf(obj)
+	for _, r := range in.Fields {
+		value, exists := fields[r.Key]
+		if !r.Matches(value, exists) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesRaw decodes raw format data of given kind, and returns true if it satisfies all
+// requirements of selector.
+func (in *Selector) MatchesRaw(kind string, dAtA []byte) (bool, error) {
+	if in.Empty() {
+		return true, nil
+	}
+	obj, err := NewObjectOf(kind)
+	if err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(dAtA, obj); err != nil {
+		return false, err
+	}
+	return in.Matches(obj), nil
+}
+
+// SelectEvent adapts a watch event of given kind to the selector. As an object could be
+// moved into or out of the selection by an update, it would be delivered as a CREATE or
+// a DELETE event respectively. The value is the latest value of object, and prev is its
+// value before an update, which could be nil if unknown. It returns the type of event to
+// be delivered, or false if the event should be dropped.
+func (in *Selector) SelectEvent(t WatchEventType, kind string, value, prev []byte) (WatchEventType, bool, error) {
+	if in.Empty() {
+		return t, true, nil
+	}
+	matched, err := in.MatchesRaw(kind, value)
+	if err != nil {
+		return t, false, err
+	}
+	if t != UPDATE || prev == nil {
+		return t, matched, nil
+	}
+	wasMatched, err := in.MatchesRaw(kind, prev)
+	if err != nil {
+		return t, false, err
+	}
+	switch {
+	case matched && wasMatched:
+		return UPDATE, true, nil
+	case matched:
+		return CREATE, true, nil
+	case wasMatched:
+		return DELETE, true, nil
+	}
+	return t, false, nil
+}
+
+// And returns a new selector that requires all requirements of both selectors.
+func (in *Selector) And(other *Selector) *Selector {
+	out := new(Selector)
+	for _, s := range []*Selector{in, other} {
+		if s != nil {
+			out.Labels = append(out.Labels, s.Labels...)
+			out.Fields = append(out.Fields, s.Fields...)
+		}
+	}
+	return out
+}
+
+// LabelSelector returns the label requirements of selector in text.
+func (in *Selector) LabelSelector() string {
+	if in == nil {
+		return ""
+	}
+	return joinRequirements(in.Labels)
+}
+
+// FieldSelector returns the field requirements of selector in text.
+func (in *Selector) FieldSelector() string {
+	if in == nil {
+		return ""
+	}
+	return joinRequirements(in.Fields)
+}
+
+func joinRequirements(list []Requirement) string {
+	parts := make([]string, 0, len(list))
+	for _, r := range list {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+var (
+	selectorKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	selectorValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+	selectorSetPattern   = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// ParseSelector parses a label selector and a field selector into a Selector. Both of
+// them are comma-separated lists of requirements, and could be empty:
+//
+//   label selector: `env=prod,role in (web,db),tier notin (cache),!canary,region`
+//   field selector: `state=FAILED,metadata.namespace!=node-1`
+//
+// Label selectors support equality (`=`, `==`, `!=`), set-based (`in`, `notin`) and
+// existence (`key`, `!key`) requirements, while field selectors support equality only.
+func ParseSelector(labelSelector, fieldSelector string) (*Selector, error) {
+	labels, err := parseRequirements(labelSelector, true)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid label selector: %v", err)
+	}
+	fields, err := parseRequirements(fieldSelector, false)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid field selector: %v", err)
+	}
+	return &Selector{Labels: labels, Fields: fields}, nil
+}
+
+// SelectorFromLabels returns a selector that requires all given labels to be equal.
+func SelectorFromLabels(labels map[string]string) *Selector {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := new(Selector)
+	for _, key := range keys {
+		out.Labels = append(out.Labels, Requirement{Key: key, Operator: Equals, Values: []string{labels[key]}})
+	}
+	return out
+}
+
+func parseRequirements(s string, setBased bool) ([]Requirement, error) {
+	var list []Requirement
+	for _, part := range splitRequirements(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part, setBased)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// splitRequirements splits requirements by commas, except those inside parentheses.
+func splitRequirements(s string) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseRequirement(s string, setBased bool) (r Requirement, err error) {
+	switch {
+	case setBased && selectorSetPattern.MatchString(s):
+		m := selectorSetPattern.FindStringSubmatch(s)
+		r = Requirement{Key: m[1], Operator: Operator(m[2])}
+		for _, v := range strings.Split(m[3], ",") {
+			r.Values = append(r.Values, strings.TrimSpace(v))
+		}
+	case strings.Contains(s, "!="):
+		kv := strings.SplitN(s, "!=", 2)
+		r = Requirement{Key: strings.TrimSpace(kv[0]), Operator: NotEquals, Values: []string{strings.TrimSpace(kv[1])}}
+	case strings.Contains(s, "=="):
+		kv := strings.SplitN(s, "==", 2)
+		r = Requirement{Key: strings.TrimSpace(kv[0]), Operator: Equals, Values: []string{strings.TrimSpace(kv[1])}}
+	case strings.Contains(s, "="):
+		kv := strings.SplitN(s, "=", 2)
+		r = Requirement{Key: strings.TrimSpace(kv[0]), Operator: Equals, Values: []string{strings.TrimSpace(kv[1])}}
+	case setBased && strings.HasPrefix(s, "!"):
+		r = Requirement{Key: strings.TrimSpace(s[1:]), Operator: DoesNotExist}
+	case setBased:
+		r = Requirement{Key: s, Operator: Exists}
+	default:
+		return r, fmt.Errorf("unsupported requirement %q", s)
+	}
+	if !selectorKeyPattern.MatchString(r.Key) {
+		return r, fmt.Errorf("invalid key %q", r.Key)
+	}
+	for _, v := range r.Values {
+		if !selectorValuePattern.MatchString(v) {
+			return r, fmt.Errorf("invalid value %q of key %q", v, r.Key)
+		}
+	}
+	return r, nil
+}
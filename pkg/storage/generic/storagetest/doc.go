@@ -0,0 +1,30 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storagetest provides a conformance suite that every implementation of
+// generic.Storage is expected to pass. A storage adapter runs it from its own tests:
+//
+//   func TestConformance(t *testing.T) {
+//       storagetest.Run(t, func(t *testing.T) generic.Storage {
+//           s, err := memory.New().Open(logging.DefaultLogger)
+//           if err != nil {
+//               t.Fatal(err)
+//           }
+//           return s
+//       })
+//   }
+//
+// The suite never assumes an empty storage. All objects it creates are named with
+// random identifiers, so that it could be run against a shared storage as well.
+package storagetest
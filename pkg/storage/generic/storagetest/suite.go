@@ -0,0 +1,868 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// DefaultEventTimeout is the time duration to wait for an expected watch event.
+const DefaultEventTimeout = 5 * time.Second
+
+// Opener returns a ready-to-use storage for a single test case. The storage will be
+// closed by the suite once the test case has finished.
+type Opener func(t *testing.T) generic.Storage
+
+// Run runs the entire conformance suite against storages returned by open.
+func Run(t *testing.T, open Opener) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, s generic.Storage)
+	}{
+		{"Create", testCreate},
+		{"NotFound", testNotFound},
+		{"NamespaceIsolation", testNamespaceIsolation},
+		{"Timestamps", testTimestamps},
+		{"ResourceVersion", testResourceVersion},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+		{"WatchOnKind", testWatchOnKind},
+		{"WatchOnNamespace", testWatchOnNamespace},
+		{"WatchOnName", testWatchOnName},
+		{"WatchFromVersion", testWatchFromVersion},
+		{"ListWithSelector", testListWithSelector},
+		{"WatchWithSelector", testWatchWithSelector},
+		{"Pagination", testPagination},
+		{"Expire", testExpire},
+		{"Immutable", testImmutable},
+		{"Restore", testRestore},
+		{"Schema", testSchema},
+	}
+	for _, c := range cases {
+		fn := c.fn
+		t.Run(c.name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			fn(t, s)
+		})
+	}
+}
+
+func randomName(prefix string) string {
+	return fmt.Sprintf("%s-%s", prefix, uuid.NewV4().String())
+}
+
+func newHost(name string) *generic.Host {
+	host := generic.NewHost()
+	host.SetName(name)
+	host.SSHAddress = "127.0.0.1"
+	host.SSHPort = 22
+	return host
+}
+
+func newHostOperation(ns, name string) *generic.HostOperation {
+	op := generic.NewHostOperation()
+	op.SetNamespace(ns)
+	op.SetName(name)
+	op.Type = generic.UserOperation
+	op.Method = generic.OutputMethod
+	op.State = generic.StartedState
+	return op
+}
+
+func testCreate(t *testing.T, s generic.Storage) {
+	host := newHost(randomName("create"))
+	if err := s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if _, err := uuid.FromString(host.GetGUID()); err != nil {
+		t.Errorf("Create: expected a valid GUID to be assigned, got %q", host.GetGUID())
+	}
+
+	got := newHost(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.GetGUID() != host.GetGUID() || got.SSHAddress != host.SSHAddress {
+		t.Errorf("Get: expected %+v, got %+v", host, got)
+	}
+
+	err := s.Create(newHost(host.GetName()))
+	if !generic.IsConflict(err) {
+		t.Errorf("Create: expected ErrResourceAlreadyExists on a taken name, got %v", err)
+	}
+
+	unnamed := generic.NewHost()
+	if err = s.Create(unnamed); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if unnamed.GetName() != unnamed.GetGUID() {
+		t.Errorf("Create: expected name to default to GUID %q, got %q", unnamed.GetGUID(), unnamed.GetName())
+	}
+}
+
+func testNotFound(t *testing.T, s generic.Storage) {
+	name := randomName("missing")
+	err := s.Get(newHost(name))
+	if !generic.IsNotFound(err) {
+		t.Errorf("Get: expected ErrResourceNotFound, got %v", err)
+	}
+	if generic.IsInternalError(err) {
+		t.Errorf("Get: expected a non-internal error, got %v", err)
+	}
+	err = s.Delete(newHost(name))
+	if !generic.IsNotFound(err) {
+		t.Errorf("Delete: expected ErrResourceNotFound, got %v", err)
+	}
+
+	host := newHost(name)
+	if err = s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if err = s.Delete(newHost(name)); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	if err = s.Get(newHost(name)); !generic.IsNotFound(err) {
+		t.Errorf("Get: expected ErrResourceNotFound after deletion, got %v", err)
+	}
+}
+
+func testNamespaceIsolation(t *testing.T, s generic.Storage) {
+	nsA, nsB := randomName("ns-a"), randomName("ns-b")
+	name := "shared-name"
+
+	a := newHostOperation(nsA, name)
+	a.Command = "echo a"
+	if err := s.Create(a); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	b := newHostOperation(nsB, name)
+	b.Command = "echo b"
+	if err := s.Create(b); err != nil {
+		t.Fatalf("Create: expected the same name to be available in another namespace, got %v", err)
+	}
+
+	got := newHostOperation(nsA, name)
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.Command != a.Command {
+		t.Errorf("Get: expected command %q in namespace %q, got %q", a.Command, nsA, got.Command)
+	}
+	if err := s.Get(newHostOperation(randomName("ns-c"), name)); !generic.IsNotFound(err) {
+		t.Errorf("Get: expected ErrResourceNotFound in an unrelated namespace, got %v", err)
+	}
+
+	list := generic.NewHostOperationList()
+	if err := s.List(list, generic.InNamespace(nsA)); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if len(list.Members) != 1 || list.Members[0].GetNamespace() != nsA {
+		t.Errorf("List: expected exactly 1 member in namespace %q, got %+v", nsA, list.Members)
+	}
+
+	all := generic.NewHostOperationList()
+	if err := s.List(all); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, each := range all.Members {
+		found[each.GetNamespace()] = true
+	}
+	if !found[nsA] || !found[nsB] {
+		t.Errorf("List: expected members of both namespaces %q and %q without namespace filter", nsA, nsB)
+	}
+
+	if err := s.Delete(newHostOperation(nsA, name)); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	if err := s.Get(newHostOperation(nsB, name)); err != nil {
+		t.Errorf("Get: expected object in namespace %q to survive a deletion in %q, got %v", nsB, nsA, err)
+	}
+}
+
+func testTimestamps(t *testing.T, s generic.Storage) {
+	host := newHost(randomName("timestamps"))
+	before := time.Now()
+	if err := s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	got := newHost(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	created := got.GetCreationTimestamp()
+	if created.IsZero() || created.Before(before.Add(-time.Second)) {
+		t.Errorf("Create: expected creation timestamp to be set, got %v", created)
+	}
+	if got.GetUpdatingTimestamp() != nil {
+		t.Errorf("Create: expected no updating timestamp, got %v", got.GetUpdatingTimestamp())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	update := newHost(host.GetName())
+	update.SetGUID(uuid.NewV4().String())
+	update.SetCreationTimestamp(time.Unix(0, 0))
+	update.Comment = "updated"
+	if err := s.Update(update); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	got = newHost(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.Comment != "updated" {
+		t.Errorf("Update: expected comment %q, got %q", "updated", got.Comment)
+	}
+	if got.GetGUID() != host.GetGUID() {
+		t.Errorf("Update: expected GUID %q to be preserved, got %q", host.GetGUID(), got.GetGUID())
+	}
+	if !got.GetCreationTimestamp().Equal(created) {
+		t.Errorf("Update: expected creation timestamp %v to be preserved, got %v", created, got.GetCreationTimestamp())
+	}
+	if updated := got.GetUpdatingTimestamp(); updated == nil || updated.Before(created) {
+		t.Errorf("Update: expected updating timestamp after %v, got %v", created, updated)
+	}
+
+	// Updating an absent object is considered as a creation.
+	absent := newHost(randomName("timestamps"))
+	if err := s.Update(absent); err != nil {
+		t.Fatalf("Update: unexpected error on absent object: %v", err)
+	}
+	got = newHost(absent.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.GetCreationTimestamp().IsZero() {
+		t.Errorf("Update: expected creation timestamp to be set on absent object")
+	}
+}
+
+func testResourceVersion(t *testing.T, s generic.Storage) {
+	host := newHost(randomName("version"))
+	if err := s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	created := host.GetResourceVersion()
+	if created == "" {
+		t.Fatalf("Create: expected resource version to be assigned")
+	}
+	got := newHost(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.GetResourceVersion() != created {
+		t.Errorf("Get: expected resource version %q, got %q", created, got.GetResourceVersion())
+	}
+	list := generic.NewHostList()
+	if err := s.List(list); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	for i := range list.Members {
+		if list.Members[i].GetName() == host.GetName() && list.Members[i].GetResourceVersion() != created {
+			t.Errorf("List: expected resource version %q, got %q", created, list.Members[i].GetResourceVersion())
+		}
+	}
+
+	got.Comment = "first"
+	if err := s.Update(got); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	if got.GetResourceVersion() == created {
+		t.Errorf("Update: expected resource version to be changed from %q", created)
+	}
+
+	// Writing with a stale version must be rejected without touching the stored object.
+	stale := newHost(host.GetName())
+	stale.SetResourceVersion(created)
+	stale.Comment = "stale"
+	if err := s.Update(stale); !generic.IsVersionConflict(err) {
+		t.Errorf("Update: expected version conflict with stale version, got %v", err)
+	}
+	if stale.GetResourceVersion() != created {
+		t.Errorf("Update: expected rejected object to keep its version %q, got %q", created, stale.GetResourceVersion())
+	}
+	check := newHost(host.GetName())
+	if err := s.Get(check); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if check.Comment != "first" || check.GetResourceVersion() != got.GetResourceVersion() {
+		t.Errorf("Update: stale write modified object to %q at version %q", check.Comment, check.GetResourceVersion())
+	}
+
+	// A versioned update never creates an object.
+	absent := newHost(randomName("version"))
+	absent.SetResourceVersion(created)
+	if err := s.Update(absent); !generic.IsNotFound(err) {
+		t.Errorf("Update: expected not found with version on absent object, got %v", err)
+	}
+
+	// Unconditional updates are still allowed.
+	blind := newHost(host.GetName())
+	blind.Comment = "blind"
+	if err := s.Update(blind); err != nil {
+		t.Fatalf("Update: unexpected error on unconditional update: %v", err)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, s generic.Storage) {
+	const writers = 16
+	host := newHost(randomName("concurrent"))
+	if err := s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		succeeded = make(map[string]bool)
+	)
+	wg.Add(writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			update := newHost(host.GetName())
+			update.SetResourceVersion(host.GetResourceVersion())
+			update.Comment = fmt.Sprintf("writer-%d", i)
+			if err := s.Update(update); err != nil {
+				if !generic.IsVersionConflict(err) {
+					t.Errorf("Update: writer %d expected version conflict, got %v", i, err)
+				}
+				return
+			}
+			lock.Lock()
+			succeeded[update.Comment] = true
+			lock.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	// All writers were based on the same version, thus only one of them could win.
+	if len(succeeded) != 1 {
+		t.Fatalf("Update: expected exactly one concurrent update to succeed, got %d", len(succeeded))
+	}
+	got := newHost(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if !succeeded[got.Comment] {
+		t.Errorf("Update: stored comment %q was not written by the succeeded writer", got.Comment)
+	}
+	if got.GetGUID() != host.GetGUID() {
+		t.Errorf("Update: expected GUID %q to be preserved, got %q", host.GetGUID(), got.GetGUID())
+	}
+}
+
+func testWatchOnKind(t *testing.T, s generic.Storage) {
+	w, err := s.Watch(generic.NewHostOperation(), generic.WatchOnKind)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	// Objects of other kinds must not be delivered.
+	if err = s.Create(newHost(randomName("watch-kind"))); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	ns := randomName("watch-kind")
+	assertLifecycle(t, s, w, newHostOperation(ns, randomName("op")))
+}
+
+func testWatchOnNamespace(t *testing.T, s generic.Storage) {
+	ns := randomName("watch-ns")
+	w, err := s.Watch(newHostOperation(ns, ""), generic.WatchOnNamespace)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	// Objects in other namespaces must not be delivered, including those whose
+	// namespace shares the same prefix.
+	if err = s.Create(newHostOperation(randomName("watch-ns"), "other")); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if err = s.Create(newHostOperation(ns+"-suffix", "other")); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	assertLifecycle(t, s, w, newHostOperation(ns, randomName("op")))
+}
+
+func testWatchOnName(t *testing.T, s generic.Storage) {
+	if _, err := s.Watch(generic.NewHostOperation(), generic.WatchOnName); err == nil {
+		t.Errorf("Watch: expected an error while watching on a name without namespace")
+	}
+	if _, err := s.Watch(generic.NewHost(), generic.WatchOnName); err == nil {
+		t.Errorf("Watch: expected an error while watching on an empty name")
+	}
+
+	name := randomName("watch-name")
+	w, err := s.Watch(newHost(name), generic.WatchOnName)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	// Objects with other names must not be delivered, including those whose name
+	// shares the same prefix.
+	if err = s.Create(newHost(name + "-suffix")); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	assertLifecycle(t, s, w, newHost(name))
+}
+
+func testWatchFromVersion(t *testing.T, s generic.Storage) {
+	first := newHost(randomName("watch-version"))
+	if err := s.Create(first); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	list := generic.NewHostList()
+	if err := s.List(list); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if list.GetResourceVersion() == "" {
+		t.Fatalf("List: expected resource version to be assigned")
+	}
+
+	// Changes made between the list and the watch must not be lost.
+	second := newHost(randomName("watch-version"))
+	if err := s.Create(second); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if err := s.Update(first); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	cv := generic.NewHost()
+	cv.SetResourceVersion(list.GetResourceVersion())
+	w, err := s.Watch(cv, generic.WatchOnKind)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.CREATE, second)
+	expectEvent(t, w, generic.UPDATE, first)
+
+	// A watcher on a single object could be resumed from the version it has seen.
+	seen := first.GetResourceVersion()
+	if err = s.Delete(first); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.DELETE, first)
+	w.Close()
+	select {
+	case _, ok := <-w.Output():
+		for ok {
+			_, ok = <-w.Output()
+		}
+	case <-time.After(DefaultEventTimeout):
+		t.Fatalf("Watch: output was not closed after the watcher had been closed")
+	}
+
+	cv = newHost(first.GetName())
+	cv.SetResourceVersion(seen)
+	w, err = s.Watch(cv, generic.WatchOnName)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+	expectEvent(t, w, generic.DELETE, first)
+}
+
+func testListWithSelector(t *testing.T, s generic.Storage) {
+	group := randomName("group")
+	labels := []map[string]string{
+		{"group": group, "env": "prod", "role": "web"},
+		{"group": group, "env": "prod", "role": "db"},
+		{"group": group, "env": "dev", "role": "web", "canary": "true"},
+	}
+	var names []string
+	for _, each := range labels {
+		host := newHost(randomName("selector"))
+		host.SetLabels(each)
+		if err := s.Create(host); err != nil {
+			t.Fatalf("Create: unexpected error: %v", err)
+		}
+		names = append(names, host.GetName())
+	}
+	ns := randomName("selector")
+	for i, state := range []generic.State{generic.SuccessState, generic.FailureState, generic.FailureState} {
+		op := newHostOperation(ns, fmt.Sprintf("op-%d", i))
+		op.State = state
+		if err := s.Create(op); err != nil {
+			t.Fatalf("Create: unexpected error: %v", err)
+		}
+	}
+
+	cases := []struct {
+		labels string
+		expect []string
+	}{
+		{"env=prod", names[:2]},
+		{"env==prod,role!=db", names[:1]},
+		{"role in (web, db),env notin (dev)", names[:2]},
+		{"canary", names[2:]},
+		{"!canary", names[:2]},
+		{"env=staging", nil},
+	}
+	for _, c := range cases {
+		sel, err := generic.ParseSelector("group="+group+","+c.labels, "")
+		if err != nil {
+			t.Fatalf("ParseSelector: unexpected error on %q: %v", c.labels, err)
+		}
+		list := generic.NewHostList()
+		if err = s.List(list, generic.WithSelector(sel)); err != nil {
+			t.Fatalf("List: unexpected error: %v", err)
+		}
+		var got []string
+		for i := range list.Members {
+			got = append(got, list.Members[i].GetName())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(sortedCopy(c.expect)) {
+			t.Errorf("List: expected %v with selector %q, got %v", sortedCopy(c.expect), c.labels, got)
+		}
+	}
+
+	sel, err := generic.ParseSelector("", "state=FAILED")
+	if err != nil {
+		t.Fatalf("ParseSelector: unexpected error: %v", err)
+	}
+	list := generic.NewHostOperationList()
+	if err = s.List(list, generic.InNamespace(ns), generic.WithSelector(sel)); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if len(list.Members) != 2 {
+		t.Errorf("List: expected 2 failed operations, got %d", len(list.Members))
+	}
+	for i := range list.Members {
+		if list.Members[i].State != generic.FailureState {
+			t.Errorf("List: expected only failed operations, got %v", list.Members[i].State)
+		}
+	}
+
+	if _, err = generic.ParseSelector("", "state in (FAILED)"); err == nil {
+		t.Errorf("ParseSelector: expected set-based field selector to be rejected")
+	}
+}
+
+func testWatchWithSelector(t *testing.T, s generic.Storage) {
+	group := randomName("group")
+	sel, err := generic.ParseSelector("group="+group+",env=prod", "")
+	if err != nil {
+		t.Fatalf("ParseSelector: unexpected error: %v", err)
+	}
+	w, err := s.Watch(generic.NewHost(), generic.WatchOnKind, sel)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	// Objects out of the selection must not be delivered.
+	host := newHost(randomName("watch-selector"))
+	host.SetLabels(map[string]string{"group": group, "env": "dev"})
+	if err = s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	// Moving into the selection is observed as a creation.
+	host.SetLabels(map[string]string{"group": group, "env": "prod"})
+	if err = s.Update(host); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.CREATE, host)
+	host.Comment = "updated"
+	if err = s.Update(host); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.UPDATE, host)
+	// Moving out of the selection is observed as a deletion.
+	host.SetLabels(map[string]string{"group": group, "env": "dev"})
+	if err = s.Update(host); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.DELETE, host)
+
+	// Deleting an object out of the selection must not be delivered either, thus the
+	// next event observed should be the creation below.
+	if err = s.Delete(host); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	another := newHost(randomName("watch-selector"))
+	another.SetLabels(map[string]string{"group": group, "env": "prod"})
+	assertLifecycle(t, s, w, another)
+}
+
+func testPagination(t *testing.T, s generic.Storage) {
+	ns := randomName("paginate")
+	var names []string
+	for i := 0; i < 7; i++ {
+		op := newHostOperation(ns, fmt.Sprintf("op-%d", i))
+		if i%2 == 1 {
+			op.State = generic.FailureState
+		}
+		if err := s.Create(op); err != nil {
+			t.Fatalf("Create: unexpected error: %v", err)
+		}
+		names = append(names, op.GetName())
+	}
+
+	var (
+		got     []string
+		pages   int
+		token   string
+		version string
+	)
+	for {
+		list := generic.NewHostOperationList()
+		if err := s.List(list, generic.InNamespace(ns), generic.WithLimit(3), generic.WithContinue(token)); err != nil {
+			t.Fatalf("List: unexpected error on page %d: %v", pages, err)
+		}
+		if len(list.Members) > 3 {
+			t.Errorf("List: expected at most 3 objects on page %d, got %d", pages, len(list.Members))
+		}
+		if version == "" {
+			version = list.GetResourceVersion()
+		} else if list.GetResourceVersion() != version {
+			t.Errorf("List: expected all pages at version %s, got %s on page %d", version, list.GetResourceVersion(), pages)
+		}
+		for i := range list.Members {
+			got = append(got, list.Members[i].GetName())
+		}
+		pages++
+		if token = list.GetContinue(); token == "" {
+			break
+		}
+		if pages > len(names) {
+			t.Fatalf("List: continue token never cleared")
+		}
+	}
+	if pages != 3 {
+		t.Errorf("List: expected 3 pages, got %d", pages)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(names) {
+		t.Errorf("List: expected %v, got %v", names, got)
+	}
+
+	// The limit applies to selected objects rather than scanned keys.
+	sel, err := generic.ParseSelector("", "state=FAILED")
+	if err != nil {
+		t.Fatalf("ParseSelector: unexpected error: %v", err)
+	}
+	list := generic.NewHostOperationList()
+	if err = s.List(list, generic.InNamespace(ns), generic.WithSelector(sel), generic.WithLimit(2)); err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if len(list.Members) != 2 || list.GetContinue() == "" {
+		t.Errorf("List: expected 2 failed operations and a continue token, got %d and %q", len(list.Members), list.GetContinue())
+	}
+
+	// Tokens are only valid for the list that they were issued by.
+	err = s.List(generic.NewHostOperationList(), generic.InNamespace(randomName("paginate")), generic.WithContinue(list.GetContinue()))
+	if err != generic.ErrInvalidContinue {
+		t.Errorf("List: expected ErrInvalidContinue on a foreign token, got %v", err)
+	}
+	err = s.List(generic.NewHostOperationList(), generic.InNamespace(ns), generic.WithContinue("not-a-token"))
+	if err != generic.ErrInvalidContinue {
+		t.Errorf("List: expected ErrInvalidContinue on a malformed token, got %v", err)
+	}
+
+	got = nil
+	it := generic.NewIterator(s, generic.RESOURCE_HOST_OPERATION, 2, generic.InNamespace(ns), generic.WithSelector(sel))
+	for it.Next() {
+		got = append(got, it.Object().GetName())
+	}
+	if err = it.Err(); err != nil {
+		t.Fatalf("Iterator: unexpected error: %v", err)
+	}
+	if expect := []string{names[1], names[3], names[5]}; fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("Iterator: expected %v, got %v", expect, got)
+	}
+}
+
+// testExpire only runs against storages that implement generic.Expirer.
+func testExpire(t *testing.T, s generic.Storage) {
+	expirer, ok := s.(generic.Expirer)
+	if !ok {
+		t.Skip("Storage does not expire objects by itself")
+	}
+	op := newHostOperation(randomName("expire"), "op")
+	if err := expirer.CreateWithTTL(context.Background(), op, time.Second); err != nil {
+		t.Fatalf("CreateWithTTL: unexpected error: %v", err)
+	}
+	w, err := s.Watch(op, generic.WatchOnName)
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+	defer w.Close()
+	// Updates must not detach the object from its ttl.
+	op.State = generic.SuccessState
+	if err = s.Update(op); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.UPDATE, op)
+	expectEvent(t, w, generic.DELETE, op)
+	if err = s.Get(newHostOperation(op.GetNamespace(), op.GetName())); !generic.IsNotFound(err) {
+		t.Errorf("Get: expected ErrResourceNotFound once expired, got %v", err)
+	}
+}
+
+func testImmutable(t *testing.T, s generic.Storage) {
+	record := generic.NewScanRecord()
+	record.SetNamespace(randomName("immutable"))
+	record.SetName(time.Now().UTC().Format(generic.ScanRecordNameFormat))
+	record.State = generic.SuccessState
+	record.Security = []generic.SecurityUpdate{{CVEID: "CVE-2018-0001", Severity: generic.CriticalSec, Package: "kernel"}}
+	if err := s.Create(record); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	record.Security = nil
+	if err := s.Update(record); !generic.IsImmutableError(err) {
+		t.Errorf("Update: expected ErrImmutable, got %v", err)
+	}
+	got := generic.NewScanRecord()
+	got.SetNamespace(record.GetNamespace())
+	got.SetName(record.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if len(got.Security) != 1 {
+		t.Errorf("Get: expected record to be kept intact, got %+v", got.Security)
+	}
+	if err := s.Delete(got); err != nil {
+		t.Errorf("Delete: expected immutable objects to be deletable, got %v", err)
+	}
+}
+
+// testRestore only runs against storages that implement generic.Restorer.
+func testRestore(t *testing.T, s generic.Storage) {
+	restorer, ok := s.(generic.Restorer)
+	if !ok {
+		t.Skip("Storage does not restore objects")
+	}
+	host := generic.NewHost()
+	host.SetGUID(uuid.NewV4().String())
+	host.SetName(randomName("restore"))
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	host.SetCreationTimestamp(createdAt)
+	if err := restorer.Restore(context.Background(), host); err != nil {
+		t.Fatalf("Restore: unexpected error: %v", err)
+	}
+	got := generic.NewHost()
+	got.SetName(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.GetGUID() != host.GetGUID() {
+		t.Errorf("Restore: expected GUID %s to be kept, got %s", host.GetGUID(), got.GetGUID())
+	}
+	if !got.GetCreationTimestamp().Equal(createdAt) {
+		t.Errorf("Restore: expected creation timestamp %v to be kept, got %v", createdAt, got.GetCreationTimestamp())
+	}
+	if err := restorer.Restore(context.Background(), host); !generic.IsConflict(err) {
+		t.Errorf("Restore: expected ErrResourceAlreadyExists, got %v", err)
+	}
+}
+
+func testSchema(t *testing.T, s generic.Storage) {
+	host := generic.NewHost()
+	host.SetName(randomName("schema"))
+	if err := s.Create(host); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	got := generic.NewHost()
+	got.SetName(host.GetName())
+	if err := s.Get(got); err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if v := generic.APIVersionOf(generic.RESOURCE_HOST); got.GetAPIVersion() != v {
+		t.Errorf("Create: expected API version %s, got %q", v, got.GetAPIVersion())
+	}
+	ctx := context.Background()
+	if err := generic.CheckSchema(ctx, s); err != nil {
+		t.Fatalf("CheckSchema: unexpected error: %v", err)
+	}
+	if err := generic.CheckSchema(ctx, s); err != nil {
+		t.Fatalf("CheckSchema: unexpected error on recorded schema: %v", err)
+	}
+	schema := generic.NewSchema()
+	if err := s.Get(schema); err != nil {
+		t.Fatalf("Get: unexpected error on schema: %v", err)
+	}
+	// Pretend that a newer binary has written into storage.
+	schema.Versions[generic.RESOURCE_HOST] = "v99"
+	if err := s.Update(schema); err != nil {
+		t.Fatalf("Update: unexpected error on schema: %v", err)
+	}
+	if err := generic.CheckSchema(ctx, s); err == nil {
+		t.Errorf("CheckSchema: expected an error on a newer schema")
+	}
+}
+
+func sortedCopy(list []string) []string {
+	out := append([]string(nil), list...)
+	sort.Strings(out)
+	return out
+}
+
+// assertLifecycle creates, updates, and deletes the given object, and asserts that the
+// watcher observes exactly these events in order.
+func assertLifecycle(t *testing.T, s generic.Storage, w generic.Watcher, obj generic.Object) {
+	if err := s.Create(obj); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.CREATE, obj)
+	if err := s.Update(obj); err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.UPDATE, obj)
+	if err := s.Delete(obj); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	expectEvent(t, w, generic.DELETE, obj)
+}
+
+func expectEvent(t *testing.T, w generic.Watcher, typ generic.WatchEventType, obj generic.Object) {
+	select {
+	case event, ok := <-w.Output():
+		if !ok {
+			t.Fatalf("Watch: output closed while expecting %v event", typ)
+		}
+		if event.Type != typ {
+			t.Fatalf("Watch: expected %v event, got %v (%s)", typ, event.Type, event.Value)
+		}
+		if event.Kind != obj.GetKind() {
+			t.Errorf("Watch: expected kind %q, got %q", obj.GetKind(), event.Kind)
+		}
+		if event.Key != obj.GetName() {
+			t.Errorf("Watch: expected key %q, got %q", obj.GetName(), event.Key)
+		}
+		cv := generic.NewHost()
+		if err := event.Unmarshal(cv); err != nil {
+			t.Errorf("Watch: could not unmarshal event value: %v", err)
+		} else {
+			if cv.GetGUID() != obj.GetGUID() {
+				t.Errorf("Watch: expected GUID %q in event value, got %q", obj.GetGUID(), cv.GetGUID())
+			}
+			if cv.GetResourceVersion() == "" {
+				t.Errorf("Watch: expected resource version in event value")
+			}
+		}
+	case <-time.After(DefaultEventTimeout):
+		t.Fatalf("Watch: timed out while expecting %v event on %q", typ, obj.GetName())
+	}
+}
@@ -17,6 +17,14 @@ package generic
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cron "github.com/robfig/cron"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 )
 
 const (
@@ -26,6 +34,18 @@ const (
 	RESOURCE_SYSTEM_SCAN = "system_scan"
 	// RESOURCE_HOST_OPERATION indicates the kind of a HostOperation
 	RESOURCE_HOST_OPERATION = "host_operation"
+	// RESOURCE_SCAN_RECORD indicates the kind of a ScanRecord
+	RESOURCE_SCAN_RECORD = "scan_record"
+	// RESOURCE_UPDATE_JOB indicates the kind of a UpdateJob
+	RESOURCE_UPDATE_JOB = "update_job"
+	// RESOURCE_HOST_FACTS indicates the kind of a HostFacts
+	RESOURCE_HOST_FACTS = "host_facts"
+	// RESOURCE_PACKAGE_INVENTORY indicates the kind of a PackageInventory
+	RESOURCE_PACKAGE_INVENTORY = "package_inventory"
+	// RESOURCE_VULNERABILITY_REPORT indicates the kind of a VulnerabilityReport
+	RESOURCE_VULNERABILITY_REPORT = "vulnerability_report"
+	// RESOURCE_SCHEDULE indicates the kind of a Schedule
+	RESOURCE_SCHEDULE = "schedule"
 )
 
 // Host indicates host data object
@@ -51,8 +71,9 @@ func (in *Host) Row() (row []string) {
 		in.GetName(),
 		in.SSHAddress,
 		fmt.Sprintf("%d", in.SSHPort),
-		in.SSHCredential.User,
-		in.OpCredential.User,
+		// Passwords are masked, only their presence is shown.
+		in.SSHCredential.String(),
+		in.OpCredential.String(),
 		string(in.Comment),
 		in.GetCreationTimestamp().String(),
 	}
@@ -62,10 +83,68 @@ func (in *Host) Row() (row []string) {
 	return append(row, "")
 }
 
-// LoginCredential indicates a pair of login user and password.
+// SelectableFields returns the fields of Host that could be used by field selectors.
+func (in *Host) SelectableFields() map[string]string {
+	return map[string]string{
+		"ssh_addr": in.SSHAddress,
+		"ssh_port": fmt.Sprintf("%d", in.SSHPort),
+	}
+}
+
+// Redact removes all secrets of Host, so that it could be exposed to clients.
+func (in *Host) Redact() {
+	in.SSHCredential.Redact()
+	in.OpCredential.Redact()
+}
+
+// LoginCredential indicates a pair of login user and password. The password is only
+// accepted in plain text from clients, and it is always sealed before being stored.
 type LoginCredential struct {
 	User     string `json:"user,omitempty" protobuf:"bytes,1,opt,name=user"`
 	Password []byte `json:"pass,omitempty" protobuf:"bytes,2,opt,name=pass"`
+	// Sealed is the password sealed by keyring.
+	Sealed *keyring.Envelope `json:"sealed,omitempty" protobuf:"bytes,3,opt,name=sealed"`
+}
+
+// HasSecret returns true if the credential carries a password in any form.
+func (in *LoginCredential) HasSecret() bool {
+	return len(in.Password) != 0 || in.Sealed != nil
+}
+
+// Seal seals the plain text password with keyring. It does nothing if there is no plain
+// text password.
+func (in *LoginCredential) Seal(kr *keyring.Keyring) error {
+	if len(in.Password) == 0 {
+		return nil
+	}
+	sealed, err := kr.Seal(in.Password)
+	if err != nil {
+		return err
+	}
+	in.Sealed, in.Password = sealed, nil
+	return nil
+}
+
+// Reveal returns the password in plain text. Credentials stored before encryption was
+// introduced carry plain text passwords, which are returned as is.
+func (in *LoginCredential) Reveal(kr *keyring.Keyring) ([]byte, error) {
+	if in.Sealed == nil {
+		return in.Password, nil
+	}
+	return kr.Open(in.Sealed)
+}
+
+// Redact removes the password in any form.
+func (in *LoginCredential) Redact() {
+	in.Password, in.Sealed = nil, nil
+}
+
+// String returns the user of credential, so that passwords never show up in logs.
+func (in LoginCredential) String() string {
+	if in.HasSecret() {
+		return in.User + ":******"
+	}
+	return in.User
 }
 
 // NewHost generates a new empty Host instance
@@ -106,16 +185,24 @@ type SystemScan struct {
 
 	State    State            `json:"state,omitempty" protobuf:"bytes,2,opt,name=state"`
 	Security []SecurityUpdate `json:"security,omitempty" protobuf:"bytes,3,rep,name=security"`
+	// Latest is the name of the latest ScanRecord of the host, if any.
+	Latest string `json:"latest,omitempty" protobuf:"bytes,4,opt,name=latest"`
+	// Scanner is the name of scanner selected for the host during the last scan.
+	Scanner string `json:"scanner,omitempty" protobuf:"bytes,5,opt,name=scanner"`
+	// RebootRequired is true if the host has to be rebooted for installed updates to take
+	// effect (e.g. kernel or glibc), and Services are those to be restarted for the same.
+	RebootRequired bool     `json:"reboot_required,omitempty" protobuf:"varint,6,opt,name=reboot_required"`
+	Services       []string `json:"services,omitempty" protobuf:"bytes,7,rep,name=services"`
 }
 
 // Header returns a set of headers that will be used for generating ASCII table.
 func (in *SystemScan) Header() []string {
-	return []string{"GUID", "Name", "State", "Security (Critical)", "Security (Important)", "Security (Moderate)", "Updated At"}
+	return []string{"GUID", "Name", "State", "Security (Critical)", "Security (Important)", "Security (Moderate)", "Security (Low)", "Reboot Required", "Updated At"}
 }
 
 // Row returns the value of object as a row of ASCII table.
 func (in *SystemScan) Row() (row []string) {
-	var critical, important, moderate int
+	var critical, important, moderate, low int
 	for _, each := range in.Security {
 		switch each.Severity {
 		case CriticalSec:
@@ -124,6 +211,8 @@ func (in *SystemScan) Row() (row []string) {
 			important++
 		case ModerateSec:
 			moderate++
+		case LowSec:
+			low++
 		}
 	}
 	row = []string{
@@ -133,6 +222,8 @@ func (in *SystemScan) Row() (row []string) {
 		fmt.Sprintf("%d", critical),
 		fmt.Sprintf("%d", important),
 		fmt.Sprintf("%d", moderate),
+		fmt.Sprintf("%d", low),
+		fmt.Sprintf("%t", in.RebootRequired),
 	}
 	if in.GetUpdatingTimestamp() != nil && !in.GetUpdatingTimestamp().IsZero() {
 		return append(row, in.UpdatedAt.String())
@@ -140,13 +231,53 @@ func (in *SystemScan) Row() (row []string) {
 	return append(row, "")
 }
 
-// SecurityUpdate is a single security update entity.
+// SelectableFields returns the fields of SystemScan that could be used by field selectors.
+func (in *SystemScan) SelectableFields() map[string]string {
+	return map[string]string{
+		"state":           in.State.String(),
+		"scanner":         in.Scanner,
+		"reboot_required": fmt.Sprintf("%t", in.RebootRequired),
+	}
+}
+
+// SecurityUpdate is a single update entity, which is an advisory (erratum) applicable to a
+// package. An advisory which fixes multiple CVEs is recorded once for each of them, while
+// those fix no CVE (e.g. bugfix advisories) are recorded without CVE.
 type SecurityUpdate struct {
 	CVEID    string           `json:"cve_id,omitempty" protobuf:"bytes,1,opt,name=cve_id"`
 	Severity SecuritySeverity `json:"severity,omitempty" protobuf:"bytes,2,opt,name=severity"`
-	Package  string           `json:"package,omitempty" protobuf:"bytes,3,opt,name=package"`
+	// Package is the NEVRA of the available package which contains the update.
+	Package string `json:"package,omitempty" protobuf:"bytes,3,opt,name=package"`
+	// Advisory is the ID of advisory, e.g. RHSA-2018:0007.
+	Advisory string       `json:"advisory,omitempty" protobuf:"bytes,4,opt,name=advisory"`
+	Type     AdvisoryType `json:"type,omitempty" protobuf:"bytes,5,opt,name=type"`
+	// Installed is the NEVRA of the package which is currently installed, if any.
+	Installed string `json:"installed,omitempty" protobuf:"bytes,6,opt,name=installed"`
+	// Issued is the date (in the form of 2006-01-02) when the advisory was issued, if known.
+	Issued string `json:"issued,omitempty" protobuf:"bytes,7,opt,name=issued"`
 }
 
+// identity returns the update without the installed package, which might change while the
+// update is still pending, e.g. once an older update of the package has been installed.
+func (in SecurityUpdate) identity() SecurityUpdate {
+	in.Installed = ""
+	return in
+}
+
+// AdvisoryType represents the type of an advisory.
+type AdvisoryType string
+
+const (
+	// SecurityAdvisory indicates an advisory which fixes security issues (RHSA).
+	SecurityAdvisory AdvisoryType = "security"
+	// BugfixAdvisory indicates an advisory which fixes bugs (RHBA).
+	BugfixAdvisory AdvisoryType = "bugfix"
+	// EnhancementAdvisory indicates an advisory which brings enhancements (RHEA).
+	EnhancementAdvisory AdvisoryType = "enhancement"
+	// NewPackageAdvisory indicates an advisory which introduces new packages.
+	NewPackageAdvisory AdvisoryType = "newpackage"
+)
+
 // SecuritySeverity represents the severity of a security update.
 type SecuritySeverity int
 
@@ -160,6 +291,8 @@ func (of SecuritySeverity) String() string {
 		return "Important"
 	case ModerateSec:
 		return "Moderate"
+	case LowSec:
+		return "Low"
 	}
 	return "<invalid>"
 }
@@ -174,6 +307,8 @@ const (
 	ImportantSec
 	// ModerateSec indicates moderate security severity.
 	ModerateSec
+	// LowSec indicates low security severity.
+	LowSec
 )
 
 // NewSystemScan generates a new empty SystemScan instance
@@ -209,6 +344,425 @@ func NewSystemScanList() *SystemScanList {
 	}
 }
 
+// HostFacts is the inventory of a single host, which is gathered on each scan. It is named
+// after its host and carries the same labels, so that hosts could be selected by their facts.
+// Facts which could not be gathered are left empty.
+type HostFacts struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	// OS is the ID of operating system (e.g. rhel), and OSName is its pretty name.
+	OS        string `json:"os,omitempty" protobuf:"bytes,2,opt,name=os"`
+	OSName    string `json:"os_name,omitempty" protobuf:"bytes,3,opt,name=os_name"`
+	OSVersion string `json:"os_version,omitempty" protobuf:"bytes,4,opt,name=os_version"`
+	Kernel    string `json:"kernel,omitempty" protobuf:"bytes,5,opt,name=kernel"`
+	Arch      string `json:"arch,omitempty" protobuf:"bytes,6,opt,name=arch"`
+	// Uptime is the time (in seconds) since the host was booted.
+	Uptime int64 `json:"uptime_seconds,omitempty" protobuf:"varint,7,opt,name=uptime_seconds"`
+	CPUs   int   `json:"cpus,omitempty" protobuf:"varint,8,opt,name=cpus"`
+	// Memory is the total memory (in bytes) of host.
+	Memory int64 `json:"memory_bytes,omitempty" protobuf:"varint,9,opt,name=memory_bytes"`
+	// Packages is the number of installed packages.
+	Packages int `json:"packages,omitempty" protobuf:"varint,10,opt,name=packages"`
+	// Repos are the IDs of enabled repositories (or the sources of APT).
+	Repos []string `json:"repos,omitempty" protobuf:"bytes,11,rep,name=repos"`
+	// Subscription is the overall status reported by subscription-manager, e.g. Current, if
+	// the host is registered to Red Hat.
+	Subscription string `json:"subscription,omitempty" protobuf:"bytes,12,opt,name=subscription"`
+	CollectedAt  Time   `json:"collected_at,omitempty" protobuf:"bytes,13,opt,name=collected_at"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *HostFacts) Header() []string {
+	return []string{"GUID", "Name", "OS", "Kernel", "Arch", "CPUs", "Memory (MiB)", "Packages", "Subscription", "Collected At"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *HostFacts) Row() (row []string) {
+	row = []string{
+		in.GetGUID(),
+		in.GetName(),
+		strings.TrimSpace(in.OS + " " + in.OSVersion),
+		in.Kernel,
+		in.Arch,
+		fmt.Sprintf("%d", in.CPUs),
+		fmt.Sprintf("%d", in.Memory>>20),
+		fmt.Sprintf("%d", in.Packages),
+		in.Subscription,
+	}
+	if !in.CollectedAt.IsZero() {
+		return append(row, in.CollectedAt.String())
+	}
+	return append(row, "")
+}
+
+// SelectableFields returns the fields of HostFacts that could be used by field selectors.
+// Numeric facts are selected by their exact values.
+func (in *HostFacts) SelectableFields() map[string]string {
+	return map[string]string{
+		"os":           in.OS,
+		"os_version":   in.OSVersion,
+		"kernel":       in.Kernel,
+		"arch":         in.Arch,
+		"cpus":         fmt.Sprintf("%d", in.CPUs),
+		"subscription": in.Subscription,
+	}
+}
+
+// NewHostFacts generates a new empty HostFacts instance
+func NewHostFacts() *HostFacts {
+	return &HostFacts{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_HOST_FACTS},
+	}
+}
+
+// HostFactsList indicates list of HostFacts
+type HostFactsList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []HostFacts `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *HostFactsList) AppendRaw(dAtA []byte) error {
+	cv := NewHostFacts()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// NewHostFactsList generates a new empty HostFactsList instance
+func NewHostFactsList() *HostFactsList {
+	return &HostFactsList{
+		ObjectListMeta: ObjectListMeta{
+			Kind: RESOURCE_HOST_FACTS,
+		},
+	}
+}
+
+// PackageInventory is the list of installed packages on a single host, which is collected on
+// each scan. Like HostFacts, it is named after its host and carries the same labels.
+type PackageInventory struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	// Manager is the package manager by whose scheme versions are compared, i.e. rpm or dpkg.
+	Manager     string             `json:"manager,omitempty" protobuf:"bytes,2,opt,name=manager"`
+	Packages    []InstalledPackage `json:"packages,omitempty" protobuf:"bytes,3,rep,name=packages"`
+	CollectedAt Time               `json:"collected_at,omitempty" protobuf:"bytes,4,opt,name=collected_at"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *PackageInventory) Header() []string {
+	return []string{"GUID", "Name", "Manager", "Packages", "Collected At"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *PackageInventory) Row() (row []string) {
+	row = []string{
+		in.GetGUID(),
+		in.GetName(),
+		in.Manager,
+		fmt.Sprintf("%d", len(in.Packages)),
+	}
+	if !in.CollectedAt.IsZero() {
+		return append(row, in.CollectedAt.String())
+	}
+	return append(row, "")
+}
+
+// SelectableFields returns the fields of PackageInventory that could be used by field selectors.
+func (in *PackageInventory) SelectableFields() map[string]string {
+	return map[string]string{
+		"manager": in.Manager,
+	}
+}
+
+// Search returns the installed packages whose names match pattern, and whose versions are in
+// the range. Pattern is a shell pattern as path.Match, e.g. `openssl*`.
+func (in *PackageInventory) Search(pattern string, versions VersionRange) []InstalledPackage {
+	var out []InstalledPackage
+	for _, each := range in.Packages {
+		if matched, _ := path.Match(pattern, each.Name); !matched {
+			continue
+		}
+		if versions.Matches(in.Manager, each.Version) {
+			out = append(out, each)
+		}
+	}
+	return out
+}
+
+// InstalledPackage is a package installed on host.
+type InstalledPackage struct {
+	Name string `json:"name,omitempty" protobuf:"bytes,1,opt,name=name"`
+	// Version is the full version of package, i.e. `[EPOCH:]VERSION-RELEASE` of rpm, or
+	// `[EPOCH:]UPSTREAM[-REVISION]` of dpkg.
+	Version string `json:"version,omitempty" protobuf:"bytes,2,opt,name=version"`
+	Arch    string `json:"arch,omitempty" protobuf:"bytes,3,opt,name=arch"`
+}
+
+// NewPackageInventory generates a new empty PackageInventory instance
+func NewPackageInventory() *PackageInventory {
+	return &PackageInventory{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_PACKAGE_INVENTORY},
+	}
+}
+
+// PackageInventoryList indicates list of PackageInventory
+type PackageInventoryList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []PackageInventory `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *PackageInventoryList) AppendRaw(dAtA []byte) error {
+	cv := NewPackageInventory()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// NewPackageInventoryList generates a new empty PackageInventoryList instance
+func NewPackageInventoryList() *PackageInventoryList {
+	return &PackageInventoryList{
+		ObjectListMeta: ObjectListMeta{
+			Kind: RESOURCE_PACKAGE_INVENTORY,
+		},
+	}
+}
+
+// VulnerabilityReport is the security updates of a single host found by correlating its
+// installed packages with the feeds of vendors, which does not depend on the repositories
+// configured on host. Like PackageInventory, it is named after its host and carries the same
+// labels.
+type VulnerabilityReport struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	Security []SecurityUpdate `json:"security,omitempty" protobuf:"bytes,2,rep,name=security"`
+	// Feeds are the names of feed files which have been correlated.
+	Feeds        []string `json:"feeds,omitempty" protobuf:"bytes,3,rep,name=feeds"`
+	CorrelatedAt Time     `json:"correlated_at,omitempty" protobuf:"bytes,4,opt,name=correlated_at"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *VulnerabilityReport) Header() []string {
+	return []string{"GUID", "Name", "Security (Critical)", "Security (Important)", "Security (Moderate)", "Security (Low)", "Correlated At"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *VulnerabilityReport) Row() (row []string) {
+	var critical, important, moderate, low int
+	for _, each := range in.Security {
+		switch each.Severity {
+		case CriticalSec:
+			critical++
+		case ImportantSec:
+			important++
+		case ModerateSec:
+			moderate++
+		case LowSec:
+			low++
+		}
+	}
+	row = []string{
+		in.GetGUID(),
+		in.GetName(),
+		fmt.Sprintf("%d", critical),
+		fmt.Sprintf("%d", important),
+		fmt.Sprintf("%d", moderate),
+		fmt.Sprintf("%d", low),
+	}
+	if !in.CorrelatedAt.IsZero() {
+		return append(row, in.CorrelatedAt.String())
+	}
+	return append(row, "")
+}
+
+// SelectableFields returns the fields of VulnerabilityReport that could be used by field
+// selectors.
+func (in *VulnerabilityReport) SelectableFields() map[string]string {
+	return map[string]string{
+		"vulnerable": fmt.Sprintf("%t", len(in.Security) > 0),
+	}
+}
+
+// NewVulnerabilityReport generates a new empty VulnerabilityReport instance
+func NewVulnerabilityReport() *VulnerabilityReport {
+	return &VulnerabilityReport{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_VULNERABILITY_REPORT},
+	}
+}
+
+// VulnerabilityReportList indicates list of VulnerabilityReport
+type VulnerabilityReportList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []VulnerabilityReport `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *VulnerabilityReportList) AppendRaw(dAtA []byte) error {
+	cv := NewVulnerabilityReport()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// NewVulnerabilityReportList generates a new empty VulnerabilityReportList instance
+func NewVulnerabilityReportList() *VulnerabilityReportList {
+	return &VulnerabilityReportList{
+		ObjectListMeta: ObjectListMeta{
+			Kind: RESOURCE_VULNERABILITY_REPORT,
+		},
+	}
+}
+
+// PackageSearchResult is the installed packages found on a single host.
+type PackageSearchResult struct {
+	Host     string             `json:"host,omitempty"`
+	Manager  string             `json:"manager,omitempty"`
+	Packages []InstalledPackage `json:"packages,omitempty"`
+}
+
+// ScanRecordNameFormat is the layout of time that names a ScanRecord after the time when
+// its scan was started, so that records of a host are ordered by time.
+const ScanRecordNameFormat = "20060102T150405.000000000Z"
+
+// ScanRecord is an immutable snapshot of a finished scan on a single host. It is namespace-
+// sensitive, and its namespace's value is restricted to be the name of the host. The record
+// refers to the operation which performed the scan, which might have been removed already
+// according to retention policies.
+type ScanRecord struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	State      State            `json:"state,omitempty" protobuf:"bytes,2,opt,name=state"`
+	Security   []SecurityUpdate `json:"security,omitempty" protobuf:"bytes,3,rep,name=security"`
+	StartedAt  Time             `json:"started_at,omitempty" protobuf:"bytes,4,opt,name=started_at"`
+	FinishedAt Time             `json:"finished_at,omitempty" protobuf:"bytes,5,opt,name=finished_at"`
+	// Duration is the time (in milliseconds) that the scan took.
+	Duration  int64  `json:"duration_ms,omitempty" protobuf:"varint,6,opt,name=duration_ms"`
+	Operation string `json:"operation,omitempty" protobuf:"bytes,7,opt,name=operation"`
+	// Reason is the reason of failure if the scan has failed.
+	Reason string `json:"reason,omitempty" protobuf:"bytes,8,opt,name=reason"`
+	// Scanner is the name of scanner which performed the scan.
+	Scanner        string   `json:"scanner,omitempty" protobuf:"bytes,9,opt,name=scanner"`
+	RebootRequired bool     `json:"reboot_required,omitempty" protobuf:"varint,10,opt,name=reboot_required"`
+	Services       []string `json:"services,omitempty" protobuf:"bytes,11,rep,name=services"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *ScanRecord) Header() []string {
+	return []string{"Name", "Host", "State", "Scanner", "Security", "Started At", "Duration", "Operation"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *ScanRecord) Row() []string {
+	return []string{
+		in.GetName(),
+		in.GetNamespace(),
+		in.State.String(),
+		in.Scanner,
+		fmt.Sprintf("%d", len(in.Security)),
+		in.StartedAt.String(),
+		(time.Duration(in.Duration) * time.Millisecond).String(),
+		in.Operation,
+	}
+}
+
+// SelectableFields returns the fields of ScanRecord that could be used by field selectors.
+func (in *ScanRecord) SelectableFields() map[string]string {
+	return map[string]string{
+		"state":   in.State.String(),
+		"scanner": in.Scanner,
+	}
+}
+
+// HasNamespace returns true if object is namespace-sensitive
+func (in *ScanRecord) HasNamespace() bool { return true }
+
+// IsImmutable returns true as records could never be updated once created.
+func (in *ScanRecord) IsImmutable() bool { return true }
+
+// Diff compares the security updates of record with those of a previous one, and returns
+// the differences between them. The previous record could be nil, which means nothing.
+func (in *ScanRecord) Diff(prev *ScanRecord) *ScanDiff {
+	diff := &ScanDiff{To: in.GetName()}
+	before := make(map[SecurityUpdate]struct{})
+	if prev != nil {
+		diff.From = prev.GetName()
+		for _, each := range prev.Security {
+			before[each.identity()] = struct{}{}
+		}
+	}
+	after := make(map[SecurityUpdate]struct{})
+	for _, each := range in.Security {
+		after[each.identity()] = struct{}{}
+		if _, ok := before[each.identity()]; ok {
+			diff.Unchanged++
+		} else {
+			diff.Added = append(diff.Added, each)
+		}
+	}
+	if prev != nil {
+		for _, each := range prev.Security {
+			if _, ok := after[each.identity()]; !ok {
+				diff.Removed = append(diff.Removed, each)
+			}
+		}
+	}
+	return diff
+}
+
+// ScanDiff is the differences of security updates between two scan records of a host.
+// Added are those newly exposed, and Removed are those which have been patched since.
+type ScanDiff struct {
+	From      string           `json:"from,omitempty"`
+	To        string           `json:"to,omitempty"`
+	Added     []SecurityUpdate `json:"added,omitempty"`
+	Removed   []SecurityUpdate `json:"removed,omitempty"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// NewScanRecord generates a new empty ScanRecord instance
+func NewScanRecord() *ScanRecord {
+	return &ScanRecord{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_SCAN_RECORD},
+	}
+}
+
+// ScanRecordList indicates list of ScanRecord
+type ScanRecordList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []ScanRecord `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *ScanRecordList) AppendRaw(dAtA []byte) error {
+	cv := NewScanRecord()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// NewScanRecordList generates a new empty ScanRecordList instance
+func NewScanRecordList() *ScanRecordList {
+	return &ScanRecordList{
+		ObjectListMeta: ObjectListMeta{
+			Kind:     RESOURCE_SCAN_RECORD,
+			Isolated: true,
+		},
+	}
+}
+
 // State is the generic execution state
 type State int
 
@@ -226,6 +780,10 @@ func (of State) String() string {
 		return "COMPLETED"
 	case FailureState:
 		return "FAILED"
+	case PausedState:
+		return "PAUSED"
+	case WaitingState:
+		return "WAITING"
 	}
 	return "<invalid>"
 }
@@ -243,6 +801,11 @@ const (
 	SuccessState
 	// FailureState indicates that a job has finished and failed.
 	FailureState
+	// PausedState indicates that a job has been paused, and it is waiting to be resumed.
+	PausedState
+	// WaitingState indicates that a job is waiting for maintenance windows of its hosts, or
+	// for their blackouts to end, and it will be resumed by executor.
+	WaitingState
 )
 
 // OperationType is the original issuer of an operation.
@@ -283,6 +846,8 @@ func (of OperationMethod) String() string {
 		return "output"
 	case CombinedOutputMethod:
 		return "combined_output"
+	case RebootMethod:
+		return "reboot"
 	}
 	return "<invalid>"
 }
@@ -300,6 +865,10 @@ const (
 	// CombinedOutputMethod is a flag that drives executor to run a command with CombinedOutput().
 	// This method is similar to OutputMethod, but also includes stderr in data.
 	CombinedOutputMethod
+	// RebootMethod is a flag that drives executor to reboot host with the command (or with
+	// DefaultRebootCommand of executor if it is empty), and to wait until host comes back over
+	// SSH. Timeout is the time to wait for host instead of the time of command.
+	RebootMethod
 )
 
 // HostOperation is a operation that is performed on a single host. It is namespace-sensitive,
@@ -339,6 +908,15 @@ func (in *HostOperation) Row() (row []string) {
 	return append(row, "")
 }
 
+// SelectableFields returns the fields of HostOperation that could be used by field selectors.
+func (in *HostOperation) SelectableFields() map[string]string {
+	return map[string]string{
+		"state":  in.State.String(),
+		"type":   in.Type.String(),
+		"method": in.Method.String(),
+	}
+}
+
 // HasNamespace returns true if object is namespace-sensitive
 func (in *HostOperation) HasNamespace() bool { return true }
 
@@ -375,3 +953,471 @@ func NewHostOperationList() *HostOperationList {
 		},
 	}
 }
+
+// UpdateJob applies the selected updates to a set of hosts by their package managers. Hosts
+// are rolled out in batches according to the rollout policy, and each of them is rescanned
+// once it has been updated.
+type UpdateJob struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	Hosts    []string       `json:"hosts,omitempty" protobuf:"bytes,2,rep,name=hosts"`
+	Selector UpdateSelector `json:"selector,omitempty" protobuf:"bytes,3,opt,name=selector"`
+	State    State          `json:"state,omitempty" protobuf:"bytes,4,opt,name=state"`
+	// Results are the results of hosts that have been handled so far, in the order of Hosts.
+	Results    []HostUpdateResult `json:"results,omitempty" protobuf:"bytes,5,rep,name=results"`
+	StartedAt  Time               `json:"started_at,omitempty" protobuf:"bytes,6,opt,name=started_at"`
+	FinishedAt Time               `json:"finished_at,omitempty" protobuf:"bytes,7,opt,name=finished_at"`
+	Rollout    RolloutPolicy      `json:"rollout,omitempty" protobuf:"bytes,8,opt,name=rollout"`
+	// Batch is the number of batches that have been started, and Batches is the total.
+	Batch   int `json:"batch,omitempty" protobuf:"varint,9,opt,name=batch"`
+	Batches int `json:"batches,omitempty" protobuf:"varint,10,opt,name=batches"`
+	// Reason is the reason why the job has been paused or aborted, if any.
+	Reason string `json:"reason,omitempty" protobuf:"bytes,11,opt,name=reason"`
+	// Stop is the action requested by users on the job in progress, which is taken once the
+	// batch being rolled out has finished.
+	Stop RolloutAction `json:"stop,omitempty" protobuf:"bytes,12,opt,name=stop"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *UpdateJob) Header() []string {
+	return []string{"Name", "State", "Hosts", "Batch", "Succeeded", "Failed", "Started At", "Finished At"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *UpdateJob) Row() []string {
+	var succeeded, failed int
+	for _, each := range in.Results {
+		switch each.State {
+		case SuccessState:
+			succeeded++
+		case FailureState, AbortState:
+			failed++
+		}
+	}
+	row := []string{
+		in.GetName(),
+		in.State.String(),
+		fmt.Sprintf("%d", len(in.Hosts)),
+		fmt.Sprintf("%d/%d", in.Batch, in.Batches),
+		fmt.Sprintf("%d", succeeded),
+		fmt.Sprintf("%d", failed),
+	}
+	for _, each := range []Time{in.StartedAt, in.FinishedAt} {
+		if each.IsZero() {
+			row = append(row, "")
+		} else {
+			row = append(row, each.String())
+		}
+	}
+	return row
+}
+
+// SelectableFields returns the fields of UpdateJob that could be used by field selectors.
+func (in *UpdateJob) SelectableFields() map[string]string {
+	return map[string]string{
+		"state": in.State.String(),
+	}
+}
+
+// RolloutAction is the action to be taken once too many hosts of a batch have failed.
+type RolloutAction string
+
+const (
+	// PauseRollout pauses the rollout until it is resumed or aborted by users.
+	PauseRollout RolloutAction = "pause"
+	// AbortRollout aborts the rollout, thus the rest of hosts are left untouched.
+	AbortRollout RolloutAction = "abort"
+)
+
+// RolloutPolicy controls how the hosts of an UpdateJob are rolled out. Both BatchSize and
+// MaxFailures are either a number (e.g. "2") or a percentage (e.g. "25%"). Hosts of a batch
+// are updated at the same time, thus executor should have more workers than a batch.
+type RolloutPolicy struct {
+	// BatchSize is the number of hosts per batch, or the percentage of all hosts. Hosts are
+	// updated one by one by default.
+	BatchSize string `json:"batch_size,omitempty" protobuf:"bytes,1,opt,name=batch_size"`
+	// HealthCheck is the command to be performed on each host once it has been updated, and
+	// the host is considered as failed if the command failed.
+	HealthCheck string `json:"health_check,omitempty" protobuf:"bytes,2,opt,name=health_check"`
+	// MaxFailures is the number of hosts allowed to fail in a batch, or the percentage of the
+	// batch. Failures are not limited by default, thus all hosts are rolled out anyway.
+	MaxFailures string        `json:"max_failures,omitempty" protobuf:"bytes,3,opt,name=max_failures"`
+	OnFailure   RolloutAction `json:"on_failure,omitempty" protobuf:"bytes,4,opt,name=on_failure"`
+	// Reboot reboots those hosts which have to be rebooted once updated, and waits until they
+	// come back before checking their health.
+	Reboot bool `json:"reboot,omitempty" protobuf:"varint,5,opt,name=reboot"`
+}
+
+// Validate returns any error of the policy.
+func (in *RolloutPolicy) Validate() error {
+	if _, err := in.BatchSizeOf(1); err != nil {
+		return err
+	}
+	if _, err := in.MaxFailuresOf(1); err != nil {
+		return err
+	}
+	switch in.OnFailure {
+	case "", PauseRollout, AbortRollout:
+		return nil
+	}
+	return fmt.Errorf("Invalid action on failure: %s", in.OnFailure)
+}
+
+// BatchSizeOf returns the number of hosts per batch among total hosts, which is at least 1.
+func (in *RolloutPolicy) BatchSizeOf(total int) (int, error) {
+	n, err := parseAmount(in.BatchSize, total, 1, true)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid batch size: %v", err)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n, nil
+}
+
+// MaxFailuresOf returns the number of hosts allowed to fail in a batch of given size.
+func (in *RolloutPolicy) MaxFailuresOf(size int) (int, error) {
+	n, err := parseAmount(in.MaxFailures, size, size, false)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid max failures: %v", err)
+	}
+	return n, nil
+}
+
+// Action returns the action to be taken on failures, which pauses the rollout by default.
+func (in *RolloutPolicy) Action() RolloutAction {
+	if in.OnFailure == "" {
+		return PauseRollout
+	}
+	return in.OnFailure
+}
+
+// parseAmount parses a number or a percentage of total. Percentages are rounded up if ceil
+// is true, otherwise they are rounded down. The def is returned if s is empty.
+func parseAmount(s string, total, def int, ceil bool) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("%s is not a valid percentage", s)
+		}
+		n := total * percent / 100
+		if ceil && total*percent%100 != 0 {
+			n++
+		}
+		return n, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s is neither a number nor a percentage", s)
+	}
+	return n, nil
+}
+
+// UpdateSelector selects the security updates of a scan to be applied. An update is selected
+// if it matches any of the criteria.
+type UpdateSelector struct {
+	// AllSecurity selects all updates of security advisories.
+	AllSecurity bool               `json:"all_security,omitempty" protobuf:"varint,1,opt,name=all_security"`
+	Severities  []SecuritySeverity `json:"severities,omitempty" protobuf:"bytes,2,rep,name=severities"`
+	CVEs        []string           `json:"cves,omitempty" protobuf:"bytes,3,rep,name=cves"`
+	Advisories  []string           `json:"advisories,omitempty" protobuf:"bytes,4,rep,name=advisories"`
+}
+
+// Empty returns true if the selector selects nothing.
+func (in *UpdateSelector) Empty() bool {
+	return !in.AllSecurity && len(in.Severities) == 0 && len(in.CVEs) == 0 && len(in.Advisories) == 0
+}
+
+// Matches returns true if the update is selected.
+func (in *UpdateSelector) Matches(update SecurityUpdate) bool {
+	if in.AllSecurity && update.Type == SecurityAdvisory {
+		return true
+	}
+	for _, each := range in.Severities {
+		if each != UnknownSec && each == update.Severity {
+			return true
+		}
+	}
+	for _, each := range in.CVEs {
+		if update.CVEID != "" && strings.EqualFold(each, update.CVEID) {
+			return true
+		}
+	}
+	for _, each := range in.Advisories {
+		if update.Advisory != "" && strings.EqualFold(each, update.Advisory) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the packages to be installed among updates, in the order they appear.
+// Updates of the same package are installed once.
+func (in *UpdateSelector) Select(updates []SecurityUpdate) []SecurityUpdate {
+	var out []SecurityUpdate
+	seen := make(map[string]bool)
+	for _, each := range updates {
+		if each.Package == "" || seen[each.Package] || !in.Matches(each) {
+			continue
+		}
+		seen[each.Package] = true
+		out = append(out, each)
+	}
+	return out
+}
+
+// HostUpdateResult is the result of an UpdateJob on a single host.
+type HostUpdateResult struct {
+	Host  string `json:"host,omitempty" protobuf:"bytes,1,opt,name=host"`
+	State State  `json:"state,omitempty" protobuf:"bytes,2,opt,name=state"`
+	// Operation is the name of operation which applied the updates, if any.
+	Operation string          `json:"operation,omitempty" protobuf:"bytes,3,opt,name=operation"`
+	Packages  []PackageResult `json:"packages,omitempty" protobuf:"bytes,4,rep,name=packages"`
+	// Reason is the reason of failure if the host could not be updated.
+	Reason string `json:"reason,omitempty" protobuf:"bytes,5,opt,name=reason"`
+	// Batch is the batch that the host was rolled out in, starting from 1.
+	Batch int `json:"batch,omitempty" protobuf:"varint,6,opt,name=batch"`
+	// HealthCheck is the name of operation which checked the health of host, if any.
+	HealthCheck string `json:"health_check,omitempty" protobuf:"bytes,7,opt,name=health_check"`
+	// Reboot is the name of operation which rebooted the host, if any.
+	Reboot string `json:"reboot,omitempty" protobuf:"bytes,8,opt,name=reboot"`
+}
+
+// PackageResult is the result of updating a single package.
+type PackageResult struct {
+	// Package is the NEVRA of the package which was expected to be installed.
+	Package string `json:"package,omitempty" protobuf:"bytes,1,opt,name=package"`
+	// Previous and Installed are the NEVRA of installed package before and after the update.
+	Previous  string `json:"previous,omitempty" protobuf:"bytes,2,opt,name=previous"`
+	Installed string `json:"installed,omitempty" protobuf:"bytes,3,opt,name=installed"`
+	State     State  `json:"state,omitempty" protobuf:"bytes,4,opt,name=state"`
+}
+
+// NewUpdateJob generates a new empty UpdateJob instance
+func NewUpdateJob() *UpdateJob {
+	return &UpdateJob{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_UPDATE_JOB},
+	}
+}
+
+// UpdateJobList indicates list of UpdateJob
+type UpdateJobList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []UpdateJob `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *UpdateJobList) AppendRaw(dAtA []byte) error {
+	cv := NewUpdateJob()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// NewUpdateJobList generates a new empty UpdateJobList instance
+func NewUpdateJobList() *UpdateJobList {
+	return &UpdateJobList{
+		ObjectListMeta: ObjectListMeta{
+			Kind: RESOURCE_UPDATE_JOB,
+		},
+	}
+}
+
+// Schedule defines when hosts are scanned and updated, which applies to the hosts listed by
+// name, or selected by their labels as a group. Hosts are scanned by Scan instead of the
+// global schedule of executor, and update jobs only touch them within maintenance windows.
+// Neither scans nor updates are performed during blackouts.
+type Schedule struct {
+	ObjectMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+
+	Hosts []string `json:"hosts,omitempty" protobuf:"bytes,2,rep,name=hosts"`
+	// HostSelector is a label selector of hosts, e.g. `env=prod,role in (web)`.
+	HostSelector string `json:"host_selector,omitempty" protobuf:"bytes,3,opt,name=host_selector"`
+	// Scan is the CRON expression of scans, or the global schedule applies if it is empty.
+	Scan string `json:"scan,omitempty" protobuf:"bytes,4,opt,name=scan"`
+	// Windows are the maintenance windows, or hosts could be updated at any time if there is
+	// none.
+	Windows   []MaintenanceWindow `json:"windows,omitempty" protobuf:"bytes,5,rep,name=windows"`
+	Blackouts []Blackout          `json:"blackouts,omitempty" protobuf:"bytes,6,rep,name=blackouts"`
+}
+
+// MaintenanceWindow is a recurring period, which opens by a CRON expression and lasts for
+// a duration, e.g. {"start": "0 0 2 * * SAT", "duration": "4h"}.
+type MaintenanceWindow struct {
+	Start    string `json:"start,omitempty" protobuf:"bytes,1,opt,name=start"`
+	Duration string `json:"duration,omitempty" protobuf:"bytes,2,opt,name=duration"`
+}
+
+// Blackout is a period during which hosts must not be touched, e.g. a change freeze.
+type Blackout struct {
+	Start  Time   `json:"start,omitempty" protobuf:"bytes,1,opt,name=start"`
+	End    Time   `json:"end,omitempty" protobuf:"bytes,2,opt,name=end"`
+	Reason string `json:"reason,omitempty" protobuf:"bytes,3,opt,name=reason"`
+}
+
+// Header returns a set of headers that will be used for generating ASCII table.
+func (in *Schedule) Header() []string {
+	return []string{"GUID", "Name", "Hosts", "Host Selector", "Scan", "Windows", "Blackouts"}
+}
+
+// Row returns the value of object as a row of ASCII table.
+func (in *Schedule) Row() []string {
+	return []string{
+		in.GetGUID(),
+		in.GetName(),
+		strings.Join(in.Hosts, ","),
+		in.HostSelector,
+		in.Scan,
+		fmt.Sprintf("%d", len(in.Windows)),
+		fmt.Sprintf("%d", len(in.Blackouts)),
+	}
+}
+
+// Validate returns an error if the schedule is invalid.
+func (in *Schedule) Validate() error {
+	if len(in.Hosts) == 0 && in.HostSelector == "" {
+		return fmt.Errorf("Either hosts or host selector is required")
+	}
+	if _, err := ParseSelector(in.HostSelector, ""); err != nil {
+		return err
+	}
+	if in.Scan != "" {
+		if _, err := cron.Parse(in.Scan); err != nil {
+			return fmt.Errorf("Invalid scan schedule: %v", err)
+		}
+	}
+	for _, each := range in.Windows {
+		if _, _, err := each.parse(); err != nil {
+			return err
+		}
+	}
+	for _, each := range in.Blackouts {
+		if !each.End.After(each.Start.Time) {
+			return fmt.Errorf("Blackout must end after it starts")
+		}
+	}
+	return nil
+}
+
+// Selects returns true if the schedule applies to host.
+func (in *Schedule) Selects(host *Host) bool {
+	for _, each := range in.Hosts {
+		if each == host.GetName() {
+			return true
+		}
+	}
+	if in.HostSelector == "" {
+		return false
+	}
+	selector, err := ParseSelector(in.HostSelector, "")
+	return err == nil && selector.Matches(host)
+}
+
+// ScanDue returns true if hosts have to be scanned at now, as they were checked at last.
+func (in *Schedule) ScanDue(last, now time.Time) bool {
+	sche, err := cron.Parse(in.Scan)
+	if err != nil {
+		return false
+	}
+	next := sche.Next(last)
+	return !next.IsZero() && !next.After(now)
+}
+
+// InWindow returns true if t is within any of maintenance windows, or there is no window.
+func (in *Schedule) InWindow(t time.Time) bool {
+	if len(in.Windows) == 0 {
+		return true
+	}
+	for _, each := range in.Windows {
+		sche, duration, err := each.parse()
+		if err != nil {
+			continue
+		}
+		// The window is open if it has been opened since t-duration.
+		if next := sche.Next(t.Add(-duration)); !next.IsZero() && !next.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlackoutAt returns the blackout which t is in, or nil if there is none.
+func (in *Schedule) BlackoutAt(t time.Time) *Blackout {
+	for i := range in.Blackouts {
+		if !t.Before(in.Blackouts[i].Start.Time) && t.Before(in.Blackouts[i].End.Time) {
+			return &in.Blackouts[i]
+		}
+	}
+	return nil
+}
+
+func (in MaintenanceWindow) parse() (cron.Schedule, time.Duration, error) {
+	sche, err := cron.Parse(in.Start)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid start of maintenance window: %v", err)
+	}
+	duration, err := time.ParseDuration(in.Duration)
+	if err != nil || duration <= 0 {
+		return nil, 0, fmt.Errorf("Invalid duration of maintenance window: %s", in.Duration)
+	}
+	return sche, duration, nil
+}
+
+// NewSchedule generates a new empty Schedule instance
+func NewSchedule() *Schedule {
+	return &Schedule{
+		ObjectMeta: ObjectMeta{Kind: RESOURCE_SCHEDULE},
+	}
+}
+
+// ScheduleList indicates list of Schedule
+type ScheduleList struct {
+	ObjectListMeta `json:",inline"`
+
+	Members []Schedule `json:"members,omitempty"`
+}
+
+// AppendRaw appends raw format data to object list, and returns any encountered error.
+func (in *ScheduleList) AppendRaw(dAtA []byte) error {
+	cv := NewSchedule()
+	if err := json.Unmarshal(dAtA, cv); err != nil {
+		return err
+	}
+	in.Members = append(in.Members, *cv)
+	return nil
+}
+
+// Of returns the schedules which apply to host. Those listing the host by name precede those
+// selecting it by labels, and then they are ordered by name.
+func (in *ScheduleList) Of(host *Host) []Schedule {
+	var named, selected []Schedule
+	for _, each := range in.Members {
+		if !each.Selects(host) {
+			continue
+		}
+		if contains(each.Hosts, host.GetName()) {
+			named = append(named, each)
+		} else {
+			selected = append(selected, each)
+		}
+	}
+	for _, list := range [][]Schedule{named, selected} {
+		sort.Slice(list, func(i, j int) bool { return list[i].GetName() < list[j].GetName() })
+	}
+	return append(named, selected...)
+}
+
+// NewScheduleList generates a new empty ScheduleList instance
+func NewScheduleList() *ScheduleList {
+	return &ScheduleList{
+		ObjectListMeta: ObjectListMeta{
+			Kind: RESOURCE_SCHEDULE,
+		},
+	}
+}
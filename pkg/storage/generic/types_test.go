@@ -0,0 +1,362 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
+)
+
+var pendingUpdates = []SecurityUpdate{
+	{CVEID: "CVE-2017-5715", Severity: ImportantSec, Package: "kernel-3.10.0-693.11.6.el7.x86_64", Advisory: "RHSA-2018:0007", Type: SecurityAdvisory},
+	{CVEID: "CVE-2017-5753", Severity: ImportantSec, Package: "kernel-3.10.0-693.11.6.el7.x86_64", Advisory: "RHSA-2018:0007", Type: SecurityAdvisory},
+	{Package: "1:openssl-1.0.2k-9.el7.x86_64", Advisory: "RHBA-2018:0010", Type: BugfixAdvisory},
+	{CVEID: "CVE-2014-6271", Severity: LowSec, Package: "bash-4.2.46-30.el7.x86_64", Advisory: "RHSA-2018:0100", Type: SecurityAdvisory},
+	{Package: "nginx-1.12.2-3.el7.x86_64", Advisory: "FEDORA-EPEL-2019-1", Type: SecurityAdvisory},
+	{CVEID: "CVE-2017-9999", Severity: ModerateSec, Type: SecurityAdvisory},
+}
+
+func TestUpdateSelectorSelect(t *testing.T) {
+	cases := []struct {
+		name     string
+		selector UpdateSelector
+		expect   []string
+	}{
+		{"Empty", UpdateSelector{}, nil},
+		{"AllSecurity", UpdateSelector{AllSecurity: true}, []string{"kernel-3.10.0-693.11.6.el7.x86_64", "bash-4.2.46-30.el7.x86_64", "nginx-1.12.2-3.el7.x86_64"}},
+		{"Severity", UpdateSelector{Severities: []SecuritySeverity{LowSec}}, []string{"bash-4.2.46-30.el7.x86_64"}},
+		{"UnknownSeverity", UpdateSelector{Severities: []SecuritySeverity{UnknownSec}}, nil},
+		{"CVE", UpdateSelector{CVEs: []string{"cve-2017-5753"}}, []string{"kernel-3.10.0-693.11.6.el7.x86_64"}},
+		{"CVEWithoutPackage", UpdateSelector{CVEs: []string{"CVE-2017-9999"}}, nil},
+		{"Advisory", UpdateSelector{Advisories: []string{"RHSA-2018:0100", "rhba-2018:0010"}}, []string{"1:openssl-1.0.2k-9.el7.x86_64", "bash-4.2.46-30.el7.x86_64"}},
+		{"Union", UpdateSelector{Severities: []SecuritySeverity{ImportantSec}, Advisories: []string{"RHSA-2018:0100"}}, []string{"kernel-3.10.0-693.11.6.el7.x86_64", "bash-4.2.46-30.el7.x86_64"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, each := range c.selector.Select(pendingUpdates) {
+			got = append(got, each.Package)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expect, got)
+		}
+		if empty := c.selector.Empty(); empty != (c.name == "Empty") {
+			t.Errorf("%s: unexpected Empty() = %v", c.name, empty)
+		}
+	}
+}
+
+func TestRolloutPolicyBatchSizeOf(t *testing.T) {
+	cases := []struct {
+		size   string
+		total  int
+		expect int
+		err    bool
+	}{
+		{"", 3, 1, false},
+		{"25%", 3, 1, false},
+		{"50%", 3, 2, false},
+		{"25%", 8, 2, false},
+		{"100%", 3, 3, false},
+		{"0%", 3, 1, false},
+		{"0", 3, 1, false},
+		{"2", 3, 2, false},
+		{"5", 3, 5, false},
+		{"25%", 0, 1, false},
+		{"101%", 3, 0, true},
+		{"-1", 3, 0, true},
+		{"-1%", 3, 0, true},
+		{"half", 3, 0, true},
+	}
+	for _, c := range cases {
+		policy := RolloutPolicy{BatchSize: c.size}
+		got, err := policy.BatchSizeOf(c.total)
+		if (err != nil) != c.err || got != c.expect {
+			t.Errorf("%q of %d: expected %d (error: %v), got %d (%v)", c.size, c.total, c.expect, c.err, got, err)
+		}
+	}
+}
+
+func TestRolloutPolicyMaxFailuresOf(t *testing.T) {
+	cases := []struct {
+		max    string
+		size   int
+		expect int
+		err    bool
+	}{
+		{"", 4, 4, false},
+		{"0", 4, 0, false},
+		{"1", 4, 1, false},
+		{"25%", 3, 0, false},
+		{"50%", 3, 1, false},
+		{"25%", 4, 1, false},
+		{"100%", 3, 3, false},
+		{"0%", 3, 0, false},
+		{"150%", 3, 0, true},
+		{"1.5", 3, 0, true},
+	}
+	for _, c := range cases {
+		policy := RolloutPolicy{MaxFailures: c.max}
+		got, err := policy.MaxFailuresOf(c.size)
+		if (err != nil) != c.err || got != c.expect {
+			t.Errorf("%q of %d: expected %d (error: %v), got %d (%v)", c.max, c.size, c.expect, c.err, got, err)
+		}
+	}
+}
+
+func TestRolloutPolicyValidate(t *testing.T) {
+	cases := []struct {
+		policy RolloutPolicy
+		valid  bool
+	}{
+		{RolloutPolicy{}, true},
+		{RolloutPolicy{BatchSize: "25%", MaxFailures: "0", OnFailure: AbortRollout}, true},
+		{RolloutPolicy{BatchSize: "x"}, false},
+		{RolloutPolicy{MaxFailures: "-1"}, false},
+		{RolloutPolicy{OnFailure: "retry"}, false},
+	}
+	for _, c := range cases {
+		if err := c.policy.Validate(); (err == nil) != c.valid {
+			t.Errorf("%+v: expected valid %v, got %v", c.policy, c.valid, err)
+		}
+	}
+	if action := (&RolloutPolicy{}).Action(); action != PauseRollout {
+		t.Errorf("Expected rollouts to be paused on failure by default, got %s", action)
+	}
+}
+
+// saturday is 2018-06-02 00:00:00 UTC, which is a Saturday.
+var saturday = time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC)
+
+func TestScheduleValidate(t *testing.T) {
+	window := []MaintenanceWindow{{Start: "0 0 2 * * SAT", Duration: "4h"}}
+	blackout := Blackout{}
+	blackout.Start.Time = saturday
+	blackout.End.Time = saturday.Add(time.Hour)
+	inverted := Blackout{}
+	inverted.Start.Time, inverted.End.Time = blackout.End.Time, blackout.Start.Time
+	cases := []struct {
+		name     string
+		schedule Schedule
+		valid    bool
+	}{
+		{"Hosts", Schedule{Hosts: []string{"web-1"}}, true},
+		{"Selector", Schedule{HostSelector: "env=prod", Scan: "0 30 1 * * *", Windows: window, Blackouts: []Blackout{blackout}}, true},
+		{"NoHost", Schedule{Scan: "@daily"}, false},
+		{"InvalidSelector", Schedule{HostSelector: "env in (prod"}, false},
+		{"InvalidScan", Schedule{Hosts: []string{"web-1"}, Scan: "daily"}, false},
+		{"InvalidStart", Schedule{Hosts: []string{"web-1"}, Windows: []MaintenanceWindow{{Start: "x", Duration: "1h"}}}, false},
+		{"InvalidDuration", Schedule{Hosts: []string{"web-1"}, Windows: []MaintenanceWindow{{Start: "@daily", Duration: "0s"}}}, false},
+		{"InvertedBlackout", Schedule{Hosts: []string{"web-1"}, Blackouts: []Blackout{inverted}}, false},
+	}
+	for _, c := range cases {
+		if err := c.schedule.Validate(); (err == nil) != c.valid {
+			t.Errorf("%s: expected valid %v, got %v", c.name, c.valid, err)
+		}
+	}
+}
+
+func TestScheduleInWindow(t *testing.T) {
+	start := saturday.Add(2 * time.Hour)
+	schedule := Schedule{Windows: []MaintenanceWindow{
+		{Start: "0 0 2 * * SAT", Duration: "4h"},
+		// Windows overlapping with each other extend the time to be touched.
+		{Start: "0 0 5 * * SAT", Duration: "2h"},
+		// Invalid windows never open.
+		{Start: "x", Duration: "24h"},
+	}}
+	cases := []struct {
+		t      time.Time
+		expect bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{start.Add(4*time.Hour - time.Second), true},
+		{start.Add(5*time.Hour - time.Second), true},
+		{start.Add(5 * time.Hour), false},
+		{start.Add(24 * time.Hour), false},
+		{start.Add(7 * 24 * time.Hour), true},
+	}
+	for _, c := range cases {
+		if got := schedule.InWindow(c.t); got != c.expect {
+			t.Errorf("%s: expected %v, got %v", c.t, c.expect, got)
+		}
+	}
+	// Windows spanning midnight are open on the next day as well.
+	night := Schedule{Windows: []MaintenanceWindow{{Start: "0 0 22 * * *", Duration: "4h"}}}
+	if !night.InWindow(saturday.Add(time.Hour)) || night.InWindow(saturday.Add(2*time.Hour)) {
+		t.Error("Expected the window to be open from 22:00 to 02:00")
+	}
+	if !(&Schedule{}).InWindow(start) {
+		t.Error("Expected schedules without windows to be always open")
+	}
+}
+
+func TestScheduleScanDue(t *testing.T) {
+	schedule := Schedule{Scan: "0 30 1 * * *"}
+	due := saturday.Add(90 * time.Minute)
+	cases := []struct {
+		last, now time.Time
+		expect    bool
+	}{
+		{due.Add(-time.Minute), due, true},
+		{due.Add(-time.Minute), due.Add(-time.Second), false},
+		{due.Add(-time.Hour), due.Add(time.Hour), true},
+		{due, due.Add(time.Minute), false},
+		{due, due.Add(24 * time.Hour), true},
+	}
+	for _, c := range cases {
+		if got := schedule.ScanDue(c.last, c.now); got != c.expect {
+			t.Errorf("%s to %s: expected %v, got %v", c.last, c.now, c.expect, got)
+		}
+	}
+	if (&Schedule{}).ScanDue(due.Add(-time.Hour), due) {
+		t.Error("Expected schedules without scan never to be due")
+	}
+}
+
+func TestScheduleBlackoutAt(t *testing.T) {
+	schedule := Schedule{Blackouts: make([]Blackout, 2)}
+	// Blackouts might overlap, and the first one is returned.
+	schedule.Blackouts[0].Start.Time = saturday
+	schedule.Blackouts[0].End.Time = saturday.Add(2 * time.Hour)
+	schedule.Blackouts[0].Reason = "first"
+	schedule.Blackouts[1].Start.Time = saturday.Add(time.Hour)
+	schedule.Blackouts[1].End.Time = saturday.Add(3 * time.Hour)
+	schedule.Blackouts[1].Reason = "second"
+	cases := []struct {
+		t      time.Time
+		expect string
+	}{
+		{saturday.Add(-time.Nanosecond), ""},
+		{saturday, "first"},
+		{saturday.Add(90 * time.Minute), "first"},
+		{saturday.Add(2 * time.Hour), "second"},
+		{saturday.Add(3*time.Hour - time.Nanosecond), "second"},
+		{saturday.Add(3 * time.Hour), ""},
+	}
+	for _, c := range cases {
+		var got string
+		if blackout := schedule.BlackoutAt(c.t); blackout != nil {
+			got = blackout.Reason
+		}
+		if got != c.expect {
+			t.Errorf("%s: expected blackout %q, got %q", c.t, c.expect, got)
+		}
+	}
+}
+
+func TestScheduleListOf(t *testing.T) {
+	host := NewHost()
+	host.SetName("web-1")
+	host.SetLabels(map[string]string{"env": "prod", "role": "web"})
+	list := NewScheduleList()
+	for _, each := range []struct {
+		name     string
+		hosts    []string
+		selector string
+	}{
+		{"z-named", []string{"web-1"}, ""},
+		{"a-prod", nil, "env=prod"},
+		{"b-named", []string{"db-1", "web-1"}, "env=dev"},
+		{"c-web", nil, "role=web"},
+		{"d-dev", nil, "env=dev"},
+		{"e-other", []string{"db-1"}, ""},
+	} {
+		schedule := NewSchedule()
+		schedule.SetName(each.name)
+		schedule.Hosts = each.hosts
+		schedule.HostSelector = each.selector
+		list.Members = append(list.Members, *schedule)
+	}
+	var got []string
+	for _, each := range list.Of(host) {
+		got = append(got, each.GetName())
+	}
+	if expect := []string{"b-named", "z-named", "a-prod", "c-web"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %v, got %v", expect, got)
+	}
+}
+
+func newTestKeyring(t *testing.T) *keyring.Keyring {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, keyring.KeySize))
+	kr, err := keyring.Parse(strings.NewReader("k1 " + key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestLoginCredential(t *testing.T) {
+	kr := newTestKeyring(t)
+	cred := LoginCredential{User: "root", Password: []byte("passw0rd")}
+	if cred.String() != "root:******" {
+		t.Errorf("Expected the password to be hidden, got %s", cred.String())
+	}
+	if err := cred.Seal(kr); err != nil {
+		t.Fatal(err)
+	}
+	if cred.Password != nil || cred.Sealed == nil || !cred.HasSecret() {
+		t.Fatalf("Expected the password to be sealed, got %+v", cred)
+	}
+	// Sealing again does nothing, as there is no plain text password.
+	sealed := cred.Sealed
+	if err := cred.Seal(kr); err != nil || cred.Sealed != sealed {
+		t.Fatalf("Expected the sealed password to be kept, got %+v, %v", cred, err)
+	}
+	got, err := cred.Reveal(kr)
+	if err != nil || string(got) != "passw0rd" {
+		t.Errorf("Expected the password to be revealed, got %q, %v", got, err)
+	}
+	// Passwords stored before encryption are revealed as they are.
+	plain := LoginCredential{User: "root", Password: []byte("passw0rd")}
+	if got, err = plain.Reveal(nil); err != nil || string(got) != "passw0rd" {
+		t.Errorf("Expected the plain text password, got %q, %v", got, err)
+	}
+	cred.Redact()
+	if cred.HasSecret() || cred.User != "root" || cred.String() != "root" {
+		t.Errorf("Expected the password to be removed, got %+v", cred)
+	}
+}
+
+func TestHostRedact(t *testing.T) {
+	kr := newTestKeyring(t)
+	host := NewHost()
+	host.SetName("web-1")
+	host.SSHCredential = LoginCredential{User: "admin", Password: []byte("ssh-passw0rd")}
+	host.OpCredential = LoginCredential{User: "root", Password: []byte("op-passw0rd")}
+	if err := host.OpCredential.Seal(kr); err != nil {
+		t.Fatal(err)
+	}
+	host.Redact()
+	dAtA, err := json.Marshal(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, each := range []string{"passw0rd", `"pass"`, `"sealed"`, `"dek"`} {
+		if strings.Contains(string(dAtA), each) {
+			t.Errorf("Expected %s to be redacted from %s", each, dAtA)
+		}
+	}
+	if host.SSHCredential.User != "admin" || host.OpCredential.User != "root" {
+		t.Errorf("Expected users to be kept, got %s and %s", host.SSHCredential, host.OpCredential)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// FormatResourceVersion formats a storage revision as a ResourceVersion.
+func FormatResourceVersion(revision int64) string {
+	return strconv.FormatInt(revision, 10)
+}
+
+// ParseResourceVersion parses a ResourceVersion back to storage revision. An empty
+// version is parsed as zero.
+func ParseResourceVersion(version string) (int64, error) {
+	if version == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(version, 10, 64)
+}
+
+// SetRawResourceVersion returns a copy of the raw format data of an object, whose
+// ResourceVersion is set to the given revision. Storages use it to attach versions to
+// stored values, as versions are never persisted along with objects.
+func SetRawResourceVersion(dAtA []byte, revision int64) ([]byte, error) {
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(dAtA, &obj); err != nil {
+		return nil, err
+	}
+	meta := make(map[string]json.RawMessage)
+	if raw, ok := obj["metadata"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, err
+		}
+	}
+	version, err := json.Marshal(FormatResourceVersion(revision))
+	if err != nil {
+		return nil, err
+	}
+	meta["resource_version"] = version
+	if obj["metadata"], err = json.Marshal(meta); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package observer provides an in-process event hub for storage adapters that have
+// no native watch mechanism, such as the in-memory and the embedded storages.
+package observer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+// DefaultHistorySize is the number of recent events kept by Hub, so that a watcher
+// could be resumed from a recent revision without losing any event.
+const DefaultHistorySize = 1024
+
+// record is an event in history along with its revision and full key. The previous
+// value of an updated object is kept as well, so that watchers with selectors could
+// tell whether it has been moved into or out of their selection.
+type record struct {
+	revision int64
+	key      string
+	prev     []byte
+	event    generic.WatchEvent
+}
+
+// Hub dispatches storage events to all registered watchers. Keys are expected to
+// follow the layout of `/<kind>/[<namespace>/]<name>`.
+type Hub struct {
+	lock      sync.Mutex
+	watchers  map[*watcher]struct{}
+	history   []record // a ring buffer of recent events
+	next      int      // the position of history to write next event
+	compacted int64    // events at or before this revision are no longer available
+	logger    *zap.SugaredLogger
+}
+
+// Watch registers a new watcher on given object with desired option. If the object
+// carries a ResourceVersion, events after that version will be replayed from history.
+// A RESYNC event is delivered first if some of them are no longer available. The
+// watcher is closed once the context is done.
+func (in *Hub) Watch(ctx context.Context, cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	var (
+		kp     string
+		prefix bool
+	)
+	rev, err := generic.ParseResourceVersion(cv.GetResourceVersion())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid resource version %q to watch from", cv.GetResourceVersion())
+	}
+	switch opt {
+	case generic.WatchOnKind:
+		kp, prefix = strings.TrimSuffix(filepath.Join("/", cv.GetKind()), "/")+"/", true
+	case generic.WatchOnNamespace:
+		var ns string
+		if cv.HasNamespace() {
+			ns = cv.GetNamespace()
+		}
+		kp, prefix = strings.TrimSuffix(filepath.Join("/", cv.GetKind(), ns), "/")+"/", true
+	case generic.WatchOnName:
+		var ns string
+		if cv.HasNamespace() {
+			if ns = cv.GetNamespace(); ns == "" {
+				return nil, fmt.Errorf("Namespace is required while watching on a namespace-sensitive object")
+			}
+		}
+		if cv.GetName() == "" {
+			return nil, fmt.Errorf("Name must be specified while watching on a specific target")
+		}
+		kp = filepath.Join("/", cv.GetKind(), ns, cv.GetName())
+	default:
+		return nil, fmt.Errorf("Invalid watch option")
+	}
+	w := newWatcher(ctx, in, kp, prefix, generic.MergeSelectors(sel...), in.logger.With(
+		"prefix", prefix,
+		"key", kp,
+	))
+	in.lock.Lock()
+	if rev > 0 {
+		in.replay(w, rev)
+	}
+	in.watchers[w] = struct{}{}
+	in.lock.Unlock()
+	return w, nil
+}
+
+// replay pushes all events in history after given revision to the watcher. It must
+// be called with lock held.
+func (in *Hub) replay(w *watcher, rev int64) {
+	if rev < in.compacted {
+		in.logger.Warnf("Revision %d is no longer available, resync from revision %d is required.", rev+1, in.compacted+1)
+		w.push(generic.WatchEvent{
+			Type:  generic.RESYNC,
+			Value: []byte(fmt.Sprintf("Required revision %d has been compacted", rev+1)),
+		})
+	}
+	for i := range in.history {
+		r := in.history[(in.next+i)%len(in.history)]
+		if r.revision > rev {
+			w.dispatch(r)
+		}
+	}
+}
+
+// Notify dispatches an event to all interested watchers, and the revision of the write
+// is attached to the value as its resource version. The prev is the value before an
+// update, and should be nil for other events. Callers must serialize their calls in the
+// order of their writes, so that events are delivered in order.
+func (in *Hub) Notify(t generic.WatchEventType, key string, value, prev []byte, revision int64) {
+	// Values of deletions and previous values might have been written in older versions.
+	if value != nil {
+		if v, err := generic.UpgradeRaw(value); err != nil {
+			in.logger.Warnf("Could not upgrade event value: %v", err)
+		} else {
+			value = v
+		}
+	}
+	if prev != nil {
+		if v, err := generic.UpgradeRaw(prev); err != nil {
+			in.logger.Warnf("Could not upgrade previous event value: %v", err)
+		} else {
+			prev = v
+		}
+	}
+	if v, err := generic.SetRawResourceVersion(value, revision); err != nil {
+		in.logger.Warnf("Could not attach resource version to event value: %v", err)
+	} else {
+		value = v
+	}
+	ev := generic.WatchEvent{
+		Type:  t,
+		Kind:  strings.SplitN(strings.TrimPrefix(key, "/"), "/", 2)[0],
+		Key:   filepath.Base(key),
+		Value: value,
+	}
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	r := record{revision: revision, key: key, prev: prev, event: ev}
+	if len(in.history) < DefaultHistorySize {
+		in.history = append(in.history, r)
+	} else {
+		in.compacted = in.history[in.next].revision
+		in.history[in.next] = r
+		in.next = (in.next + 1) % len(in.history)
+	}
+	for w := range in.watchers {
+		w.dispatch(r)
+	}
+}
+
+// Close stops all registered watchers.
+func (in *Hub) Close() error {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	for w := range in.watchers {
+		w.stop()
+		delete(in.watchers, w)
+	}
+	return nil
+}
+
+func (in *Hub) unregister(w *watcher) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	delete(in.watchers, w)
+}
+
+// NewHub returns a new Hub instance. The revision is the current revision of storage,
+// as all events before it are not available in history.
+func NewHub(revision int64, logger *zap.SugaredLogger) *Hub {
+	return &Hub{
+		watchers:  make(map[*watcher]struct{}),
+		compacted: revision,
+		logger:    logger,
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observer
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+// watcher receives events from the hub and forwards them to its output. Events
+// are queued without bound internally, so that a slow consumer never blocks writers
+// of the storage, and never loses any event either.
+type watcher struct {
+	ctx      context.Context
+	key      string
+	prefix   bool
+	selector *generic.Selector
+	hub      *Hub
+	lock     sync.Mutex
+	pending  []generic.WatchEvent
+	wakeup   chan struct{}
+	clzChan  chan struct{}
+	once     sync.Once
+	outChan  chan generic.WatchEvent
+	logger   *zap.SugaredLogger
+}
+
+func (in *watcher) Close() error {
+	in.hub.unregister(in)
+	in.stop()
+	return nil
+}
+
+func (in *watcher) Output() <-chan generic.WatchEvent {
+	return in.outChan
+}
+
+func (in *watcher) accepts(key string) bool {
+	if in.prefix {
+		return strings.HasPrefix(key, in.key)
+	}
+	return key == in.key
+}
+
+// dispatch pushes the event of a record if the watcher is interested in it.
+func (in *watcher) dispatch(r record) {
+	if !in.accepts(r.key) {
+		return
+	}
+	ev := r.event
+	t, ok, err := in.selector.SelectEvent(ev.Type, ev.Kind, ev.Value, r.prev)
+	if err != nil {
+		in.logger.Warnf("Could not apply selector on key '%s' due to: %v", r.key, err)
+	}
+	if !ok {
+		return
+	}
+	ev.Type = t
+	in.push(ev)
+}
+
+func (in *watcher) push(ev generic.WatchEvent) {
+	in.lock.Lock()
+	in.pending = append(in.pending, ev)
+	in.lock.Unlock()
+	select {
+	case in.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (in *watcher) stop() {
+	in.once.Do(func() {
+		close(in.clzChan)
+	})
+}
+
+func (in *watcher) watch() {
+	defer in.logger.Sync()
+	defer close(in.outChan)
+	in.logger.Debug("Watcher started.")
+	in.logger.Sync()
+
+	for {
+		in.lock.Lock()
+		events := in.pending
+		in.pending = nil
+		in.lock.Unlock()
+
+		for _, ev := range events {
+			select {
+			case in.outChan <- ev:
+				in.logger.Debugw("Sent event =>", "type", ev.Type, "kind", ev.Kind, "key", ev.Key)
+			case <-in.clzChan:
+				in.logger.Debug("Watcher exited.")
+				return
+			case <-in.ctx.Done():
+				in.hub.unregister(in)
+				in.logger.Debug("Watcher exited.")
+				return
+			}
+		}
+
+		select {
+		case <-in.wakeup:
+		case <-in.clzChan:
+			in.logger.Debug("Watcher exited.")
+			return
+		case <-in.ctx.Done():
+			in.hub.unregister(in)
+			in.logger.Debug("Watcher exited.")
+			return
+		}
+	}
+}
+
+func newWatcher(ctx context.Context, hub *Hub, key string, prefix bool, selector *generic.Selector, logger *zap.SugaredLogger) *watcher {
+	t := &watcher{
+		ctx:      ctx,
+		key:      key,
+		prefix:   prefix,
+		selector: selector,
+		hub:      hub,
+		wakeup:   make(chan struct{}, 1),
+		clzChan:  make(chan struct{}),
+		outChan:  make(chan generic.WatchEvent, generic.DefaultWatchChanSize),
+		logger:   logger,
+	}
+	go t.watch()
+	return t
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+// Config indicates the in-memory storage configuration. The in-memory storage keeps
+// everything inside the process, thus all data will be lost once the process exits.
+// It is intended for CI and single-node lab environments only.
+type Config struct{}
+
+// Open is used for initiating a new in-memory storage.
+func (in *Config) Open(logger *zap.SugaredLogger) (generic.Storage, error) {
+	return newStore(logger), nil
+}
+
+// New returns an empty configuration carrier.
+func New() *Config {
+	return new(Config)
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"testing"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	storagetest "github.com/universonic/panther/pkg/storage/generic/storagetest"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	zap "go.uber.org/zap"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) generic.Storage {
+		s, err := memory.New().Open(zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,364 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	observer "github.com/universonic/panther/pkg/storage/internal/observer"
+	zap "go.uber.org/zap"
+)
+
+// entry is a single stored value along with its revisions, which follows the same
+// semantics as etcd does.
+type entry struct {
+	value          []byte
+	createRevision int64
+	modRevision    int64
+}
+
+type store struct {
+	lock     sync.RWMutex
+	revision int64
+	data     map[string]*entry
+	hub      *observer.Hub
+	logger   *zap.SugaredLogger
+}
+
+func (in *store) Close() error {
+	return in.hub.Close()
+}
+
+func (in *store) Create(obj generic.Object) error {
+	return in.create(obj, false)
+}
+
+// Restore creates an object, keeping its GUID and timestamps.
+func (in *store) Restore(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.create(obj, true)
+}
+
+func (in *store) create(obj generic.Object, restore bool) (err error) {
+	defer in.logger.Sync()
+	if _, err := uuid.FromString(obj.GetGUID()); err != nil {
+		obj.SetGUID(uuid.NewV4().String())
+	}
+	if !restore || obj.GetCreationTimestamp().IsZero() {
+		obj.SetCreationTimestamp(time.Now())
+	}
+	if obj.GetName() == "" {
+		obj.SetName(obj.GetGUID())
+	}
+	// Versions are assigned by storage, and are never persisted along with objects.
+	obj.SetResourceVersion("")
+	obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
+	key := in.keyOf(obj)
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during creating data entity '%s' due to: %v", key, err)
+		}
+	}()
+	var b []byte
+	b, err = json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	if _, ok := in.data[key]; ok {
+		return generic.ErrResourceAlreadyExists
+	}
+	in.revision++
+	in.data[key] = &entry{
+		value:          b,
+		createRevision: in.revision,
+		modRevision:    in.revision,
+	}
+	in.hub.Notify(generic.CREATE, key, b, nil, in.revision)
+	obj.SetResourceVersion(generic.FormatResourceVersion(in.revision))
+	in.logger.Debugf("Created key '%s'", key)
+	return nil
+}
+
+func (in *store) Get(cv generic.Object) (err error) {
+	defer in.logger.Sync()
+	key := in.keyOf(cv)
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during getting data entity '%s' due to: %v", key, err)
+		}
+	}()
+	in.lock.RLock()
+	e, ok := in.data[key]
+	in.lock.RUnlock()
+	if !ok {
+		return generic.ErrResourceNotFound
+	}
+	in.logger.Debugf("Retrieved key '%s'", key)
+	var value []byte
+	if value, err = generic.UpgradeRaw(e.value); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(value, cv); err != nil {
+		return err
+	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(e.modRevision))
+	return nil
+}
+
+func (in *store) Watch(cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	return in.hub.Watch(context.Background(), cv, opt, sel...)
+}
+
+func (in *store) List(cv generic.ObjectList, opts ...generic.ListOption) (err error) {
+	defer in.logger.Sync()
+	o := generic.NewListOptions(opts...)
+	var kp string
+	if cv.HasNamespace() && o.Namespace != "" {
+		kp = filepath.Join("/", cv.GetKind(), o.Namespace) + "/"
+	} else {
+		kp = filepath.Join("/", cv.GetKind()) + "/"
+	}
+
+	// There is no history of values kept in memory, thus following pages of a paginated
+	// list are retrieved from the latest values, starting at the key where the previous
+	// page stopped.
+	var rev int64
+	start := kp
+	if o.Continue != "" {
+		if rev, start, err = generic.DecodeContinue(o.Continue, kp); err != nil {
+			return
+		}
+	}
+
+	in.lock.RLock()
+	var keys []string
+	for k := range in.data {
+		if strings.HasPrefix(k, kp) && k >= start {
+			keys = append(keys, k)
+		}
+	}
+	// Keep the same ordering as etcd does, which is ordered by key.
+	sort.Strings(keys)
+	values := make([]*entry, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, in.data[k])
+	}
+	if rev == 0 {
+		rev = in.revision
+	}
+	in.lock.RUnlock()
+
+	length := 0
+	for i, e := range values {
+		if o.Limit > 0 && int64(length) == o.Limit {
+			cv.SetContinue(generic.EncodeContinue(rev, keys[i]))
+			break
+		}
+		var raw []byte
+		if raw, err = generic.UpgradeRaw(e.value); err != nil {
+			return
+		}
+		var matched bool
+		matched, err = o.Selector.MatchesRaw(cv.GetKind(), raw)
+		if err != nil {
+			return
+		}
+		if !matched {
+			continue
+		}
+		raw, err = generic.SetRawResourceVersion(raw, e.modRevision)
+		if err != nil {
+			return
+		}
+		if err = cv.AppendRaw(raw); err != nil {
+			return
+		}
+		length++
+	}
+	cv.SetResourceVersion(generic.FormatResourceVersion(rev))
+	in.logger.Debugf("Listed %d object(s) in kind %s", length, cv.GetKind())
+	return nil
+}
+
+func (in *store) Update(obj generic.Object) (err error) {
+	if generic.IsImmutable(obj) {
+		return generic.ErrImmutable
+	}
+	defer in.logger.Sync()
+	key := in.keyOf(obj)
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during updating data entity '%s' due to: %v", key, err)
+		}
+	}()
+	version := obj.GetResourceVersion()
+	var expected int64
+	expected, err = generic.ParseResourceVersion(version)
+	if err != nil {
+		return generic.ErrResourceVersionConflict
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	old := new(struct {
+		generic.ObjectMeta `json:"metadata,omitempty"`
+	})
+	current, exists := in.data[key]
+	if expected != 0 {
+		if !exists {
+			return generic.ErrResourceNotFound
+		}
+		if current.modRevision != expected {
+			return generic.ErrResourceVersionConflict
+		}
+	}
+	if exists {
+		err = json.Unmarshal(current.value, old)
+		if err != nil {
+			return err
+		}
+		// Permanently preserve an object's history metadata.
+		obj.SetGUID(old.GetGUID())
+		obj.SetKind(old.GetKind())
+		obj.SetNamespace(old.GetNamespace())
+		obj.SetName(old.GetName())
+	}
+	now := time.Now()
+	// If it is not present, then we consider it as a newly created object.
+	if old.GetCreationTimestamp().IsZero() {
+		obj.SetCreationTimestamp(now)
+	} else {
+		obj.SetCreationTimestamp(old.GetCreationTimestamp())
+	}
+	obj.SetUpdatingTimestamp(now)
+	obj.SetResourceVersion("")
+	obj.SetAPIVersion(generic.APIVersionOf(obj.GetKind()))
+	var b []byte
+	b, err = json.Marshal(obj)
+	if err != nil {
+		obj.SetResourceVersion(version)
+		return err
+	}
+
+	in.revision++
+	t := generic.UPDATE
+	if !exists {
+		current = &entry{createRevision: in.revision}
+		in.data[key] = current
+		t = generic.CREATE
+	}
+	prev := current.value
+	current.value = b
+	current.modRevision = in.revision
+	in.hub.Notify(t, key, b, prev, in.revision)
+	obj.SetResourceVersion(generic.FormatResourceVersion(in.revision))
+	in.logger.Debugf("Updated key '%s'", key)
+	return nil
+}
+
+func (in *store) Delete(obj generic.Object) (err error) {
+	defer in.logger.Sync()
+	key := in.keyOf(obj)
+	defer func() {
+		if err != nil {
+			in.logger.Errorf("Error occurred during deleting data entity '%s' due to: %v", key, err)
+		}
+	}()
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	current, ok := in.data[key]
+	if !ok {
+		return generic.ErrResourceNotFound
+	}
+	in.revision++
+	delete(in.data, key)
+	in.hub.Notify(generic.DELETE, key, current.value, nil, in.revision)
+	in.logger.Debugf("Deleted key '%s'", key)
+	return nil
+}
+
+// Requests on memory are never blocked for long, thus contexts are only checked before
+// they are served.
+
+func (in *store) CreateContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Create(obj)
+}
+
+func (in *store) GetContext(ctx context.Context, cv generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Get(cv)
+}
+
+func (in *store) WatchContext(ctx context.Context, cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return in.hub.Watch(ctx, cv, opt, sel...)
+}
+
+func (in *store) ListContext(ctx context.Context, cv generic.ObjectList, opts ...generic.ListOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.List(cv, opts...)
+}
+
+func (in *store) UpdateContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Update(obj)
+}
+
+func (in *store) DeleteContext(ctx context.Context, obj generic.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return in.Delete(obj)
+}
+
+func (in *store) keyOf(obj generic.Object) string {
+	if obj.HasNamespace() {
+		return filepath.Join("/", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	return filepath.Join("/", obj.GetKind(), obj.GetName())
+}
+
+func newStore(logger *zap.SugaredLogger) *store {
+	return &store{
+		data:   make(map[string]*entry),
+		hub:    observer.NewHub(0, logger.Named("OBSERVER")),
+		logger: logger,
+	}
+}
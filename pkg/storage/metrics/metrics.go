@@ -0,0 +1,163 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"sync"
+
+	prometheus "github.com/prometheus/client_golang/prometheus"
+	generic "github.com/universonic/panther/pkg/storage/generic"
+)
+
+const (
+	namespace = "panther"
+	subsystem = "storage"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of storage requests by operation and kind.",
+		// From 1ms to about 8s.
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"operation", "kind"})
+
+	requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_errors_total",
+		Help:      "Failed storage requests by operation, kind and type of error.",
+	}, []string{"operation", "kind", "type"})
+
+	slowRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "slow_requests_total",
+		Help:      "Storage requests that took longer than the slow threshold by operation and kind.",
+	}, []string{"operation", "kind"})
+
+	watchers = newWatchCollector()
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, requestErrors, slowRequests, watchers)
+}
+
+// Types of errors which are counted by requestErrors.
+const (
+	errNotFound = "not_found"
+	errConflict = "conflict"
+	errInvalid  = "invalid"
+	errInternal = "internal"
+)
+
+// errorType classifies a storage error. Conflicts include both existing names and outdated
+// versions, while invalid errors are the other ones caused by clients, e.g. updates on
+// immutable objects or malformed continue tokens.
+func errorType(err error) string {
+	switch {
+	case generic.IsNotFound(err):
+		return errNotFound
+	case generic.IsConflict(err), generic.IsVersionConflict(err):
+		return errConflict
+	case !generic.IsInternalError(err):
+		return errInvalid
+	}
+	return errInternal
+}
+
+// watchCollector samples the output buffers of all active watchers on each scrape. Events
+// are dropped or watchers are blocked once their buffers are full, thus the backlog is an
+// early sign of slow consumers.
+type watchCollector struct {
+	lock     sync.Mutex
+	watchers map[*watcher]struct{}
+
+	count    *prometheus.Desc
+	backlog  *prometheus.Desc
+	capacity *prometheus.Desc
+}
+
+func newWatchCollector() *watchCollector {
+	return &watchCollector{
+		watchers: make(map[*watcher]struct{}),
+		count: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "watchers"),
+			"Active watchers by kind.",
+			[]string{"kind"}, nil,
+		),
+		backlog: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "watch_backlog_events"),
+			"Events buffered in the fullest output channel of watchers by kind.",
+			[]string{"kind"}, nil,
+		),
+		capacity: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "watch_buffer_capacity_events"),
+			"Capacity of the output channels of watchers by kind.",
+			[]string{"kind"}, nil,
+		),
+	}
+}
+
+func (in *watchCollector) add(w *watcher) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	in.watchers[w] = struct{}{}
+}
+
+func (in *watchCollector) remove(w *watcher) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	delete(in.watchers, w)
+}
+
+// Describe implements prometheus.Collector
+func (in *watchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- in.count
+	ch <- in.backlog
+	ch <- in.capacity
+}
+
+// Collect implements prometheus.Collector
+func (in *watchCollector) Collect(ch chan<- prometheus.Metric) {
+	type sample struct {
+		count, backlog, capacity int
+	}
+	samples := make(map[string]*sample)
+	in.lock.Lock()
+	for w := range in.watchers {
+		s, ok := samples[w.kind]
+		if !ok {
+			s = new(sample)
+			samples[w.kind] = s
+		}
+		out := w.Watcher.Output()
+		s.count++
+		if n := len(out); n > s.backlog {
+			s.backlog = n
+		}
+		if n := cap(out); n > s.capacity {
+			s.capacity = n
+		}
+	}
+	in.lock.Unlock()
+	for kind, s := range samples {
+		ch <- prometheus.MustNewConstMetric(in.count, prometheus.GaugeValue, float64(s.count), kind)
+		ch <- prometheus.MustNewConstMetric(in.backlog, prometheus.GaugeValue, float64(s.backlog), kind)
+		ch <- prometheus.MustNewConstMetric(in.capacity, prometheus.GaugeValue, float64(s.capacity), kind)
+	}
+}
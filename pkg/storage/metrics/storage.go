@@ -0,0 +1,273 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+	zap "go.uber.org/zap"
+)
+
+// Operations which are labeled on metrics.
+const (
+	opCreate  = "create"
+	opGet     = "get"
+	opWatch   = "watch"
+	opList    = "list"
+	opUpdate  = "update"
+	opDelete  = "delete"
+	opRestore = "restore"
+)
+
+// storage measures every request to the underlying storage. Requests that took longer than
+// the slow threshold are logged as warnings with their keys, while values are never logged
+// as they might contain secrets.
+type storage struct {
+	storage generic.Storage
+	slow    time.Duration
+	logger  *zap.SugaredLogger
+}
+
+// New wraps a storage so that its requests are exported as metrics. Requests that took longer
+// than slow are logged as warnings, which is disabled if slow is not positive. The optional
+// interfaces implemented by the underlying storage are implemented by the returned one too.
+func New(s generic.Storage, slow time.Duration, logger *zap.SugaredLogger) generic.Storage {
+	in := &storage{
+		storage: s,
+		slow:    slow,
+		logger:  logger,
+	}
+	_, isExpirer := s.(generic.Expirer)
+	_, isRestorer := s.(generic.Restorer)
+	switch {
+	case isExpirer && isRestorer:
+		return struct {
+			*storage
+			expirer
+			restorer
+		}{in, expirer{in}, restorer{in}}
+	case isExpirer:
+		return struct {
+			*storage
+			expirer
+		}{in, expirer{in}}
+	case isRestorer:
+		return struct {
+			*storage
+			restorer
+		}{in, restorer{in}}
+	}
+	return in
+}
+
+func (in *storage) observe(op, kind, key string, start time.Time, err *error) {
+	d := time.Since(start)
+	requestDuration.WithLabelValues(op, kind).Observe(d.Seconds())
+	if *err != nil {
+		requestErrors.WithLabelValues(op, kind, errorType(*err)).Inc()
+	}
+	if in.slow <= 0 || d < in.slow {
+		return
+	}
+	slowRequests.WithLabelValues(op, kind).Inc()
+	defer in.logger.Sync()
+	fields := []interface{}{
+		"operation", op,
+		"kind", kind,
+		"key", key,
+		"duration", d.String(),
+	}
+	if *err != nil {
+		fields = append(fields, "error", *err)
+	}
+	in.logger.Warnw("Slow storage request =>", fields...)
+}
+
+// keyOf returns the key of object in logs, which is made up of its namespace and name.
+func keyOf(obj generic.Object) string {
+	if obj.HasNamespace() {
+		return obj.GetNamespace() + "/" + obj.GetName()
+	}
+	return obj.GetName()
+}
+
+// Close closes the underlying storage.
+func (in *storage) Close() error {
+	return in.storage.Close()
+}
+
+// Create is equivalent to CreateContext with context.Background()
+func (in *storage) Create(obj generic.Object) error {
+	return in.CreateContext(context.Background(), obj)
+}
+
+// CreateContext creates an object and measures the request.
+func (in *storage) CreateContext(ctx context.Context, obj generic.Object) (err error) {
+	defer in.observe(opCreate, obj.GetKind(), keyOf(obj), time.Now(), &err)
+	return in.storage.CreateContext(ctx, obj)
+}
+
+// Get is equivalent to GetContext with context.Background()
+func (in *storage) Get(cv generic.Object) error {
+	return in.GetContext(context.Background(), cv)
+}
+
+// GetContext retrieves an object and measures the request.
+func (in *storage) GetContext(ctx context.Context, cv generic.Object) (err error) {
+	defer in.observe(opGet, cv.GetKind(), keyOf(cv), time.Now(), &err)
+	return in.storage.GetContext(ctx, cv)
+}
+
+// Watch is equivalent to WatchContext with context.Background()
+func (in *storage) Watch(cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (generic.Watcher, error) {
+	return in.WatchContext(context.Background(), cv, opt, sel...)
+}
+
+// WatchContext establishes a watcher and measures the establishment. The output buffer of
+// watcher is sampled until it is closed.
+func (in *storage) WatchContext(ctx context.Context, cv generic.Object, opt generic.WatchOption, sel ...*generic.Selector) (_ generic.Watcher, err error) {
+	defer in.observe(opWatch, cv.GetKind(), keyOf(cv), time.Now(), &err)
+	w, err := in.storage.WatchContext(ctx, cv, opt, sel...)
+	if err != nil {
+		return nil, err
+	}
+	return newWatcher(ctx, w, cv.GetKind()), nil
+}
+
+// List is equivalent to ListContext with context.Background()
+func (in *storage) List(cv generic.ObjectList, opts ...generic.ListOption) error {
+	return in.ListContext(context.Background(), cv, opts...)
+}
+
+// ListContext lists objects and measures the request. The key of a list is its namespace.
+func (in *storage) ListContext(ctx context.Context, cv generic.ObjectList, opts ...generic.ListOption) (err error) {
+	defer in.observe(opList, cv.GetKind(), generic.NewListOptions(opts...).Namespace, time.Now(), &err)
+	return in.storage.ListContext(ctx, cv, opts...)
+}
+
+// Update is equivalent to UpdateContext with context.Background()
+func (in *storage) Update(obj generic.Object) error {
+	return in.UpdateContext(context.Background(), obj)
+}
+
+// UpdateContext updates an object and measures the request.
+func (in *storage) UpdateContext(ctx context.Context, obj generic.Object) (err error) {
+	defer in.observe(opUpdate, obj.GetKind(), keyOf(obj), time.Now(), &err)
+	return in.storage.UpdateContext(ctx, obj)
+}
+
+// Delete is equivalent to DeleteContext with context.Background()
+func (in *storage) Delete(obj generic.Object) error {
+	return in.DeleteContext(context.Background(), obj)
+}
+
+// DeleteContext deletes an object and measures the request.
+func (in *storage) DeleteContext(ctx context.Context, obj generic.Object) (err error) {
+	defer in.observe(opDelete, obj.GetKind(), keyOf(obj), time.Now(), &err)
+	return in.storage.DeleteContext(ctx, obj)
+}
+
+// expirer implements generic.Expirer if the underlying storage does.
+type expirer struct {
+	in *storage
+}
+
+// CreateWithTTL implements generic.Expirer
+func (e expirer) CreateWithTTL(ctx context.Context, obj generic.Object, ttl time.Duration) (err error) {
+	defer e.in.observe(opCreate, obj.GetKind(), keyOf(obj), time.Now(), &err)
+	return e.in.storage.(generic.Expirer).CreateWithTTL(ctx, obj, ttl)
+}
+
+// restorer implements generic.Restorer if the underlying storage does.
+type restorer struct {
+	in *storage
+}
+
+// Restore implements generic.Restorer
+func (r restorer) Restore(ctx context.Context, obj generic.Object) (err error) {
+	defer r.in.observe(opRestore, obj.GetKind(), keyOf(obj), time.Now(), &err)
+	return r.in.storage.(generic.Restorer).Restore(ctx, obj)
+}
+
+// watcher keeps itself sampled by the watchCollector until it is closed, either by Close, by
+// the context it was established with, or by the underlying watcher. Events are forwarded
+// from the underlying output, whose buffer is still sampled as the backlog.
+type watcher struct {
+	generic.Watcher
+	kind    string
+	once    sync.Once
+	clzChan chan struct{}
+	outChan chan generic.WatchEvent
+}
+
+func newWatcher(ctx context.Context, w generic.Watcher, kind string) *watcher {
+	out := &watcher{
+		Watcher: w,
+		kind:    kind,
+		clzChan: make(chan struct{}),
+		outChan: make(chan generic.WatchEvent),
+	}
+	watchers.add(out)
+	go out.forward(ctx.Done())
+	return out
+}
+
+// forward forwards events from the underlying output until it is closed, and releases the
+// watcher afterwards.
+func (in *watcher) forward(done <-chan struct{}) {
+	defer close(in.outChan)
+	defer in.release()
+	input := in.Watcher.Output()
+	for {
+		select {
+		case ev, ok := <-input:
+			if !ok {
+				return
+			}
+			select {
+			case in.outChan <- ev:
+			case <-in.clzChan:
+				return
+			case <-done:
+				return
+			}
+		case <-in.clzChan:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+func (in *watcher) release() {
+	in.once.Do(func() {
+		watchers.remove(in)
+		close(in.clzChan)
+	})
+}
+
+// Output returns the events forwarded from the underlying watcher.
+func (in *watcher) Output() <-chan generic.WatchEvent {
+	return in.outChan
+}
+
+// Close closes the underlying watcher.
+func (in *watcher) Close() error {
+	in.release()
+	return in.Watcher.Close()
+}
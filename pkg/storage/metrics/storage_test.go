@@ -0,0 +1,103 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	generic "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// fakeWatcher is a watcher whose output is closed by test.
+type fakeWatcher struct {
+	outChan chan generic.WatchEvent
+	closed  bool
+}
+
+func (in *fakeWatcher) Close() error {
+	in.closed = true
+	return nil
+}
+
+func (in *fakeWatcher) Output() <-chan generic.WatchEvent {
+	return in.outChan
+}
+
+func isWatched(w *watcher) bool {
+	watchers.lock.Lock()
+	defer watchers.lock.Unlock()
+	_, ok := watchers.watchers[w]
+	return ok
+}
+
+// drain returns the events received from w until its output is closed.
+func drain(t *testing.T, w *watcher) []generic.WatchEvent {
+	var out []generic.WatchEvent
+	for {
+		select {
+		case ev, ok := <-w.Output():
+			if !ok {
+				return out
+			}
+			out = append(out, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the output to be closed")
+		}
+	}
+}
+
+func TestWatcherReleasedOnClosedOutput(t *testing.T) {
+	inner := &fakeWatcher{outChan: make(chan generic.WatchEvent, 2)}
+	w := newWatcher(context.Background(), inner, "host")
+	if !isWatched(w) {
+		t.Fatal("Expected the watcher to be sampled")
+	}
+	inner.outChan <- generic.WatchEvent{Key: "a"}
+	inner.outChan <- generic.WatchEvent{Key: "b"}
+	// The underlying watcher might be closed by storage, e.g. once it has lost connection.
+	close(inner.outChan)
+	got := drain(t, w)
+	if len(got) != 2 || got[0].Key != "a" || got[1].Key != "b" {
+		t.Errorf("Expected all events to be forwarded, got %+v", got)
+	}
+	if isWatched(w) {
+		t.Error("Expected the watcher to be released")
+	}
+}
+
+func TestWatcherReleasedOnClose(t *testing.T) {
+	inner := &fakeWatcher{outChan: make(chan generic.WatchEvent)}
+	w := newWatcher(context.Background(), inner, "host")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, w)
+	if isWatched(w) || !inner.closed {
+		t.Errorf("Expected the watcher to be released and closed, got sampled %v and closed %v", isWatched(w), inner.closed)
+	}
+}
+
+func TestWatcherReleasedOnContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inner := &fakeWatcher{outChan: make(chan generic.WatchEvent)}
+	w := newWatcher(ctx, inner, "host")
+	cancel()
+	drain(t, w)
+	if isWatched(w) {
+		t.Error("Expected the watcher to be released")
+	}
+}
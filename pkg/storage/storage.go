@@ -15,19 +15,64 @@
 package storage
 
 import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	bolt "github.com/universonic/panther/pkg/storage/bolt"
 	etcd "github.com/universonic/panther/pkg/storage/etcd"
 	generic "github.com/universonic/panther/pkg/storage/generic"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	metrics "github.com/universonic/panther/pkg/storage/metrics"
 	zap "go.uber.org/zap"
 )
 
+const (
+	// DefaultAdapter is the storage adapter to be used if none was specified.
+	DefaultAdapter = "etcd"
+	// DefaultSlowThreshold is the duration of requests to be logged as slow if none was
+	// specified.
+	DefaultSlowThreshold = "500ms"
+)
+
 // Config is a generic type of storage configuration
 type Config interface {
 	Open(logger *zap.SugaredLogger) (generic.Storage, error)
 }
 
+// Adapter returns a new empty configuration carrier of a storage adapter.
+type Adapter func() Config
+
+var (
+	adaptersLock sync.RWMutex
+	adapters     = make(map[string]Adapter)
+)
+
+// Register makes a storage adapter available by the provided name. If Register is
+// called twice with the same name or if adapter is nil, it panics.
+func Register(name string, adapter Adapter) {
+	adaptersLock.Lock()
+	defer adaptersLock.Unlock()
+	if adapter == nil {
+		panic("storage: Register adapter is nil")
+	}
+	if _, dup := adapters[name]; dup {
+		panic("storage: Register called twice for adapter " + name)
+	}
+	adapters[name] = adapter
+}
+
+func init() {
+	Register("etcd", func() Config { return etcd.New() })
+	Register("bolt", func() Config { return bolt.New() })
+	Register("memory", func() Config { return memory.New() })
+}
+
 // ConfigInitiator is used for initialize a storage config
 type ConfigInitiator struct {
-	Adapter string `json:"adapter,omitempty" yaml:"adapter,omitempty" toml:"adapter,omitempty"`
+	Adapter       string `json:"adapter,omitempty" yaml:"adapter,omitempty" toml:"adapter,omitempty"`
+	SlowThreshold string `json:"slow_threshold,omitempty" yaml:"slow_threshold,omitempty" toml:"slow_threshold,omitempty"`
 }
 
 // NewConfigInitiator returns an empty set of ConfigInitiator
@@ -37,18 +82,81 @@ func NewConfigInitiator() *ConfigInitiator {
 
 // QualifiedConfig is a fulfilled top layer storage configuration.
 type QualifiedConfig struct {
-	Adapter      string `json:"adapter,omitempty" yaml:"adapter,omitempty" toml:"adapter,omitempty"`
-	*etcd.Config `json:"config,omitempty" yaml:"config,omitempty" toml:"config,omitempty"`
+	Adapter string `json:"adapter,omitempty" yaml:"adapter,omitempty" toml:"adapter,omitempty"`
+	// SlowThreshold is the duration of requests to be logged as slow, which applies to all
+	// adapters. Zero disables it.
+	SlowThreshold string `json:"slow_threshold,omitempty" yaml:"slow_threshold,omitempty" toml:"slow_threshold,omitempty"`
+	Config        `json:"config,omitempty" yaml:"config,omitempty" toml:"config,omitempty"`
+}
+
+// Open opens the storage of adapter, whose requests are exported as metrics.
+func (in *QualifiedConfig) Open(logger *zap.SugaredLogger) (generic.Storage, error) {
+	threshold := in.SlowThreshold
+	if threshold == "" {
+		threshold = DefaultSlowThreshold
+	}
+	slow, err := time.ParseDuration(threshold)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid slow threshold of storage: %v", err)
+	}
+	s, err := in.Config.Open(logger)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.New(s, slow, logger), nil
 }
 
 // NewQualifiedConfig returns a new QualifiedConfig as config carrier by given adapter name, and any encountered error if any.
 func NewQualifiedConfig(of string) (*QualifiedConfig, error) {
-	switch of {
-	case "etcd":
-		return &QualifiedConfig{
-			Adapter: of,
-			Config:  etcd.New(),
-		}, nil
-	}
-	return nil, ErrUnknownStorageAdapter
+	adaptersLock.RLock()
+	adapter, ok := adapters[of]
+	adaptersLock.RUnlock()
+	if !ok {
+		return nil, ErrUnknownStorageAdapter
+	}
+	return &QualifiedConfig{
+		Adapter: of,
+		Config:  adapter(),
+	}, nil
+}
+
+// ParseQualifiedConfig parses the given section of a configuration document with the
+// given unmarshal function. The adapter is determined from the `adapter` field of the
+// section first, and then the entire section is decoded into the configuration of that
+// adapter. The DefaultAdapter will be used if no adapter was specified.
+func ParseQualifiedConfig(section string, dAtA []byte, unmarshal func([]byte, interface{}) error) (*QualifiedConfig, error) {
+	tag := reflect.StructTag(fmt.Sprintf(`json:"%[1]s,omitempty" yaml:"%[1]s,omitempty" toml:"%[1]s,omitempty"`, section))
+
+	initiator := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "Section", Type: reflect.TypeOf(NewConfigInitiator()), Tag: tag},
+	}))
+	if err := unmarshal(dAtA, initiator.Interface()); err != nil {
+		return nil, err
+	}
+	of, slow := DefaultAdapter, ""
+	if v := initiator.Elem().Field(0); !v.IsNil() {
+		if adapter := v.Interface().(*ConfigInitiator).Adapter; adapter != "" {
+			of = adapter
+		}
+		slow = v.Interface().(*ConfigInitiator).SlowThreshold
+	}
+	cfg, err := NewQualifiedConfig(of)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SlowThreshold = slow
+
+	// The layout of the section is only known at runtime, thus we have to construct
+	// its carrier dynamically.
+	carrier := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "Section", Type: reflect.TypeOf(cfg.Config), Tag: tag},
+	}))
+	carrier.Elem().Field(0).Set(reflect.ValueOf(cfg.Config))
+	if err = unmarshal(dAtA, carrier.Interface()); err != nil {
+		return nil, err
+	}
+	if v := carrier.Elem().Field(0); !v.IsNil() {
+		cfg.Config = v.Interface().(Config)
+	}
+	return cfg, nil
 }
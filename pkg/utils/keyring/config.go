@@ -0,0 +1,35 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+// DefaultFile is the default location of keyring file.
+const DefaultFile = "/etc/panther/keyring"
+
+// Config is the configuration of keyring
+type Config struct {
+	File string `json:"file,omitempty" yaml:"file,omitempty" toml:"file,omitempty"`
+}
+
+// Complete fulfills the empty fields of Config
+func (in *Config) Complete() {
+	if in.File == "" {
+		in.File = DefaultFile
+	}
+}
+
+// Apply loads the keyring with configuration, and returns any encountered error.
+func (in *Config) Apply() (*Keyring, error) {
+	return Load(in.File)
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fsutil "github.com/universonic/panther/pkg/utils/filesystem"
+)
+
+// KeySize is the size of keys in bytes, which selects AES-256.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is the error returned if a secret was sealed by a key that is absent from
+	// the keyring, e.g. it has been removed after rotation.
+	ErrUnknownKey = errors.New("Secret was sealed by an unknown key")
+	// ErrNoKeyring is the error returned if a secret is sealed or opened without a keyring.
+	ErrNoKeyring = errors.New("No keyring is available")
+)
+
+// Envelope is a secret sealed by envelope encryption. The secret is encrypted by a random
+// data key, which is in turn encrypted by a key of keyring. Only the data key has to be
+// encrypted again once the keyring is rotated.
+type Envelope struct {
+	// KeyID is the ID of the key of keyring which sealed the data key.
+	KeyID string `json:"kid" protobuf:"bytes,1,opt,name=kid"`
+	// DataKey is the sealed data key, prefixed by its nonce.
+	DataKey []byte `json:"dek" protobuf:"bytes,2,opt,name=dek"`
+	// Data is the sealed secret, prefixed by its nonce.
+	Data []byte `json:"data" protobuf:"bytes,3,opt,name=data"`
+}
+
+// Keyring is a set of keys. The primary key seals new secrets, while the others are kept
+// so that secrets sealed before a rotation could still be opened.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// Primary returns the ID of the primary key.
+func (in *Keyring) Primary() string {
+	return in.primary
+}
+
+// Seal seals a secret with a new data key and the primary key.
+func (in *Keyring) Seal(secret []byte) (*Envelope, error) {
+	if in == nil {
+		return nil, ErrNoKeyring
+	}
+	dek := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	data, err := seal(dek, secret, nil)
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := seal(in.keys[in.primary], dek, []byte(in.primary))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: in.primary, DataKey: sealedKey, Data: data}, nil
+}
+
+// Open opens a sealed secret.
+func (in *Keyring) Open(env *Envelope) ([]byte, error) {
+	dek, err := in.openDataKey(env)
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, env.Data, nil)
+}
+
+// Rewrap seals the data key of envelope with the primary key again, and returns true if it
+// was sealed by another key. The secret itself is left untouched.
+func (in *Keyring) Rewrap(env *Envelope) (bool, error) {
+	if in == nil {
+		return false, ErrNoKeyring
+	}
+	if env.KeyID == in.primary {
+		return false, nil
+	}
+	dek, err := in.openDataKey(env)
+	if err != nil {
+		return false, err
+	}
+	sealedKey, err := seal(in.keys[in.primary], dek, []byte(in.primary))
+	if err != nil {
+		return false, err
+	}
+	env.KeyID, env.DataKey = in.primary, sealedKey
+	return true, nil
+}
+
+func (in *Keyring) openDataKey(env *Envelope) ([]byte, error) {
+	if in == nil {
+		return nil, ErrNoKeyring
+	}
+	key, ok := in.keys[env.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// The key ID is authenticated, so that a data key could not be moved to another key.
+	return open(key, env.DataKey, []byte(env.KeyID))
+}
+
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, ciphertext, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("Sealed data is too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additional)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Parse parses a keyring file. Each line of it is a key in the form of `<ID> <KEY>`, where
+// KEY is 32 bytes encoded in standard base64. The key on the first line is the primary key.
+// Blank lines and those starting with '#' are ignored.
+func Parse(r io.Reader) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid key on line %d of keyring", n)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("Invalid key on line %d of keyring", n)
+		}
+		if _, dup := kr.keys[fields[0]]; dup {
+			return nil, fmt.Errorf("Duplicated key ID %s on line %d of keyring", fields[0], n)
+		}
+		if kr.primary == "" {
+			kr.primary = fields[0]
+		}
+		kr.keys[fields[0]] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if kr.primary == "" {
+		return nil, fmt.Errorf("Keyring contains no key")
+	}
+	return kr, nil
+}
+
+// Load loads a keyring from file. A new keyring with a single random key will be created
+// if the file is absent.
+func Load(path string) (*Keyring, error) {
+	exists, err := fsutil.FileExists(path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = Generate(path); err != nil {
+			return nil, err
+		}
+	}
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	return Parse(fi)
+}
+
+// Generate writes a new keyring file with a single random key. Only the owner is allowed
+// to access the file.
+func Generate(path string) error {
+	line, err := NewKeyLine()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# Panther keyring. The key on the first line seals new secrets, while the others are\n")
+	buf.WriteString("# only used for opening secrets sealed before rotation.\n")
+	buf.WriteString(line + "\n")
+	fi, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	_, err = buf.WriteTo(fi)
+	return err
+}
+
+// NewKeyLine returns a line of keyring file with a new random key, which is identified by
+// the current time. To rotate the keyring, insert it as the first line of file.
+func NewKeyLine() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s", time.Now().UTC().Format("20060102T150405Z"), base64.StdEncoding.EncodeToString(key)), nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
+)
+
+// keyOf returns a key of keyring file, whose bytes are all b.
+func keyOf(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keyring.KeySize))
+}
+
+func mustParse(t *testing.T, lines ...string) *keyring.Keyring {
+	kr, err := keyring.Parse(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestSealOpen(t *testing.T) {
+	kr := mustParse(t, "# comment", "", "k1 "+keyOf(1), "k2 "+keyOf(2))
+	if kr.Primary() != "k1" {
+		t.Fatalf("Expected the first key to be primary, got %s", kr.Primary())
+	}
+	secret := []byte("passw0rd")
+	env, err := kr.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k1" || bytes.Contains(env.Data, secret) {
+		t.Fatalf("Unexpected envelope: %+v", env)
+	}
+	got, err := kr.Open(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Errorf("Expected %q, got %q", secret, got)
+	}
+	// Data keys are random, thus the same secret is never sealed into the same envelope.
+	another, err := kr.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(another.Data, env.Data) || bytes.Equal(another.DataKey, env.DataKey) {
+		t.Error("Expected the secret to be sealed by another data key")
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	// Both keys are the same, thus only the authenticated key ID tells them apart.
+	kr := mustParse(t, "k1 "+keyOf(1), "k2 "+keyOf(1))
+	cases := []struct {
+		name   string
+		tamper func(env *keyring.Envelope)
+	}{
+		{"KeyID", func(env *keyring.Envelope) { env.KeyID = "k2" }},
+		{"DataKey", func(env *keyring.Envelope) { env.DataKey[len(env.DataKey)-1] ^= 1 }},
+		{"Data", func(env *keyring.Envelope) { env.Data[len(env.Data)-1] ^= 1 }},
+		{"Nonce", func(env *keyring.Envelope) { env.Data[0] ^= 1 }},
+		{"Truncated", func(env *keyring.Envelope) { env.Data = env.Data[:4] }},
+	}
+	for _, c := range cases {
+		env, err := kr.Seal([]byte("passw0rd"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.tamper(env)
+		if got, err := kr.Open(env); err == nil {
+			t.Errorf("%s: expected an error on tampered envelope, got %q", c.name, got)
+		}
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := mustParse(t, "k1 "+keyOf(1))
+	env, err := old.Seal([]byte("passw0rd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), env.Data...)
+
+	rotated := mustParse(t, "k2 "+keyOf(2), "k1 "+keyOf(1))
+	changed, err := rotated.Rewrap(env)
+	if err != nil || !changed {
+		t.Fatalf("Expected the envelope to be rewrapped, got %v, %v", changed, err)
+	}
+	if env.KeyID != "k2" || !bytes.Equal(env.Data, data) {
+		t.Fatalf("Expected only the data key to be sealed by the primary key, got %+v", env)
+	}
+	if changed, err = rotated.Rewrap(env); err != nil || changed {
+		t.Errorf("Expected the envelope to be left untouched, got %v, %v", changed, err)
+	}
+	// The old key could be removed once all envelopes have been rewrapped.
+	removed := mustParse(t, "k2 "+keyOf(2))
+	got, err := removed.Open(env)
+	if err != nil || string(got) != "passw0rd" {
+		t.Errorf("Expected the secret to be opened by the new key, got %q, %v", got, err)
+	}
+	if _, err = old.Open(env); err != keyring.ErrUnknownKey {
+		t.Errorf("Expected %v, got %v", keyring.ErrUnknownKey, err)
+	}
+}
+
+func TestMissingKey(t *testing.T) {
+	env, err := mustParse(t, "k1 "+keyOf(1)).Seal([]byte("passw0rd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := mustParse(t, "k2 "+keyOf(2))
+	if _, err = other.Open(env); err != keyring.ErrUnknownKey {
+		t.Errorf("Open: expected %v, got %v", keyring.ErrUnknownKey, err)
+	}
+	if _, err = other.Rewrap(env); err != keyring.ErrUnknownKey {
+		t.Errorf("Rewrap: expected %v, got %v", keyring.ErrUnknownKey, err)
+	}
+	var none *keyring.Keyring
+	if _, err = none.Seal([]byte("passw0rd")); err != keyring.ErrNoKeyring {
+		t.Errorf("Seal: expected %v, got %v", keyring.ErrNoKeyring, err)
+	}
+	if _, err = none.Open(env); err != keyring.ErrNoKeyring {
+		t.Errorf("Open: expected %v, got %v", keyring.ErrNoKeyring, err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := map[string]string{
+		"Empty":      "# no key\n",
+		"NoKey":      "k1",
+		"ShortKey":   "k1 " + base64.StdEncoding.EncodeToString([]byte("short")),
+		"InvalidKey": "k1 !!!",
+		"ExtraField": "k1 " + keyOf(1) + " extra",
+		"Duplicated": "k1 " + keyOf(1) + "\nk1 " + keyOf(2),
+	}
+	for name, content := range cases {
+		if _, err := keyring.Parse(strings.NewReader(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadGenerates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "panther-keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "keyring")
+	kr, err := keyring.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected the keyring file to be accessed by owner only, got %v", mode)
+	}
+	// The generated keyring is loaded as it is next time.
+	again, err := keyring.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Primary() != kr.Primary() {
+		t.Errorf("Expected primary key %s, got %s", kr.Primary(), again.Primary())
+	}
+}
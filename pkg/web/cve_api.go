@@ -0,0 +1,171 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// CVE handles requests from /api/v1/cve, which lists CVEs and the hosts exposed to them.
+// Usage:
+//   - GET /api/v1/cve[?source=scan|feed][&id=CVE_LIST][&severity=SEVERITY_LIST][&since=DATE][&until=DATE][&labelSelector=SELECTOR][&fieldSelector=SELECTOR]
+// CVEs are collected from the latest successful scans of hosts, which could be selected by
+// the selectors of scans, or from the vulnerability reports of hosts if `source` is "feed".
+// Severities are given by names or values, e.g. `critical,important`, and dates are those
+// (in the form of 2006-01-02, inclusive) when advisories were issued. CVEs are ordered by
+// severity and then by ID, and each of them lists the exposed hosts with the packages to be
+// updated.
+func (in *Handler) CVE(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_, cves, ok := in.indexCVEs(w, r)
+	if !ok {
+		return
+	}
+	dAtA, err := json.Marshal(cves)
+	if err != nil {
+		panic(err)
+	}
+	in.finalizeJSON(w, bytes.NewReader(dAtA))
+}
+
+// CVESummary handles requests from /api/v1/cve/summary, which counts the exposure of hosts.
+// Usage:
+//   - GET /api/v1/cve/summary[?source=scan|feed][&id=CVE_LIST][&severity=SEVERITY_LIST][&since=DATE][&until=DATE][&labelSelector=SELECTOR][&fieldSelector=SELECTOR]
+// CVEs are filtered in the same way as /api/v1/cve, and are counted by severity along with
+// the hosts exposed to them.
+func (in *Handler) CVESummary(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	scans, cves, ok := in.indexCVEs(w, r)
+	if !ok {
+		return
+	}
+	dAtA, err := json.Marshal(genericStorage.SummarizeExposure(scans, cves))
+	if err != nil {
+		panic(err)
+	}
+	in.finalizeJSON(w, bytes.NewReader(dAtA))
+}
+
+// indexCVEs lists the selected scans, and indexes CVEs from them by the filter of request.
+// The error is finalized if it returns false.
+func (in *Handler) indexCVEs(w http.ResponseWriter, r *http.Request) ([]genericStorage.SystemScan, []genericStorage.CVEExposure, bool) {
+	filter, err := in.parseCVEFilter(r)
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return nil, nil, false
+	}
+	selector, err := in.parseSelector(r)
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return nil, nil, false
+	}
+	var scans []genericStorage.SystemScan
+	switch source := r.URL.Query().Get("source"); source {
+	case "", "scan":
+		cv := genericStorage.NewSystemScanList()
+		err = in.storage.ListContext(r.Context(), cv, genericStorage.WithSelector(selector))
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return nil, nil, false
+		}
+		scans = cv.Members
+	case "feed":
+		cv := genericStorage.NewVulnerabilityReportList()
+		err = in.storage.ListContext(r.Context(), cv, genericStorage.WithSelector(selector))
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return nil, nil, false
+		}
+		// Reports are indexed in the same way as successful scans.
+		for _, each := range cv.Members {
+			scan := genericStorage.NewSystemScan()
+			scan.ObjectMeta = each.ObjectMeta
+			scan.State = genericStorage.SuccessState
+			scan.Security = each.Security
+			scans = append(scans, *scan)
+		}
+	default:
+		in.finalizeError(w, fmt.Errorf("Invalid source: %s", source), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return scans, genericStorage.IndexCVEs(scans, filter), true
+}
+
+// parseCVEFilter parses the `id`, `severity`, `since` and `until` query parameters of request.
+func (in *Handler) parseCVEFilter(r *http.Request) (*genericStorage.CVEFilter, error) {
+	filter := new(genericStorage.CVEFilter)
+	for _, each := range strings.Split(r.URL.Query().Get("id"), ",") {
+		if each = strings.TrimSpace(each); each != "" {
+			filter.CVEs = append(filter.CVEs, each)
+		}
+	}
+	for _, each := range strings.Split(r.URL.Query().Get("severity"), ",") {
+		if strings.TrimSpace(each) == "" {
+			continue
+		}
+		sev, err := genericStorage.ParseSecuritySeverity(each)
+		if err != nil {
+			return nil, err
+		}
+		filter.Severities = append(filter.Severities, sev)
+	}
+	for _, each := range []struct {
+		key   string
+		value *string
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := r.URL.Query().Get(each.key)
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return nil, fmt.Errorf("Invalid date of %s: %s", each.key, v)
+		}
+		*each.value = v
+	}
+	return filter, nil
+}
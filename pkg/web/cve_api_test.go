@@ -0,0 +1,64 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+func TestParseCVEFilter(t *testing.T) {
+	h, storage, _ := newTestHandler(t)
+	defer storage.Close()
+	cases := []struct {
+		query   string
+		want    *genericStorage.CVEFilter
+		invalid bool
+	}{
+		{query: "", want: &genericStorage.CVEFilter{}},
+		{
+			query: "id=CVE-2018-0001,+cve-2018-0002+,",
+			want:  &genericStorage.CVEFilter{CVEs: []string{"CVE-2018-0001", "cve-2018-0002"}},
+		},
+		{
+			query: "severity=critical,Important,3",
+			want: &genericStorage.CVEFilter{Severities: []genericStorage.SecuritySeverity{
+				genericStorage.CriticalSec, genericStorage.ImportantSec, genericStorage.ModerateSec,
+			}},
+		},
+		{query: "severity=urgent", invalid: true},
+		{
+			query: "since=2018-01-01&until=2018-12-31",
+			want:  &genericStorage.CVEFilter{Since: "2018-01-01", Until: "2018-12-31"},
+		},
+		{query: "since=2018-13-01", invalid: true},
+		{query: "until=yesterday", invalid: true},
+	}
+	for _, c := range cases {
+		got, err := h.parseCVEFilter(httptest.NewRequest("GET", "/api/v1/cve?"+c.query, nil))
+		if c.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", c.query, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: expected %+v, got %+v, %v", c.query, c.want, got, err)
+		}
+	}
+}
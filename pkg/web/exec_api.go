@@ -15,7 +15,9 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -30,14 +32,18 @@ import (
 // Exec handles requests from /api/v1/exec, dispatches a new session for long-polling requests
 // via websocket.
 // Usage:
-//   - GET /api/v1/exec?mode=scan&watch=[HOST_LIST|*]
+//   - GET /api/v1/exec?mode=scan&watch=[HOST_LIST|*][&labelSelector=SELECTOR][&fieldSelector=SELECTOR]
 //   - GET /api/v1/exec?mode=cmd
+//   - GET /api/v1/exec?mode=update&watch=[JOB_LIST|*][&labelSelector=SELECTOR][&fieldSelector=SELECTOR]
 // Mode:
 //   - scan: Retrieve and watch scanning data on given hosts. Users are able to send requests
-//           to enforce a rescan operation on specified hosts.
+//           to enforce a rescan operation on specified hosts. Scanning data carries the same
+//           labels as their hosts, thus hosts could be selected by labels as well.
 //   - cmd:  Send qualified command on specified hosts, and retrieves execution result one by one.
 //           If the previous request was not accomplished, it will not accept the next one until
 //           current process has finished.
+//   - update: Retrieve and watch the progress of update jobs. Any message from client is
+//           ignored, as jobs are controlled through /api/v1/update.
 func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 	defer in.logger.Sync()
 
@@ -48,6 +54,12 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 
 	mode := r.URL.Query().Get("mode")
 	watch := strings.Split(r.URL.Query().Get("watch"), ",")
+	selector, err := in.parseSelector(r)
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return
+	}
 
 	conn, err := in.ws.Upgrade(w, r, nil)
 	if err != nil {
@@ -63,7 +75,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	if mode != "scan" && mode != "cmd" {
+	if mode != "scan" && mode != "cmd" && mode != "update" {
 		conn.WriteControl(
 			websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "No such channel."),
@@ -71,7 +83,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	if mode == "scan" && len(watch) == 1 && watch[0] == "" {
+	if (mode == "scan" || mode == "update") && len(watch) == 1 && watch[0] == "" && selector.Empty() {
 		conn.WriteControl(
 			websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "Target required."),
@@ -96,6 +108,10 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 	}
 	defer recoverFromPanic()
 
+	// All storage requests of the session are cancelled once the session has exited.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
 	cache := NewCache()
 
 	switch mode {
@@ -108,43 +124,57 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 			eventChan <-chan genericStorage.WatchEvent
 		)
 
-		observer, err = in.storage.Watch(genericStorage.NewSystemScan(), genericStorage.WatchOnKind)
-		if err != nil {
-			in.logger.Errorf("Could not watch on system updates due to: %v", err)
-			panic(err)
-		}
-		defer observer.Close()
-		eventChan = observer.Output()
-
-		if watch[0] == "*" {
-			cache.Loose = true
-			list := genericStorage.NewSystemScanList()
-			err = in.storage.List(list)
-			if err != nil {
-				in.logger.Errorf("Unexpected storage error: %v", err)
-				panic(err)
-			}
-			for i := range list.Members {
-				scan := &list.Members[i]
-				cache.Set(scan.GetName(), scan)
-				result = append(result, scan)
+		// load retrieves the latest state of all watched system scans into cache. It is
+		// also used for recovering from lost events.
+		load := func() {
+			if cache.Loose {
+				list := genericStorage.NewSystemScanList()
+				err := in.storage.ListContext(ctx, list, genericStorage.WithSelector(selector))
+				if err != nil {
+					in.logger.Errorf("Unexpected storage error: %v", err)
+					panic(err)
+				}
+				cache.Reset()
+				for i := range list.Members {
+					cache.Set(list.Members[i].GetName(), &list.Members[i])
+				}
+				return
 			}
-		} else {
 			for _, name := range watch {
 				scan := genericStorage.NewSystemScan()
 				scan.SetName(name)
-				err = in.storage.Get(scan)
+				err := in.storage.GetContext(ctx, scan)
 				if err != nil {
 					if genericStorage.IsInternalError(err) {
 						in.logger.Errorf("Unexpected storage error: %v", err)
 						panic(err)
 					}
+					cache.Pop(name)
+					continue
+				}
+				if !selector.Matches(scan) {
+					cache.Pop(name)
 					continue
 				}
 				cache.Set(scan.GetName(), scan)
-				result = append(result, scan)
 			}
 		}
+
+		observer, err = in.storage.WatchContext(ctx, genericStorage.NewSystemScan(), genericStorage.WatchOnKind, selector)
+		if err != nil {
+			in.logger.Errorf("Could not watch on system updates due to: %v", err)
+			panic(err)
+		}
+		defer observer.Close()
+		eventChan = observer.Output()
+
+		// Selecting by selectors only is considered as selecting among all hosts.
+		cache.Loose = watch[0] == "*" || (len(watch) == 1 && watch[0] == "")
+		load()
+		all := cache.Flush()
+		for i := range all {
+			result = append(result, all[i].(*genericStorage.SystemScan))
+		}
 		err = conn.WriteJSON(result)
 		if err != nil {
 			in.logger.Errorf("Failed to send result: %v", err)
@@ -156,20 +186,30 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 			defer recoverFromPanic()
 			defer in.logger.Sync()
 			for event := range eventChan {
-				cv := genericStorage.NewSystemScan()
-				err = event.Unmarshal(cv)
-				if err != nil {
-					in.logger.Errorf("Could not unmarshal incoming event due to: %v", err)
-					panic(err)
-				}
-				if !cache.Check(cv.GetName()) {
-					continue
-				}
 				switch event.Type {
-				case genericStorage.CREATE, genericStorage.UPDATE:
-					cache.Set(cv.GetName(), cv)
-				case genericStorage.DELETE:
-					cache.Pop(cv.GetName())
+				case genericStorage.ERROR:
+					in.logger.Errorf("System scanning event observer was broken due to: %s", event.Value)
+					panic(fmt.Errorf("%s", event.Value))
+				case genericStorage.RESYNC:
+					// Some events have been lost, thus we have to load all of them again.
+					in.logger.Warnf("Reloading system scans due to: %s", event.Value)
+					load()
+				default:
+					cv := genericStorage.NewSystemScan()
+					err = event.Unmarshal(cv)
+					if err != nil {
+						in.logger.Errorf("Could not unmarshal incoming event due to: %v", err)
+						panic(err)
+					}
+					if !cache.Check(cv.GetName()) {
+						continue
+					}
+					switch event.Type {
+					case genericStorage.CREATE, genericStorage.UPDATE:
+						cache.Set(cv.GetName(), cv)
+					case genericStorage.DELETE:
+						cache.Pop(cv.GetName())
+					}
 				}
 
 				all := cache.Flush()
@@ -219,7 +259,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 					switch scan.State {
 					case genericStorage.SuccessState, genericStorage.FailureState:
 						scan.State = genericStorage.StartedState
-						err = in.storage.Update(scan)
+						err = in.storage.UpdateContext(ctx, scan)
 						if err != nil {
 							in.logger.Errorf("Could not start scanning host '%s' due to: %v", err)
 						}
@@ -232,6 +272,125 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 		// Server will never exit unless client is closed first.
 		<-clzChan
 
+	case "update":
+		clzChan := make(chan struct{})
+
+		var (
+			result    []*genericStorage.UpdateJob
+			observer  genericStorage.Watcher
+			eventChan <-chan genericStorage.WatchEvent
+		)
+
+		// load retrieves the latest state of all watched update jobs into cache. It is also
+		// used for recovering from lost events.
+		load := func() {
+			if cache.Loose {
+				list := genericStorage.NewUpdateJobList()
+				err := in.storage.ListContext(ctx, list, genericStorage.WithSelector(selector))
+				if err != nil {
+					in.logger.Errorf("Unexpected storage error: %v", err)
+					panic(err)
+				}
+				cache.Reset()
+				for i := range list.Members {
+					cache.Set(list.Members[i].GetName(), &list.Members[i])
+				}
+				return
+			}
+			for _, name := range watch {
+				job := genericStorage.NewUpdateJob()
+				job.SetName(name)
+				err := in.storage.GetContext(ctx, job)
+				if err != nil {
+					if genericStorage.IsInternalError(err) {
+						in.logger.Errorf("Unexpected storage error: %v", err)
+						panic(err)
+					}
+					cache.Pop(name)
+					continue
+				}
+				if !selector.Matches(job) {
+					cache.Pop(name)
+					continue
+				}
+				cache.Set(job.GetName(), job)
+			}
+		}
+		send := func() {
+			all := cache.Flush()
+			for i := range all {
+				result = append(result, all[i].(*genericStorage.UpdateJob))
+			}
+			err := conn.WriteJSON(result)
+			if err != nil {
+				in.logger.Errorf("Failed to send result due to: %v", err)
+				panic(err)
+			}
+			result = result[:0]
+		}
+
+		observer, err = in.storage.WatchContext(ctx, genericStorage.NewUpdateJob(), genericStorage.WatchOnKind, selector)
+		if err != nil {
+			in.logger.Errorf("Could not watch on update jobs due to: %v", err)
+			panic(err)
+		}
+		defer observer.Close()
+		eventChan = observer.Output()
+
+		cache.Loose = watch[0] == "*" || (len(watch) == 1 && watch[0] == "")
+		load()
+		send()
+
+		go func() {
+			defer recoverFromPanic()
+			defer in.logger.Sync()
+			for event := range eventChan {
+				switch event.Type {
+				case genericStorage.ERROR:
+					in.logger.Errorf("Update job event observer was broken due to: %s", event.Value)
+					panic(fmt.Errorf("%s", event.Value))
+				case genericStorage.RESYNC:
+					in.logger.Warnf("Reloading update jobs due to: %s", event.Value)
+					load()
+				default:
+					cv := genericStorage.NewUpdateJob()
+					err := event.Unmarshal(cv)
+					if err != nil {
+						in.logger.Errorf("Could not unmarshal incoming event due to: %v", err)
+						panic(err)
+					}
+					if !cache.Check(cv.GetName()) {
+						continue
+					}
+					switch event.Type {
+					case genericStorage.CREATE, genericStorage.UPDATE:
+						cache.Set(cv.GetName(), cv)
+					case genericStorage.DELETE:
+						cache.Pop(cv.GetName())
+					}
+				}
+				send()
+			}
+			in.logger.Debugf("Update job event observer exited.")
+		}()
+
+		go func() {
+			defer in.logger.Sync()
+			// Messages are drained only for detecting the closure of client.
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					if err != io.EOF {
+						in.logger.Errorf("Could not read from the message due to: %v", err)
+					}
+					close(clzChan)
+					break
+				}
+			}
+			in.logger.Debugf("Update job websocket sub-handler exited.")
+		}()
+
+		<-clzChan
+
 	case "cmd":
 		var (
 			observer  genericStorage.Watcher
@@ -266,7 +425,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 		for i := range order.Commands {
 			host := genericStorage.NewHost()
 			host.SetName(order.Commands[i].Target)
-			err = in.storage.Get(host)
+			err = in.storage.GetContext(ctx, host)
 			if err != nil {
 				if genericStorage.IsInternalError(err) {
 					in.logger.Errorf("Unexpected storage error: %v", err)
@@ -278,7 +437,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 			commands[host.GetName()] = &order.Commands[i]
 		}
 
-		observer, err = in.storage.Watch(genericStorage.NewHostOperation(), genericStorage.WatchOnKind)
+		observer, err = in.storage.WatchContext(ctx, genericStorage.NewHostOperation(), genericStorage.WatchOnKind)
 		if err != nil {
 			in.logger.Errorf("Could not watch on system updates due to: %v", err)
 			panic(err)
@@ -295,7 +454,7 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 			op.Command = cmd.Command
 			op.Method = genericStorage.CombinedOutputMethod
 			op.State = genericStorage.StartedState
-			err = in.storage.Create(op)
+			err = in.storage.CreateContext(ctx, op)
 			if err != nil {
 				in.logger.Errorf("Unexpected storage error: %v", err)
 				panic(err)
@@ -304,25 +463,57 @@ func (in *Handler) Exec(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for finished := 0; finished <= len(commands); {
+			var changes []*genericStorage.HostOperation
 			event := <-eventChan
-			cv := genericStorage.NewHostOperation()
-			err = event.Unmarshal(cv)
-			if err != nil {
-				in.logger.Errorf("Could not unmarshal incoming event due to: %v", err)
-				panic(err)
-			}
-			if cache.Get(cv.GetName()) == nil {
-				continue
-			}
-			cache.Set(cv.GetName(), cv)
-			err = conn.WriteJSON(cv)
-			if err != nil {
-				in.logger.Errorf("Failed to send result: %v", err)
-				panic(err)
+			switch event.Type {
+			case genericStorage.ERROR:
+				in.logger.Errorf("Host operation event observer was broken due to: %s", event.Value)
+				panic(fmt.Errorf("%s", event.Value))
+			case genericStorage.RESYNC:
+				// Some events have been lost, thus we have to retrieve the latest state
+				// of all operations which have not been finished yet.
+				in.logger.Warnf("Reloading host operations due to: %s", event.Value)
+				for _, v := range cache.Flush() {
+					prev := v.(*genericStorage.HostOperation)
+					switch prev.State {
+					case genericStorage.SuccessState, genericStorage.FailureState:
+						continue
+					}
+					cv := genericStorage.NewHostOperation()
+					cv.SetNamespace(prev.GetNamespace())
+					cv.SetName(prev.GetName())
+					err = in.storage.GetContext(ctx, cv)
+					if err != nil {
+						in.logger.Errorf("Unexpected storage error: %v", err)
+						panic(err)
+					}
+					if cv.GetResourceVersion() != prev.GetResourceVersion() {
+						changes = append(changes, cv)
+					}
+				}
+			default:
+				cv := genericStorage.NewHostOperation()
+				err = event.Unmarshal(cv)
+				if err != nil {
+					in.logger.Errorf("Could not unmarshal incoming event due to: %v", err)
+					panic(err)
+				}
+				if cache.Get(cv.GetName()) == nil {
+					continue
+				}
+				changes = append(changes, cv)
 			}
-			switch cv.State {
-			case genericStorage.SuccessState, genericStorage.FailureState:
-				finished++
+			for _, cv := range changes {
+				cache.Set(cv.GetName(), cv)
+				err = conn.WriteJSON(cv)
+				if err != nil {
+					in.logger.Errorf("Failed to send result: %v", err)
+					panic(err)
+				}
+				switch cv.State {
+				case genericStorage.SuccessState, genericStorage.FailureState:
+					finished++
+				}
 			}
 		}
 
@@ -0,0 +1,117 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Facts handles requests from /api/v1/facts, which lists the facts gathered from hosts.
+// Usage:
+//   - GET /api/v1/facts[?host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+// Facts are gathered on each scan, and are named after their hosts. Those of all hosts are
+// listed if `host` is omitted, which could be selected by facts, e.g.
+// `fieldSelector=os=rhel,os_version=7.9,subscription!=Current`. The list could be
+// paginated by `limit`, and the next page is retrieved by passing the `X-Continue` header of
+// response as `continue`.
+func (in *Handler) Facts(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements facts query process.
+		if host := r.URL.Query().Get("host"); host != "" {
+			cv := genericStorage.NewHostFacts()
+			cv.SetName(host)
+			err := in.storage.GetContext(r.Context(), cv)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			dAtA, err := json.Marshal(cv)
+			if err != nil {
+				panic(err)
+			}
+			in.finalizeJSON(w, bytes.NewReader(dAtA))
+			return
+		}
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		cv := genericStorage.NewHostFactsList()
+		err = in.storage.ListContext(r.Context(), cv, append(opts, genericStorage.WithSelector(selector))...)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.HostFacts{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// parseFactSelector parses the `factSelector` query parameter of request, which selects hosts
+// by the fields of their facts.
+func (in *Handler) parseFactSelector(r *http.Request) (*genericStorage.Selector, error) {
+	return genericStorage.ParseSelector("", r.URL.Query().Get("factSelector"))
+}
+
+// matchFacts returns true if the facts of host satisfy selector. Hosts whose facts have not
+// been gathered yet match only an empty selector.
+func (in *Handler) matchFacts(ctx context.Context, host string, selector *genericStorage.Selector) (bool, error) {
+	if selector.Empty() {
+		return true, nil
+	}
+	facts := genericStorage.NewHostFacts()
+	facts.SetName(host)
+	err := in.storage.GetContext(ctx, facts)
+	if genericStorage.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(facts), nil
+}
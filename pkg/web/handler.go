@@ -20,12 +20,15 @@ import (
 	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	mux "github.com/gorilla/mux"
 	websocket "github.com/gorilla/websocket"
+	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
 	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 	zap "go.uber.org/zap"
 )
 
@@ -34,6 +37,7 @@ type Handler struct {
 	*mux.Router
 	wwwroot string
 	storage genericStorage.Storage
+	keyring *keyring.Keyring
 	logger  *zap.SugaredLogger
 	ws      websocket.Upgrader
 }
@@ -52,12 +56,59 @@ func (in *Handler) Frontend(w http.ResponseWriter, r *http.Request) {
 	http.FileServer(http.Dir(in.wwwroot)).ServeHTTP(w, r)
 }
 
+// parseSelector parses the `labelSelector` and `fieldSelector` query parameters of request.
+func (in *Handler) parseSelector(r *http.Request) (*genericStorage.Selector, error) {
+	return genericStorage.ParseSelector(r.URL.Query().Get("labelSelector"), r.URL.Query().Get("fieldSelector"))
+}
+
+// parsePagination parses the `limit` and `continue` query parameters of request into list
+// options. The continue token of the returned page is carried by the `X-Continue` header.
+func (in *Handler) parsePagination(r *http.Request) ([]genericStorage.ListOption, error) {
+	var opts []genericStorage.ListOption
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("Invalid limit: %s", v)
+		}
+		opts = append(opts, genericStorage.WithLimit(limit))
+	}
+	if v := r.URL.Query().Get("continue"); v != "" {
+		opts = append(opts, genericStorage.WithContinue(v))
+	}
+	return opts, nil
+}
+
+func (in *Handler) finalizeContinue(w http.ResponseWriter, cv genericStorage.ObjectList) {
+	if token := cv.GetContinue(); token != "" {
+		w.Header().Set("X-Continue", token)
+	}
+}
+
+// finalizeDatabaseError reports any error returned by storage. Internal errors are logged
+// but never exposed to clients.
+func (in *Handler) finalizeDatabaseError(w http.ResponseWriter, e error) {
+	in.logger.Error(e)
+	if !genericStorage.IsInternalError(e) {
+		in.finalizeStorageError(w, e)
+		return
+	}
+	in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
+}
+
 func (in *Handler) finalizeStorageError(w http.ResponseWriter, e error) {
-	if genericStorage.IsNotFound(e) {
+	switch {
+	case genericStorage.IsNotFound(e):
 		in.finalizeError(w, e, http.StatusNotFound)
-	}
-	if genericStorage.IsConflict(e) {
+	case genericStorage.IsConflict(e), genericStorage.IsVersionConflict(e):
+		// Clients should retrieve the latest version of the object and try again.
+		in.finalizeError(w, e, http.StatusConflict)
+	case genericStorage.IsImmutableError(e):
 		in.finalizeError(w, e, http.StatusConflict)
+	case genericStorage.IsExpired(e):
+		// Clients should list again from the beginning.
+		in.finalizeError(w, e, http.StatusGone)
+	default:
+		in.finalizeError(w, e, http.StatusBadRequest)
 	}
 }
 
@@ -120,12 +171,13 @@ func (in *Handler) auditIntercepter(next http.Handler) http.Handler {
 }
 
 // NewHandler returns a new initialized HTTP handler
-func NewHandler(storage genericStorage.Storage, logger *zap.SugaredLogger, wwwroot string) *Handler {
+func NewHandler(storage genericStorage.Storage, kr *keyring.Keyring, logger *zap.SugaredLogger, wwwroot string) *Handler {
 	root := mux.NewRouter()
 	h := &Handler{
 		Router:  root,
 		wwwroot: wwwroot,
 		storage: storage,
+		keyring: kr,
 		logger:  logger,
 		ws: websocket.Upgrader{
 			ReadBufferSize:    4096,
@@ -141,7 +193,19 @@ func NewHandler(storage genericStorage.Storage, logger *zap.SugaredLogger, wwwro
 	apiRoot := root.PathPrefix("/api/v1").Subrouter()
 	apiRoot.HandleFunc("/host", h.Host)
 	apiRoot.HandleFunc("/exec", h.Exec)
+	apiRoot.HandleFunc("/operation", h.Operation)
+	apiRoot.HandleFunc("/scan", h.Scan)
+	apiRoot.HandleFunc("/scan/diff", h.ScanDiff)
+	apiRoot.HandleFunc("/update", h.Update)
+	apiRoot.HandleFunc("/facts", h.Facts)
+	apiRoot.HandleFunc("/package", h.Package)
+	apiRoot.HandleFunc("/cve", h.CVE)
+	apiRoot.HandleFunc("/cve/summary", h.CVESummary)
+	apiRoot.HandleFunc("/vulnerability", h.Vulnerability)
+	apiRoot.HandleFunc("/schedule", h.Schedule)
 
+	// Metrics are exported in Prometheus format, including those of storage.
+	root.Handle("/metrics", promhttp.Handler())
 	root.PathPrefix("/").HandlerFunc(h.Frontend)
 	return h
 }
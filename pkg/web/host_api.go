@@ -28,10 +28,16 @@ import (
 
 // Host handles requests from /api/v1/host.
 // Usage:
-//   - GET /api/v1/host?search=[HOST_LIST|*]
+//   - GET /api/v1/host?search=[HOST_LIST|*][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&factSelector=SELECTOR][&limit=N][&continue=TOKEN]
 //   - POST /api/v1/host
 //   - PUT /api/v1/host
 //   - DELETE /api/v1/host?target=[HOST_NAME]
+// Searching among all hosts could be paginated by `limit`, and the next page is retrieved by
+// passing the `X-Continue` header of response as `continue`. Hosts could also be selected by
+// their facts with `factSelector`, which is a field selector of facts, e.g. `arch=x86_64`,
+// and those whose facts have not been gathered yet are not selected by it. Passwords are
+// sealed before being stored and are never returned. They could be left empty by PUT to keep
+// the stored ones.
 // TODO: make logger content qualified.
 func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 	defer in.logger.Sync()
@@ -47,11 +53,33 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		// GET implements host query process.
 		targets := strings.Split(r.URL.Query().Get("search"), ",")
-		if len(targets) == 1 && targets[0] == "" {
-			in.finalizeError(w, fmt.Errorf("Target required"), http.StatusBadRequest)
-			in.logger.Errorf("No target was specified during query")
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		factSelector, err := in.parseFactSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		pagination, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
 			return
 		}
+		if len(targets) == 1 && targets[0] == "" {
+			if selector.Empty() && factSelector.Empty() {
+				in.finalizeError(w, fmt.Errorf("Target required"), http.StatusBadRequest)
+				in.logger.Errorf("No target was specified during query")
+				return
+			}
+			// Search among all hosts if only selectors were specified.
+			targets[0] = "*"
+		}
 		in.logger.Debugf("Search host: %s", strings.Join(targets, ", "))
 		var all bool
 		for _, each := range targets {
@@ -63,29 +91,55 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 		sortor := genericStorage.NewSortor()
 		if all {
 			cv := genericStorage.NewHostList()
-			err := in.storage.List(cv)
+			err := in.storage.ListContext(r.Context(), cv, append(pagination, genericStorage.WithSelector(selector))...)
 			if err != nil {
-				in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
 				in.logger.Error(err)
+				if !genericStorage.IsInternalError(err) {
+					in.finalizeStorageError(w, err)
+					return
+				}
+				in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
 				return
 			}
+			in.finalizeContinue(w, cv)
 			for i := range cv.Members {
+				matched, err := in.matchFacts(r.Context(), cv.Members[i].GetName(), factSelector)
+				if err != nil {
+					in.finalizeDatabaseError(w, err)
+					return
+				}
+				if !matched {
+					continue
+				}
+				cv.Members[i].Redact()
 				sortor.AppendMember(&cv.Members[i])
 			}
 		} else {
 			for _, each := range targets {
 				newObj := genericStorage.NewHost()
 				newObj.Name = each
-				err := in.storage.Get(newObj)
+				err := in.storage.GetContext(r.Context(), newObj)
 				if err != nil {
 					in.logger.Error(err)
-					if genericStorage.IsInternalError(err) {
+					if !genericStorage.IsInternalError(err) {
 						in.finalizeStorageError(w, err)
 						return
 					}
 					in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
 					return
 				}
+				if !selector.Matches(newObj) {
+					continue
+				}
+				matched, err := in.matchFacts(r.Context(), newObj.GetName(), factSelector)
+				if err != nil {
+					in.finalizeDatabaseError(w, err)
+					return
+				}
+				if !matched {
+					continue
+				}
+				newObj.Redact()
 				sortor.AppendMember(newObj)
 			}
 		}
@@ -108,22 +162,29 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 			in.logger.Error(err)
 			return
 		}
-		err = in.validateAndFulfillHost(cv)
+		err = in.validateAndFulfillHost(cv, nil)
 		if err != nil {
 			in.logger.Error(err)
 			in.finalizeError(w, err, http.StatusBadRequest)
 			return
 		}
-		err = in.storage.Create(cv)
+		err = in.sealHost(cv)
+		if err != nil {
+			in.logger.Errorf("Could not seal credentials of host '%s' due to: %v", cv.GetName(), err)
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			return
+		}
+		err = in.storage.CreateContext(r.Context(), cv)
 		if err != nil {
 			in.logger.Error(err)
-			if genericStorage.IsInternalError(err) {
+			if !genericStorage.IsInternalError(err) {
 				in.finalizeStorageError(w, err)
 				return
 			}
 			in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
 			return
 		}
+		cv.Redact()
 		dAtA, err := json.Marshal(cv)
 		if err != nil {
 			panic(err)
@@ -143,22 +204,47 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 			in.logger.Error(err)
 			return
 		}
-		err = in.validateAndFulfillHost(cv)
+		// Passwords are redacted from responses, thus clients could leave them empty to keep
+		// the stored ones.
+		prev := genericStorage.NewHost()
+		prev.SetName(cv.GetName())
+		err = in.storage.GetContext(r.Context(), prev)
+		if genericStorage.IsNotFound(err) {
+			// Like storage updates, PUT creates the host if it does not exist yet.
+			prev, err = nil, nil
+		}
+		if err != nil {
+			in.logger.Error(err)
+			if !genericStorage.IsInternalError(err) {
+				in.finalizeStorageError(w, err)
+				return
+			}
+			in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
+			return
+		}
+		err = in.validateAndFulfillHost(cv, prev)
 		if err != nil {
 			in.logger.Error(err)
 			in.finalizeError(w, err, http.StatusBadRequest)
 			return
 		}
-		err = in.storage.Update(cv)
+		err = in.sealHost(cv)
+		if err != nil {
+			in.logger.Errorf("Could not seal credentials of host '%s' due to: %v", cv.GetName(), err)
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			return
+		}
+		err = in.storage.UpdateContext(r.Context(), cv)
 		if err != nil {
 			in.logger.Error(err)
-			if genericStorage.IsInternalError(err) {
+			if !genericStorage.IsInternalError(err) {
 				in.finalizeStorageError(w, err)
 				return
 			}
 			in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
 			return
 		}
+		cv.Redact()
 		dAtA, err := json.Marshal(cv)
 		if err != nil {
 			panic(err)
@@ -174,10 +260,10 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 		}
 		cv := genericStorage.NewHost()
 		cv.Name = target
-		err := in.storage.Delete(cv)
+		err := in.storage.DeleteContext(r.Context(), cv)
 		if err != nil {
 			in.logger.Error(err)
-			if genericStorage.IsInternalError(err) {
+			if !genericStorage.IsInternalError(err) {
 				in.finalizeStorageError(w, err)
 				return
 			}
@@ -190,15 +276,42 @@ func (in *Handler) Host(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (in *Handler) validateAndFulfillHost(cv *genericStorage.Host) error {
+// validateAndFulfillHost validates a host from clients. If prev is the stored version of
+// host, its passwords are kept for those credentials which are given without password.
+func (in *Handler) validateAndFulfillHost(cv, prev *genericStorage.Host) error {
 	if ip := net.ParseIP(cv.SSHAddress); ip == nil {
 		return fmt.Errorf("Invalid IP address: %s", cv.SSHAddress)
 	}
 	if cv.SSHPort == 0 {
 		cv.SSHPort = 22
 	}
-	if cv.SSHCredential.User == "" || len(cv.SSHCredential.Password) == 0 {
+	// Sealed passwords are never accepted from clients.
+	cv.SSHCredential.Sealed = nil
+	cv.OpCredential.Sealed = nil
+	if prev != nil {
+		keepSecret(&cv.SSHCredential, &prev.SSHCredential)
+		keepSecret(&cv.OpCredential, &prev.OpCredential)
+	}
+	if cv.SSHCredential.User == "" || !cv.SSHCredential.HasSecret() {
 		return fmt.Errorf("Invalid SSH authencation credential")
 	}
 	return nil
 }
+
+// keepSecret copies the password of prev into cred if no password was given and the user
+// remains the same.
+func keepSecret(cred, prev *genericStorage.LoginCredential) {
+	if cred.HasSecret() || cred.User != prev.User {
+		return
+	}
+	cred.Password = prev.Password
+	cred.Sealed = prev.Sealed
+}
+
+// sealHost seals the plain text passwords of host, which must be done before it is stored.
+func (in *Handler) sealHost(cv *genericStorage.Host) error {
+	if err := cv.SSHCredential.Seal(in.keyring); err != nil {
+		return err
+	}
+	return cv.OpCredential.Seal(in.keyring)
+}
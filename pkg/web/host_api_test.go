@@ -0,0 +1,245 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	memory "github.com/universonic/panther/pkg/storage/memory"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
+	zap "go.uber.org/zap"
+)
+
+func newTestHandler(t *testing.T) (*Handler, genericStorage.Storage, *keyring.Keyring) {
+	storage, err := memory.New().Open(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, keyring.KeySize))
+	kr, err := keyring.Parse(strings.NewReader("k1 " + key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(storage, kr, zap.NewNop().Sugar(), ""), storage, kr
+}
+
+func TestKeepSecret(t *testing.T) {
+	sealed := &keyring.Envelope{KeyID: "k1"}
+	cases := []struct {
+		name     string
+		cred     genericStorage.LoginCredential
+		prev     genericStorage.LoginCredential
+		password string
+		sealed   *keyring.Envelope
+	}{
+		{
+			name:   "kept for the same user",
+			cred:   genericStorage.LoginCredential{User: "root"},
+			prev:   genericStorage.LoginCredential{User: "root", Sealed: sealed},
+			sealed: sealed,
+		},
+		{
+			name:     "plain text kept for the same user",
+			cred:     genericStorage.LoginCredential{User: "root"},
+			prev:     genericStorage.LoginCredential{User: "root", Password: []byte("old")},
+			password: "old",
+		},
+		{
+			name: "dropped for another user",
+			cred: genericStorage.LoginCredential{User: "admin"},
+			prev: genericStorage.LoginCredential{User: "root", Sealed: sealed},
+		},
+		{
+			name:     "replaced by the given one",
+			cred:     genericStorage.LoginCredential{User: "root", Password: []byte("new")},
+			prev:     genericStorage.LoginCredential{User: "root", Sealed: sealed},
+			password: "new",
+		},
+	}
+	for _, c := range cases {
+		keepSecret(&c.cred, &c.prev)
+		if string(c.cred.Password) != c.password || c.cred.Sealed != c.sealed {
+			t.Errorf("%s: expected password %q and sealed %v, got %+v", c.name, c.password, c.sealed, c.cred)
+		}
+	}
+}
+
+func TestValidateAndFulfillHost(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	forged := &keyring.Envelope{KeyID: "forged"}
+
+	cv := genericStorage.NewHost()
+	cv.SSHAddress = "192.0.2.1"
+	cv.SSHCredential = genericStorage.LoginCredential{User: "root", Sealed: forged}
+	if err := h.validateAndFulfillHost(cv, nil); err == nil {
+		t.Errorf("Expected sealed passwords of clients to be refused, got %+v", cv.SSHCredential)
+	}
+
+	stored := &keyring.Envelope{KeyID: "k1"}
+	prev := genericStorage.NewHost()
+	prev.SSHCredential = genericStorage.LoginCredential{User: "root", Sealed: stored}
+	prev.OpCredential = genericStorage.LoginCredential{User: "root", Sealed: stored}
+	cv.OpCredential = genericStorage.LoginCredential{User: "root", Sealed: forged}
+	if err := h.validateAndFulfillHost(cv, prev); err != nil {
+		t.Fatal(err)
+	}
+	if cv.SSHCredential.Sealed != stored || cv.OpCredential.Sealed != stored {
+		t.Errorf("Expected stored passwords to be kept, got %+v and %+v", cv.SSHCredential, cv.OpCredential)
+	}
+	if cv.SSHPort != 22 {
+		t.Errorf("Expected default SSH port, got %d", cv.SSHPort)
+	}
+}
+
+func TestHostPutKeepsSecret(t *testing.T) {
+	h, storage, kr := newTestHandler(t)
+	defer storage.Close()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PUT", "/api/v1/host", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	check := func(w *httptest.ResponseRecorder) {
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		for _, each := range []string{"passw0rd", `"pass"`, `"sealed"`} {
+			if strings.Contains(w.Body.String(), each) {
+				t.Errorf("Expected %s to be redacted from %s", each, w.Body.String())
+			}
+		}
+	}
+	reveal := func() string {
+		cv := genericStorage.NewHost()
+		cv.SetName("web-1")
+		if err := storage.Get(cv); err != nil {
+			t.Fatal(err)
+		}
+		if cv.SSHCredential.Password != nil {
+			t.Errorf("Expected the password to be stored sealed, got %q", cv.SSHCredential.Password)
+		}
+		dAtA, err := cv.SSHCredential.Reveal(kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(dAtA)
+	}
+
+	// PUT creates the host if it does not exist yet.
+	check(put(`{"metadata":{"name":"web-1"},"ssh_addr":"192.0.2.1","ssh_cred":{"user":"root","pass":"cGFzc3cwcmQ="}}`))
+	if got := reveal(); got != "passw0rd" {
+		t.Fatalf("Expected the stored password, got %q", got)
+	}
+
+	// The response without password is put back as it is.
+	w := put(`{"metadata":{"name":"web-1"},"ssh_addr":"192.0.2.1","ssh_cred":{"user":"root"}}`)
+	check(w)
+	var got genericStorage.Host
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SSHCredential.User != "root" || got.SSHCredential.HasSecret() {
+		t.Errorf("Expected the redacted credential, got %+v", got.SSHCredential)
+	}
+	if got := reveal(); got != "passw0rd" {
+		t.Errorf("Expected the stored password to be kept, got %q", got)
+	}
+
+	// Without password, the stored one is not given to another user.
+	w = put(`{"metadata":{"name":"web-1"},"ssh_addr":"192.0.2.1","ssh_cred":{"user":"admin"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := reveal(); got != "passw0rd" {
+		t.Errorf("Expected the stored password to be kept, got %q", got)
+	}
+}
+
+func TestHostFactSelector(t *testing.T) {
+	h, storage, _ := newTestHandler(t)
+	defer storage.Close()
+	facts := map[string]*genericStorage.HostFacts{
+		"web-1": {OS: "rhel", Arch: "x86_64", CPUs: 4},
+		"web-2": {OS: "ubuntu", Arch: "aarch64", CPUs: 2},
+		// Facts of web-3 have not been gathered yet.
+		"web-3": nil,
+	}
+	for name, each := range facts {
+		host := genericStorage.NewHost()
+		host.SetName(name)
+		host.SSHCredential = genericStorage.LoginCredential{User: "root", Password: []byte("passw0rd")}
+		if err := storage.Create(host); err != nil {
+			t.Fatal(err)
+		}
+		if each == nil {
+			continue
+		}
+		cv := genericStorage.NewHostFacts()
+		cv.SetName(name)
+		cv.OS, cv.Arch, cv.CPUs = each.OS, each.Arch, each.CPUs
+		if err := storage.Create(cv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		query string
+		code  int
+		hosts []string
+	}{
+		{query: "search=*", code: http.StatusOK, hosts: []string{"web-1", "web-2", "web-3"}},
+		{query: "factSelector=arch%3Dx86_64", code: http.StatusOK, hosts: []string{"web-1"}},
+		{query: "factSelector=arch!%3Dx86_64", code: http.StatusOK, hosts: []string{"web-2"}},
+		{query: "factSelector=os%3Dubuntu,cpus%3D2", code: http.StatusOK, hosts: []string{"web-2"}},
+		{query: "factSelector=cpus%3D8", code: http.StatusOK},
+		{query: "search=web-1,web-3&factSelector=os%3Drhel", code: http.StatusOK, hosts: []string{"web-1"}},
+		{query: "search=web-2,web-3", code: http.StatusOK, hosts: []string{"web-2", "web-3"}},
+		{query: "factSelector=arch+in+(x86_64)", code: http.StatusBadRequest},
+		{query: "", code: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/host?"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("%q: expected status %d, got %d: %s", c.query, c.code, w.Code, w.Body.String())
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		var got []genericStorage.Host
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%q: %v", c.query, err)
+		}
+		var names []string
+		for _, each := range got {
+			names = append(names, each.GetName())
+			if each.SSHCredential.HasSecret() {
+				t.Errorf("%q: expected password of %s to be redacted", c.query, each.GetName())
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(c.hosts, ",") {
+			t.Errorf("%q: expected hosts %v, got %v", c.query, c.hosts, names)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	uuid "github.com/satori/go.uuid"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Operation handles requests from /api/v1/operation.
+// Usage:
+//   - GET /api/v1/operation[?host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+//   - POST /api/v1/operation?host=HOST_NAME&action=reboot[&timeout=SECONDS]
+// Operations are listed on the given host, or on all hosts if it is omitted. The list could be
+// paginated by `limit`, and the next page is retrieved by passing the `X-Continue` header of
+// response as `continue`. A reboot operation reboots the host and waits for it to come back
+// over SSH in `timeout` seconds, and it is returned once accepted so that it could be followed
+// by querying the host's operations.
+func (in *Handler) Operation(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements operation query process.
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts = append(opts, genericStorage.WithSelector(selector))
+		if host := r.URL.Query().Get("host"); host != "" {
+			opts = append(opts, genericStorage.InNamespace(host))
+		}
+		cv := genericStorage.NewHostOperationList()
+		err = in.storage.ListContext(r.Context(), cv, opts...)
+		if err != nil {
+			in.logger.Error(err)
+			if !genericStorage.IsInternalError(err) {
+				in.finalizeStorageError(w, err)
+				return
+			}
+			in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.HostOperation{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	case "POST":
+		// POST implements host operation creation process.
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			in.finalizeError(w, fmt.Errorf("Host required"), http.StatusBadRequest)
+			in.logger.Errorf("No host was specified for operation")
+			return
+		}
+		if action := r.URL.Query().Get("action"); action != "reboot" {
+			in.finalizeError(w, fmt.Errorf("Invalid action: %s", action), http.StatusBadRequest)
+			return
+		}
+		var timeout uint64
+		if v := r.URL.Query().Get("timeout"); v != "" {
+			var err error
+			timeout, err = strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				in.finalizeError(w, fmt.Errorf("Invalid timeout: %s", v), http.StatusBadRequest)
+				return
+			}
+		}
+		cv := genericStorage.NewHost()
+		cv.SetName(host)
+		err := in.storage.GetContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		op := genericStorage.NewHostOperation()
+		op.SetGUID(uuid.NewV4().String())
+		op.SetName(op.GetGUID())
+		op.SetNamespace(host)
+		op.Type = genericStorage.UserOperation
+		op.Method = genericStorage.RebootMethod
+		op.Timeout = uint(timeout)
+		op.State = genericStorage.StartedState
+		err = in.storage.CreateContext(r.Context(), op)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		dAtA, err := json.Marshal(op)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA), http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
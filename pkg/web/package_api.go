@@ -0,0 +1,126 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Package handles requests from /api/v1/package, which searches installed packages.
+// Usage:
+//   - GET /api/v1/package?host=HOST_NAME
+//   - GET /api/v1/package?name=PATTERN[&version=RANGE][&host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+// Installed packages are collected on each scan. All of them are returned on the given host
+// if `name` is omitted, otherwise packages are searched on the given host, or on all hosts if
+// it is omitted. Names are matched by shell patterns, e.g. `openssl*`, and versions by a
+// comma-separated list of constraints, e.g. `version=>=1.0.1,<1.0.2k-16` (URL encoded).
+// Versions are compared by the scheme of package manager of each host. Epochs are 0 if
+// omitted, while releases (or Debian revisions) are compared only if both versions have
+// them. Only those hosts which have matching packages are listed, and the search among all
+// hosts could be paginated by `limit`, and the next page is retrieved by passing the
+// `X-Continue` header of response as `continue`.
+func (in *Handler) Package(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	host := r.URL.Query().Get("host")
+	name := r.URL.Query().Get("name")
+	if name == "" && host == "" {
+		in.finalizeError(w, fmt.Errorf("Name or host required"), http.StatusBadRequest)
+		in.logger.Errorf("Neither package name nor host was specified during search")
+		return
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		in.finalizeError(w, fmt.Errorf("Invalid package name: %s", name), http.StatusBadRequest)
+		return
+	}
+	versions, err := genericStorage.ParseVersionRange(r.URL.Query().Get("version"))
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return
+	}
+
+	if host != "" {
+		cv := genericStorage.NewPackageInventory()
+		cv.SetName(host)
+		err = in.storage.GetContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		if name != "" {
+			cv.Packages = cv.Search(name, versions)
+		}
+		dAtA, err := json.Marshal(cv)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+		return
+	}
+	selector, err := in.parseSelector(r)
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return
+	}
+	opts, err := in.parsePagination(r)
+	if err != nil {
+		in.finalizeError(w, err, http.StatusBadRequest)
+		in.logger.Error(err)
+		return
+	}
+	cv := genericStorage.NewPackageInventoryList()
+	err = in.storage.ListContext(r.Context(), cv, append(opts, genericStorage.WithSelector(selector))...)
+	if err != nil {
+		in.finalizeDatabaseError(w, err)
+		return
+	}
+	in.finalizeContinue(w, cv)
+	results := []genericStorage.PackageSearchResult{}
+	for i := range cv.Members {
+		found := cv.Members[i].Search(name, versions)
+		if len(found) == 0 {
+			continue
+		}
+		results = append(results, genericStorage.PackageSearchResult{
+			Host:     cv.Members[i].GetName(),
+			Manager:  cv.Members[i].Manager,
+			Packages: found,
+		})
+	}
+	dAtA, err := json.Marshal(results)
+	if err != nil {
+		panic(err)
+	}
+	in.finalizeJSON(w, bytes.NewReader(dAtA))
+}
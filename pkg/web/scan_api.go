@@ -0,0 +1,163 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Scan handles requests from /api/v1/scan, which lists the history of scans.
+// Usage:
+//   - GET /api/v1/scan[?host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+// Scan records are listed on the given host, or on all hosts if it is omitted. Records of a
+// host are ordered by time, from the oldest to the latest. The list could be paginated by
+// `limit`, and the next page is retrieved by passing the `X-Continue` header of response as
+// `continue`.
+func (in *Handler) Scan(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements scan record query process.
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts = append(opts, genericStorage.WithSelector(selector))
+		if host := r.URL.Query().Get("host"); host != "" {
+			opts = append(opts, genericStorage.InNamespace(host))
+		}
+		cv := genericStorage.NewScanRecordList()
+		err = in.storage.ListContext(r.Context(), cv, opts...)
+		if err != nil {
+			in.logger.Error(err)
+			if !genericStorage.IsInternalError(err) {
+				in.finalizeStorageError(w, err)
+				return
+			}
+			in.finalizeError(w, fmt.Errorf("Database Failure"), http.StatusInternalServerError)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.ScanRecord{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// ScanDiff handles requests from /api/v1/scan/diff, which compares two scans of a host.
+// Usage:
+//   - GET /api/v1/scan/diff?host=HOST_NAME[&from=RECORD_NAME][&to=RECORD_NAME]
+// The latest record is compared if `to` is omitted, and it is compared with the record right
+// before it if `from` is omitted. Security updates that are newly exposed are reported as
+// added, while those have been patched since are reported as removed.
+func (in *Handler) ScanDiff(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		in.finalizeError(w, fmt.Errorf("Host required"), http.StatusBadRequest)
+		in.logger.Errorf("No host was specified during diff")
+		return
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		scan := genericStorage.NewSystemScan()
+		scan.SetName(host)
+		if err := in.storage.GetContext(r.Context(), scan); err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		if to = scan.Latest; to == "" {
+			in.finalizeError(w, fmt.Errorf("No scan has been recorded on host %s", host), http.StatusNotFound)
+			return
+		}
+	}
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		// Records are ordered by time, thus the previous one is the last one before it.
+		it := genericStorage.NewIteratorContext(r.Context(), in.storage, genericStorage.RESOURCE_SCAN_RECORD, genericStorage.DefaultPageSize, genericStorage.InNamespace(host))
+		for it.Next() {
+			if name := it.Object().GetName(); name < to {
+				from = name
+			}
+		}
+		if err := it.Err(); err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+	}
+
+	newer := genericStorage.NewScanRecord()
+	newer.SetNamespace(host)
+	newer.SetName(to)
+	if err := in.storage.GetContext(r.Context(), newer); err != nil {
+		in.finalizeDatabaseError(w, err)
+		return
+	}
+	var older *genericStorage.ScanRecord
+	if from != "" {
+		older = genericStorage.NewScanRecord()
+		older.SetNamespace(host)
+		older.SetName(from)
+		if err := in.storage.GetContext(r.Context(), older); err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+	}
+	dAtA, err := json.Marshal(newer.Diff(older))
+	if err != nil {
+		panic(err)
+	}
+	in.finalizeJSON(w, bytes.NewReader(dAtA))
+}
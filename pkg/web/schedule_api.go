@@ -0,0 +1,184 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Schedule handles requests from /api/v1/schedule.
+// Usage:
+//   - GET /api/v1/schedule[?name=SCHEDULE_NAME|host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+//   - POST /api/v1/schedule
+//   - PUT /api/v1/schedule
+//   - DELETE /api/v1/schedule?target=[SCHEDULE_NAME]
+// Schedules define when hosts are scanned and updated, which apply to hosts listed by name,
+// or to groups of hosts selected by labels, e.g.:
+//   {"metadata": {"name": "prod-web"}, "host_selector": "env=prod,role=web", "scan": "0 30 1 * * *",
+//    "windows": [{"start": "0 0 2 * * SAT", "duration": "4h"}],
+//    "blackouts": [{"start": "2018-12-20T00:00:00Z", "end": "2019-01-03T00:00:00Z", "reason": "Holiday freeze"}]}
+// Hosts are scanned by `scan` instead of the global schedule, and update jobs wait for the
+// maintenance windows of their hosts. Neither scans nor updates are performed during
+// blackouts. If multiple schedules apply to a host, those listing it by name precede those
+// selecting it by labels, and then they are ordered by name. The first of them which defines
+// scans or windows takes effect, while the blackouts of all of them apply. The schedules
+// applied to a host are listed in that order by `host`.
+func (in *Handler) Schedule(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements schedule query process.
+		if name := r.URL.Query().Get("name"); name != "" {
+			cv := genericStorage.NewSchedule()
+			cv.SetName(name)
+			err := in.storage.GetContext(r.Context(), cv)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			dAtA, err := json.Marshal(cv)
+			if err != nil {
+				panic(err)
+			}
+			in.finalizeJSON(w, bytes.NewReader(dAtA))
+			return
+		}
+		if name := r.URL.Query().Get("host"); name != "" {
+			host := genericStorage.NewHost()
+			host.SetName(name)
+			err := in.storage.GetContext(r.Context(), host)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			cv := genericStorage.NewScheduleList()
+			err = in.storage.ListContext(r.Context(), cv)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			schedules := cv.Of(host)
+			if schedules == nil {
+				schedules = []genericStorage.Schedule{}
+			}
+			dAtA, err := json.Marshal(schedules)
+			if err != nil {
+				panic(err)
+			}
+			in.finalizeJSON(w, bytes.NewReader(dAtA))
+			return
+		}
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		cv := genericStorage.NewScheduleList()
+		err = in.storage.ListContext(r.Context(), cv, append(opts, genericStorage.WithSelector(selector))...)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.Schedule{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	case "POST", "PUT":
+		// POST implements schedule creation process, and PUT implements schedule updating
+		// process.
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, r.Body)
+		if err != nil {
+			panic(err)
+		}
+		cv := genericStorage.NewSchedule()
+		err = json.Unmarshal(buf.Bytes(), cv)
+		if err != nil {
+			in.finalizeError(w, fmt.Errorf("Invalid Request Body"), http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		if cv.GetName() == "" {
+			in.finalizeError(w, fmt.Errorf("Name required"), http.StatusBadRequest)
+			return
+		}
+		err = cv.Validate()
+		if err != nil {
+			in.logger.Error(err)
+			in.finalizeError(w, err, http.StatusBadRequest)
+			return
+		}
+		status := http.StatusOK
+		if r.Method == "POST" {
+			status = http.StatusCreated
+			err = in.storage.CreateContext(r.Context(), cv)
+		} else {
+			err = in.storage.UpdateContext(r.Context(), cv)
+		}
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		dAtA, err := json.Marshal(cv)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA), status)
+	case "DELETE":
+		// DELETE implements schedule deletion process.
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			in.finalizeError(w, fmt.Errorf("Target required"), http.StatusBadRequest)
+			in.logger.Errorf("No schedule target was specified")
+			return
+		}
+		cv := genericStorage.NewSchedule()
+		cv.SetName(target)
+		err := in.storage.DeleteContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+	keyring "github.com/universonic/panther/pkg/utils/keyring"
 	zap "go.uber.org/zap"
 )
 
@@ -48,8 +49,8 @@ type Server struct {
 }
 
 // Prepare initialize a new router for inner server
-func (in *Server) Prepare(storage genericStorage.Storage, logger *zap.SugaredLogger) {
-	router := NewHandler(storage, logger, in.wwwroot)
+func (in *Server) Prepare(storage genericStorage.Storage, kr *keyring.Keyring, logger *zap.SugaredLogger) {
+	router := NewHandler(storage, kr, logger, in.wwwroot)
 	in.unixSrv.Handler = router
 	in.tcpSrv.Handler = router
 }
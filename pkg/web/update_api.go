@@ -0,0 +1,268 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Update handles requests from /api/v1/update.
+// Usage:
+//   - GET /api/v1/update[?name=JOB_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+//   - POST /api/v1/update
+//   - PUT /api/v1/update?target=[JOB_NAME]&action=[resume|pause|abort]
+//   - DELETE /api/v1/update?target=[JOB_NAME]
+// Update jobs apply the security updates selected from the latest scans to hosts, e.g.:
+//   {"hosts": ["web-1", "web-2"], "selector": {"severities": [1, 2], "cves": ["CVE-2018-1000001"]},
+//    "rollout": {"batch_size": "25%", "health_check": "systemctl is-active nginx", "max_failures": "1"}}
+// Updates are selected if they match any of the criteria, or all security updates could be
+// selected by `all_security`. Hosts are rolled out in batches, and the job is paused (or
+// aborted if `on_failure` is "abort") once failures of a batch exceed `max_failures`. Jobs
+// wait while hosts of a batch are out of their maintenance windows or in blackouts, see
+// /api/v1/schedule. Paused jobs could be resumed or aborted by PUT, and those not yet started
+// or waiting could be paused or aborted. Jobs in progress are paused or aborted once the batch
+// being rolled out has finished, and those interrupted, e.g. by a restart of executor, are
+// paused once executor has started again. Jobs are named randomly if their names are omitted,
+// and they could not be deleted while in progress.
+func (in *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements update job query process.
+		if name := r.URL.Query().Get("name"); name != "" {
+			cv := genericStorage.NewUpdateJob()
+			cv.SetName(name)
+			err := in.storage.GetContext(r.Context(), cv)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			dAtA, err := json.Marshal(cv)
+			if err != nil {
+				panic(err)
+			}
+			in.finalizeJSON(w, bytes.NewReader(dAtA))
+			return
+		}
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		cv := genericStorage.NewUpdateJobList()
+		err = in.storage.ListContext(r.Context(), cv, append(opts, genericStorage.WithSelector(selector))...)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.UpdateJob{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	case "POST":
+		// POST implements update job creation process.
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, r.Body)
+		if err != nil {
+			panic(err)
+		}
+		cv := genericStorage.NewUpdateJob()
+		err = json.Unmarshal(buf.Bytes(), cv)
+		if err != nil {
+			in.finalizeError(w, fmt.Errorf("Invalid Request Body"), http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		err = in.validateUpdateJob(cv)
+		if err != nil {
+			in.logger.Error(err)
+			in.finalizeError(w, err, http.StatusBadRequest)
+			return
+		}
+		// Hosts must exist by now, while those removed later are reported as failed.
+		for _, each := range cv.Hosts {
+			host := genericStorage.NewHost()
+			host.SetName(each)
+			err = in.storage.GetContext(r.Context(), host)
+			if genericStorage.IsNotFound(err) {
+				in.finalizeError(w, fmt.Errorf("Host '%s' does not exist", each), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+		}
+		err = in.storage.CreateContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		dAtA, err := json.Marshal(cv)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA), http.StatusCreated)
+	case "PUT":
+		// PUT implements update job control process.
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			in.finalizeError(w, fmt.Errorf("Target required"), http.StatusBadRequest)
+			in.logger.Errorf("No update job target was specified")
+			return
+		}
+		cv := genericStorage.NewUpdateJob()
+		cv.SetName(target)
+		err := in.storage.GetContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		switch action := r.URL.Query().Get("action"); action {
+		case "resume":
+			if cv.State != genericStorage.PausedState {
+				in.finalizeError(w, fmt.Errorf("Update job '%s' is not paused", target), http.StatusConflict)
+				return
+			}
+			cv.State = genericStorage.StartedState
+			cv.Stop = ""
+		case "pause":
+			switch cv.State {
+			case genericStorage.StartedState, genericStorage.WaitingState:
+				cv.State = genericStorage.PausedState
+				cv.Reason = "Paused by user"
+			case genericStorage.InProgressState:
+				// The job is paused by executor once the batch being rolled out has finished.
+				cv.Stop = genericStorage.PauseRollout
+			default:
+				in.finalizeError(w, fmt.Errorf("Update job '%s' could not be paused while %s", target, cv.State), http.StatusConflict)
+				return
+			}
+		case "abort":
+			switch cv.State {
+			case genericStorage.PausedState, genericStorage.StartedState, genericStorage.WaitingState:
+				cv.State = genericStorage.AbortState
+				cv.Reason = "Aborted by user"
+				cv.FinishedAt.Time = time.Now()
+			case genericStorage.InProgressState:
+				// The job is aborted by executor once the batch being rolled out has finished.
+				cv.Stop = genericStorage.AbortRollout
+			default:
+				in.finalizeError(w, fmt.Errorf("Update job '%s' could not be aborted while %s", target, cv.State), http.StatusConflict)
+				return
+			}
+		default:
+			in.finalizeError(w, fmt.Errorf("Invalid action: %s", action), http.StatusBadRequest)
+			return
+		}
+		// The update fails with a conflict if the job has been picked up by executor since.
+		err = in.storage.UpdateContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		dAtA, err := json.Marshal(cv)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	case "DELETE":
+		// DELETE implements update job deletion process.
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			in.finalizeError(w, fmt.Errorf("Target required"), http.StatusBadRequest)
+			in.logger.Errorf("No update job target was specified")
+			return
+		}
+		cv := genericStorage.NewUpdateJob()
+		cv.SetName(target)
+		err := in.storage.GetContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		if cv.State == genericStorage.InProgressState {
+			in.finalizeError(w, fmt.Errorf("Update job '%s' is in progress", target), http.StatusConflict)
+			return
+		}
+		err = in.storage.DeleteContext(r.Context(), cv)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// validateUpdateJob validates an update job from clients, and resets it to be started.
+func (in *Handler) validateUpdateJob(cv *genericStorage.UpdateJob) error {
+	if len(cv.Hosts) == 0 {
+		return fmt.Errorf("At least one host is required")
+	}
+	if cv.Selector.Empty() {
+		return fmt.Errorf("No update was selected")
+	}
+	if err := cv.Rollout.Validate(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, each := range cv.Hosts {
+		if seen[each] {
+			return fmt.Errorf("Duplicated host: %s", each)
+		}
+		seen[each] = true
+	}
+	if cv.GetName() == "" {
+		cv.SetName(uuid.NewV4().String())
+	}
+	cv.State = genericStorage.StartedState
+	cv.Results = nil
+	cv.Batch = 0
+	cv.Batches = 0
+	cv.Reason = ""
+	cv.StartedAt = genericStorage.Time{}
+	cv.FinishedAt = genericStorage.Time{}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright © 2018 Alfred Chou <unioverlord@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	genericStorage "github.com/universonic/panther/pkg/storage/generic"
+)
+
+// Vulnerability handles requests from /api/v1/vulnerability, which lists the vulnerabilities
+// found by correlating feeds with installed packages of hosts.
+// Usage:
+//   - GET /api/v1/vulnerability[?host=HOST_NAME][&labelSelector=SELECTOR][&fieldSelector=SELECTOR][&limit=N][&continue=TOKEN]
+// Reports are named after their hosts, and those of all hosts are listed if `host` is
+// omitted, e.g. `fieldSelector=vulnerable=true` lists those vulnerable. The list could be
+// paginated by `limit`, and the next page is retrieved by passing the `X-Continue` header of
+// response as `continue`. See /api/v1/cve with `source=feed` for the CVEs of them.
+func (in *Handler) Vulnerability(w http.ResponseWriter, r *http.Request) {
+	defer in.logger.Sync()
+	defer func() {
+		if rec := recover(); rec != nil {
+			in.finalizeError(w, fmt.Errorf("Internal Server Error"), http.StatusInternalServerError)
+			in.logger.Error(rec)
+		}
+	}()
+	defer in.finalizeHeader(w)
+
+	switch r.Method {
+	case "GET":
+		// GET implements vulnerability report query process.
+		if host := r.URL.Query().Get("host"); host != "" {
+			cv := genericStorage.NewVulnerabilityReport()
+			cv.SetName(host)
+			err := in.storage.GetContext(r.Context(), cv)
+			if err != nil {
+				in.finalizeDatabaseError(w, err)
+				return
+			}
+			dAtA, err := json.Marshal(cv)
+			if err != nil {
+				panic(err)
+			}
+			in.finalizeJSON(w, bytes.NewReader(dAtA))
+			return
+		}
+		selector, err := in.parseSelector(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		opts, err := in.parsePagination(r)
+		if err != nil {
+			in.finalizeError(w, err, http.StatusBadRequest)
+			in.logger.Error(err)
+			return
+		}
+		cv := genericStorage.NewVulnerabilityReportList()
+		err = in.storage.ListContext(r.Context(), cv, append(opts, genericStorage.WithSelector(selector))...)
+		if err != nil {
+			in.finalizeDatabaseError(w, err)
+			return
+		}
+		in.finalizeContinue(w, cv)
+		if cv.Members == nil {
+			cv.Members = []genericStorage.VulnerabilityReport{}
+		}
+		dAtA, err := json.Marshal(cv.Members)
+		if err != nil {
+			panic(err)
+		}
+		in.finalizeJSON(w, bytes.NewReader(dAtA))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
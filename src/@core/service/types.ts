@@ -51,6 +51,101 @@ export class SystemScan implements GenericObject {
 
     state?: State;
     security?: SecurityUpdate[];
+    scanner?: string;
+    reboot_required?: boolean;
+    services?: string[];
+}
+
+export class HostFacts implements GenericObject {
+    metadata?: ObjectMeta;
+
+    os?: string;
+    os_name?: string;
+    os_version?: string;
+    kernel?: string;
+    arch?: string;
+    uptime_seconds?: number;
+    cpus?: number;
+    memory_bytes?: number;
+    packages?: number;
+    repos?: string[];
+    subscription?: string;
+    collected_at?: string;
+}
+
+export class PackageInventory implements GenericObject {
+    metadata?: ObjectMeta;
+
+    manager?: string;
+    packages?: InstalledPackage[];
+    collected_at?: string;
+}
+
+export class InstalledPackage {
+    name?: string;
+    version?: string;
+    arch?: string;
+}
+
+export class VulnerabilityReport implements GenericObject {
+    metadata?: ObjectMeta;
+
+    security?: SecurityUpdate[];
+    feeds?: string[];
+    correlated_at?: string;
+}
+
+export class Schedule implements GenericObject {
+    metadata?: ObjectMeta;
+
+    hosts?: string[];
+    host_selector?: string;
+    scan?: string;
+    windows?: MaintenanceWindow[];
+    blackouts?: Blackout[];
+}
+
+export class MaintenanceWindow {
+    start?: string;
+    duration?: string;
+}
+
+export class Blackout {
+    start?: string;
+    end?: string;
+    reason?: string;
+}
+
+export class CVEExposure {
+    cve_id?: string;
+    severity?: SecuritySeverity;
+    issued?: string;
+    advisories?: string[];
+    hosts?: ExposedHost[];
+}
+
+export class ExposedHost {
+    host?: string;
+    packages?: string[];
+}
+
+export class ExposureSummary {
+    hosts?: number;
+    exposed_hosts?: number;
+    cves?: number;
+    severities?: SeverityExposure[];
+}
+
+export class SeverityExposure {
+    severity?: SecuritySeverity;
+    cves?: number;
+    hosts?: number;
+}
+
+export class PackageSearchResult {
+    host?: string;
+    manager?: string;
+    packages?: InstalledPackage[];
 }
 
 export enum State {
@@ -60,12 +155,18 @@ export enum State {
 	InProgressState,
 	SuccessState,
 	FailureState,
+	PausedState,
+	WaitingState,
 }
 
 export class SecurityUpdate {
     cve_id?: string;
     severity?: SecuritySeverity;
     package?: string;
+    advisory?: string;
+    type?: string;
+    installed?: string;
+    issued?: string;
 }
 
 export enum SecuritySeverity {
@@ -73,6 +174,7 @@ export enum SecuritySeverity {
     CriticalSec,
     ImportantSec,
     ModerateSec,
+    LowSec,
 }
 
 export class Order {
@@ -107,4 +209,51 @@ export class HostOperation {
     command?: string;
     state?: State;
     data?: string;
-}
\ No newline at end of file
+}
+export class UpdateJob implements GenericObject {
+    metadata?: ObjectMeta;
+
+    hosts?: string[];
+    selector?: UpdateSelector;
+    state?: State;
+    results?: HostUpdateResult[];
+    started_at?: string;
+    finished_at?: string;
+    rollout?: RolloutPolicy;
+    batch?: number;
+    batches?: number;
+    reason?: string;
+}
+
+export class RolloutPolicy {
+    batch_size?: string;
+    health_check?: string;
+    max_failures?: string;
+    on_failure?: string;
+    reboot?: boolean;
+}
+
+export class UpdateSelector {
+    all_security?: boolean;
+    severities?: SecuritySeverity[];
+    cves?: string[];
+    advisories?: string[];
+}
+
+export class HostUpdateResult {
+    host?: string;
+    state?: State;
+    operation?: string;
+    packages?: PackageResult[];
+    reason?: string;
+    batch?: number;
+    health_check?: string;
+    reboot?: string;
+}
+
+export class PackageResult {
+    package?: string;
+    previous?: string;
+    installed?: string;
+    state?: State;
+}
@@ -114,12 +114,25 @@ export class AppExecScanDetailsComponent implements OnInit, OnDestroy {
         this.selectionCritical.clear();
         this.selectionImportant.clear();
         this.selectionModerate.clear();
-        let ref = this.dialog.open(AppExecCmdComponent, {disableClose: true, data: new Order([new Command(this.name, `yum install -y ${packages.join(' ')}`)])});
+        let ref = this.dialog.open(AppExecCmdComponent, {disableClose: true, data: new Order([new Command(this.name, this.installCommand(packages))])});
         ref.afterClosed().subscribe(() => {
             this.scan.send(new Order([new Command(this.name)]));
         });
     }
 
+    // installCommand returns the command which installs packages by the package manager that
+    // scanned the host.
+    private installCommand(packages: string[]): string {
+        switch (this.result.scanner) {
+        case 'dnf':
+            return `dnf upgrade -y ${packages.join(' ')}`;
+        case 'apt':
+            // Packages are reported as <NAME>_<VERSION>_<ARCH> by apt.
+            return `apt-get install -y --only-upgrade ${packages.map(p => p.split('_')[0]).join(' ')}`;
+        }
+        return `yum install -y ${packages.join(' ')}`;
+    }
+
     private get critical(): SecurityUpdate[] {
         const list: SecurityUpdate[] = [];
         if (this.result && this.result.security) {